@@ -27,6 +27,15 @@ type Config struct {
 	SubVer string
 	//local listen ip port
 	LocalAddr string //ip:port
+	//json rpc listen ip:port
+	RpcAddr string
+	//json rpc basic auth user and password,cookie file auth if empty
+	RpcUser string
+	RpcPass string
+	//mempool max vsize bytes
+	MaxMempool int
+	//min relay tx fee satoshi per 1000 vbytes
+	MinRelayTxFee int64
 	//
 	BIP16Exception string
 	BIP34Height    uint32
@@ -35,6 +44,7 @@ type Config struct {
 	BIP66Height    uint32
 	CSVHeight      uint32
 	SegwitHeight   uint32
+	TaprootHeight  uint32
 
 	b58prefixs map[int][]byte
 	//210000
@@ -43,11 +53,21 @@ type Config struct {
 	Bech32HRP string
 	//
 	GenesisBlock string
+	//genesis block raw hex,create local when database empty
+	GenesisData string
+	//leveldb path
+	DataDir string
+	//signet block challenge script hex
+	SignetChallenge string
 
 	PowLimit          string
 	PowTargetTimespan int
 	PowTargetSpacing  int
 	PowMinerWindow    int
+	//testnet allow min difficulty block after 2*spacing
+	PowAllowMinDifficultyBlocks bool
+	//regtest not retarget
+	PowNoRetargeting bool
 }
 
 //DifficultyAdjustmentInterval
@@ -63,29 +83,48 @@ var (
 	config *Config = nil
 )
 
-//main network config
+//selected network config,default main network
 func GetConfig() *Config {
-	if config != nil {
-		return config
+	if config == nil {
+		config = newMainConfig()
 	}
+	return config
+}
 
-	c := &Config{Id: "main"}
+//local settings same for all networks
+func newBaseConfig(id string) *Config {
+	c := &Config{Id: id}
 
 	c.LocalIP = "192.168.31.198"
 	c.ListenAddr = "0.0.0.0"
-	c.ListenPort = 8333
 
 	c.MaxInConn = 5
 	c.MaxOutConn = 5
 
 	c.b58prefixs = map[int][]byte{}
-	c.MsgStart = []byte{0xF9, 0xBE, 0xB4, 0xD9}
 
-	c.PowLimit = "00000000ffffffffffffffffffffffffffffffffffffffffffffffffffffffff"
 	c.PowTargetTimespan = 14 * 24 * 60 * 60 // two weeks
 	c.PowTargetSpacing = 10 * 60
 	c.PowMinerWindow = c.PowTargetTimespan / c.PowTargetSpacing
+
+	c.SubVer = "/golang:0.1.0/"
+	c.MaxMempool = 300 * 1000 * 1000
+	c.MinRelayTxFee = 1000
+	c.SubHalving = 210000
+	return c
+}
+
+//main network config
+func newMainConfig() *Config {
+	c := newBaseConfig(NET_MAIN)
+
+	c.ListenPort = 8333
+	c.MsgStart = []byte{0xF9, 0xBE, 0xB4, 0xD9}
+	c.DataDir = "database"
+
+	c.PowLimit = "00000000ffffffffffffffffffffffffffffffffffffffffffffffffffffffff"
 	c.GenesisBlock = "000000000019d6689c085ae165831e934ff763ae46a2a6c172b3f1b60a8ce26f"
+	c.GenesisData = genesisData("29ab5f49ffff001d1dac2b7c")
 
 	c.Seeds = []string{
 		"seed.bitcoin.sipa.be",
@@ -97,16 +136,17 @@ func GetConfig() *Config {
 		"seed.bitcoin.sprovoost.nl",
 		"dnsseed.emzy.de",
 	}
-	c.SubVer = "/golang:0.1.0/"
 	c.LocalAddr = "192.168.31.198:8333"
+	c.RpcAddr = "127.0.0.1:8332"
 
 	c.BIP16Exception = "00000000000002dc756eebf4f49723ed8d30cc28a5f108eb94b1ba88ac4f9c22"
 	c.BIP34Height = 227931
 	c.BIP34Hash = "000000000000024b89b42a942fe0d9fea3bb44ab7bd1b19115dd6a759c0808b8"
-	c.BIP65Height = 388381  // 000000000000000004c2b624ed5d7756c508d90fd0da2c7c679febfa6c4735f0
-	c.BIP66Height = 363725  // 00000000000000000379eaa19dce8c9b722d46ae6a57c2f1a988119488b50931
-	c.CSVHeight = 419328    // 000000000000000004a1b34462cb8aeebd5799177f7a29cf28f2d1961716b5b5
-	c.SegwitHeight = 481824 // 0000000000000000001c8018d9cb3b742ef25114f27563e3fc4a1902167f9893
+	c.BIP65Height = 388381   // 000000000000000004c2b624ed5d7756c508d90fd0da2c7c679febfa6c4735f0
+	c.BIP66Height = 363725   // 00000000000000000379eaa19dce8c9b722d46ae6a57c2f1a988119488b50931
+	c.CSVHeight = 419328     // 000000000000000004a1b34462cb8aeebd5799177f7a29cf28f2d1961716b5b5
+	c.SegwitHeight = 481824  // 0000000000000000001c8018d9cb3b742ef25114f27563e3fc4a1902167f9893
+	c.TaprootHeight = 709632 // 0000000000000000000687bca986194dc2c1f949318629b44bb54ec0a94d8244
 	//
 	c.b58prefixs[PUBKEY_ADDRESS] = []byte{0}
 	c.b58prefixs[SCRIPT_ADDRESS] = []byte{5}
@@ -114,8 +154,6 @@ func GetConfig() *Config {
 	c.b58prefixs[EXT_PUBLIC_KEY] = []byte{0x04, 0x88, 0xB2, 0x1E}
 	c.b58prefixs[EXT_SECRET_KEY] = []byte{0x04, 0x88, 0xAD, 0xE4}
 	//
-	c.SubHalving = 210000
 	c.Bech32HRP = "bc"
-	config = c
-	return config
+	return c
 }
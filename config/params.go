@@ -0,0 +1,180 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+//network id
+const (
+	NET_MAIN    = "main"
+	NET_TEST    = "test"
+	NET_SIGNET  = "signet"
+	NET_REGTEST = "regtest"
+)
+
+const (
+	//genesis block header before time bits nonce
+	genesisHeader = "0100000000000000000000000000000000000000000000000000000000000000000000003ba3edfd7a7b12b27ac72c3e67768f617fc81bc3888a51323a9fb8aa4b1e5e4a"
+	//genesis block txs,all networks same coinbase
+	genesisTxs = "0101000000010000000000000000000000000000000000000000000000000000000000000000ffffffff4d04ffff001d0104455468652054696d65732030332f4a616e2f32303039204368616e63656c6c6f72206f6e206272696e6b206f66207365636f6e64206261696c6f757420666f722062616e6b73ffffffff0100f2052a01000000434104678afdb0fe5548271967f1a67130b7105cd6a828e03909a67962e0ea1f61deb649f6bc3f4cef38c4f35504e51ec112de5c384df7ba0b8d578a4c702b6bf11d5fac00000000"
+	//default signet 1-of-2 multisig challenge
+	defaultSignetChallenge = "512103ad5e0edad18cb1f0fc0d28a3d4f1f3e445640337489abb10404f2d1e086be430210359ef5021964fe22d6f8e05b2463c9540ce96883fe3b278760f048f5189f2e6c452ae"
+)
+
+//tv = time bits nonce hex
+func genesisData(tv string) string {
+	return genesisHeader + tv + genesisTxs
+}
+
+//signet message start,first 4 bytes hash256 of challenge
+func signetMsgStart(challenge string) []byte {
+	b, err := hex.DecodeString(challenge)
+	if err != nil || len(b) >= 0xfd {
+		panic(fmt.Errorf("signet challenge %s error", challenge))
+	}
+	s1 := sha256.Sum256(append([]byte{byte(len(b))}, b...))
+	s2 := sha256.Sum256(s1[:])
+	return s2[:4]
+}
+
+//testnet3 network config
+func newTestNetConfig() *Config {
+	c := newBaseConfig(NET_TEST)
+
+	c.ListenPort = 18333
+	c.MsgStart = []byte{0x0B, 0x11, 0x09, 0x07}
+	c.DataDir = "testnet3/database"
+
+	c.PowLimit = "00000000ffffffffffffffffffffffffffffffffffffffffffffffffffffffff"
+	c.PowAllowMinDifficultyBlocks = true
+	c.GenesisBlock = "000000000933ea01ad0ee984209779baaec3ced90fa3f408719526f8d77f4943"
+	c.GenesisData = genesisData("dae5494dffff001d1aa4ae18")
+
+	c.Seeds = []string{
+		"testnet-seed.bitcoin.jonasschnelli.ch",
+		"seed.tbtc.petertodd.org",
+		"seed.testnet.bitcoin.sprovoost.nl",
+		"testnet-seed.bluematt.me",
+	}
+	c.LocalAddr = "192.168.31.198:18333"
+	c.RpcAddr = "127.0.0.1:18332"
+
+	c.BIP16Exception = "00000000dd30457c001f4095d208cc1296b0eed002427aa599874af7a432b105"
+	c.BIP34Height = 21111
+	c.BIP34Hash = "0000000023b3a96d3484e5abb3755c413e7d41500f8e2a5c3f0dd01299cd8ef8"
+	c.BIP65Height = 581885  // 00000000007f6655f22f98e72ed80d8b06dc761d5da09df0fa1dc4be4f861eb6
+	c.BIP66Height = 330776  // 000000002104c8c45e99a8853285a3b592602a3ccde2b832481da85e9e4ba182
+	c.CSVHeight = 770112    // 00000000025e930139bac5c6c31a403776da130831ab85be56578f3fa75369bb
+	c.SegwitHeight = 834624 // 00000000002b980fcd729daaa248fd9316a5200e9b367f4ff2c42453e84201ca
+	c.TaprootHeight = 2011968
+	//
+	c.b58prefixs[PUBKEY_ADDRESS] = []byte{111}
+	c.b58prefixs[SCRIPT_ADDRESS] = []byte{196}
+	c.b58prefixs[SECRET_KEY] = []byte{239}
+	c.b58prefixs[EXT_PUBLIC_KEY] = []byte{0x04, 0x35, 0x87, 0xCF}
+	c.b58prefixs[EXT_SECRET_KEY] = []byte{0x04, 0x35, 0x83, 0x94}
+	//
+	c.Bech32HRP = "tb"
+	return c
+}
+
+//default signet network config
+func newSigNetConfig() *Config {
+	c := newBaseConfig(NET_SIGNET)
+
+	c.ListenPort = 38333
+	c.SignetChallenge = defaultSignetChallenge
+	c.MsgStart = signetMsgStart(c.SignetChallenge)
+	c.DataDir = "signet/database"
+
+	c.PowLimit = "00000377ae000000000000000000000000000000000000000000000000000000"
+	c.GenesisBlock = "00000008819873e925422c1ff0f99f7cc9bbb232af63a077a480a3633bee1ef6"
+	c.GenesisData = genesisData("008f4d5fae77031e8ad22203")
+
+	c.Seeds = []string{
+		"seed.signet.bitcoin.sprovoost.nl",
+	}
+	c.LocalAddr = "192.168.31.198:38333"
+	c.RpcAddr = "127.0.0.1:38332"
+
+	//all soft forks active from block 1
+	c.BIP34Height = 1
+	c.BIP65Height = 1
+	c.BIP66Height = 1
+	c.CSVHeight = 1
+	c.SegwitHeight = 1
+	c.TaprootHeight = 1
+	//
+	c.b58prefixs[PUBKEY_ADDRESS] = []byte{111}
+	c.b58prefixs[SCRIPT_ADDRESS] = []byte{196}
+	c.b58prefixs[SECRET_KEY] = []byte{239}
+	c.b58prefixs[EXT_PUBLIC_KEY] = []byte{0x04, 0x35, 0x87, 0xCF}
+	c.b58prefixs[EXT_SECRET_KEY] = []byte{0x04, 0x35, 0x83, 0x94}
+	//
+	c.Bech32HRP = "tb"
+	return c
+}
+
+//regression test network config
+func newRegTestConfig() *Config {
+	c := newBaseConfig(NET_REGTEST)
+
+	c.ListenPort = 18444
+	c.MsgStart = []byte{0xFA, 0xBF, 0xB5, 0xDA}
+	c.DataDir = "regtest/database"
+
+	c.PowLimit = "7fffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff"
+	c.PowAllowMinDifficultyBlocks = true
+	c.PowNoRetargeting = true
+	c.GenesisBlock = "0f9188f13cb7b2c71f2a335e3a4fc328bf5beb436012afca590b1a11466e2206"
+	c.GenesisData = genesisData("dae5494dffff7f2002000000")
+
+	//no dns seeds
+	c.Seeds = []string{}
+	c.LocalAddr = "127.0.0.1:18444"
+	c.RpcAddr = "127.0.0.1:18443"
+
+	c.BIP34Height = 1
+	c.BIP65Height = 1
+	c.BIP66Height = 1
+	c.CSVHeight = 1
+	c.SegwitHeight = 0
+	c.TaprootHeight = 0
+	//
+	c.b58prefixs[PUBKEY_ADDRESS] = []byte{111}
+	c.b58prefixs[SCRIPT_ADDRESS] = []byte{196}
+	c.b58prefixs[SECRET_KEY] = []byte{239}
+	c.b58prefixs[EXT_PUBLIC_KEY] = []byte{0x04, 0x35, 0x87, 0xCF}
+	c.b58prefixs[EXT_SECRET_KEY] = []byte{0x04, 0x35, 0x83, 0x94}
+	//
+	c.SubHalving = 150
+	c.Bech32HRP = "bcrt"
+	return c
+}
+
+//create network config by id
+func NewConfig(id string) (*Config, error) {
+	switch id {
+	case NET_MAIN:
+		return newMainConfig(), nil
+	case NET_TEST:
+		return newTestNetConfig(), nil
+	case NET_SIGNET:
+		return newSigNetConfig(), nil
+	case NET_REGTEST:
+		return newRegTestConfig(), nil
+	}
+	return nil, fmt.Errorf("unknown network %s", id)
+}
+
+//select network at startup,before GetConfig used
+func SelectNetwork(id string) (*Config, error) {
+	c, err := NewConfig(id)
+	if err != nil {
+		return nil, err
+	}
+	config = c
+	return c, nil
+}
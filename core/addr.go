@@ -66,7 +66,10 @@ func (m *MsgAddr) Read(h *NetHeader) {
 }
 
 func (m *MsgAddr) Write(h *NetHeader) {
-	//no payload
+	h.WriteVarInt(len(m.Addrs))
+	for _, v := range m.Addrs {
+		v.Write(h, true)
+	}
 }
 
 func NewMsgAddr() *MsgAddr {
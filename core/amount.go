@@ -23,5 +23,5 @@ func GetCoinbaseReward(h int) Amount {
 type Amount int64
 
 func (a Amount) IsRange() bool {
-	return a >= 0 && a < MAX_MONEY
+	return a >= 0 && a <= MAX_MONEY
 }
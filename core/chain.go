@@ -0,0 +1,181 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"log"
+)
+
+//block data saved
+func HasBlock(id HashID) bool {
+	bkey := NewTBlockKey(id)
+	has, err := Store().Has(bkey[:], nil)
+	return err == nil && has
+}
+
+//block in main chain
+func IsMainChain(id HashID) bool {
+	n := Index.Get(id)
+	if n == nil {
+		return false
+	}
+	hkey := NewTHeightKey(n.Height)
+	hv, err := Store().Get(hkey[:], nil)
+	if err != nil {
+		return false
+	}
+	return NewHashID(hv).Equal(id)
+}
+
+//accept block,connect to main chain or save to side chain
+//switch to the chain with most work when block data ready
+//caller must hold G lock
+func (g *Global) AcceptBlock(m *MsgBlock) error {
+	if g.best == nil && !m.IsGenesis() {
+		return errors.New("miss genesis block")
+	}
+	node, err := Index.AddHeader(m.Header())
+	if err != nil {
+		return fmt.Errorf("block %v header error %w", m.Hash, err)
+	}
+	if node.IsFailed() {
+		return fmt.Errorf("block %v in failed chain", m.Hash)
+	}
+	if node.HasData() {
+		return fmt.Errorf("block %v exists", m.Hash)
+	}
+	m.Height = node.Height
+	if g.IsNextBlock(m) {
+		if err := g.connectBlock(node, m); err != nil {
+			return err
+		}
+	} else {
+		if err := m.CheckMerkle(); err != nil {
+			return err
+		}
+		if err := m.checkWitness(m.GetScriptFlags()); err != nil {
+			return err
+		}
+		if err := m.SaveData(); err != nil {
+			return fmt.Errorf("DB save side block error %w", err)
+		}
+		if err := Index.SetStatus(node, IndexStatusData); err != nil {
+			return err
+		}
+	}
+	return g.activateBestChain()
+}
+
+//check and save block to main chain
+func (g *Global) connectBlock(node *IndexNode, m *MsgBlock) error {
+	if err := m.Check(); err != nil {
+		//witness mutated by peer,header may valid
+		if errors.Is(err, ErrBlockMutated) {
+			return fmt.Errorf("check block error %w", err)
+		}
+		if serr := Index.SetStatus(node, IndexStatusFailed); serr != nil {
+			log.Println("set block index status error", serr)
+		}
+		return fmt.Errorf("check block error %w", err)
+	}
+	if err := m.Save(true); err != nil {
+		return fmt.Errorf("DB save block error %w", err)
+	}
+	if err := Index.SetStatus(node, IndexStatusData); err != nil {
+		return err
+	}
+	g.SetBestBlock(m)
+	return nil
+}
+
+//connect blocks on best header chain,data saved and more work than main chain
+func (g *Global) activateBestChain() error {
+	best := Index.Get(g.best.Hash)
+	tip := Index.BestHeader()
+	if best == nil || tip == nil || tip.Work.Cmp(best.Work) <= 0 {
+		return nil
+	}
+	fork := LastCommonAncestor(best, tip)
+	//data ready chain
+	path := Index.Path(fork, tip)
+	for i, v := range path {
+		if !v.HasData() {
+			path = path[:i]
+			break
+		}
+	}
+	if len(path) == 0 || path[len(path)-1].Work.Cmp(best.Work) <= 0 {
+		return nil
+	}
+	if fork != best {
+		return g.reorganize(fork, path)
+	}
+	for _, v := range path {
+		m, err := LoadBlock(v.Hash())
+		if err != nil {
+			return err
+		}
+		m.Height = v.Height
+		if err := g.connectBlock(v, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//switch main chain to side chain path
+func (g *Global) reorganize(fork *IndexNode, path []*IndexNode) error {
+	obest := g.best
+	dis := []*MsgBlock{}
+	var failed *IndexNode
+	Txs.Push()
+	err := DBTransaction(func(tr DBImp) error {
+		//disconnect main chain block to fork point
+		for !g.best.Hash.Equal(fork.Hash()) {
+			if err := g.best.disconnect(tr); err != nil {
+				return fmt.Errorf("disconnect block %v error %w", g.best.Hash, err)
+			}
+			dis = append(dis, g.best)
+			prev, err := LoadBlock(g.best.Prev)
+			if err != nil {
+				return err
+			}
+			g.SetBestBlock(prev)
+		}
+		//connect side chain block
+		for _, v := range path {
+			bv, err := LoadBlock(v.Hash())
+			if err != nil {
+				return err
+			}
+			bv.Height = v.Height
+			if err := bv.check(tr); err != nil {
+				failed = v
+				return fmt.Errorf("check side block %v error %w", bv.Hash, err)
+			}
+			if err := bv.save(tr, true); err != nil {
+				return fmt.Errorf("DB save side block %v error %w", bv.Hash, err)
+			}
+			g.SetBestBlock(bv)
+		}
+		return nil
+	})
+	Txs.Pop()
+	if err != nil {
+		g.SetBestBlock(obest)
+		if failed != nil {
+			if serr := Index.SetStatus(failed, IndexStatusFailed); serr != nil {
+				log.Println("set block index status error", serr)
+			}
+		}
+		return err
+	}
+	//txs in disconnected block maybe cached
+	for _, bv := range dis {
+		for _, tx := range bv.Txs {
+			Txs.Del(tx.Hash)
+		}
+	}
+	log.Println("reorganize chain fork=", fork.Hash(), "disconnect=", len(dis), "connect=", len(path), "best=", g.best.Hash)
+	return nil
+}
@@ -0,0 +1,193 @@
+package core
+
+import (
+	"bitcoin/script"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+const (
+	testGenesisBlock = "0100000000000000000000000000000000000000000000000000000000000000000000003ba3edfd7a7b12b27ac72c3e67768f617fc81bc3888a51323a9fb8aa4b1e5e4a29ab5f49ffff001d1dac2b7c0101000000010000000000000000000000000000000000000000000000000000000000000000ffffffff4d04ffff001d0104455468652054696d65732030332f4a616e2f32303039204368616e63656c6c6f72206f6e206272696e6b206f66207365636f6e64206261696c6f757420666f722062616e6b73ffffffff0100f2052a01000000434104678afdb0fe5548271967f1a67130b7105cd6a828e03909a67962e0ea1f61deb649f6bc3f4cef38c4f35504e51ec112de5c384df7ba0b8d578a4c702b6bf11d5fac00000000"
+)
+
+func testGenesis(t *testing.T) *MsgBlock {
+	data, err := hex.DecodeString(testGenesisBlock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := NewMsgBlock()
+	m.Read(NewNetHeader(data))
+	if !m.IsGenesis() {
+		t.Fatal("genesis block error")
+	}
+	return m
+}
+
+func testP2PKHScript(b byte) *script.Script {
+	pkh := make([]byte, 20)
+	pkh[0] = b
+	s := script.NewScript([]byte{})
+	s.PushOp(script.OP_DUP).PushOp(script.OP_HASH160).PushBytes(pkh)
+	s.PushOp(script.OP_EQUALVERIFY).PushOp(script.OP_CHECKSIG)
+	return s
+}
+
+func testCoinbaseTx(height int64, out *script.Script) *TX {
+	tx := &TX{Ver: 1}
+	in := &TxIn{OutIndex: 0xffffffff, Sequence: 0xffffffff}
+	in.Script = script.NewScript([]byte{}).PushInt64(height).PushInt64(0)
+	tx.Ins = []*TxIn{in}
+	tx.Outs = []*TxOut{{Value: uint64(50 * COIN), Script: out}}
+	tx.Write(NewNetHeader())
+	return tx
+}
+
+func testNewBlock(prev *MsgBlock, txs ...*TX) *MsgBlock {
+	m := NewMsgBlock()
+	m.Ver = 1
+	m.Prev = prev.Hash
+	m.Bits = prev.Bits
+	m.Timestamp = prev.Timestamp + 600
+	m.Height = prev.Height + 1
+	m.Txs = txs
+	txids := []HashID{}
+	for _, v := range txs {
+		txids = append(txids, v.Hash)
+	}
+	m.Merkle, _, _ = BuildMerkleTree(txids).Extract()
+	m.Write(NewNetHeader())
+	return m
+}
+
+//add block header to index without check
+func testIndexBlock(m *MsgBlock, status uint8) *IndexNode {
+	Index.mu.Lock()
+	defer Index.mu.Unlock()
+	n := &IndexNode{Header: m.Header(), Height: m.Height, Status: IndexStatusHeader | status}
+	n.Work = GetBlockProof(m.Bits)
+	if prev, ok := Index.nodes[m.Prev]; ok {
+		n.prev = prev
+		n.Work = prev.Work.Add(n.Work)
+	}
+	Index.nodes[m.Hash] = n
+	if Index.best == nil || n.Work.Cmp(Index.best.Work) > 0 {
+		Index.best = n
+	}
+	return n
+}
+
+func TestBlockDisconnect(t *testing.T) {
+	UseMemDB()
+	Index = NewBlockIndex()
+	gb := testGenesis(t)
+	if err := gb.Save(true); err != nil {
+		t.Fatal(err)
+	}
+	testIndexBlock(gb, IndexStatusData)
+	sa, sb := testP2PKHScript(1), testP2PKHScript(2)
+	//A coinbase -> sa
+	cba := testCoinbaseTx(1, sa)
+	ba := testNewBlock(gb, cba)
+	if err := ba.Save(true); err != nil {
+		t.Fatal(err)
+	}
+	testIndexBlock(ba, IndexStatusData)
+	//B spend A coinbase -> sb
+	cbb := testCoinbaseTx(2, sb)
+	stx := &TX{Ver: 1}
+	stx.Ins = []*TxIn{{OutHash: cba.Hash, OutIndex: 0, Script: script.NewScript([]byte{}), Sequence: 0xffffffff}}
+	stx.Outs = []*TxOut{{Value: uint64(49 * COIN), Script: sb}}
+	stx.Write(NewNetHeader())
+	bb := testNewBlock(ba, cbb, stx)
+	if err := bb.Save(true); err != nil {
+		t.Fatal(err)
+	}
+	testIndexBlock(bb, IndexStatusData)
+	akey := NewTAddrKey(sa.GetAddress(), cba.Hash, 0)
+	if has, _ := Store().Has(akey, nil); has {
+		t.Fatal("spent address index exists")
+	}
+	undo, err := LoadBlockUndo(bb.Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(undo.Outs) != 1 || len(undo.Addrs) != 1 || !undo.Outs[0].OutHash.Equal(cba.Hash) {
+		t.Fatal("block undo data error")
+	}
+	node := Index.Get(bb.Hash)
+	if node == nil {
+		t.Fatal("block index not found")
+	}
+	proof := GetBlockProof(gb.Bits)
+	if !node.Work.Equal(proof.Add(proof).Add(proof)) {
+		t.Fatal("chain work error")
+	}
+	if err := bb.Disconnect(); err != nil {
+		t.Fatal(err)
+	}
+	if has, _ := Store().Has(akey, nil); !has {
+		t.Fatal("spent address index not restore")
+	}
+	skey := NewTAddrKey(sb.GetAddress(), stx.Hash, 0)
+	if has, _ := Store().Has(skey, nil); has {
+		t.Fatal("disconnect address index exists")
+	}
+	if _, err := LoadTxValue(stx.Hash); err == nil {
+		t.Fatal("disconnect tx index exists")
+	}
+	if _, err := LoadBlockUndo(bb.Hash); err == nil {
+		t.Fatal("block undo data exists")
+	}
+	best, err := Store().Get([]byte(TBestBlockHashKey), nil)
+	if err != nil || !NewHashID(best).Equal(ba.Hash) {
+		t.Fatal("best block error")
+	}
+	//side block data keep
+	if !HasBlock(bb.Hash) || IsMainChain(bb.Hash) {
+		t.Fatal("side block state error")
+	}
+	if !IsMainChain(ba.Hash) {
+		t.Fatal("main block state error")
+	}
+}
+
+func TestBlockProof(t *testing.T) {
+	v := GetBlockProof(0x1d00ffff)
+	if !v.Equal(NewUIHash(0x100010001)) {
+		t.Errorf("block proof error %v", v)
+	}
+}
+
+func TestDBTransactionDiscard(t *testing.T) {
+	UseMemDB()
+	key := []byte("TestDBTransactionDiscard")
+	err := DBTransaction(func(tr DBImp) error {
+		if err := tr.Put(key, []byte{1}, nil); err != nil {
+			return err
+		}
+		return errors.New("discard")
+	})
+	if err == nil {
+		t.Fatal("transaction error miss")
+	}
+	if has, _ := Store().Has(key, nil); has {
+		t.Error("transaction not discard")
+	}
+	err = DBTransaction(func(tr DBImp) error {
+		if err := tr.Put(key, []byte{1}, nil); err != nil {
+			return err
+		}
+		//uncommitted write not seen by store readers
+		if has, _ := Store().Has(key, nil); has {
+			t.Error("uncommitted write visible")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if has, _ := Store().Has(key, nil); !has {
+		t.Error("transaction not commit")
+	}
+}
@@ -88,6 +88,8 @@ type Client struct {
 	Ping      int
 	Err       interface{}
 	FeeRate   Amount //trans fee
+	CmpctVer  uint64 //peer compact block version
+	CmpctHigh bool   //peer want cmpctblock announce
 	k1        uint64 //use siphash k1,k2
 	k2        uint64
 }
@@ -108,8 +110,18 @@ func (c *Client) WriteMsg(m MsgIO) {
 
 func (c *Client) OnVersion() {
 	if c.Type == ClientTypeIn {
+		//inbound counted when accept,handshake deadline clear
+		c.Conn.SetReadDeadline(time.Time{})
+		conf := config.GetConfig()
 		InIps.Set(c)
+		//responder send version after recv version
+		local := IPPort{
+			ip:   net.ParseIP(conf.LocalIP),
+			port: conf.ListenPort,
+		}
+		c.WriteMsg(NewMsgVersion(local, c.IP))
 	}
+	c.WriteMsg(NewMsgVerAck())
 }
 
 func (c *Client) processMsg(m *NetHeader) {
@@ -122,11 +134,14 @@ func (c *Client) processMsg(m *NetHeader) {
 		mp := &MsgVersion{}
 		msg = m.Full(mp)
 		c.VerInfo = mp
+		//outbound peers time for adjusted clock
+		if c.Type == ClientTypeOut {
+			NetTime.Add(c.IP.ip.String(), int64(mp.Timestamp)-time.Now().Unix())
+		}
 		c.OnVersion()
 	case NMT_VERACK:
 		mp := &MsgVerAck{}
 		msg = m.Full(mp)
-		c.WriteMsg(NewMsgVerAck())
 		c.Acked = true
 		c.OnReady()
 	case NMT_PING:
@@ -149,9 +164,25 @@ func (c *Client) processMsg(m *NetHeader) {
 		mp := NewMsgSendCmpct()
 		msg = m.Full(mp)
 		//log.Println("cmpct ver=", mp.Ver, " set=", mp.Inter)
+		if mp.Ver == CMPCT_VERSION {
+			c.CmpctVer = mp.Ver
+			c.CmpctHigh = mp.Inter == 1
+		}
 	case NMT_GETHEADERS:
 		mp := NewMsgGetHeaders()
 		msg = m.Full(mp)
+	case NMT_GETBLOCKS:
+		mp := NewMsgGetBlocks()
+		msg = m.Full(mp)
+	case NMT_GETDATA:
+		mp := NewMsgGetData()
+		msg = m.Full(mp)
+	case NMT_GETADDR:
+		mp := NewMsgGetAddr()
+		msg = m.Full(mp)
+	case NMT_MEMPOOL:
+		mp := NewMsgMemPool()
+		msg = m.Full(mp)
 	case NMT_FEEFILTER:
 		mp := NewMsgFeeFilter()
 		msg = m.Full(mp)
@@ -184,7 +215,7 @@ func (c *Client) processMsg(m *NetHeader) {
 		mp := NewMsgCmpctBlock()
 		msg = m.Full(mp)
 	case NMT_GETBLOCKTXN:
-		mp := NewMsgBlockTxn()
+		mp := NewMsgGetBlockTxn()
 		msg = m.Full(mp)
 	case NMT_BLOCKTXN:
 		mp := NewMsgBlockTxn()
@@ -198,6 +229,8 @@ func (c *Client) processMsg(m *NetHeader) {
 
 func (c *Client) OnReady() {
 	c.WriteMsg(NewMsgPing())
+	//support low bandwidth compact block
+	c.WriteMsg(&MsgSendCmpct{Inter: 0, Ver: CMPCT_VERSION})
 	if c.Type == ClientTypeOut {
 		OutIps.Set(c)
 	}
@@ -213,6 +246,8 @@ func (c *Client) OnClosed() {
 	} else if c.Type == ClientTypeIn {
 		InIps.Del(c)
 	}
+	Relay.RemovePeer(c)
+	Compact.RemovePeer(c)
 	c.listener.OnClosed()
 }
 
@@ -346,6 +381,7 @@ func (c *Client) run() {
 }
 
 func (c *Client) OnLoop() {
+	Relay.Flush(c)
 	c.listener.OnLoop()
 }
 
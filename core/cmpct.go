@@ -1,6 +1,30 @@
 package core
 
-import "bitcoin/util"
+import (
+	"bitcoin/util"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	//compact block version,use wtxid short ids
+	CMPCT_VERSION = 2
+	//max high bandwidth peers
+	CMPCT_HIGH_PEERS = 3
+	//serve compact block depth from best
+	MAX_CMPCTBLOCK_DEPTH = 5
+	//serve blocktxn depth from best
+	MAX_BLOCKTXN_DEPTH = 10
+	//older best block in initial block download,not announce
+	MAX_TIP_AGE = 24 * time.Hour
+)
+
+var (
+	ErrShortIdCollision = errors.New("compact block short id collision")
+)
 
 type MsgBlockTxn struct {
 	Hash HashID
@@ -47,17 +71,23 @@ func (m *MsgGetBlockTxn) Read(h *NetHeader) {
 	m.Hash = h.ReadHash()
 	ic, _ := h.ReadVarInt()
 	m.Indexs = make([]uint32, ic)
+	//differentially encoded
+	next := uint64(0)
 	for i, _ := range m.Indexs {
 		v, _ := h.ReadVarInt()
-		m.Indexs[i] = uint32(v)
+		next += v
+		m.Indexs[i] = uint32(next)
+		next++
 	}
 }
 
 func (m *MsgGetBlockTxn) Write(h *NetHeader) {
 	h.WriteHash(m.Hash)
 	h.WriteVarInt(len(m.Indexs))
+	next := uint32(0)
 	for _, v := range m.Indexs {
-		h.WriteVarInt(v)
+		h.WriteVarInt(v - next)
+		next = v + 1
 	}
 }
 
@@ -68,7 +98,7 @@ func NewMsgGetBlockTxn() *MsgGetBlockTxn {
 //
 
 type PreFilledTx struct {
-	Index uint32
+	Index uint32 //differentially encoded in message
 	Tx    TX
 }
 
@@ -148,8 +178,11 @@ func (m *MsgCmpctBlock) Read(h *NetHeader) {
 	}
 	tc, _ := h.ReadVarInt()
 	m.PreTxs = make([]PreFilledTx, tc)
+	next := uint32(0)
 	for i, _ := range m.PreTxs {
 		m.PreTxs[i].Read(h)
+		m.PreTxs[i].Index += next
+		next = m.PreTxs[i].Index + 1
 	}
 	m.FillSelector(m.Header, m.Nonce)
 }
@@ -162,8 +195,11 @@ func (m *MsgCmpctBlock) Write(h *NetHeader) {
 		h.WriteShortId(v)
 	}
 	h.WriteVarInt(len(m.PreTxs))
+	next := uint32(0)
 	for _, v := range m.PreTxs {
-		v.Write(h)
+		h.WriteVarInt(v.Index - next)
+		v.Tx.Write(h)
+		next = v.Index + 1
 	}
 }
 
@@ -195,3 +231,257 @@ func (m *MsgSendCmpct) Write(h *NetHeader) {
 func NewMsgSendCmpct() *MsgSendCmpct {
 	return &MsgSendCmpct{}
 }
+
+func (m *CmpctHeader) Hash() HashID {
+	h := NewNetHeader()
+	m.Write(h)
+	id := HashID{}
+	return HASH256To(h.Bytes(), &id)
+}
+
+func (m *CmpctHeader) BHeader() *BHeader {
+	return &BHeader{
+		Ver:       m.Ver,
+		Prev:      m.Prev,
+		Merkle:    m.Merkle,
+		Timestamp: m.Timestamp,
+		Bits:      m.Bits,
+		Nonce:     m.Nonce,
+		Hash:      m.Hash(),
+	}
+}
+
+//create compact block,prefill coinbase
+func NewMsgCmpctBlockWithBlock(b *MsgBlock, nonce uint64) *MsgCmpctBlock {
+	m := NewMsgCmpctBlock()
+	m.Header = CmpctHeader{
+		Ver:       b.Ver,
+		Prev:      b.Prev,
+		Merkle:    b.Merkle,
+		Timestamp: b.Timestamp,
+		Bits:      b.Bits,
+		Nonce:     b.Nonce,
+	}
+	m.Nonce = nonce
+	m.FillSelector(m.Header, m.Nonce)
+	for i, v := range b.Txs {
+		if i == 0 {
+			m.PreTxs = append(m.PreTxs, PreFilledTx{Index: 0, Tx: *v})
+			continue
+		}
+		m.ShortIds = append(m.ShortIds, m.GetShortId(v.WitnessHash()))
+	}
+	return m
+}
+
+//block rebuild from compact block
+type PartialBlock struct {
+	Hash   HashID
+	header CmpctHeader
+	txs    []*TX
+}
+
+//fill txs from prefilled and mempool
+func NewPartialBlock(m *MsgCmpctBlock, pool *TxMap) (*PartialBlock, error) {
+	num := len(m.ShortIds) + len(m.PreTxs)
+	if num == 0 || uint(num) > MAX_BLOCK_WEIGHT/MIN_SERIALIZABLE_TRANSACTION_WEIGHT {
+		return nil, fmt.Errorf("compact block txs num %d error", num)
+	}
+	pb := &PartialBlock{Hash: m.Header.Hash(), header: m.Header, txs: make([]*TX, num)}
+	for i, v := range m.PreTxs {
+		if int(v.Index) >= num {
+			return nil, fmt.Errorf("prefilled tx index %d outbound", v.Index)
+		}
+		pb.txs[v.Index] = &m.PreTxs[i].Tx
+	}
+	ids := map[uint64]int{}
+	idx := 0
+	for _, v := range m.ShortIds {
+		for pb.txs[idx] != nil {
+			idx++
+		}
+		if _, ok := ids[v]; ok {
+			return nil, ErrShortIdCollision
+		}
+		ids[v] = idx
+		idx++
+	}
+	//two mempool txs same short id,request it
+	dups := map[int]bool{}
+	pool.Iter(func(e *TxEntry) {
+		i, ok := ids[m.GetShortId(e.WTxID)]
+		if !ok {
+			return
+		}
+		if pb.txs[i] != nil {
+			dups[i] = true
+			return
+		}
+		pb.txs[i] = e.Tx
+	})
+	for i := range dups {
+		pb.txs[i] = nil
+	}
+	return pb, nil
+}
+
+//missing tx indexs
+func (pb *PartialBlock) Missing() []uint32 {
+	ids := []uint32{}
+	for i, v := range pb.txs {
+		if v == nil {
+			ids = append(ids, uint32(i))
+		}
+	}
+	return ids
+}
+
+//fill missing txs from blocktxn
+func (pb *PartialBlock) Fill(m *MsgBlockTxn) error {
+	if !m.Hash.Equal(pb.Hash) {
+		return errors.New("blocktxn hash not match")
+	}
+	miss := pb.Missing()
+	if len(miss) != len(m.Txs) {
+		return fmt.Errorf("blocktxn txs num %d want %d", len(m.Txs), len(miss))
+	}
+	for i, v := range miss {
+		pb.txs[v] = &m.Txs[i]
+	}
+	return nil
+}
+
+//full block,merkle root not match when short id collision
+func (pb *PartialBlock) Block() (*MsgBlock, error) {
+	if len(pb.Missing()) > 0 {
+		return nil, errors.New("partial block miss txs")
+	}
+	h := NewNetHeader()
+	pb.header.Write(h)
+	h.WriteVarInt(len(pb.txs))
+	for _, v := range pb.txs {
+		v.Write(h)
+	}
+	b := NewMsgBlock()
+	b.Read(NewNetHeader(h.Bytes()))
+	if err := b.CheckMerkle(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+//compact block relay state
+type CmpctState struct {
+	mu      sync.Mutex
+	pending map[string]*PartialBlock //wait blocktxn
+	high    []*Client                //high bandwidth peers
+}
+
+var (
+	Compact = NewCmpctState()
+)
+
+func NewCmpctState() *CmpctState {
+	return &CmpctState{pending: map[string]*PartialBlock{}}
+}
+
+func (s *CmpctState) SetPending(c *Client, pb *PartialBlock) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending[c.Key()] = pb
+}
+
+//get and remove wait block
+func (s *CmpctState) TakePending(c *Client, id HashID) *PartialBlock {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pb, ok := s.pending[c.Key()]
+	if !ok || !pb.Hash.Equal(id) {
+		return nil
+	}
+	delete(s.pending, c.Key())
+	return pb
+}
+
+func (s *CmpctState) RemovePeer(c *Client) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.pending, c.Key())
+	for i, v := range s.high {
+		if v.Key() == c.Key() {
+			s.high = append(s.high[:i], s.high[i+1:]...)
+			break
+		}
+	}
+}
+
+func (s *CmpctState) IsHigh(c *Client) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, v := range s.high {
+		if v.Key() == c.Key() {
+			return true
+		}
+	}
+	return false
+}
+
+//peer move to last,return added and evicted peer
+func (s *CmpctState) promote(c *Client) (bool, *Client) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, v := range s.high {
+		if v.Key() == c.Key() {
+			s.high = append(append(s.high[:i], s.high[i+1:]...), c)
+			return false, nil
+		}
+	}
+	var old *Client = nil
+	if len(s.high) >= CMPCT_HIGH_PEERS {
+		old = s.high[0]
+		s.high = s.high[1:]
+	}
+	s.high = append(s.high, c)
+	return true, old
+}
+
+//peer first send us new best block,ask it announce blocks with cmpctblock
+func (s *CmpctState) UpdateHigh(c *Client) {
+	if c.CmpctVer != CMPCT_VERSION {
+		return
+	}
+	add, old := s.promote(c)
+	if old != nil && old.IsConnected() {
+		old.WriteMsg(&MsgSendCmpct{Inter: 0, Ver: CMPCT_VERSION})
+	}
+	if add {
+		c.WriteMsg(&MsgSendCmpct{Inter: 1, Ver: CMPCT_VERSION})
+	}
+}
+
+func isRecentBlock(b *MsgBlock) bool {
+	return time.Since(time.Unix(int64(b.Timestamp), 0)) < MAX_TIP_AGE
+}
+
+//announce new best block,cmpctblock to high bandwidth peers,inv to others
+func AnnounceBlock(b *MsgBlock, from *Client) {
+	if !isRecentBlock(b) {
+		return
+	}
+	var cm *MsgCmpctBlock = nil
+	for _, c := range append(OutIps.All(), InIps.All()...) {
+		if c == from {
+			continue
+		}
+		if c.CmpctHigh && c.CmpctVer == CMPCT_VERSION {
+			if cm == nil {
+				cm = NewMsgCmpctBlockWithBlock(b, rand.Uint64())
+			}
+			c.WriteMsg(cm)
+			continue
+		}
+		m := NewMsgINV()
+		m.Invs = append(m.Invs, &Inventory{Type: MSG_BLOCK, ID: b.Hash})
+		c.WriteMsg(m)
+	}
+}
@@ -0,0 +1,111 @@
+package core
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestGetBlockTxnIndexs(t *testing.T) {
+	m := &MsgGetBlockTxn{Hash: HashID{1}, Indexs: []uint32{2, 5, 6, 100}}
+	h := NewNetHeader()
+	m.Write(h)
+	rm := NewMsgGetBlockTxn()
+	rm.Read(NewNetHeader(h.Bytes()))
+	if len(rm.Indexs) != 4 || rm.Indexs[1] != 5 || rm.Indexs[2] != 6 || rm.Indexs[3] != 100 {
+		t.Error("getblocktxn indexs error", rm.Indexs)
+	}
+}
+
+func TestCmpctBlockRebuild(t *testing.T) {
+	testMempool(t)
+	pk, pks := testP2PKHKey(t)
+	ina := testAddCoin(t, HashID{1}, uint64(COIN), pks)
+	tx1 := testSignTx(t, pk, pks, []*TxIn{ina}, uint64(COIN)-100000)
+	if _, err := TxsMap.AcceptTx(tx1); err != nil {
+		t.Fatal(err)
+	}
+	inb := testAddCoin(t, HashID{2}, uint64(COIN), pks)
+	tx2 := testSignTx(t, pk, pks, []*TxIn{inb}, uint64(COIN)-100000)
+	b := testNewBlock(G.LastBlock(), testCoinbaseTx(1, pks), tx1, tx2)
+	cm := NewMsgCmpctBlockWithBlock(b, 1)
+	h := NewNetHeader()
+	cm.Write(h)
+	rm := NewMsgCmpctBlock()
+	rm.Read(NewNetHeader(h.Bytes()))
+	if !rm.Header.Hash().Equal(b.Hash) || len(rm.ShortIds) != 2 || len(rm.PreTxs) != 1 || rm.PreTxs[0].Index != 0 {
+		t.Fatal("cmpctblock encode error")
+	}
+	pb, err := NewPartialBlock(rm, TxsMap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if miss := pb.Missing(); len(miss) != 1 || miss[0] != 2 {
+		t.Fatal("missing txs error", miss)
+	}
+	if err := pb.Fill(&MsgBlockTxn{Hash: b.Hash}); err == nil {
+		t.Error("blocktxn num check error")
+	}
+	if err := pb.Fill(&MsgBlockTxn{Hash: b.Hash, Txs: []TX{*tx2}}); err != nil {
+		t.Fatal(err)
+	}
+	nb, err := pb.Block()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !nb.Hash.Equal(b.Hash) || len(nb.Txs) != 3 || !nb.Txs[2].Hash.Equal(tx2.Hash) {
+		t.Error("rebuild block error")
+	}
+	//same short id
+	rm.ShortIds[1] = rm.ShortIds[0]
+	if _, err := NewPartialBlock(rm, TxsMap); !errors.Is(err, ErrShortIdCollision) {
+		t.Error("short id collision error", err)
+	}
+}
+
+func TestServeCmpctBlock(t *testing.T) {
+	ms := testServeChain(t)
+	G.SetBestBlock(ms[3])
+	c := testDownloadPeer("1.1.1.1", 0)
+	gd := NewMsgGetData()
+	gd.AddHash(MSG_CMPCT_BLOCK, ms[3].Hash[:])
+	if err := processGetData(0, c, gd); err != nil {
+		t.Fatal(err)
+	}
+	if cm, ok := (<-c.wc).(*MsgCmpctBlock); !ok || !cm.Header.Hash().Equal(ms[3].Hash) || len(cm.PreTxs) != 1 {
+		t.Fatal("getdata cmpct block error")
+	}
+	if err := processGetBlockTxn(0, c, &MsgGetBlockTxn{Hash: ms[3].Hash, Indexs: []uint32{0}}); err != nil {
+		t.Fatal(err)
+	}
+	if bm, ok := (<-c.wc).(*MsgBlockTxn); !ok || len(bm.Txs) != 1 || !bm.Txs[0].Hash.Equal(ms[3].Txs[0].Hash) {
+		t.Fatal("getblocktxn error")
+	}
+	if err := processGetBlockTxn(0, c, &MsgGetBlockTxn{Hash: ms[3].Hash, Indexs: []uint32{1}}); err == nil {
+		t.Error("getblocktxn index outbound error")
+	}
+}
+
+func TestCmpctHighPeers(t *testing.T) {
+	s := NewCmpctState()
+	ps := []*Client{}
+	for _, ip := range []string{"1.1.1.1", "2.2.2.2", "3.3.3.3", "4.4.4.4"} {
+		p := testDownloadPeer(ip, 0)
+		p.CmpctVer = CMPCT_VERSION
+		ps = append(ps, p)
+	}
+	for _, p := range ps[:3] {
+		s.UpdateHigh(p)
+		if m, ok := (<-p.wc).(*MsgSendCmpct); !ok || m.Inter != 1 {
+			t.Fatal("high bandwidth sendcmpct error")
+		}
+	}
+	//ps[0] latest,evict ps[1]
+	s.UpdateHigh(ps[0])
+	s.UpdateHigh(ps[3])
+	if !s.IsHigh(ps[0]) || s.IsHigh(ps[1]) || !s.IsHigh(ps[3]) {
+		t.Error("high bandwidth peers error")
+	}
+	if len(ps[0].wc) != 0 || len(ps[3].wc) != 1 {
+		t.Error("high bandwidth message error")
+	}
+}
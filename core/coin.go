@@ -0,0 +1,170 @@
+package core
+
+import (
+	"bitcoin/script"
+	"bitcoin/util"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	lvutil "github.com/syndtr/goleveldb/leveldb/util"
+)
+
+var (
+	ErrCoinNotFound = errors.New("coin not found or spent")
+)
+
+//prefix[1] txid[32] idx[4]
+type TCoinKey [37]byte
+
+func NewTCoinKey(id HashID, idx uint32) TCoinKey {
+	k := TCoinKey{}
+	k[0] = TPrefixCoin
+	copy(k[1:], id[:])
+	ByteOrder.PutUint32(k[33:], idx)
+	return k
+}
+
+//unspent out
+type TCoin struct {
+	Value    uint64
+	Script   *script.Script
+	Height   uint32
+	CoinBase bool
+}
+
+func NewTCoin(out *TxOut, height uint32, cb bool) *TCoin {
+	return &TCoin{
+		Value:    out.Value,
+		Script:   out.Script.Clone(),
+		Height:   height,
+		CoinBase: cb,
+	}
+}
+
+//height<<1|coinbase compressvalue script
+func (m *TCoin) Read(h *NetHeader) {
+	code, _ := h.ReadVarInt()
+	m.Height = uint32(code >> 1)
+	m.CoinBase = code&1 != 0
+	cv, _ := h.ReadVarInt()
+	m.Value = util.DecompressAmount(cv)
+	m.Script = h.ReadScript()
+}
+
+func (m *TCoin) Write(h *NetHeader) {
+	code := uint64(m.Height) << 1
+	if m.CoinBase {
+		code |= 1
+	}
+	h.WriteVarInt(code)
+	h.WriteVarInt(util.CompressAmount(m.Value))
+	h.WriteScript(m.Script)
+}
+
+func (m *TCoin) Bytes() []byte {
+	h := NewNetHeader()
+	m.Write(h)
+	return h.Bytes()
+}
+
+func (m *TCoin) ToTxOut() *TxOut {
+	return &TxOut{
+		Value:  m.Value,
+		Script: m.Script,
+	}
+}
+
+//coinbase out spend need maturity
+func (m *TCoin) IsMature(height uint32) bool {
+	return !m.CoinBase || height-m.Height >= COINBASE_MATURITY
+}
+
+func LoadCoin(id HashID, idx uint32) (*TCoin, error) {
+	return loadCoin(Store(), id, idx)
+}
+
+func loadCoin(db DBImp, id HashID, idx uint32) (*TCoin, error) {
+	ckey := NewTCoinKey(id, idx)
+	data, err := db.Get(ckey[:], nil)
+	if err == leveldb.ErrNotFound {
+		return nil, ErrCoinNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	m := &TCoin{}
+	m.Read(NewNetHeader(data))
+	return m, nil
+}
+
+func HasCoin(id HashID, idx uint32) bool {
+	ckey := NewTCoinKey(id, idx)
+	has, err := Store().Has(ckey[:], nil)
+	return err == nil && has
+}
+
+//unspendable out not save to utxo set
+func IsCoinOut(out *TxOut) bool {
+	return out.Script != nil && !out.Script.IsUnspendable()
+}
+
+//utxo set sync to best block
+func IsCoinsSynced(best HashID) bool {
+	data, err := Store().Get([]byte(TCoinsBestKey), nil)
+	return err == nil && NewHashID(data).Equal(best)
+}
+
+//rebuild utxo set from main chain blocks,for database without utxo set
+func RebuildCoins(best uint32) error {
+	iter := Store().NewIterator(lvutil.BytesPrefix([]byte{TPrefixCoin}), nil)
+	batch := &leveldb.Batch{}
+	for iter.Next() {
+		batch.Delete(append([]byte{}, iter.Key()...))
+	}
+	iter.Release()
+	if err := Store().Write(batch, nil); err != nil {
+		return err
+	}
+	for h := uint32(0); h <= best; {
+		batch := &leveldb.Batch{}
+		bid := HashID{}
+		for ; h <= best && batch.Len() < 10000; h++ {
+			hkey := NewTHeightKey(h)
+			hv, err := Store().Get(hkey[:], nil)
+			if err != nil {
+				return fmt.Errorf("load height %d error %w", h, err)
+			}
+			bid = NewHashID(hv)
+			bkey := NewTBlockKey(bid)
+			bv, err := Store().Get(bkey[:], nil)
+			if err != nil {
+				return fmt.Errorf("load block %v error %w", bid, err)
+			}
+			m := TBlock(bv).ToBlock()
+			for _, tx := range m.Txs {
+				for iidx, in := range tx.Ins {
+					if iidx == 0 && tx.IsCoinBase() {
+						continue
+					}
+					ckey := NewTCoinKey(in.OutHash, in.OutIndex)
+					batch.Delete(ckey[:])
+				}
+				for oidx, out := range tx.Outs {
+					if !IsCoinOut(out) {
+						continue
+					}
+					ckey := NewTCoinKey(tx.Hash, uint32(oidx))
+					batch.Put(ckey[:], NewTCoin(out, h, tx.IsCoinBase()).Bytes())
+				}
+			}
+		}
+		batch.Put([]byte(TCoinsBestKey), bid[:])
+		if err := Store().Write(batch, nil); err != nil {
+			return err
+		}
+		log.Println("rebuild utxo set height=", h-1)
+	}
+	return nil
+}
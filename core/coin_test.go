@@ -0,0 +1,117 @@
+package core
+
+import (
+	"bitcoin/script"
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestCoinReadWrite(t *testing.T) {
+	out := &TxOut{Value: 1234500000, Script: testP2PKHScript(1)}
+	c1 := NewTCoin(out, 630000, true)
+	c2 := &TCoin{}
+	c2.Read(NewNetHeader(c1.Bytes()))
+	if c2.Value != c1.Value || c2.Height != c1.Height || !c2.CoinBase || !bytes.Equal(c2.Script.Bytes(), c1.Script.Bytes()) {
+		t.Errorf("coin read write error %v", c2)
+	}
+	if c2.IsMature(630099) || !c2.IsMature(630100) {
+		t.Error("coin maturity error")
+	}
+}
+
+func TestCoinSaveDisconnect(t *testing.T) {
+	UseMemDB()
+	gb := testGenesis(t)
+	if err := gb.Save(true); err != nil {
+		t.Fatal(err)
+	}
+	sa, sb := testP2PKHScript(1), testP2PKHScript(2)
+	cba := testCoinbaseTx(1, sa)
+	ba := testNewBlock(gb, cba)
+	if err := ba.Save(true); err != nil {
+		t.Fatal(err)
+	}
+	coin, err := LoadCoin(cba.Hash, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if coin.Height != 1 || !coin.CoinBase || coin.Value != cba.Outs[0].Value {
+		t.Fatal("coin data error")
+	}
+	//stx1 spend A coinbase,stx2 spend stx1 in same block
+	cbb := testCoinbaseTx(2, sb)
+	stx1 := &TX{Ver: 1}
+	stx1.Ins = []*TxIn{{OutHash: cba.Hash, OutIndex: 0, Script: script.NewScript([]byte{}), Sequence: 0xffffffff}}
+	stx1.Outs = []*TxOut{{Value: uint64(49 * COIN), Script: sb}}
+	stx1.Write(NewNetHeader())
+	stx2 := &TX{Ver: 1}
+	stx2.Ins = []*TxIn{{OutHash: stx1.Hash, OutIndex: 0, Script: script.NewScript([]byte{}), Sequence: 0xffffffff}}
+	stx2.Outs = []*TxOut{{Value: uint64(48 * COIN), Script: sa}}
+	stx2.Write(NewNetHeader())
+	bb := testNewBlock(ba, cbb, stx1, stx2)
+	if err := bb.Save(true); err != nil {
+		t.Fatal(err)
+	}
+	if HasCoin(cba.Hash, 0) || HasCoin(stx1.Hash, 0) || !HasCoin(stx2.Hash, 0) {
+		t.Fatal("spent coin state error")
+	}
+	if !IsCoinsSynced(bb.Hash) {
+		t.Fatal("coins best error")
+	}
+	//rebuild get same utxo set
+	if err := RebuildCoins(2); err != nil {
+		t.Fatal(err)
+	}
+	if HasCoin(cba.Hash, 0) || HasCoin(stx1.Hash, 0) || !HasCoin(stx2.Hash, 0) || !HasCoin(cbb.Hash, 0) {
+		t.Fatal("rebuild coin state error")
+	}
+	if err := bb.Disconnect(); err != nil {
+		t.Fatal(err)
+	}
+	if !HasCoin(cba.Hash, 0) || HasCoin(stx1.Hash, 0) || HasCoin(stx2.Hash, 0) || HasCoin(cbb.Hash, 0) {
+		t.Fatal("disconnect coin state error")
+	}
+	coin, err = LoadCoin(cba.Hash, 0)
+	if err != nil || coin.Height != 1 || !coin.CoinBase {
+		t.Fatal("restore coin error")
+	}
+	if !IsCoinsSynced(ba.Hash) {
+		t.Fatal("coins best error")
+	}
+}
+
+func TestCheckDoubleSpend(t *testing.T) {
+	UseMemDB()
+	gb := testGenesis(t)
+	if err := gb.Save(true); err != nil {
+		t.Fatal(err)
+	}
+	Txs.Push()
+	defer Txs.Pop()
+	in := &TxIn{OutHash: gb.Txs[0].Hash, OutIndex: 0, Script: script.NewScript([]byte{}), Sequence: 0xffffffff}
+	tx1 := &TX{Ver: 1, Ins: []*TxIn{in}, Outs: []*TxOut{{Value: 1, Script: testP2PKHScript(1)}}}
+	tx1.Write(NewNetHeader())
+	tx2 := &TX{Ver: 1, Ins: []*TxIn{in}, Outs: []*TxOut{{Value: 2, Script: testP2PKHScript(1)}}}
+	tx2.Write(NewNetHeader())
+	m := &MsgBlock{Height: 101}
+	spent := map[TCoinKey]bool{}
+	if err := m.checkSpent(Store(), tx1, spent); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.checkSpent(Store(), tx2, spent); err == nil {
+		t.Error("double spend in block not reject")
+	}
+	//spent coin in utxo set
+	in2 := &TxIn{OutHash: tx1.Hash, OutIndex: 0, Script: script.NewScript([]byte{}), Sequence: 0xffffffff}
+	tx3 := &TX{Ver: 1, Ins: []*TxIn{in2}, Outs: []*TxOut{{Value: 1, Script: testP2PKHScript(1)}}}
+	tx3.Write(NewNetHeader())
+	if err := m.checkSpent(Store(), tx3, map[TCoinKey]bool{}); !errors.Is(err, ErrCoinNotFound) {
+		t.Errorf("missing coin error %v", err)
+	}
+	//immature coinbase
+	m.Height = 99
+	if err := m.checkSpent(Store(), tx1, map[TCoinKey]bool{}); err == nil {
+		t.Error("immature coinbase spend not reject")
+	}
+}
@@ -0,0 +1,419 @@
+package core
+
+import (
+	"bitcoin/script"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+//bitcoin core src/test/data json files,see dat/core/README.md
+const testCoreDataDir = "../dat/core"
+
+var testCoreFlags = map[string]int{
+	"NONE":                                  script.SCRIPT_VERIFY_NONE,
+	"P2SH":                                  script.SCRIPT_VERIFY_P2SH,
+	"STRICTENC":                             script.SCRIPT_VERIFY_STRICTENC,
+	"DERSIG":                                script.SCRIPT_VERIFY_DERSIG,
+	"LOW_S":                                 script.SCRIPT_VERIFY_LOW_S,
+	"SIGPUSHONLY":                           script.SCRIPT_VERIFY_SIGPUSHONLY,
+	"MINIMALDATA":                           script.SCRIPT_VERIFY_MINIMALDATA,
+	"NULLDUMMY":                             script.SCRIPT_VERIFY_NULLDUMMY,
+	"DISCOURAGE_UPGRADABLE_NOPS":            script.SCRIPT_VERIFY_DISCOURAGE_UPGRADABLE_NOPS,
+	"CLEANSTACK":                            script.SCRIPT_VERIFY_CLEANSTACK,
+	"MINIMALIF":                             script.SCRIPT_VERIFY_MINIMALIF,
+	"NULLFAIL":                              script.SCRIPT_VERIFY_NULLFAIL,
+	"CHECKLOCKTIMEVERIFY":                   script.SCRIPT_VERIFY_CHECKLOCKTIMEVERIFY,
+	"CHECKSEQUENCEVERIFY":                   script.SCRIPT_VERIFY_CHECKSEQUENCEVERIFY,
+	"WITNESS":                               script.SCRIPT_VERIFY_WITNESS,
+	"DISCOURAGE_UPGRADABLE_WITNESS_PROGRAM": script.SCRIPT_VERIFY_DISCOURAGE_UPGRADABLE_WITNESS_PROGRAM,
+	"WITNESS_PUBKEYTYPE":                    script.SCRIPT_VERIFY_WITNESS_PUBKEYTYPE,
+	"CONST_SCRIPTCODE":                      script.SCRIPT_VERIFY_CONST_SCRIPTCODE,
+	"TAPROOT":                               script.SCRIPT_VERIFY_TAPROOT,
+	"DISCOURAGE_UPGRADABLE_TAPROOT_VERSION": script.SCRIPT_VERIFY_DISCOURAGE_UPGRADABLE_TAPROOT_VERSION,
+	"DISCOURAGE_OP_SUCCESS":                 script.SCRIPT_VERIFY_DISCOURAGE_OP_SUCCESS,
+	"DISCOURAGE_UPGRADABLE_PUBKEYTYPE":      script.SCRIPT_VERIFY_DISCOURAGE_UPGRADABLE_PUBKEYTYPE,
+}
+
+func testParseCoreFlags(s string) (int, error) {
+	flags := 0
+	if s == "" {
+		return flags, nil
+	}
+	for _, v := range strings.Split(s, ",") {
+		f, ok := testCoreFlags[v]
+		if !ok {
+			return 0, fmt.Errorf("unknown flag %s", v)
+		}
+		flags |= f
+	}
+	return flags, nil
+}
+
+func testLoadCoreJSON(t *testing.T, name string) [][]interface{} {
+	data, err := ioutil.ReadFile(filepath.Join(testCoreDataDir, name))
+	if err != nil {
+		t.Fatalf("%s miss,vendor from bitcoin core src/test/data %v", name, err)
+	}
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	tests := [][]interface{}{}
+	if err := d.Decode(&tests); err != nil {
+		t.Fatal(name, err)
+	}
+	return tests
+}
+
+//script error name without SCRIPT_ERR_ prefix,OK if nil
+func testScriptErrorName(err error) string {
+	if err == nil {
+		return "OK"
+	}
+	for errors.Unwrap(err) != nil {
+		err = errors.Unwrap(err)
+	}
+	//core throws scriptnum_error,reported as UNKNOWN_ERROR
+	if err == script.SCRIPT_ERR_SCRIPTNUM {
+		return "UNKNOWN_ERROR"
+	}
+	if err == script.SCRIPT_ERR_SIG_NULLFAIL {
+		return "NULLFAIL"
+	}
+	if s := err.Error(); strings.HasPrefix(s, "SCRIPT_ERR_") {
+		return strings.TrimPrefix(s, "SCRIPT_ERR_")
+	}
+	return "UNKNOWN_ERROR"
+}
+
+//recover engine panic as divergence
+func testCatch(f func() error) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = fmt.Errorf("panic %v", v)
+		}
+	}()
+	return f()
+}
+
+const (
+	//NewScriptAsm limit decimal to +-0xffffffff as core ParseScript does now,vectors older
+	testFailDecimal = "decimal out of range"
+	//witness script stack not one element is CLEANSTACK in newer core,vectors say EVAL_FALSE
+	testFailWitnessStack = "witness stack CLEANSTACK"
+)
+
+//known divergences kept on purpose,file -> case index -> reason
+var testCoreExpectedFail = map[string]map[int]string{
+	"script_tests.json": {
+		106: testFailDecimal, 107: testFailDecimal, 108: testFailDecimal,
+		118: testFailDecimal, 119: testFailDecimal, 120: testFailDecimal,
+		300: testFailDecimal, 301: testFailDecimal, 302: testFailDecimal,
+		313: testFailDecimal, 314: testFailDecimal, 315: testFailDecimal,
+		1154: testFailDecimal,
+		1185: testFailWitnessStack, 1186: testFailWitnessStack, 1190: testFailWitnessStack,
+		1195: testFailWitnessStack, 1196: testFailWitnessStack, 1197: testFailWitnessStack,
+		1200: testFailWitnessStack, 1211: testFailWitnessStack, 1212: testFailWitnessStack,
+		1216: testFailWitnessStack, 1221: testFailWitnessStack, 1222: testFailWitnessStack,
+		1223: testFailWitnessStack, 1226: testFailWitnessStack,
+	},
+	"tx_valid.json": {
+		146: testFailDecimal, 147: testFailDecimal, 148: testFailDecimal,
+	},
+	"tx_invalid.json": {
+		92: testFailDecimal,
+	},
+}
+
+//divergences by rule
+type testDivergence struct {
+	t     *testing.T
+	name  string
+	total int
+	fails int
+	known int
+	codes int
+	rules map[string]int
+}
+
+func newTestDivergence(t *testing.T, name string) *testDivergence {
+	return &testDivergence{t: t, name: name, rules: map[string]int{}}
+}
+
+func (d *testDivergence) Add(i int, rule string, format string, args ...interface{}) {
+	d.rules[rule]++
+	if why, ok := testCoreExpectedFail[d.name][i]; ok {
+		d.known++
+		d.t.Logf(d.name+" expected fail "+why+" "+format, args...)
+		return
+	}
+	d.fails++
+	d.t.Errorf(d.name+" "+format, args...)
+}
+
+//same result,other error code
+func (d *testDivergence) Code(i int, format string, args ...interface{}) {
+	d.codes++
+	if why, ok := testCoreExpectedFail[d.name][i]; ok {
+		d.known++
+		d.t.Logf(d.name+" expected fail "+why+" "+format, args...)
+		return
+	}
+	d.t.Errorf(d.name+" error code "+format, args...)
+}
+
+//expected fail case passing must be dropped from list
+func (d *testDivergence) Pass(i int) {
+	if why, ok := testCoreExpectedFail[d.name][i]; ok {
+		d.t.Errorf("%s %d expected fail (%s) now passes", d.name, i, why)
+	}
+}
+
+func (d *testDivergence) Report() {
+	keys := []string{}
+	for k := range d.rules {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		d.t.Logf("%s diverge %s %d", d.name, k, d.rules[k])
+	}
+	d.t.Logf("%s %d cases,%d result diverge,%d expected fail,%d error code diverge", d.name, d.total, d.fails, d.known, d.codes)
+}
+
+//bitcoin core BuildCreditingTransaction and BuildSpendingTransaction
+func testCoreScriptTx(sigs *script.Script, pks *script.Script, wits [][]byte, amount uint64) (*TX, *TxOut) {
+	credit := &TX{Ver: 1}
+	credit.Ins = []*TxIn{{OutIndex: 0xffffffff, Script: script.NewScript([]byte{script.OP_0, script.OP_0}), Sequence: script.SEQUENCE_FINAL}}
+	credit.Outs = []*TxOut{{Value: amount, Script: pks}}
+	credit.Write(NewNetHeader())
+	tx := &TX{Ver: 1}
+	in := &TxIn{OutHash: credit.Hash, OutIndex: 0, Script: sigs, Sequence: script.SEQUENCE_FINAL}
+	if len(wits) > 0 {
+		in.Witness = testWitness(wits...)
+		tx.SetHasWitness(true)
+	}
+	tx.Ins = []*TxIn{in}
+	tx.Outs = []*TxOut{{Value: amount, Script: script.NewScript([]byte{})}}
+	tx.Write(NewNetHeader())
+	return tx, credit.Outs[0]
+}
+
+//[[wit...,amount]?,scriptSig,scriptPubKey,flags,expected_scripterror,comments?]
+func TestCoreScriptTests(t *testing.T) {
+	tests := testLoadCoreJSON(t, "script_tests.json")
+	d := newTestDivergence(t, "script_tests.json")
+	defer d.Report()
+	for i, v := range tests {
+		pos, wits, amount := 0, [][]byte{}, uint64(0)
+		if ws, ok := v[0].([]interface{}); ok && len(ws) > 0 {
+			for _, w := range ws[:len(ws)-1] {
+				b, err := hex.DecodeString(fmt.Sprint(w))
+				if err != nil {
+					t.Errorf("script_tests %d bad witness %v", i, w)
+					continue
+				}
+				wits = append(wits, b)
+			}
+			btc, _ := ws[len(ws)-1].(json.Number).Float64()
+			amount = uint64(math.Round(btc * 1e8))
+			pos = 1
+		}
+		//comment line
+		if len(v) < pos+4 {
+			continue
+		}
+		d.total++
+		sigs, err := script.NewScriptAsm(fmt.Sprint(v[pos]))
+		if err != nil {
+			d.Add(i, "parse", "%d scriptSig %v", i, err)
+			continue
+		}
+		pks, err := script.NewScriptAsm(fmt.Sprint(v[pos+1]))
+		if err != nil {
+			d.Add(i, "parse", "%d scriptPubKey %v", i, err)
+			continue
+		}
+		flags, err := testParseCoreFlags(fmt.Sprint(v[pos+2]))
+		if err != nil {
+			t.Errorf("script_tests %d %v", i, err)
+			continue
+		}
+		want := fmt.Sprint(v[pos+3])
+		tx, out := testCoreScriptTx(sigs, pks, wits, amount)
+		spent := newSpentOutputs(tx)
+		spent.outs[0] = out
+		err = testCatch(func() error {
+			return newScriptVerify(0, tx.Ins[0], out, tx, CheckTXType(tx.Ins[0], out), spent).Verify(flags)
+		})
+		got := testScriptErrorName(err)
+		if (want == "OK") != (err == nil) {
+			d.Add(i, want, "%d [%v] [%v] %v want %s got %v", i, v[pos], v[pos+1], v[pos+2], want, err)
+		} else if got != want {
+			d.Code(i, "%d [%v] [%v] %v want %s got %v", i, v[pos], v[pos+1], v[pos+2], want, err)
+		} else {
+			d.Pass(i)
+		}
+	}
+}
+
+//prevouts resolved by tx cacher
+type testCoreCacher struct {
+	txs map[HashID]*TX
+}
+
+func (c *testCoreCacher) Set(id HashID, v interface{}) (interface{}, error) {
+	c.txs[id] = v.(*TX)
+	return v, nil
+}
+
+func (c *testCoreCacher) Del(id HashID) {
+	delete(c.txs, id)
+}
+
+func (c *testCoreCacher) Get(id HashID) (interface{}, error) {
+	if tx, ok := c.txs[id]; ok {
+		return tx, nil
+	}
+	return nil, CacheNotFoundErr
+}
+
+//[[[prevout hash,prevout index,prevout scriptPubKey,amount?],...],serializedTransaction,flags]
+func testCoreTxTests(t *testing.T, name string, valid bool) {
+	tests := testLoadCoreJSON(t, name)
+	d := newTestDivergence(t, name)
+	defer d.Report()
+	for i, v := range tests {
+		prevs, ok := v[0].([]interface{})
+		if !ok || len(v) < 3 {
+			continue
+		}
+		d.total++
+		cacher := &testCoreCacher{txs: map[HashID]*TX{}}
+		var perr error
+		for _, p := range prevs {
+			pv := p.([]interface{})
+			id := NewHashID(fmt.Sprint(pv[0]))
+			idx, _ := pv[1].(json.Number).Int64()
+			pks, err := script.NewScriptAsm(fmt.Sprint(pv[2]))
+			if err != nil {
+				perr = err
+				break
+			}
+			amount := int64(0)
+			if len(pv) > 3 {
+				amount, _ = pv[3].(json.Number).Int64()
+			}
+			//null prevout not resolvable
+			if idx < 0 {
+				continue
+			}
+			tx := cacher.txs[id]
+			if tx == nil {
+				tx = &TX{Hash: id}
+				cacher.txs[id] = tx
+			}
+			for len(tx.Outs) <= int(idx) {
+				tx.Outs = append(tx.Outs, &TxOut{Script: script.NewScript([]byte{})})
+			}
+			tx.Outs[idx] = &TxOut{Value: uint64(amount), Script: pks}
+		}
+		if perr != nil {
+			d.Add(i, "parse", "%d prevout %v", i, perr)
+			continue
+		}
+		data, err := hex.DecodeString(fmt.Sprint(v[1]))
+		if err != nil {
+			t.Errorf("%s %d bad tx hex", name, i)
+			continue
+		}
+		fs := fmt.Sprint(v[2])
+		flags, err := testParseCoreFlags(fs)
+		if err != nil {
+			t.Errorf("%s %d %v", name, i, err)
+			continue
+		}
+		//same txid reused with other prevouts across cases
+		ScriptCache = NewScriptCacher(DEFAULT_SCRIPT_CACHE_SIZE)
+		Txs.Push(cacher)
+		err = testCatch(func() error {
+			tx := &TX{}
+			tx.Read(NewNetHeader(data))
+			return VerifyTX(tx, flags)
+		})
+		Txs.Pop()
+		if valid && err != nil {
+			d.Add(i, testScriptErrorName(err), "%d flags %s error %v", i, fs, err)
+		} else if !valid && err == nil {
+			d.Add(i, fs, "%d flags %s invalid tx accepted", i, fs)
+		} else {
+			d.Pass(i)
+		}
+	}
+}
+
+func TestCoreTxValid(t *testing.T) {
+	testCoreTxTests(t, "tx_valid.json", true)
+}
+
+func TestCoreTxInvalid(t *testing.T) {
+	testCoreTxTests(t, "tx_invalid.json", false)
+}
+
+//[raw_transaction,script,input_index,hashType,signature_hash(result)]
+func TestCoreSigHash(t *testing.T) {
+	tests := testLoadCoreJSON(t, "sighash.json")
+	d := newTestDivergence(t, "sighash.json")
+	defer d.Report()
+	for i, v := range tests {
+		if len(v) < 5 {
+			continue
+		}
+		data, err := hex.DecodeString(fmt.Sprint(v[0]))
+		if err != nil {
+			t.Errorf("sighash %d bad tx hex", i)
+			continue
+		}
+		code, err := hex.DecodeString(fmt.Sprint(v[1]))
+		if err != nil {
+			t.Errorf("sighash %d bad script hex", i)
+			continue
+		}
+		idx, _ := v[2].(json.Number).Int64()
+		ht, _ := v[3].(json.Number).Int64()
+		want := fmt.Sprint(v[4])
+		d.total++
+		got := ""
+		err = testCatch(func() error {
+			tx := &TX{}
+			tx.Read(NewNetHeader(data))
+			vfy := newScriptVerify(int(idx), tx.Ins[idx], nil, tx, TX_NONSTANDARD, nil)
+			vfy.scode = script.NewScript(code)
+			sp := &baseSigPacker{idx: int(idx), in: tx.Ins[idx], ctx: tx, ht: uint32(ht), typ: TX_NONSTANDARD}
+			b, err := sp.Hash(vfy)
+			if err != nil {
+				return err
+			}
+			hash := HashID{}
+			copy(hash[:], b)
+			got = hash.String()
+			return nil
+		})
+		if err == nil && got == want {
+			d.Pass(i)
+		} else {
+			rule := fmt.Sprintf("hashtype %02x", uint32(ht)&0x9f)
+			if bytes.IndexByte(code, script.OP_CODESEPARATOR) >= 0 {
+				rule += " codeseparator"
+			}
+			d.Add(i, rule, "%d hashtype %x want %s got %s %v", i, uint32(ht), want, got, err)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package core
+
+import (
+	"bitcoin/config"
+	"bitcoin/script"
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+//bip68 relative lock,-1 no constraint
+//block height and median time past must greater than these
+type SequenceLock struct {
+	Height int64
+	Time   int64
+}
+
+//check lock satisfied at block height with prev block median time past
+func (l SequenceLock) Evaluate(height uint32, mtp int64) bool {
+	return l.Height < int64(height) && l.Time < mtp
+}
+
+//bip68 relative lock for tx,heights are ins coin heights
+//prev is parent of the block tx to be included
+func (m *TX) CalculateSequenceLocks(heights []uint32, prev *IndexNode) SequenceLock {
+	lock := SequenceLock{Height: -1, Time: -1}
+	if m.Ver < 2 || m.IsCoinBase() {
+		return lock
+	}
+	for i, in := range m.Ins {
+		if in.Sequence&script.SEQUENCE_LOCKTIME_DISABLE_FLAG != 0 {
+			continue
+		}
+		value := int64(in.Sequence & script.SEQUENCE_LOCKTIME_MASK)
+		if in.Sequence&script.SEQUENCE_LOCKTIME_TYPE_FLAG == 0 {
+			if v := int64(heights[i]) + value - 1; v > lock.Height {
+				lock.Height = v
+			}
+			continue
+		}
+		//coin time is median time past of block before coin block
+		ch := uint32(0)
+		if heights[i] > 0 {
+			ch = heights[i] - 1
+		}
+		ct := int64(0)
+		if prev != nil {
+			if n := prev.Ancestor(ch); n != nil {
+				ct = n.MedianTimePast()
+			}
+		}
+		if v := ct + value<<script.SEQUENCE_LOCKTIME_GRANULARITY - 1; v > lock.Time {
+			lock.Time = v
+		}
+	}
+	return lock
+}
+
+//median time past of block,block time if not in index
+func GetMedianTimePast(b *MsgBlock) int64 {
+	if n := Index.Get(b.Hash); n != nil {
+		return n.MedianTimePast()
+	}
+	return int64(b.Timestamp)
+}
+
+//min block version at height
+func checkBlockVersion(ver uint32, height uint32) error {
+	conf := config.GetConfig()
+	v := int32(ver)
+	if (v < 2 && height >= conf.BIP34Height) || (v < 3 && height >= conf.BIP66Height) || (v < 4 && height >= conf.BIP65Height) {
+		return fmt.Errorf("bad-version(0x%08x)", ver)
+	}
+	return nil
+}
+
+//bip34 coinbase script start with height
+func CoinbaseHeightScript(height uint32) *script.Script {
+	return script.NewScript([]byte{}).PushInt64(int64(height))
+}
+
+//bip113 lock time cutoff for block txs
+func (m *MsgBlock) LockTimeCutoff(prev *IndexNode) int64 {
+	if prev != nil && m.Height >= config.GetConfig().CSVHeight {
+		return prev.MedianTimePast()
+	}
+	return int64(m.Timestamp)
+}
+
+//block version and bip34 coinbase height
+func (m *MsgBlock) checkDeployments() error {
+	if err := checkBlockVersion(m.Ver, m.Height); err != nil {
+		return err
+	}
+	if m.Height < config.GetConfig().BIP34Height {
+		return nil
+	}
+	if !m.Txs[0].IsCoinBase() {
+		return errors.New("0 tx not coinbase")
+	}
+	hs := CoinbaseHeightScript(m.Height)
+	cs := m.Txs[0].Ins[0].Script
+	if cs.Len() < hs.Len() || !bytes.Equal(cs.SubBytes(0, hs.Len()), hs.Bytes()) {
+		return fmt.Errorf("bad-cb-height %d", m.Height)
+	}
+	return nil
+}
+
+//coin heights of tx ins,outs in block at block height
+func (m *MsgBlock) prevHeights(db DBImp, tx *TX, intxs map[HashID]bool) ([]uint32, error) {
+	heights := make([]uint32, len(tx.Ins))
+	if tx.IsCoinBase() {
+		return heights, nil
+	}
+	for i, in := range tx.Ins {
+		if intxs[in.OutHash] {
+			heights[i] = m.Height
+			continue
+		}
+		coin, err := loadCoin(db, in.OutHash, in.OutIndex)
+		if err != nil {
+			return nil, err
+		}
+		heights[i] = coin.Height
+	}
+	return heights, nil
+}
+
+//bip113 final and bip68 sequence locks for block tx
+func (m *MsgBlock) checkTxLocks(db DBImp, tx *TX, prev *IndexNode, intxs map[HashID]bool) error {
+	if !tx.IsFinal(int64(m.Height), m.LockTimeCutoff(prev)) {
+		return fmt.Errorf("bad-txns-nonfinal tx=%v", tx.Hash)
+	}
+	if prev == nil || m.Height < config.GetConfig().CSVHeight {
+		return nil
+	}
+	heights, err := m.prevHeights(db, tx, intxs)
+	if err != nil {
+		return fmt.Errorf("tx %v ins height error %w", tx.Hash, err)
+	}
+	if !tx.CalculateSequenceLocks(heights, prev).Evaluate(m.Height, prev.MedianTimePast()) {
+		return fmt.Errorf("bad-txns-nonfinal tx=%v sequence locks", tx.Hash)
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package core
+
+import (
+	"bitcoin/config"
+	"bitcoin/script"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func testLoadBlockFile(t testing.TB) *MsgBlock {
+	data, err := ioutil.ReadFile("../dat/block.dat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &MsgBlock{}
+	m.Read(NewNetHeader(data))
+	return m
+}
+
+func testLoadTxFile(t *testing.T, id string) *TX {
+	data, err := ioutil.ReadFile(fmt.Sprintf("../dat/tx%s.dat", id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := &TX{}
+	tx.Read(NewNetHeader(data))
+	return tx
+}
+
+//index chain with block times
+func testTimeChain(ts ...uint32) *IndexNode {
+	var n *IndexNode
+	for i, v := range ts {
+		n = &IndexNode{Header: &BHeader{Timestamp: v}, Height: uint32(i), prev: n}
+	}
+	return n
+}
+
+func TestBlockDeployments(t *testing.T) {
+	m := testLoadBlockFile(t)
+	m.Height = 553576
+	if err := m.checkDeployments(); err != nil {
+		t.Fatal(err)
+	}
+	m.Height = 553575
+	if err := m.checkDeployments(); err == nil || !strings.Contains(err.Error(), "bad-cb-height") {
+		t.Error("bip34 coinbase height check error", err)
+	}
+	conf := config.GetConfig()
+	if checkBlockVersion(1, conf.BIP34Height) == nil || checkBlockVersion(2, conf.BIP66Height) == nil {
+		t.Error("bip34 bip66 min version error")
+	}
+	if checkBlockVersion(3, conf.BIP65Height) == nil || checkBlockVersion(4, conf.BIP65Height) != nil {
+		t.Error("bip65 min version error")
+	}
+	if checkBlockVersion(1, conf.BIP34Height-1) != nil {
+		t.Error("version before bip34 error")
+	}
+}
+
+func TestLockTimeCutoff(t *testing.T) {
+	m := testLoadBlockFile(t)
+	m.Height = 553576
+	for _, v := range m.Txs {
+		if !v.IsFinal(int64(m.Height), int64(m.Timestamp)) {
+			t.Fatalf("block tx %v not final", v.Hash)
+		}
+	}
+	tx := testLoadTxFile(t, "2668361f01c966d29a5028ec70d749a0ae3f7cd42fe4996e762b4ff96e276561")
+	if tx.IsFinal(592326, 0) || !tx.IsFinal(592327, 0) {
+		t.Error("height lock time final error")
+	}
+	//median time past before block time
+	prev := testTimeChain(10, 20, 30, 40, 50, 60, 70, 80, 90, 100, 1000)
+	if prev.MedianTimePast() != 60 {
+		t.Fatal("median time past error", prev.MedianTimePast())
+	}
+	tx.LockTime = script.LOCKTIME_THRESHOLD + 100
+	b := &MsgBlock{Height: config.GetConfig().CSVHeight, Timestamp: script.LOCKTIME_THRESHOLD + 1000}
+	if tx.IsFinal(int64(b.Height), b.LockTimeCutoff(prev)) {
+		t.Error("bip113 lock time cutoff error")
+	}
+	b.Height--
+	if !tx.IsFinal(int64(b.Height), b.LockTimeCutoff(prev)) {
+		t.Error("lock time cutoff before csv error")
+	}
+}
+
+func TestSequenceLocks(t *testing.T) {
+	tx := testLoadTxFile(t, "8d1c4103dcaabbdcda701331779dd44d82681264af07b9e6fc84e0893bba3d10")
+	prev := testTimeChain(0, 600, 1200, 1800, 2400, 3000)
+	heights := []uint32{3, 3, 3}
+	if lock := tx.CalculateSequenceLocks(heights, prev); lock.Height != -1 || lock.Time != -1 {
+		t.Fatal("disable flag sequence lock error", lock)
+	}
+	tx.Ins[0].Sequence = 2
+	lock := tx.CalculateSequenceLocks(heights, prev)
+	if lock.Height != 4 || lock.Evaluate(4, 10000) || !lock.Evaluate(5, 10000) {
+		t.Error("height sequence lock error", lock)
+	}
+	//coin time is mtp of block 2,512 seconds
+	tx.Ins[1].Sequence = script.SEQUENCE_LOCKTIME_TYPE_FLAG | 1
+	lock = tx.CalculateSequenceLocks(heights, prev)
+	if lock.Time != 600+512-1 || lock.Evaluate(6, 1111) || !lock.Evaluate(6, 1112) {
+		t.Error("time sequence lock error", lock)
+	}
+	tx.Ver = 1
+	if lock := tx.CalculateSequenceLocks(heights, prev); lock.Height != -1 || lock.Time != -1 {
+		t.Error("version 1 sequence lock error", lock)
+	}
+}
+
+func TestBlockTxLocks(t *testing.T) {
+	defer config.SelectNetwork(config.NET_MAIN)
+	testRegTest(t)
+	_, pks := testP2PKHKey(t)
+	ids, err := GenerateToScript(pks, COINBASE_MATURITY+1, DEFAULT_MAX_TRIES)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b1, err := LoadBlock(ids[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	//relative height lock not reached
+	in := &TxIn{OutHash: b1.Txs[0].Hash, Script: script.NewScript([]byte{script.OP_1}), Sequence: 1000}
+	tx := &TX{Ver: 2, Ins: []*TxIn{in}, Outs: []*TxOut{{Value: 1000, Script: pks}}}
+	tx.Write(NewNetHeader())
+	if _, err := TxsMap.AcceptTx(tx); !errors.Is(err, ErrTxNonBIP68Final) {
+		t.Error("mempool bip68 check error", err)
+	}
+	m, err := NewBlockTemplate(pks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Txs = append(m.Txs, tx)
+	addWitnessCommitment(m.Txs[0], m.Txs)
+	if err := testRemineBlock(t, m).Check(); err == nil || !strings.Contains(err.Error(), "bad-txns-nonfinal") {
+		t.Error("block bip68 check error", err)
+	}
+	//absolute lock time at block height
+	in.Sequence = 0
+	tx.LockTime = m.Height
+	tx.Write(NewNetHeader())
+	m.Txs[0].Outs = m.Txs[0].Outs[:1]
+	addWitnessCommitment(m.Txs[0], m.Txs)
+	if err := testRemineBlock(t, m).Check(); err == nil || !strings.Contains(err.Error(), "bad-txns-nonfinal") {
+		t.Error("block lock time check error", err)
+	}
+	//coinbase without height
+	m, _ = NewBlockTemplate(pks)
+	m.Txs[0].Ins[0].Script = script.NewScript([]byte{}).PushInt64(int64(m.Height + 1)).PushInt64(0)
+	if err := testRemineBlock(t, m).Check(); err == nil || !strings.Contains(err.Error(), "bad-cb-height") {
+		t.Error("block bip34 check error", err)
+	}
+}
@@ -0,0 +1,189 @@
+package core
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	//max blocks download ahead of main chain
+	DownloadWindow = 1024
+	//max blocks in flight per peer
+	DownloadPeerInFlight = 16
+	//block download timeout,request from other peer
+	DownloadTimeout = time.Minute
+	//headers sync timeout
+	HeadersTimeout = time.Second * 30
+)
+
+type inflight struct {
+	c    *Client
+	time time.Time
+}
+
+//headers first download,get block data from multiple peers
+type BlockDownloader struct {
+	mu     sync.Mutex
+	blocks map[HashID]*inflight
+	peers  map[string]int
+	hsync  *Client //headers sync peer
+	htime  time.Time
+}
+
+func NewBlockDownloader() *BlockDownloader {
+	return &BlockDownloader{
+		blocks: map[HashID]*inflight{},
+		peers:  map[string]int{},
+	}
+}
+
+var (
+	Download = NewBlockDownloader()
+)
+
+func (d *BlockDownloader) remove(id HashID) {
+	v, ok := d.blocks[id]
+	if !ok {
+		return
+	}
+	delete(d.blocks, id)
+	if d.peers[v.c.Key()]--; d.peers[v.c.Key()] <= 0 {
+		delete(d.peers, v.c.Key())
+	}
+}
+
+//recv block data
+func (d *BlockDownloader) Received(id HashID) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.remove(id)
+}
+
+//peer closed,request blocks from other peers
+func (d *BlockDownloader) RemovePeer(c *Client) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for id, v := range d.blocks {
+		if v.c.Key() == c.Key() {
+			d.remove(id)
+		}
+	}
+	if d.hsync != nil && d.hsync.Key() == c.Key() {
+		d.hsync = nil
+	}
+}
+
+func (d *BlockDownloader) InFlight() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.blocks)
+}
+
+//check peer can sync headers
+func (d *BlockDownloader) NeedHeaders(c *Client) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.hsync != nil && time.Since(d.htime) < HeadersTimeout {
+		return false
+	}
+	tip := Index.BestHeader()
+	if tip == nil || c.VerInfo == nil || c.VerInfo.Height <= tip.Height {
+		return false
+	}
+	d.hsync = c
+	d.htime = time.Now()
+	return true
+}
+
+//continue headers sync from peer
+func (d *BlockDownloader) ContinueHeaders(c *Client) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.hsync = c
+	d.htime = time.Now()
+}
+
+//headers sync finished from peer
+func (d *BlockDownloader) HeadersDone(c *Client) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.hsync != nil && d.hsync.Key() == c.Key() {
+		d.hsync = nil
+	}
+}
+
+//request headers from peer
+func RequestHeaders(c *Client, n *IndexNode) {
+	m := NewMsgGetHeaders()
+	for _, v := range Index.Locator(n) {
+		m.AddHashID(v)
+	}
+	c.WriteMsg(m)
+}
+
+//blocks need download in window,from main chain to best header
+func (d *BlockDownloader) candidates(best *IndexNode) []*IndexNode {
+	tip := Index.BestHeader()
+	if best == nil || tip == nil || tip.Work.Cmp(best.Work) <= 0 {
+		return nil
+	}
+	fork := LastCommonAncestor(best, tip)
+	if end := fork.Height + DownloadWindow; tip.Height > end {
+		tip = tip.Ancestor(end)
+	}
+	ns := []*IndexNode{}
+	now := time.Now()
+	for _, v := range Index.Path(fork, tip) {
+		if v.HasData() || v.IsFailed() {
+			continue
+		}
+		if iv, ok := d.blocks[v.Hash()]; ok {
+			if now.Sub(iv.time) < DownloadTimeout {
+				continue
+			}
+			//timeout,request from other peer
+			d.remove(v.Hash())
+		}
+		ns = append(ns, v)
+	}
+	return ns
+}
+
+//request blocks in window from peers
+func (d *BlockDownloader) Schedule(best *IndexNode, peers []*Client) {
+	for c, m := range d.schedule(best, peers) {
+		c.WriteMsg(m)
+	}
+}
+
+func (d *BlockDownloader) schedule(best *IndexNode, peers []*Client) map[*Client]*MsgGetData {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	msgs := map[*Client]*MsgGetData{}
+	ns := d.candidates(best)
+	if len(ns) == 0 || len(peers) == 0 {
+		return msgs
+	}
+	for _, v := range ns {
+		for i := 0; i < len(peers); i++ {
+			c := peers[(int(v.Height)+i)%len(peers)]
+			if c.VerInfo == nil || c.VerInfo.Height < v.Height {
+				continue
+			}
+			if d.peers[c.Key()] >= DownloadPeerInFlight {
+				continue
+			}
+			m, ok := msgs[c]
+			if !ok {
+				m = NewMsgGetData()
+				msgs[c] = m
+			}
+			hv := v.Hash()
+			m.AddHash(MSG_WITNESS_BLOCK, hv[:])
+			d.blocks[hv] = &inflight{c: c, time: time.Now()}
+			d.peers[c.Key()]++
+			break
+		}
+	}
+	return msgs
+}
@@ -0,0 +1,53 @@
+package core
+
+import (
+	"net"
+	"testing"
+)
+
+func testDownloadPeer(ip string, height uint32) *Client {
+	return &Client{
+		wc:      make(chan MsgIO, 10),
+		IP:      IPPort{ip: net.ParseIP(ip), port: 8333},
+		VerInfo: &MsgVersion{Height: height},
+	}
+}
+
+func TestDownloadSchedule(t *testing.T) {
+	UseMemDB()
+	Index = NewBlockIndex()
+	gb := testGenesis(t)
+	best := testIndexBlock(gb, IndexStatusData)
+	ms := testIndexChain(gb, DownloadWindow+100, 0)
+	d := NewBlockDownloader()
+	if ns := d.candidates(best); len(ns) != DownloadWindow || ns[0].Height != 1 {
+		t.Fatal("download window error")
+	}
+	//p3 only has blocks <= 10
+	p3 := testDownloadPeer("3.3.3.3", 10)
+	msgs := NewBlockDownloader().schedule(best, []*Client{p3})
+	if len(msgs[p3].Invs) != 10 {
+		t.Fatal("request block peer not has")
+	}
+	p1, p2 := testDownloadPeer("1.1.1.1", 2000), testDownloadPeer("2.2.2.2", 100)
+	msgs = d.schedule(best, []*Client{p1, p2})
+	if len(msgs[p1].Invs) != DownloadPeerInFlight || len(msgs[p2].Invs) != DownloadPeerInFlight {
+		t.Fatal("peer in flight error")
+	}
+	if d.InFlight() != 2*DownloadPeerInFlight {
+		t.Fatal("in flight count error")
+	}
+	//peers full
+	if msgs := d.schedule(best, []*Client{p1, p2}); len(msgs) != 0 {
+		t.Fatal("schedule over peer limit")
+	}
+	d.Received(ms[1].Hash)
+	d.RemovePeer(p2)
+	if d.InFlight() != DownloadPeerInFlight-1 {
+		t.Fatal("received or remove peer error")
+	}
+	msgs = d.schedule(best, []*Client{p1})
+	if len(msgs[p1].Invs) != 1 {
+		t.Fatal("reschedule error")
+	}
+}
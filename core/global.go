@@ -1,7 +1,10 @@
 package core
 
 import (
+	"bitcoin/config"
 	"bytes"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -72,12 +75,52 @@ func (g *Global) Init() error {
 	if best, err := LoadBestBlock(); err == nil {
 		g.best = best
 		log.Println("load best block", best.Hash, "height=", best.Height)
+		//database without block index
+		if err := Index.Load(); err != nil || Index.Get(best.Hash) == nil {
+			log.Println("rebuild block index")
+			if err := RebuildIndex(best.Height); err != nil {
+				return err
+			}
+		}
+		log.Println("load block index count=", Index.Len(), "best header height=", Index.BestHeader().Height)
+		//database without utxo set
+		if !IsCoinsSynced(best.Hash) {
+			log.Println("rebuild utxo set")
+			if err := RebuildCoins(best.Height); err != nil {
+				return err
+			}
+		}
+	} else if conf := config.GetConfig(); conf.GenesisData != "" {
+		m, err := GetGenesisBlock(conf)
+		if err != nil {
+			return err
+		}
+		g.Lock()
+		defer g.Unlock()
+		if err := g.AcceptBlock(m); err != nil {
+			return fmt.Errorf("accept genesis block error %w", err)
+		}
+		log.Println("database empty,create genesis block", m.Hash)
 	} else {
 		log.Println("database empty,start download genesis block")
 	}
 	return nil
 }
 
+//genesis block from network config data
+func GetGenesisBlock(conf *config.Config) (*MsgBlock, error) {
+	data, err := hex.DecodeString(conf.GenesisData)
+	if err != nil {
+		return nil, err
+	}
+	m := NewMsgBlock()
+	m.Read(NewNetHeader(data))
+	if !m.Hash.Equal(NewHashID(conf.GenesisBlock)) {
+		return nil, errors.New("genesis block data error")
+	}
+	return m, nil
+}
+
 var (
 	G = &Global{}
 )
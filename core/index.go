@@ -0,0 +1,421 @@
+package core
+
+import (
+	"bitcoin/config"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	lvutil "github.com/syndtr/goleveldb/leveldb/util"
+)
+
+var (
+	ErrPrevHeaderNotFound = errors.New("prev header not found")
+	ErrHeaderFailed       = errors.New("header in failed chain")
+)
+
+//blocks for median time past
+const (
+	MEDIAN_TIME_SPAN = 11
+)
+
+//block index status
+const (
+	//header checked
+	IndexStatusHeader = uint8(1 << 0)
+	//block data saved
+	IndexStatusData = uint8(1 << 1)
+	//block check failed
+	IndexStatusFailed = uint8(1 << 2)
+)
+
+//prefix[1] blockhash[32]
+type TIndexKey [33]byte
+
+func NewTIndexKey(id HashID) TIndexKey {
+	k := TIndexKey{}
+	k[0] = TPrefixIndex
+	copy(k[1:], id[:])
+	return k
+}
+
+//block index tree node
+type IndexNode struct {
+	Header *BHeader
+	Height uint32
+	Work   UIHash //chain work
+	Status uint8
+	prev   *IndexNode
+}
+
+func (n *IndexNode) Hash() HashID {
+	return n.Header.Hash
+}
+
+func (n *IndexNode) Prev() *IndexNode {
+	return n.prev
+}
+
+func (n *IndexNode) HasData() bool {
+	return n.Status&IndexStatusData != 0
+}
+
+func (n *IndexNode) IsFailed() bool {
+	return n.Status&IndexStatusFailed != 0
+}
+
+//get ancestor node at height
+func (n *IndexNode) Ancestor(h uint32) *IndexNode {
+	if h > n.Height {
+		return nil
+	}
+	v := n
+	for v != nil && v.Height > h {
+		v = v.prev
+	}
+	return v
+}
+
+//bip113 median time of last MEDIAN_TIME_SPAN blocks
+func (n *IndexNode) MedianTimePast() int64 {
+	ts := []int64{}
+	for v := n; v != nil && len(ts) < MEDIAN_TIME_SPAN; v = v.prev {
+		ts = append(ts, int64(v.Header.Timestamp))
+	}
+	sort.Slice(ts, func(i, j int) bool {
+		return ts[i] < ts[j]
+	})
+	return ts[len(ts)/2]
+}
+
+//next block bits
+//bits required for next block with time bt
+func (n *IndexNode) NextWorkRequired(bt uint32) uint32 {
+	conf := config.GetConfig()
+	dav := uint32(conf.DiffAdjusInterval())
+	if (n.Height+1)%dav != 0 {
+		if !conf.PowAllowMinDifficultyBlocks {
+			return n.Header.Bits
+		}
+		limit := NewUIHash(conf.PowLimit).Compact(false)
+		//testnet block time > 2*spacing,allow min difficulty
+		if bt > n.Header.Timestamp+uint32(conf.PowTargetSpacing*2) {
+			return limit
+		}
+		//last not min difficulty block bits
+		v := n
+		for v.prev != nil && v.Height%dav != 0 && v.Header.Bits == limit {
+			v = v.prev
+		}
+		return v.Header.Bits
+	}
+	if conf.PowNoRetargeting {
+		return n.Header.Bits
+	}
+	first := n.Ancestor(n.Height + 1 - dav)
+	return CalculateWorkRequired(n.Header.Timestamp, first.Header.Timestamp, n.Header.Bits)
+}
+
+//header[81] height[4] work[32] status[1]
+const (
+	TIndexNodeSize = 81 + 4 + 32 + 1
+)
+
+func (n *IndexNode) Read(h *NetHeader) {
+	n.Header = &BHeader{}
+	n.Header.Read(h)
+	n.Height = h.ReadUInt32()
+	hv := HashID{}
+	h.ReadBytes(hv[:])
+	n.Work = NewUIHash(hv[:])
+	n.Status = h.ReadUint8()
+}
+
+func (n *IndexNode) Write(h *NetHeader) {
+	n.Header.Write(h)
+	h.WriteUInt32(n.Height)
+	hv := n.Work.ToHashID()
+	h.WriteBytes(hv[:])
+	h.WriteUint8(n.Status)
+}
+
+func (n *IndexNode) Bytes() []byte {
+	h := NewNetHeader()
+	n.Write(h)
+	return h.Bytes()
+}
+
+//last common ancestor
+func LastCommonAncestor(a *IndexNode, b *IndexNode) *IndexNode {
+	if a == nil || b == nil {
+		return nil
+	}
+	if a.Height > b.Height {
+		a = a.Ancestor(b.Height)
+	} else if b.Height > a.Height {
+		b = b.Ancestor(a.Height)
+	}
+	for a != b && a != nil && b != nil {
+		a, b = a.prev, b.prev
+	}
+	return a
+}
+
+//block index tree,all checked headers
+type BlockIndex struct {
+	mu    sync.RWMutex
+	nodes map[HashID]*IndexNode
+	best  *IndexNode //best header
+}
+
+func NewBlockIndex() *BlockIndex {
+	return &BlockIndex{
+		nodes: map[HashID]*IndexNode{},
+	}
+}
+
+var (
+	Index = NewBlockIndex()
+)
+
+//load block index from db
+func (bi *BlockIndex) Load() error {
+	bi.mu.Lock()
+	defer bi.mu.Unlock()
+	bi.nodes = map[HashID]*IndexNode{}
+	bi.best = nil
+	iter := Store().NewIterator(lvutil.BytesPrefix([]byte{TPrefixIndex}), nil)
+	defer iter.Release()
+	for iter.Next() {
+		if len(iter.Value()) != TIndexNodeSize {
+			return errors.New("block index data size error")
+		}
+		n := &IndexNode{}
+		n.Read(NewNetHeader(iter.Value()))
+		bi.nodes[n.Hash()] = n
+	}
+	if err := iter.Error(); err != nil {
+		return err
+	}
+	for _, n := range bi.nodes {
+		if n.Height == 0 {
+			continue
+		}
+		prev, ok := bi.nodes[n.Header.Prev]
+		if !ok {
+			return fmt.Errorf("block index %v miss prev", n.Hash())
+		}
+		n.prev = prev
+	}
+	bi.updateBest()
+	return nil
+}
+
+func (bi *BlockIndex) Len() int {
+	bi.mu.RLock()
+	defer bi.mu.RUnlock()
+	return len(bi.nodes)
+}
+
+func (bi *BlockIndex) Get(id HashID) *IndexNode {
+	bi.mu.RLock()
+	defer bi.mu.RUnlock()
+	return bi.nodes[id]
+}
+
+//best work header
+func (bi *BlockIndex) BestHeader() *IndexNode {
+	bi.mu.RLock()
+	defer bi.mu.RUnlock()
+	return bi.best
+}
+
+func (bi *BlockIndex) updateBest() {
+	bi.best = nil
+	for _, n := range bi.nodes {
+		if n.IsFailed() {
+			continue
+		}
+		if bi.best == nil || n.Work.Cmp(bi.best.Work) > 0 {
+			bi.best = n
+		}
+	}
+}
+
+//check header and add to index
+func (bi *BlockIndex) AddHeader(h *BHeader) (*IndexNode, error) {
+	bi.mu.Lock()
+	defer bi.mu.Unlock()
+	if n, ok := bi.nodes[h.Hash]; ok {
+		return n, nil
+	}
+	n := &IndexNode{Header: h, Status: IndexStatusHeader}
+	if h.Hash.Equal(NewHashID(config.GetConfig().GenesisBlock)) {
+		n.Work = GetBlockProof(h.Bits)
+	} else {
+		prev, ok := bi.nodes[h.Prev]
+		if !ok {
+			return nil, ErrPrevHeaderNotFound
+		}
+		if prev.IsFailed() {
+			return nil, ErrHeaderFailed
+		}
+		if err := bi.checkHeader(prev, h); err != nil {
+			return nil, err
+		}
+		n.prev = prev
+		n.Height = prev.Height + 1
+		n.Work = prev.Work.Add(GetBlockProof(h.Bits))
+	}
+	if err := bi.save(n); err != nil {
+		return nil, err
+	}
+	bi.nodes[h.Hash] = n
+	if bi.best == nil || n.Work.Cmp(bi.best.Work) > 0 {
+		bi.best = n
+	}
+	return n, nil
+}
+
+//check header pow,bits,time and version
+func (bi *BlockIndex) checkHeader(prev *IndexNode, h *BHeader) error {
+	if !CheckProofOfWork(h.Hash, h.Bits) {
+		return fmt.Errorf("header %v proof of work check error", h.Hash)
+	}
+	if bits := prev.NextWorkRequired(h.Timestamp); h.Bits != bits {
+		return fmt.Errorf("header %v bits error %x - %x", h.Hash, h.Bits, bits)
+	}
+	if int64(h.Timestamp) <= prev.MedianTimePast() {
+		return fmt.Errorf("header %v time-too-old", h.Hash)
+	}
+	if int64(h.Timestamp) > GetAdjustedTime()+MAX_FUTURE_BLOCK_TIME {
+		return fmt.Errorf("header %v time-too-new", h.Hash)
+	}
+	if err := checkBlockVersion(h.Ver, prev.Height+1); err != nil {
+		return fmt.Errorf("header %v %w", h.Hash, err)
+	}
+	return nil
+}
+
+func (bi *BlockIndex) save(n *IndexNode) error {
+	ikey := NewTIndexKey(n.Hash())
+	return Store().Put(ikey[:], n.Bytes(), nil)
+}
+
+//set node status and save
+func (bi *BlockIndex) SetStatus(n *IndexNode, status uint8) error {
+	bi.mu.Lock()
+	defer bi.mu.Unlock()
+	n.Status |= status
+	if status&IndexStatusFailed == 0 {
+		return bi.save(n)
+	}
+	//descendant of failed block is failed
+	batch := &leveldb.Batch{}
+	for _, v := range bi.nodes {
+		if v.Height <= n.Height || v.IsFailed() {
+			continue
+		}
+		if v.Ancestor(n.Height) == n {
+			v.Status |= IndexStatusFailed
+			ikey := NewTIndexKey(v.Hash())
+			batch.Put(ikey[:], v.Bytes())
+		}
+	}
+	ikey := NewTIndexKey(n.Hash())
+	batch.Put(ikey[:], n.Bytes())
+	bi.updateBest()
+	return Store().Write(batch, nil)
+}
+
+//block locator from node
+func (bi *BlockIndex) Locator(n *IndexNode) []HashID {
+	ids := []HashID{}
+	step := uint32(1)
+	for n != nil {
+		ids = append(ids, n.Hash())
+		if n.Height == 0 {
+			break
+		}
+		if len(ids) >= 10 {
+			step *= 2
+		}
+		h := uint32(0)
+		if n.Height > step {
+			h = n.Height - step
+		}
+		n = n.Ancestor(h)
+	}
+	return ids
+}
+
+//chain from fork(exclude) to tip
+func (bi *BlockIndex) Path(fork *IndexNode, tip *IndexNode) []*IndexNode {
+	if fork == nil || tip == nil || tip.Height <= fork.Height {
+		return nil
+	}
+	ns := make([]*IndexNode, tip.Height-fork.Height)
+	for v := tip; v != nil && v != fork; v = v.prev {
+		ns[v.Height-fork.Height-1] = v
+	}
+	return ns
+}
+
+//rebuild block index from main chain blocks,for database without block index
+func RebuildIndex(best uint32) error {
+	bi := Index
+	bi.mu.Lock()
+	defer bi.mu.Unlock()
+	iter := Store().NewIterator(lvutil.BytesPrefix([]byte{TPrefixIndex}), nil)
+	batch := &leveldb.Batch{}
+	for iter.Next() {
+		batch.Delete(append([]byte{}, iter.Key()...))
+	}
+	iter.Release()
+	if err := Store().Write(batch, nil); err != nil {
+		return err
+	}
+	bi.nodes = map[HashID]*IndexNode{}
+	var prev *IndexNode
+	for h := uint32(0); h <= best; {
+		batch := &leveldb.Batch{}
+		for ; h <= best && batch.Len() < 10000; h++ {
+			hkey := NewTHeightKey(h)
+			hv, err := Store().Get(hkey[:], nil)
+			if err != nil {
+				return fmt.Errorf("load height %d error %w", h, err)
+			}
+			id := NewHashID(hv)
+			bkey := NewTBlockKey(id)
+			bv, err := Store().Get(bkey[:], nil)
+			if err != nil {
+				return fmt.Errorf("load block %v error %w", id, err)
+			}
+			//only read header,not decode block
+			body := TBlock(bv).Body()
+			if len(body) < 80 {
+				return errors.New("block data size error")
+			}
+			n := &IndexNode{Header: &BHeader{}, Height: h, prev: prev}
+			n.Header.Read(NewNetHeader(append(body[:80:80], 0)))
+			n.Status = IndexStatusHeader | IndexStatusData
+			n.Work = GetBlockProof(n.Header.Bits)
+			if prev != nil {
+				n.Work = prev.Work.Add(n.Work)
+			}
+			bi.nodes[id] = n
+			ikey := NewTIndexKey(id)
+			batch.Put(ikey[:], n.Bytes())
+			prev = n
+		}
+		if err := Store().Write(batch, nil); err != nil {
+			return err
+		}
+	}
+	bi.updateBest()
+	log.Println("rebuild block index count=", len(bi.nodes))
+	return nil
+}
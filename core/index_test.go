@@ -0,0 +1,167 @@
+package core
+
+import (
+	"bitcoin/config"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+//build header chain from prev without check
+func testIndexChain(prev *MsgBlock, num int, nonce uint32) []*MsgBlock {
+	ms := []*MsgBlock{}
+	for i := 0; i < num; i++ {
+		m := NewMsgBlock()
+		m.Ver = 1
+		m.Prev = prev.Hash
+		m.Bits = prev.Bits
+		m.Timestamp = prev.Timestamp + 600
+		m.Nonce = nonce
+		m.Height = prev.Height + 1
+		m.Write(NewNetHeader())
+		testIndexBlock(m, 0)
+		ms = append(ms, m)
+		prev = m
+	}
+	return ms
+}
+
+func TestIndexAddHeader(t *testing.T) {
+	UseMemDB()
+	Index = NewBlockIndex()
+	gb := testGenesis(t)
+	gn, err := Index.AddHeader(gb.Header())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gn.Height != 0 || !gn.Work.Equal(GetBlockProof(gb.Bits)) || Index.BestHeader() != gn {
+		t.Fatal("genesis index error")
+	}
+	//unknown prev
+	hv := gb.Header()
+	hv.Prev = HashID{1}
+	hv.Hash = HashID{2}
+	if _, err := Index.AddHeader(hv); !errors.Is(err, ErrPrevHeaderNotFound) {
+		t.Errorf("unknown prev header error %v", err)
+	}
+	//bad proof of work
+	ms := testIndexChain(gb, 1, 0)
+	Index = NewBlockIndex()
+	if _, err := Index.AddHeader(gb.Header()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Index.AddHeader(ms[0].Header()); err == nil {
+		t.Error("bad proof of work header accepted")
+	}
+	//reload from db
+	Index = NewBlockIndex()
+	if err := Index.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if Index.Len() != 1 || Index.BestHeader() == nil || !Index.BestHeader().Hash().Equal(gb.Hash) {
+		t.Error("load block index error")
+	}
+}
+
+func TestIndexLocatorFork(t *testing.T) {
+	UseMemDB()
+	Index = NewBlockIndex()
+	gb := testGenesis(t)
+	testIndexBlock(gb, 0)
+	main := testIndexChain(gb, 100, 0)
+	side := testIndexChain(main[49], 60, 1)
+	tip := Index.BestHeader()
+	if !tip.Hash().Equal(side[59].Hash) || tip.Height != 110 {
+		t.Fatal("best header error")
+	}
+	ids := Index.Locator(Index.Get(main[99].Hash))
+	if len(ids) < 12 || !ids[0].Equal(main[99].Hash) || !ids[9].Equal(main[90].Hash) || !ids[len(ids)-1].Equal(gb.Hash) {
+		t.Errorf("locator error %d", len(ids))
+	}
+	fork := LastCommonAncestor(Index.Get(main[99].Hash), tip)
+	if fork == nil || !fork.Hash().Equal(main[49].Hash) {
+		t.Fatal("fork error")
+	}
+	path := Index.Path(fork, tip)
+	if len(path) != 60 || path[0] != Index.Get(side[0].Hash) || path[59] != tip {
+		t.Fatal("path error")
+	}
+	//failed block and descendants
+	if err := Index.SetStatus(Index.Get(side[10].Hash), IndexStatusFailed); err != nil {
+		t.Fatal(err)
+	}
+	if !Index.Get(side[59].Hash).IsFailed() || Index.Get(side[9].Hash).IsFailed() {
+		t.Error("failed status error")
+	}
+	if !Index.BestHeader().Hash().Equal(main[99].Hash) {
+		t.Error("best header not switch")
+	}
+}
+
+func TestRebuildIndex(t *testing.T) {
+	UseMemDB()
+	Index = NewBlockIndex()
+	gb := testGenesis(t)
+	if err := gb.Save(true); err != nil {
+		t.Fatal(err)
+	}
+	ba := testNewBlock(gb, testCoinbaseTx(1, testP2PKHScript(1)))
+	if err := ba.Save(true); err != nil {
+		t.Fatal(err)
+	}
+	if err := RebuildIndex(1); err != nil {
+		t.Fatal(err)
+	}
+	n := Index.Get(ba.Hash)
+	if n == nil || n.Height != 1 || !n.HasData() || n.Prev() != Index.Get(gb.Hash) {
+		t.Fatal("rebuild index error")
+	}
+	proof := GetBlockProof(gb.Bits)
+	if !n.Work.Equal(proof.Add(proof)) || !IsMainChain(ba.Hash) {
+		t.Error("rebuild index work error")
+	}
+}
+
+func TestHeaderContextCheck(t *testing.T) {
+	defer config.SelectNetwork(config.NET_MAIN)
+	testRegTest(t)
+	_, pks := testP2PKHKey(t)
+	if _, err := GenerateToScript(pks, 3, DEFAULT_MAX_TRIES); err != nil {
+		t.Fatal(err)
+	}
+	prev := Index.Get(G.LastHash())
+	c := testDownloadPeer("1.1.1.1", 0)
+	tests := []struct {
+		ver  uint32
+		time int64
+		err  string
+	}{
+		{BLOCK_VERSION_TOP_BITS, prev.MedianTimePast(), "time-too-old"},
+		{BLOCK_VERSION_TOP_BITS, time.Now().Unix() + MAX_FUTURE_BLOCK_TIME + 600, "time-too-new"},
+		{3, prev.MedianTimePast() + 1, "bad-version"},
+		{BLOCK_VERSION_TOP_BITS, prev.MedianTimePast() + 1, ""},
+	}
+	for i, v := range tests {
+		m, err := NewBlockTemplate(pks)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.Ver = v.ver
+		m.Timestamp = uint32(v.time)
+		if err := MineBlock(m, DEFAULT_MAX_TRIES); err != nil {
+			t.Fatal(err)
+		}
+		err = processHeaders(0, c, &MsgHeaders{Headers: []*BHeader{m.Header()}})
+		n := Index.Get(m.Hash)
+		if v.err == "" {
+			if err != nil || n == nil || n.HasData() {
+				t.Errorf("%d valid header error %v", i, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), v.err) || n != nil {
+			t.Errorf("%d header check error %v", i, err)
+		}
+	}
+}
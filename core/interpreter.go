@@ -0,0 +1,277 @@
+package core
+
+import (
+	"bitcoin/script"
+	"bitcoin/util"
+	"bytes"
+	"fmt"
+)
+
+//generic script verify,scriptSig then scriptPubKey then redeem or witness script
+type scriptVerify struct {
+	baseVerify
+	spent   *spentOutputs
+	sigver  script.SigVersion
+	code    *script.Script //script executing
+	codesep int            //byte position after last OP_CODESEPARATOR
+	scode   *script.Script //script code for current sighash
+	dels    [][]byte       //signatures removed from legacy script code
+	tracer  script.Tracer  //trace steps,nil if not debug
+}
+
+func newScriptVerify(idx int, in *TxIn, out *TxOut, ctx *TX, typ TxType, spent *spentOutputs) *scriptVerify {
+	return &scriptVerify{
+		baseVerify: baseVerify{
+			idx: idx,
+			in:  in,
+			out: out,
+			ctx: ctx,
+			typ: typ,
+		},
+		spent: spent,
+	}
+}
+
+func (vfy *scriptVerify) Packer(sig *script.SigValue) SigPacker {
+	if vfy.sigver == script.SIGVERSION_WITNESS_V0 {
+		return &witnesSigPacker{
+			idx: vfy.idx,
+			in:  vfy.in,
+			out: vfy.out,
+			ctx: vfy.ctx,
+			ht:  uint32(sig.HashType),
+			typ: vfy.typ,
+		}
+	}
+	return &baseSigPacker{
+		idx: vfy.idx,
+		in:  vfy.in,
+		out: vfy.out,
+		ctx: vfy.ctx,
+		ht:  uint32(sig.HashType),
+		typ: vfy.typ,
+	}
+}
+
+func (vfy *scriptVerify) SigScript() *script.Script {
+	return vfy.scode
+}
+
+func (vfy *scriptVerify) SigVersion() script.SigVersion {
+	return vfy.sigver
+}
+
+func (vfy *scriptVerify) SetCodeSeparator(pos int) {
+	vfy.codesep = pos
+}
+
+//script code from last OP_CODESEPARATOR,legacy without signatures of op
+func (vfy *scriptVerify) scriptCode() (*script.Script, int) {
+	code := vfy.code.SubScript(vfy.codesep, vfy.code.Len())
+	if vfy.sigver != script.SIGVERSION_BASE {
+		return code, 0
+	}
+	found := 0
+	for _, sig := range vfy.dels {
+		n := 0
+		code, n = code.FindAndDelete(*script.NewScript([]byte{}).PushBytes(sig))
+		found += n
+	}
+	return code, found
+}
+
+func (vfy *scriptVerify) DeleteSigs(sigs [][]byte) int {
+	vfy.dels = sigs
+	_, found := vfy.scriptCode()
+	return found
+}
+
+func (vfy *scriptVerify) CheckSig(stack *script.Stack, sigv []byte, pubv []byte) error {
+	sig, err := script.NewSigValue(sigv)
+	if err != nil {
+		return err
+	}
+	pub, err := script.NewPublicKey(pubv)
+	if err != nil {
+		return err
+	}
+	vfy.scode, _ = vfy.scriptCode()
+	hash, err := vfy.Packer(sig).Hash(vfy)
+	if err != nil {
+		return fmt.Errorf("packer hash sig data error %w", err)
+	}
+	if !SigCache.Verify(hash, pub, sig, pubv, sigv) {
+		return ErrSigVerify
+	}
+	return nil
+}
+
+//run s with sigver,stack carried between scripts
+func (vfy *scriptVerify) eval(stack *script.Stack, s *script.Script, sigver script.SigVersion, flags int) error {
+	vfy.sigver = sigver
+	vfy.code = s
+	vfy.codesep = 0
+	vfy.dels = nil
+	return s.EvalTrace(stack, vfy, flags, vfy.tracer)
+}
+
+//witness v0 script must left exactly one true element
+func (vfy *scriptVerify) execWitnessScript(stack *script.Stack, s *script.Script, flags int) error {
+	if stack.Count(func(v script.Value) bool { return v.Len() > script.MAX_SCRIPT_ELEMENT_SIZE }) > 0 {
+		return script.SCRIPT_ERR_PUSH_SIZE
+	}
+	if err := vfy.eval(stack, s, script.SIGVERSION_WITNESS_V0, flags); err != nil {
+		return err
+	}
+	if stack.Len() != 1 {
+		return script.SCRIPT_ERR_CLEANSTACK
+	}
+	if !script.StackTopBool(stack, -1) {
+		return script.SCRIPT_ERR_EVAL_FALSE
+	}
+	return nil
+}
+
+func (vfy *scriptVerify) verifyWitnessProgram(ver int, prog []byte, p2sh bool, flags int) error {
+	wits := []*script.Script{}
+	if vfy.in.Witness != nil {
+		wits = vfy.in.Witness.Script
+	}
+	stack := script.NewStack()
+	if ver == 0 {
+		if len(prog) == 32 {
+			//p2wsh,last element is witness script
+			if len(wits) == 0 {
+				return script.SCRIPT_ERR_WITNESS_PROGRAM_WITNESS_EMPTY
+			}
+			ws := wits[len(wits)-1]
+			if !bytes.Equal(util.SHA256(*ws), prog) {
+				return script.SCRIPT_ERR_WITNESS_PROGRAM_MISMATCH
+			}
+			for _, v := range wits[:len(wits)-1] {
+				stack.Push(v.Bytes())
+			}
+			return vfy.execWitnessScript(stack, ws, flags)
+		}
+		if len(prog) == 20 {
+			//p2wpkh,sig and pubkey
+			if len(wits) != 2 {
+				return script.SCRIPT_ERR_WITNESS_PROGRAM_MISMATCH
+			}
+			ws := script.NewScript([]byte{script.OP_DUP, script.OP_HASH160}).PushBytes(prog)
+			ws.PushOp(script.OP_EQUALVERIFY).PushOp(script.OP_CHECKSIG)
+			for _, v := range wits {
+				stack.Push(v.Bytes())
+			}
+			return vfy.execWitnessScript(stack, ws, flags)
+		}
+		return script.SCRIPT_ERR_WITNESS_PROGRAM_WRONG_LENGTH
+	}
+	if ver == 1 && len(prog) == script.WITNESS_V1_TAPROOT_PROGRAM_SIZE && !p2sh && flags&script.SCRIPT_VERIFY_TAPROOT != 0 {
+		return newP2TRVerify(vfy.idx, vfy.in, vfy.out, vfy.ctx, vfy.typ, vfy.spent).Verify(flags)
+	}
+	if flags&script.SCRIPT_VERIFY_DISCOURAGE_UPGRADABLE_WITNESS_PROGRAM != 0 {
+		return script.SCRIPT_ERR_DISCOURAGE_UPGRADABLE_WITNESS_PROGRAM
+	}
+	//upgradable version,anyone can spend
+	return nil
+}
+
+//bitcoin core VerifyScript
+func (vfy *scriptVerify) Verify(flags int) error {
+	sigs := vfy.in.Script
+	if sigs == nil {
+		sigs = script.NewScript([]byte{})
+	}
+	pks := vfy.out.Script
+	if flags&script.SCRIPT_VERIFY_SIGPUSHONLY != 0 && !sigs.IsPushOnly() {
+		return script.WithStage(script.SCRIPT_ERR_SIG_PUSHONLY, script.SCRIPT_STAGE_SIG)
+	}
+	stack := script.NewStack()
+	if err := vfy.eval(stack, sigs, script.SIGVERSION_BASE, flags); err != nil {
+		return script.WithStage(err, script.SCRIPT_STAGE_SIG)
+	}
+	var copys *script.Stack
+	if flags&script.SCRIPT_VERIFY_P2SH != 0 {
+		copys = stack.Clone()
+	}
+	if err := vfy.eval(stack, pks, script.SIGVERSION_BASE, flags); err != nil {
+		return script.WithStage(err, script.SCRIPT_STAGE_PUBKEY)
+	}
+	if !script.StackTopBool(stack, -1) {
+		return script.WithStage(script.SCRIPT_ERR_EVAL_FALSE, script.SCRIPT_STAGE_PUBKEY)
+	}
+	witness := false
+	if flags&script.SCRIPT_VERIFY_WITNESS != 0 {
+		if ver, prog, ok := pks.GetWitnessProgram(); ok {
+			witness = true
+			if sigs.Len() != 0 {
+				return script.SCRIPT_ERR_WITNESS_MALLEATED
+			}
+			if err := vfy.verifyWitnessProgram(ver, prog, false, flags); err != nil {
+				return script.WithStage(err, script.SCRIPT_STAGE_WITNESS)
+			}
+			//bypass cleanstack
+			stack = script.NewStack()
+			stack.Push(script.VsTrue)
+		}
+	}
+	if flags&script.SCRIPT_VERIFY_P2SH != 0 && pks.IsP2SH() {
+		if !sigs.IsPushOnly() {
+			return script.WithStage(script.SCRIPT_ERR_SIG_PUSHONLY, script.SCRIPT_STAGE_SIG)
+		}
+		stack = copys
+		if stack.Empty() {
+			return script.SCRIPT_ERR_EVAL_FALSE
+		}
+		redeem := script.NewScript(stack.Pop())
+		if err := vfy.eval(stack, redeem, script.SIGVERSION_BASE, flags); err != nil {
+			return script.WithStage(err, script.SCRIPT_STAGE_REDEEM)
+		}
+		if !script.StackTopBool(stack, -1) {
+			return script.WithStage(script.SCRIPT_ERR_EVAL_FALSE, script.SCRIPT_STAGE_REDEEM)
+		}
+		if ver, prog, ok := redeem.GetWitnessProgram(); ok && flags&script.SCRIPT_VERIFY_WITNESS != 0 {
+			witness = true
+			//scriptSig must exactly push redeem script
+			if !bytes.Equal(*sigs, *script.NewScript([]byte{}).PushBytes(*redeem)) {
+				return script.SCRIPT_ERR_WITNESS_MALLEATED_P2SH
+			}
+			if err := vfy.verifyWitnessProgram(ver, prog, true, flags); err != nil {
+				return script.WithStage(err, script.SCRIPT_STAGE_WITNESS)
+			}
+			stack = script.NewStack()
+			stack.Push(script.VsTrue)
+		}
+	}
+	if flags&script.SCRIPT_VERIFY_CLEANSTACK != 0 && stack.Len() != 1 {
+		return script.SCRIPT_ERR_CLEANSTACK
+	}
+	if flags&script.SCRIPT_VERIFY_WITNESS != 0 && !witness && vfy.in.Witness != nil && len(vfy.in.Witness.Script) > 0 {
+		return script.SCRIPT_ERR_WITNESS_UNEXPECTED
+	}
+	return nil
+}
+
+//replay in idx scripts,TX_NONSTANDARD dumps debug
+func DebugTxIn(tx *TX, idx int, flags int) (*script.Debugger, error) {
+	if idx < 0 || idx >= len(tx.Ins) {
+		return nil, fmt.Errorf("in %d outbound", idx)
+	}
+	spent := newSpentOutputs(tx)
+	for i, in := range tx.Ins {
+		out, err := in.OutTx()
+		if err != nil {
+			return nil, fmt.Errorf("load ref out error %w", err)
+		}
+		spent.outs[i] = out
+	}
+	in, out := tx.Ins[idx], spent.outs[idx]
+	vfy := newScriptVerify(idx, in, out, tx, CheckTXType(in, out), spent)
+	d := script.NewDebugger()
+	d.Run(func(tr script.Tracer) error {
+		vfy.tracer = tr
+		return vfy.Verify(flags)
+	})
+	return d, nil
+}
@@ -0,0 +1,241 @@
+package core
+
+import (
+	"bitcoin/config"
+	"bitcoin/script"
+	"bitcoin/util"
+	"errors"
+	"testing"
+)
+
+//sign in idx with code as script code
+func testScriptSign(t *testing.T, pk *script.PrivateKey, tx *TX, spent *spentOutputs, idx int, code *script.Script, sigver script.SigVersion) []byte {
+	vfy := newScriptVerify(idx, tx.Ins[idx], spent.outs[idx], tx, TX_NONSTANDARD, spent)
+	vfy.sigver, vfy.scode = sigver, code
+	hash, err := vfy.Packer(&script.SigValue{HashType: script.SIGHASH_ALL}).Hash(vfy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := pk.Sign(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig.HashType = script.SIGHASH_ALL
+	return sig.Encode()
+}
+
+func testP2SHScript(redeem *script.Script) *script.Script {
+	s := script.NewScript([]byte{script.OP_HASH160}).PushBytes(util.HASH160(*redeem))
+	return s.PushOp(script.OP_EQUAL)
+}
+
+func testP2WSHScript(ws *script.Script) *script.Script {
+	return script.NewScript([]byte{script.OP_0}).PushBytes(util.SHA256(*ws))
+}
+
+func TestScriptVerifyP2SHHashLock(t *testing.T) {
+	flags := script.SCRIPT_VERIFY_P2SH | script.SCRIPT_VERIFY_WITNESS
+	pk, _ := testP2PKHKey(t)
+	preimage := []byte("preimage")
+	redeem := script.NewScript([]byte{script.OP_SHA256}).PushBytes(util.SHA256(preimage))
+	redeem.PushOp(script.OP_EQUALVERIFY).PushBytes(pk.PublicKey().Marshal()).PushOp(script.OP_CHECKSIG)
+	out := &TxOut{Value: 5000, Script: testP2SHScript(redeem)}
+	tx, spent := testTaprootTx(out)
+	sig := testScriptSign(t, pk, tx, spent, 0, redeem, script.SIGVERSION_BASE)
+	tx.Ins[0].Script = script.NewScript([]byte{}).PushBytes(sig).PushBytes(preimage).PushBytes(*redeem)
+	if err := testTaprootVerify(tx, spent, 0, flags); err != nil {
+		t.Fatal("hash lock verify error", err)
+	}
+	tx.Ins[0].Script = script.NewScript([]byte{}).PushBytes(sig).PushBytes([]byte("other")).PushBytes(*redeem)
+	if err := testTaprootVerify(tx, spent, 0, flags); err == nil {
+		t.Error("wrong preimage not detected")
+	}
+	tx.Ins[0].Script = script.NewScript([]byte{script.OP_NOP}).PushBytes(sig).PushBytes(preimage).PushBytes(*redeem)
+	if err := testTaprootVerify(tx, spent, 0, flags); !errors.Is(err, script.SCRIPT_ERR_SIG_PUSHONLY) {
+		t.Error("push only not checked", err)
+	}
+}
+
+func TestScriptVerifyP2WSHHTLC(t *testing.T) {
+	flags := script.SCRIPT_VERIFY_P2SH | script.SCRIPT_VERIFY_WITNESS | script.SCRIPT_VERIFY_CHECKLOCKTIMEVERIFY
+	ka, _ := testP2PKHKey(t)
+	kb, _ := testP2PKHKey(t)
+	preimage := []byte("htlc secret")
+	ws := script.NewScript([]byte{script.OP_IF, script.OP_SHA256}).PushBytes(util.SHA256(preimage))
+	ws.PushOp(script.OP_EQUALVERIFY).PushBytes(ka.PublicKey().Marshal())
+	ws.PushOp(script.OP_ELSE).PushInt64(500).PushOp(script.OP_CHECKLOCKTIMEVERIFY).PushOp(script.OP_DROP)
+	ws.PushBytes(kb.PublicKey().Marshal()).PushOp(script.OP_ENDIF).PushOp(script.OP_CHECKSIG)
+	out := &TxOut{Value: 5000, Script: testP2WSHScript(ws)}
+	tx, spent := testTaprootTx(out)
+	//claim with preimage
+	sig := testScriptSign(t, ka, tx, spent, 0, ws, script.SIGVERSION_WITNESS_V0)
+	tx.Ins[0].Witness = testWitness(sig, preimage, []byte{1}, *ws)
+	if err := testTaprootVerify(tx, spent, 0, flags); err != nil {
+		t.Fatal("htlc claim error", err)
+	}
+	//refund after locktime
+	tx.LockTime, tx.Ins[0].Sequence = 500, 0
+	sig = testScriptSign(t, kb, tx, spent, 0, ws, script.SIGVERSION_WITNESS_V0)
+	tx.Ins[0].Witness = testWitness(sig, []byte{}, *ws)
+	if err := testTaprootVerify(tx, spent, 0, flags); err != nil {
+		t.Fatal("htlc refund error", err)
+	}
+	tx.LockTime = 499
+	if err := testTaprootVerify(tx, spent, 0, flags); err == nil {
+		t.Error("refund before locktime not detected")
+	}
+	tx.Ins[0].Witness = testWitness(sig, []byte{}, []byte{script.OP_1})
+	if err := testTaprootVerify(tx, spent, 0, flags); !errors.Is(err, script.SCRIPT_ERR_WITNESS_PROGRAM_MISMATCH) {
+		t.Error("witness script mismatch not detected", err)
+	}
+	tx.Ins[0].Script = script.NewScript([]byte{script.OP_1})
+	if err := testTaprootVerify(tx, spent, 0, flags); !errors.Is(err, script.SCRIPT_ERR_WITNESS_MALLEATED) {
+		t.Error("witness malleated not detected", err)
+	}
+}
+
+func TestScriptVerifyP2WPKH(t *testing.T) {
+	flags := script.SCRIPT_VERIFY_P2SH | script.SCRIPT_VERIFY_WITNESS
+	pk, pks := testP2PKHKey(t)
+	pub := pk.PublicKey().Marshal()
+	wpkh := script.NewScript([]byte{script.OP_0}).PushBytes(util.HASH160(pub))
+	out1 := &TxOut{Value: 5000, Script: wpkh}
+	out2 := &TxOut{Value: 6000, Script: testP2SHScript(wpkh)}
+	tx, spent := testTaprootTx(out1, out2)
+	tx.Ins[0].Witness = testWitness(testScriptSign(t, pk, tx, spent, 0, pks, script.SIGVERSION_WITNESS_V0), pub)
+	tx.Ins[1].Witness = testWitness(testScriptSign(t, pk, tx, spent, 1, pks, script.SIGVERSION_WITNESS_V0), pub)
+	tx.Ins[1].Script = script.NewScript([]byte{}).PushBytes(*wpkh)
+	for idx := range tx.Ins {
+		if err := testTaprootVerify(tx, spent, idx, flags); err != nil {
+			t.Error("p2wpkh verify error", idx, err)
+		}
+	}
+	//amount committed
+	spent.outs[0] = &TxOut{Value: 5001, Script: wpkh}
+	if err := testTaprootVerify(tx, spent, 0, flags); !errors.Is(err, script.SCRIPT_ERR_EVAL_FALSE) {
+		t.Error("amount change not detected", err)
+	}
+	tx.Ins[1].Script = script.NewScript([]byte{script.OP_0}).PushBytes(*wpkh)
+	if err := testTaprootVerify(tx, spent, 1, flags); !errors.Is(err, script.SCRIPT_ERR_WITNESS_MALLEATED_P2SH) {
+		t.Error("p2sh witness malleated not detected", err)
+	}
+}
+
+func TestScriptVerifyWitnessPubKeyType(t *testing.T) {
+	flags := script.SCRIPT_VERIFY_P2SH | script.SCRIPT_VERIFY_WITNESS
+	pk, _ := testP2PKHKey(t)
+	pub := pk.PublicKey().Compressed(false).Marshal()
+	for len(pub) != 65 {
+		pk, _ = testP2PKHKey(t)
+		pub = pk.PublicKey().Compressed(false).Marshal()
+	}
+	ws := script.NewScript([]byte{}).PushBytes(pub).PushOp(script.OP_CHECKSIG)
+	tx, spent := testTaprootTx(&TxOut{Value: 5000, Script: testP2WSHScript(ws)}, &TxOut{Value: 6000, Script: ws})
+	tx.Ins[0].Witness = testWitness(testScriptSign(t, pk, tx, spent, 0, ws, script.SIGVERSION_WITNESS_V0), *ws)
+	tx.Ins[1].Script = script.NewScript([]byte{}).PushBytes(testScriptSign(t, pk, tx, spent, 1, ws, script.SIGVERSION_BASE))
+	if err := testTaprootVerify(tx, spent, 0, flags); err != nil {
+		t.Fatal("uncompressed witness key without flag error", err)
+	}
+	flags |= script.SCRIPT_VERIFY_WITNESS_PUBKEYTYPE
+	err := testTaprootVerify(tx, spent, 0, flags)
+	se := &script.ScriptError{}
+	if !errors.Is(err, script.SCRIPT_ERR_WITNESS_PUBKEYTYPE) || !errors.As(err, &se) || se.Stage != script.SCRIPT_STAGE_WITNESS {
+		t.Error("uncompressed witness key not detected", err)
+	}
+	//legacy script not restricted
+	if err := testTaprootVerify(tx, spent, 1, flags); err != nil {
+		t.Error("uncompressed legacy key error", err)
+	}
+}
+
+//bare scripts not matched any template
+func TestScriptVerifyNonStandard(t *testing.T) {
+	out := &TxOut{Value: 5000, Script: script.NewScript([]byte{script.OP_2, script.OP_EQUAL})}
+	tx, spent := testTaprootTx(out)
+	if typ := CheckTXType(tx.Ins[0], out); typ != TX_NONSTANDARD {
+		t.Fatal("type error", typ)
+	}
+	tx.Ins[0].Script = script.NewScript([]byte{script.OP_2})
+	if err := testTaprootVerify(tx, spent, 0, 0); err != nil {
+		t.Error("nonstandard verify error", err)
+	}
+	tx.Ins[0].Script = script.NewScript([]byte{script.OP_3})
+	if err := testTaprootVerify(tx, spent, 0, 0); !errors.Is(err, script.SCRIPT_ERR_EVAL_FALSE) {
+		t.Error("nonstandard false not detected", err)
+	}
+	tx.Ins[0].Script = script.NewScript([]byte{script.OP_2, script.OP_2})
+	if err := testTaprootVerify(tx, spent, 0, script.SCRIPT_VERIFY_P2SH|script.SCRIPT_VERIFY_CLEANSTACK); !errors.Is(err, script.SCRIPT_ERR_CLEANSTACK) {
+		t.Error("cleanstack not detected", err)
+	}
+	tx.Ins[0].Script = script.NewScript([]byte{script.OP_2})
+	tx.Ins[0].Witness = testWitness([]byte{1})
+	if err := testTaprootVerify(tx, spent, 0, script.SCRIPT_VERIFY_P2SH|script.SCRIPT_VERIFY_WITNESS); !errors.Is(err, script.SCRIPT_ERR_WITNESS_UNEXPECTED) {
+		t.Error("unexpected witness not detected", err)
+	}
+}
+
+func TestDebugTxIn(t *testing.T) {
+	redeem := script.NewScript([]byte{script.OP_SHA256}).PushBytes(util.SHA256([]byte("secret"))).PushOp(script.OP_EQUALVERIFY).PushOp(script.OP_1)
+	prev := &TX{Ver: 1, Hash: HashID{9}, Outs: []*TxOut{{Value: 5000, Script: testP2SHScript(redeem)}}}
+	tx := &TX{Ver: 1}
+	in := &TxIn{OutHash: prev.Hash, Sequence: script.SEQUENCE_FINAL}
+	in.Script = script.NewScript([]byte{}).PushBytes([]byte("other")).PushBytes(*redeem)
+	tx.Ins = []*TxIn{in}
+	tx.Outs = []*TxOut{{Value: 1000, Script: redeem}}
+	Txs.Push(&testCoreCacher{txs: map[HashID]*TX{prev.Hash: prev}})
+	defer Txs.Pop()
+	d, err := DebugTxIn(tx, 0, script.SCRIPT_VERIFY_P2SH)
+	if err != nil {
+		t.Fatal(err)
+	}
+	se := &script.ScriptError{}
+	if !errors.Is(d.Err(), script.SCRIPT_ERR_EQUALVERIFY) || !errors.As(d.Err(), &se) || se.Stage != script.SCRIPT_STAGE_REDEEM {
+		t.Fatal("debug error", d.Err())
+	}
+	//scriptSig,scriptPubKey then redeem steps
+	if st := d.Failed(); st == nil || st.Op != script.OP_EQUALVERIFY || st.Script.Len() != redeem.Len() || len(d.Steps()) != 2+3+3 {
+		t.Error("failed step error", st, len(d.Steps()))
+	}
+}
+
+func TestScriptErrorIndex(t *testing.T) {
+	defer config.SelectNetwork(config.NET_MAIN)
+	testRegTest(t)
+	_, pks := testP2PKHKey(t)
+	ids, err := GenerateToScript(pks, COINBASE_MATURITY+1, DEFAULT_MAX_TRIES)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b1, err := LoadBlock(ids[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := &TxIn{OutHash: b1.Txs[0].Hash, Script: script.NewScript([]byte{script.OP_1, script.OP_1}), Sequence: script.SEQUENCE_FINAL}
+	tx := &TX{Ver: 2, Ins: []*TxIn{in}, Outs: []*TxOut{{Value: 1000, Script: pks}}}
+	tx.Write(NewNetHeader())
+	check := func(name string, err error, pos int) {
+		se := &script.ScriptError{}
+		if !errors.As(err, &se) || !errors.Is(err, script.SCRIPT_ERR_EQUALVERIFY) {
+			t.Fatal(name, "script error type error", err)
+		}
+		if se.Index != 0 || se.Op != script.OP_EQUALVERIFY || se.Pos != pos || se.Stage != script.SCRIPT_STAGE_PUBKEY {
+			t.Error(name, "script error position error", se)
+		}
+	}
+	check("verify tx", VerifyTX(tx, script.SCRIPT_VERIFY_P2SH), 23)
+	m, err := NewBlockTemplate(pks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Txs = append(m.Txs, tx)
+	addWitnessCommitment(m.Txs[0], m.Txs)
+	check("block check", testRemineBlock(t, m).Check(), 23)
+	//error after eval,no op position
+	out := &TxOut{Value: 5000, Script: script.NewScript([]byte{script.OP_0})}
+	tx2, spent := testTaprootTx(out, out)
+	err = testTaprootVerify(tx2, spent, 1, 0)
+	se := &script.ScriptError{}
+	if !errors.As(err, &se) || se.Code != script.SCRIPT_ERR_EVAL_FALSE || se.Index != 1 || se.Pos != -1 || se.Stage != script.SCRIPT_STAGE_PUBKEY {
+		t.Error("eval false error", err)
+	}
+}
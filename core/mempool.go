@@ -1,15 +1,62 @@
 package core
 
-import "sync"
+import (
+	"bitcoin/config"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	ErrTxExists          = errors.New("txn-already-in-mempool")
+	ErrTxInChain         = errors.New("txn-already-known")
+	ErrTxConflict        = errors.New("txn-mempool-conflict")
+	ErrTxCoinBase        = errors.New("coinbase")
+	ErrTxNotFinal        = errors.New("non-final")
+	ErrTxNonBIP68Final   = errors.New("non-BIP68-final")
+	ErrTxPremature       = errors.New("bad-txns-premature-spend-of-coinbase")
+	ErrTxInsufficientFee = errors.New("min relay fee not met")
+	ErrTxTooLongChain    = errors.New("too-long-mempool-chain")
+	ErrMempoolFull       = errors.New("mempool full")
+	ErrTxReplace         = errors.New("txn-mempool-replace")
+)
+
+//mempool tx entry
+type TxEntry struct {
+	Tx       *TX
+	WTxID    HashID //witness hash for compact block
+	Fee      Amount
+	VSize    int
+	SigOps   int64 //bip141 sigop cost
+	Time     time.Time
+	Height   uint32 //best height when accept
+	parents  map[HashID]*TxEntry
+	children map[HashID]*TxEntry
+}
+
+//fee satoshi per 1000 vbytes
+func (e *TxEntry) FeeRate() Amount {
+	return e.Fee * 1000 / Amount(e.VSize)
+}
+
+//fee rate a/as < b/bs
+func feeRateLess(a Amount, as int, b Amount, bs int) bool {
+	return int64(a)*int64(bs) < int64(b)*int64(as)
+}
 
 type TxMap struct {
-	mu  sync.RWMutex
-	txs map[HashID]*TX
+	mu    sync.RWMutex
+	txs   map[HashID]*TxEntry
+	spent map[TCoinKey]*TxEntry //out spent by mempool tx
+	size  int                   //all entry vsize
 }
 
 func NewTxMap() *TxMap {
 	return &TxMap{
-		txs: map[HashID]*TX{},
+		txs:   map[HashID]*TxEntry{},
+		spent: map[TCoinKey]*TxEntry{},
 	}
 }
 
@@ -24,17 +71,52 @@ func (m *TxMap) Has(id HashID) bool {
 	return ok
 }
 
-func (m *TxMap) Del(id HashID) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	delete(m.txs, id)
+func (m *TxMap) Get(id HashID) (*TX, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	e, ok := m.txs[id]
+	if !ok {
+		return nil, false
+	}
+	return e.Tx, true
+}
+
+func (m *TxMap) Entry(id HashID) *TxEntry {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.txs[id]
+}
+
+func (m *TxMap) Iter(f func(e *TxEntry)) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, v := range m.txs {
+		f(v)
+	}
+}
+
+//out spent by mempool tx
+func (m *TxMap) IsSpent(id HashID, idx uint32) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, ok := m.spent[NewTCoinKey(id, idx)]
+	return ok
+}
+
+//all tx vsize
+func (m *TxMap) Bytes() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.size
 }
 
-func (m *TxMap) Set(tx *TX) int {
+//remove tx and descendants
+func (m *TxMap) Del(id HashID) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	m.txs[tx.Hash] = tx
-	return len(m.txs)
+	if e, ok := m.txs[id]; ok {
+		m.removeRecursive(e)
+	}
 }
 
 func (m *TxMap) Len() int {
@@ -42,3 +124,404 @@ func (m *TxMap) Len() int {
 	defer m.mu.RUnlock()
 	return len(m.txs)
 }
+
+//entries order by fee rate desc
+func (m *TxMap) Sorted() []*TxEntry {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.sorted()
+}
+
+func (m *TxMap) sorted() []*TxEntry {
+	es := []*TxEntry{}
+	for _, v := range m.txs {
+		es = append(es, v)
+	}
+	sort.Slice(es, func(i, j int) bool {
+		a, b := es[i], es[j]
+		if feeRateLess(b.Fee, b.VSize, a.Fee, a.VSize) {
+			return true
+		}
+		if feeRateLess(a.Fee, a.VSize, b.Fee, b.VSize) {
+			return false
+		}
+		return a.Time.Before(b.Time)
+	})
+	return es
+}
+
+//in mempool parents,parents first
+func (m *TxMap) Ancestors(id HashID) []*TxEntry {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	e, ok := m.txs[id]
+	if !ok {
+		return nil
+	}
+	return m.sortEntries(m.ancestors(e))
+}
+
+//in mempool children,parents first
+func (m *TxMap) Descendants(id HashID) []*TxEntry {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	e, ok := m.txs[id]
+	if !ok {
+		return nil
+	}
+	return m.sortEntries(m.descendants(e))
+}
+
+func (m *TxMap) sortEntries(es map[HashID]*TxEntry) []*TxEntry {
+	ds := []*TxEntry{}
+	for _, v := range es {
+		ds = append(ds, v)
+	}
+	sort.Slice(ds, func(i, j int) bool {
+		return len(m.ancestors(ds[i])) < len(m.ancestors(ds[j]))
+	})
+	return ds
+}
+
+func (m *TxMap) ancestors(e *TxEntry) map[HashID]*TxEntry {
+	as := map[HashID]*TxEntry{}
+	stack := []*TxEntry{e}
+	for len(stack) > 0 {
+		v := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for id, p := range v.parents {
+			if _, ok := as[id]; !ok {
+				as[id] = p
+				stack = append(stack, p)
+			}
+		}
+	}
+	return as
+}
+
+func (m *TxMap) descendants(e *TxEntry) map[HashID]*TxEntry {
+	ds := map[HashID]*TxEntry{}
+	stack := []*TxEntry{e}
+	for len(stack) > 0 {
+		v := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for id, c := range v.children {
+			if _, ok := ds[id]; !ok {
+				ds[id] = c
+				stack = append(stack, c)
+			}
+		}
+	}
+	return ds
+}
+
+func (m *TxMap) add(e *TxEntry) {
+	id := e.Tx.Hash
+	m.txs[id] = e
+	for _, in := range e.Tx.Ins {
+		m.spent[NewTCoinKey(in.OutHash, in.OutIndex)] = e
+	}
+	for _, p := range e.parents {
+		p.children[id] = e
+	}
+	m.size += e.VSize
+}
+
+//remove entry only,children parent link removed
+func (m *TxMap) remove(e *TxEntry) {
+	id := e.Tx.Hash
+	if _, ok := m.txs[id]; !ok {
+		return
+	}
+	delete(m.txs, id)
+	for _, in := range e.Tx.Ins {
+		ckey := NewTCoinKey(in.OutHash, in.OutIndex)
+		if m.spent[ckey] == e {
+			delete(m.spent, ckey)
+		}
+	}
+	for _, p := range e.parents {
+		delete(p.children, id)
+	}
+	for _, c := range e.children {
+		delete(c.parents, id)
+	}
+	m.size -= e.VSize
+}
+
+func (m *TxMap) removeRecursive(e *TxEntry) {
+	for _, v := range m.descendants(e) {
+		m.remove(v)
+	}
+	m.remove(e)
+}
+
+//check ancestors and descendants count and size limit
+func (m *TxMap) checkLimits(e *TxEntry) error {
+	as := m.ancestors(e)
+	if len(as)+1 > DEFAULT_ANCESTOR_LIMIT {
+		return fmt.Errorf("%w too many unconfirmed parents", ErrTxTooLongChain)
+	}
+	size := e.VSize
+	for _, a := range as {
+		size += a.VSize
+	}
+	if size > DEFAULT_ANCESTOR_SIZE_LIMIT {
+		return fmt.Errorf("%w exceeds ancestor size limit", ErrTxTooLongChain)
+	}
+	for _, a := range as {
+		ds := m.descendants(a)
+		size := a.VSize + e.VSize
+		for _, d := range ds {
+			size += d.VSize
+		}
+		if len(ds)+2 > DEFAULT_DESCENDANT_LIMIT || size > DEFAULT_DESCENDANT_SIZE_LIMIT {
+			return fmt.Errorf("%w exceeds descendant limit", ErrTxTooLongChain)
+		}
+	}
+	return nil
+}
+
+//entry with descendants fee and vsize
+func (m *TxMap) packageFee(e *TxEntry) (Amount, int) {
+	fee, size := e.Fee, e.VSize
+	for _, d := range m.descendants(e) {
+		fee += d.Fee
+		size += d.VSize
+	}
+	return fee, size
+}
+
+//evict lowest fee rate entries with descendants when over size
+func (m *TxMap) trim(max int) {
+	for m.size > max && len(m.txs) > 0 {
+		var low *TxEntry
+		lfee, lsize := Amount(0), 0
+		for _, v := range m.txs {
+			//score max(fee rate,package fee rate)
+			fee, size := m.packageFee(v)
+			if feeRateLess(fee, size, v.Fee, v.VSize) {
+				fee, size = v.Fee, v.VSize
+			}
+			if low == nil || feeRateLess(fee, size, lfee, lsize) {
+				low, lfee, lsize = v, fee, size
+			}
+		}
+		m.removeRecursive(low)
+	}
+}
+
+//tx or unconfirmed ancestors signal bip125
+func (m *TxMap) isReplaceable(e *TxEntry) bool {
+	if SignalsOptInRBF(e.Tx) {
+		return true
+	}
+	for _, a := range m.ancestors(e) {
+		if SignalsOptInRBF(a.Tx) {
+			return true
+		}
+	}
+	return false
+}
+
+//check bip125 rules,return entries replaced by e
+func (m *TxMap) checkReplace(e *TxEntry, conflicts map[HashID]*TxEntry) (map[HashID]*TxEntry, error) {
+	evict := map[HashID]*TxEntry{}
+	if len(conflicts) == 0 {
+		return evict, nil
+	}
+	//conflicts unconfirmed parents
+	cparents := map[HashID]bool{}
+	for id, c := range conflicts {
+		if !m.isReplaceable(c) {
+			return nil, fmt.Errorf("%w %v not replaceable", ErrTxConflict, id)
+		}
+		//new fee rate must higher than direct conflicts
+		if !feeRateLess(c.Fee, c.VSize, e.Fee, e.VSize) {
+			return nil, fmt.Errorf("%w fee rate not higher than %v", ErrTxInsufficientFee, id)
+		}
+		for pid := range c.parents {
+			cparents[pid] = true
+		}
+		evict[id] = c
+		for did, d := range m.descendants(c) {
+			evict[did] = d
+		}
+	}
+	if len(evict) > MAX_BIP125_REPLACEMENT_CANDIDATES {
+		return nil, fmt.Errorf("%w too many potential replacements %d", ErrTxReplace, len(evict))
+	}
+	for pid := range e.parents {
+		if _, ok := evict[pid]; ok {
+			return nil, fmt.Errorf("%w spends conflicting tx %v", ErrTxReplace, pid)
+		}
+		if !cparents[pid] {
+			return nil, fmt.Errorf("%w adds unconfirmed input %v", ErrTxReplace, pid)
+		}
+	}
+	fee := Amount(0)
+	for _, v := range evict {
+		fee += v.Fee
+	}
+	if e.Fee < fee {
+		return nil, fmt.Errorf("%w less fee than replaced %d < %d", ErrTxInsufficientFee, e.Fee, fee)
+	}
+	if min := GetFeeForSize(DEFAULT_INCREMENTAL_RELAY_FEE, e.VSize); e.Fee-fee < min {
+		return nil, fmt.Errorf("%w not pay for relay bandwidth %d < %d", ErrTxInsufficientFee, e.Fee-fee, min)
+	}
+	return evict, nil
+}
+
+//verify tx and add to mempool
+func (m *TxMap) AcceptTx(tx *TX) (*TxEntry, error) {
+	if tx.IsCoinBase() {
+		return nil, ErrTxCoinBase
+	}
+	if err := tx.Check(); err != nil {
+		return nil, err
+	}
+	if err := IsStandardTx(tx); err != nil {
+		return nil, err
+	}
+	conf := config.GetConfig()
+	G.Lock()
+	defer G.Unlock()
+	best := G.LastBlock()
+	if best == nil {
+		return nil, errors.New("mempool miss best block")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.txs[tx.Hash]; ok {
+		return nil, ErrTxExists
+	}
+	if HasTx(tx.Hash) {
+		return nil, ErrTxInChain
+	}
+	tip := Index.Get(best.Hash)
+	if tip == nil {
+		return nil, ErrPrevHeaderNotFound
+	}
+	height := best.Height + 1
+	//bip113 next block lock time cutoff
+	mtp := tip.MedianTimePast()
+	if !tx.IsFinal(int64(height), mtp) {
+		return nil, ErrTxNotFinal
+	}
+	e := &TxEntry{
+		Tx:       tx,
+		WTxID:    tx.WitnessHash(),
+		VSize:    tx.VirtualSize(),
+		Time:     time.Now(),
+		Height:   best.Height,
+		parents:  map[HashID]*TxEntry{},
+		children: map[HashID]*TxEntry{},
+	}
+	//mempool txs spent same outs
+	conflicts := map[HashID]*TxEntry{}
+	//unconfirmed parents in cache,other outs from utxo set
+	Txs.Push()
+	defer Txs.Pop()
+	//ins coin height,unconfirmed parents at next block
+	heights := make([]uint32, len(tx.Ins))
+	for idx, in := range tx.Ins {
+		ckey := NewTCoinKey(in.OutHash, in.OutIndex)
+		if c, ok := m.spent[ckey]; ok {
+			conflicts[c.Tx.Hash] = c
+		}
+		if p, ok := m.txs[in.OutHash]; ok {
+			if int(in.OutIndex) >= len(p.Tx.Outs) {
+				return nil, fmt.Errorf("in %d out index outbound parent outs", idx)
+			}
+			e.parents[in.OutHash] = p
+			Txs.Set(p.Tx)
+			heights[idx] = height
+			continue
+		}
+		coin, err := LoadCoin(in.OutHash, in.OutIndex)
+		if err != nil {
+			return nil, fmt.Errorf("in %d missing inputs %v[%d] %w", idx, in.OutHash, in.OutIndex, err)
+		}
+		if !coin.IsMature(height) {
+			return nil, fmt.Errorf("in %d %w", idx, ErrTxPremature)
+		}
+		heights[idx] = coin.Height
+	}
+	if !tx.CalculateSequenceLocks(heights, tip).Evaluate(height, mtp) {
+		return nil, ErrTxNonBIP68Final
+	}
+	if err := AreInputsStandard(tx); err != nil {
+		return nil, err
+	}
+	fee, err := tx.GetFee()
+	if err != nil {
+		return nil, err
+	}
+	e.Fee = fee
+	flags := best.GetScriptFlags() | STANDARD_SCRIPT_VERIFY_FLAGS
+	if e.SigOps, err = tx.GetSigOpCost(flags); err != nil {
+		return nil, err
+	}
+	if min := GetFeeForSize(conf.MinRelayTxFee, e.VSize); fee < min {
+		return nil, fmt.Errorf("%w fee %d < %d", ErrTxInsufficientFee, fee, min)
+	}
+	evict, err := m.checkReplace(e, conflicts)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.checkLimits(e); err != nil {
+		return nil, err
+	}
+	if err := VerifyTX(tx, flags); err != nil {
+		return nil, err
+	}
+	//consensus flags result cached for block connect
+	if err := VerifyTX(tx, best.GetScriptFlags()); err != nil {
+		return nil, err
+	}
+	for _, v := range evict {
+		m.remove(v)
+	}
+	m.add(e)
+	m.trim(conf.MaxMempool)
+	if _, ok := m.txs[tx.Hash]; !ok {
+		return nil, ErrMempoolFull
+	}
+	return e, nil
+}
+
+//remove block txs and conflicts from mempool
+func (m *TxMap) RemoveForBlock(b *MsgBlock) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, tx := range b.Txs {
+		if e, ok := m.txs[tx.Hash]; ok {
+			m.remove(e)
+		}
+		if tx.IsCoinBase() {
+			continue
+		}
+		for _, in := range tx.Ins {
+			if e, ok := m.spent[NewTCoinKey(in.OutHash, in.OutIndex)]; ok {
+				m.removeRecursive(e)
+			}
+		}
+	}
+}
+
+//remove entries spent outs not in utxo set,after reorg
+func (m *TxMap) RemoveForReorg() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, e := range m.txs {
+		for _, in := range e.Tx.Ins {
+			if _, ok := e.parents[in.OutHash]; ok {
+				continue
+			}
+			if !HasCoin(in.OutHash, in.OutIndex) {
+				m.removeRecursive(e)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,299 @@
+package core
+
+import (
+	"bitcoin/config"
+	"bitcoin/script"
+	"bitcoin/util"
+	"errors"
+	"math/big"
+	"testing"
+)
+
+//p2pkh private key and out script
+func testP2PKHKey(t *testing.T) (*script.PrivateKey, *script.Script) {
+	for {
+		pk, err := script.NewPrivateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		pub := pk.PublicKey().Marshal()
+		if len(pub) != 33 {
+			continue
+		}
+		s := script.NewScript([]byte{})
+		s.PushOp(script.OP_DUP).PushOp(script.OP_HASH160).PushBytes(util.HASH160(pub))
+		s.PushOp(script.OP_EQUALVERIFY).PushOp(script.OP_CHECKSIG)
+		return pk, s
+	}
+}
+
+//mempool with genesis best block
+func testMempool(t *testing.T) {
+	UseMemDB()
+	Index = NewBlockIndex()
+	TxsMap = NewTxMap()
+	gb := testGenesis(t)
+	if err := gb.Save(true); err != nil {
+		t.Fatal(err)
+	}
+	testIndexBlock(gb, IndexStatusData)
+	G.SetBestBlock(gb)
+}
+
+//add utxo to db
+func testAddCoin(t *testing.T, id HashID, value uint64, pks *script.Script) *TxIn {
+	coin := NewTCoin(&TxOut{Value: value, Script: pks}, 0, false)
+	ckey := NewTCoinKey(id, 0)
+	if err := Store().Put(ckey[:], coin.Bytes(), nil); err != nil {
+		t.Fatal(err)
+	}
+	return &TxIn{OutHash: id, OutIndex: 0, Sequence: script.SEQUENCE_FINAL}
+}
+
+//create p2pkh signed tx
+func testSignTx(t *testing.T, pk *script.PrivateKey, pks *script.Script, ins []*TxIn, values ...uint64) *TX {
+	tx := &TX{Ver: 1, Ins: ins}
+	for _, v := range values {
+		tx.Outs = append(tx.Outs, &TxOut{Value: v, Script: pks})
+	}
+	for idx, in := range tx.Ins {
+		vfy := newScriptVerify(idx, in, &TxOut{Script: pks}, tx, TX_P2PKH, nil)
+		vfy.scode = pks
+		hash, err := vfy.Packer(&script.SigValue{HashType: script.SIGHASH_ALL}).Hash(vfy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig, err := pk.Sign(hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig.HashType = script.SIGHASH_ALL
+		in.Script = script.NewScript([]byte{}).PushBytes(sig.Encode()).PushBytes(pk.PublicKey().Marshal())
+	}
+	tx.Write(NewNetHeader())
+	return tx
+}
+
+func TestDustThreshold(t *testing.T) {
+	out := &TxOut{Value: 546, Script: testP2PKHScript(1)}
+	if GetDustThreshold(out) != 546 || IsDust(out) {
+		t.Error("p2pkh dust threshold error")
+	}
+	if !IsStandardScript(script.NewScript([]byte{script.OP_RETURN, 1, 1})) {
+		t.Error("null data standard error")
+	}
+	if IsStandardScript(script.NewScript([]byte{script.OP_1})) {
+		t.Error("nonstandard script error")
+	}
+}
+
+func TestMempoolAccept(t *testing.T) {
+	testMempool(t)
+	pk, pks := testP2PKHKey(t)
+	ina := testAddCoin(t, HashID{1}, uint64(COIN), pks)
+	tx1 := testSignTx(t, pk, pks, []*TxIn{ina}, uint64(COIN)-100000)
+	if _, err := TxsMap.AcceptTx(tx1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := TxsMap.AcceptTx(tx1); !errors.Is(err, ErrTxExists) {
+		t.Error("tx exists error", err)
+	}
+	//unconfirmed parent
+	tx2 := testSignTx(t, pk, pks, []*TxIn{{OutHash: tx1.Hash, Sequence: script.SEQUENCE_FINAL}}, uint64(COIN)-200000)
+	e2, err := TxsMap.AcceptTx(tx2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e2.Fee != 100000 || TxsMap.Bytes() != tx1.VirtualSize()+tx2.VirtualSize() {
+		t.Error("entry fee or size error")
+	}
+	if as := TxsMap.Ancestors(tx2.Hash); len(as) != 1 || !as[0].Tx.Hash.Equal(tx1.Hash) {
+		t.Error("ancestors error")
+	}
+	if ds := TxsMap.Descendants(tx1.Hash); len(ds) != 1 || !ds[0].Tx.Hash.Equal(tx2.Hash) {
+		t.Error("descendants error")
+	}
+	//double spend mempool tx out
+	tx3 := testSignTx(t, pk, pks, []*TxIn{{OutHash: HashID{1}, Sequence: script.SEQUENCE_FINAL}}, uint64(COIN)-300000)
+	if _, err := TxsMap.AcceptTx(tx3); !errors.Is(err, ErrTxConflict) {
+		t.Error("conflict error", err)
+	}
+	tx4 := testSignTx(t, pk, pks, []*TxIn{{OutHash: HashID{9}, Sequence: script.SEQUENCE_FINAL}}, 100000)
+	if _, err := TxsMap.AcceptTx(tx4); !errors.Is(err, ErrCoinNotFound) {
+		t.Error("missing inputs error", err)
+	}
+	inb := testAddCoin(t, HashID{2}, uint64(COIN), pks)
+	tx5 := testSignTx(t, pk, pks, []*TxIn{inb}, uint64(COIN))
+	if _, err := TxsMap.AcceptTx(tx5); !errors.Is(err, ErrTxInsufficientFee) {
+		t.Error("min relay fee error", err)
+	}
+	tx6 := testSignTx(t, pk, pks, []*TxIn{inb}, uint64(COIN)-100000, 100)
+	if _, err := TxsMap.AcceptTx(tx6); !errors.Is(err, ErrTxDust) {
+		t.Error("dust error", err)
+	}
+	//bad signature
+	tx7 := testSignTx(t, pk, pks, []*TxIn{inb}, uint64(COIN)-100000)
+	tx7.Outs[0].Value--
+	tx7.Write(NewNetHeader())
+	if _, err := TxsMap.AcceptTx(tx7); err == nil {
+		t.Error("bad signature accepted")
+	}
+	TxsMap.Del(tx1.Hash)
+	if TxsMap.Len() != 0 || TxsMap.Bytes() != 0 || TxsMap.IsSpent(HashID{1}, 0) {
+		t.Error("remove with descendants error")
+	}
+}
+
+func TestMempoolPolicyFlags(t *testing.T) {
+	testMempool(t)
+	pk, pks := testP2PKHKey(t)
+	flags := G.LastBlock().GetScriptFlags()
+	//extra stack item left,consensus valid
+	ina := testAddCoin(t, HashID{1}, uint64(COIN), pks)
+	tx1 := testSignTx(t, pk, pks, []*TxIn{ina}, uint64(COIN)-100000)
+	tx1.Ins[0].Script = script.NewScript([]byte{script.OP_1}).Concat(tx1.Ins[0].Script)
+	tx1.Write(NewNetHeader())
+	if err := VerifyTX(tx1, flags); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := TxsMap.AcceptTx(tx1); !errors.Is(err, script.SCRIPT_ERR_CLEANSTACK) {
+		t.Error("cleanstack policy error", err)
+	}
+	//high s signature,consensus valid
+	inb := testAddCoin(t, HashID{2}, uint64(COIN), pks)
+	tx2 := testSignTx(t, pk, pks, []*TxIn{inb}, uint64(COIN)-100000)
+	_, _, _, sigv := tx2.Ins[0].Script.GetOp(0)
+	sig, err := script.NewSigValue(sigv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig.S = new(big.Int).Sub(util.SECP256K1().Params().N, sig.S)
+	tx2.Ins[0].Script = script.NewScript([]byte{}).PushBytes(sig.Encode()).PushBytes(pk.PublicKey().Marshal())
+	tx2.Write(NewNetHeader())
+	if err := VerifyTX(tx2, flags); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := TxsMap.AcceptTx(tx2); !errors.Is(err, script.SCRIPT_ERR_SIG_HIGH_S) {
+		t.Error("low s policy error", err)
+	}
+	if TxsMap.Len() != 0 {
+		t.Error("nonstandard script tx accepted")
+	}
+}
+
+func TestMempoolEvict(t *testing.T) {
+	testMempool(t)
+	conf := config.GetConfig()
+	omax := conf.MaxMempool
+	defer func() {
+		conf.MaxMempool = omax
+	}()
+	pk, pks := testP2PKHKey(t)
+	txs := []*TX{}
+	for i, fee := range []uint64{300000, 100000, 200000} {
+		in := testAddCoin(t, HashID{byte(i + 1)}, uint64(COIN), pks)
+		txs = append(txs, testSignTx(t, pk, pks, []*TxIn{in}, uint64(COIN)-fee))
+	}
+	for _, tx := range txs[:2] {
+		if _, err := TxsMap.AcceptTx(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if es := TxsMap.Sorted(); !es[0].Tx.Hash.Equal(txs[0].Hash) {
+		t.Error("fee rate order error")
+	}
+	//vsize differ by signature length
+	conf.MaxMempool = TxsMap.Bytes() + 4
+	if _, err := TxsMap.AcceptTx(txs[2]); err != nil {
+		t.Fatal(err)
+	}
+	if TxsMap.Len() != 2 || TxsMap.Has(txs[1].Hash) {
+		t.Error("lowest fee rate not evict")
+	}
+	in := testAddCoin(t, HashID{9}, uint64(COIN), pks)
+	low := testSignTx(t, pk, pks, []*TxIn{in}, uint64(COIN)-1000)
+	if _, err := TxsMap.AcceptTx(low); !errors.Is(err, ErrMempoolFull) {
+		t.Error("mempool full error", err)
+	}
+}
+
+func TestMempoolRemoveForBlock(t *testing.T) {
+	testMempool(t)
+	pk, pks := testP2PKHKey(t)
+	ina := testAddCoin(t, HashID{1}, uint64(COIN), pks)
+	inb := testAddCoin(t, HashID{2}, uint64(COIN), pks)
+	tx1 := testSignTx(t, pk, pks, []*TxIn{ina}, uint64(COIN)-100000)
+	tx2 := testSignTx(t, pk, pks, []*TxIn{{OutHash: tx1.Hash, Sequence: script.SEQUENCE_FINAL}}, uint64(COIN)-200000)
+	tx3 := testSignTx(t, pk, pks, []*TxIn{inb}, uint64(COIN)-100000)
+	tx4 := testSignTx(t, pk, pks, []*TxIn{{OutHash: tx3.Hash, Sequence: script.SEQUENCE_FINAL}}, uint64(COIN)-200000)
+	for _, tx := range []*TX{tx1, tx2, tx3, tx4} {
+		if _, err := TxsMap.AcceptTx(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	//block confirm tx1 and conflict with tx3
+	conflict := testSignTx(t, pk, pks, []*TxIn{{OutHash: HashID{2}, Sequence: script.SEQUENCE_FINAL}}, uint64(COIN)-300000)
+	b := &MsgBlock{Txs: []*TX{testCoinbaseTx(1, pks), tx1, conflict}}
+	TxsMap.RemoveForBlock(b)
+	if TxsMap.Len() != 1 || !TxsMap.Has(tx2.Hash) {
+		t.Fatal("remove for block error")
+	}
+	if len(TxsMap.Ancestors(tx2.Hash)) != 0 || TxsMap.Bytes() != tx2.VirtualSize() {
+		t.Error("confirmed parent link error")
+	}
+}
+
+func TestMempoolReplace(t *testing.T) {
+	testMempool(t)
+	pk, pks := testP2PKHKey(t)
+	ina := testAddCoin(t, HashID{1}, uint64(COIN), pks)
+	ina.Sequence = MAX_BIP125_RBF_SEQUENCE
+	tx1 := testSignTx(t, pk, pks, []*TxIn{ina}, uint64(COIN)-100000)
+	tx2 := testSignTx(t, pk, pks, []*TxIn{{OutHash: tx1.Hash, Sequence: script.SEQUENCE_FINAL}}, uint64(COIN)-200000)
+	for _, tx := range []*TX{tx1, tx2} {
+		if _, err := TxsMap.AcceptTx(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	//must pay tx1 and tx2 fee
+	r1 := testSignTx(t, pk, pks, []*TxIn{{OutHash: HashID{1}, Sequence: script.SEQUENCE_FINAL}}, uint64(COIN)-150000)
+	if _, err := TxsMap.AcceptTx(r1); !errors.Is(err, ErrTxInsufficientFee) {
+		t.Error("replacement absolute fee error", err)
+	}
+	//must pay incremental relay fee
+	r2 := testSignTx(t, pk, pks, []*TxIn{{OutHash: HashID{1}, Sequence: script.SEQUENCE_FINAL}}, uint64(COIN)-200100)
+	if _, err := TxsMap.AcceptTx(r2); !errors.Is(err, ErrTxInsufficientFee) {
+		t.Error("replacement incremental fee error", err)
+	}
+	r3 := testSignTx(t, pk, pks, []*TxIn{{OutHash: HashID{1}, Sequence: script.SEQUENCE_FINAL}}, uint64(COIN)-300000)
+	if _, err := TxsMap.AcceptTx(r3); err != nil {
+		t.Fatal(err)
+	}
+	if TxsMap.Len() != 1 || !TxsMap.Has(r3.Hash) || TxsMap.Bytes() != r3.VirtualSize() {
+		t.Fatal("replace with descendants error")
+	}
+	//r3 not signal
+	r4 := testSignTx(t, pk, pks, []*TxIn{{OutHash: HashID{1}, Sequence: script.SEQUENCE_FINAL}}, uint64(COIN)-400000)
+	if _, err := TxsMap.AcceptTx(r4); !errors.Is(err, ErrTxConflict) {
+		t.Error("replace not signal tx error", err)
+	}
+}
+
+func TestMempoolReplaceLimit(t *testing.T) {
+	testMempool(t)
+	pk, pks := testP2PKHKey(t)
+	ins := []*TxIn{}
+	for i := 0; i <= MAX_BIP125_REPLACEMENT_CANDIDATES; i++ {
+		in := testAddCoin(t, HashID{byte(i), byte(i >> 8), 1}, uint64(COIN), pks)
+		in.Sequence = MAX_BIP125_RBF_SEQUENCE
+		tx := testSignTx(t, pk, pks, []*TxIn{in}, uint64(COIN)-10000)
+		if _, err := TxsMap.AcceptTx(tx); err != nil {
+			t.Fatal(err)
+		}
+		ins = append(ins, &TxIn{OutHash: in.OutHash, Sequence: script.SEQUENCE_FINAL})
+	}
+	tx := testSignTx(t, pk, pks, ins, uint64(COIN))
+	if _, err := TxsMap.AcceptTx(tx); !errors.Is(err, ErrTxReplace) {
+		t.Error("replacement candidates limit error", err)
+	}
+}
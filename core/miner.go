@@ -0,0 +1,288 @@
+package core
+
+import (
+	"bitcoin/config"
+	"bitcoin/script"
+	"container/heap"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	//bip9 version bits top
+	BLOCK_VERSION_TOP_BITS = uint32(0x20000000)
+	//weight reserved for coinbase
+	COINBASE_RESERVED_WEIGHT = 4000
+	//sigop cost reserved for coinbase
+	COINBASE_RESERVED_SIGOPS = int64(400)
+	//default max nonce tries for one block
+	DEFAULT_MAX_TRIES = 1000000
+	//stop select after consecutive package failures when block near full
+	MAX_CONSECUTIVE_FAILURES = 1000
+	BLOCK_FULL_WEIGHT_MARGIN = 4000
+)
+
+var (
+	ErrMaxTries = errors.New("mine block max tries")
+)
+
+//add bip141 witness commitment out to coinbase
+func addWitnessCommitment(cb *TX, txs []*TX) {
+	reserved := make([]byte, 32)
+	cb.Ins[0].Witness = &TxWitnesses{Script: []*script.Script{script.NewScript(reserved)}}
+	cb.SetHasWitness(true)
+	root := BlockWitnessRoot(txs)
+	id := HashID{}
+	HASH256To(append(root[:], reserved...), &id)
+	data := append(append([]byte{}, WitnessCommitmentHeader...), id[:]...)
+	out := &TxOut{Value: 0, Script: script.NewScript([]byte{}).PushOp(script.OP_RETURN).PushBytes(data)}
+	cb.Outs = append(cb.Outs, out)
+}
+
+//block template package of entry with ancestors not in block
+//core CTxMemPoolModifiedEntry
+type blockPackage struct {
+	e       *TxEntry
+	weight  int                 //entry tx weight
+	depth   int                 //mempool ancestors count,parents first order
+	order   int                 //pool fee rate order,tie break
+	ver     int                 //bumped when ancestor added
+	failed  bool                //not fit or not final
+	as      map[HashID]*TxEntry //ancestors not in block
+	pfee    Amount
+	psize   int
+	pweight int
+	pops    int64
+}
+
+//package state when pushed to heap
+type packageItem struct {
+	p     *blockPackage
+	ver   int
+	fee   Amount
+	size  int
+	order int
+}
+
+func (p *blockPackage) item() packageItem {
+	return packageItem{p: p, ver: p.ver, fee: p.pfee, size: p.psize, order: p.order}
+}
+
+//max heap by package fee rate
+type packageHeap []packageItem
+
+func (h packageHeap) Len() int {
+	return len(h)
+}
+
+func (h packageHeap) Less(i, j int) bool {
+	a, b := h[i], h[j]
+	if feeRateLess(b.fee, b.size, a.fee, a.size) {
+		return true
+	}
+	if feeRateLess(a.fee, a.size, b.fee, b.size) {
+		return false
+	}
+	return a.order < b.order
+}
+
+func (h packageHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+}
+
+func (h *packageHeap) Push(v interface{}) {
+	*h = append(*h, v.(packageItem))
+}
+
+func (h *packageHeap) Pop() interface{} {
+	old := *h
+	v := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return v
+}
+
+//mempool txs ancestor package fee rate order,parents first
+//child with high fee pull low fee parents into block
+//package totals updated only for descendants of added txs,core addPackageTxs
+func selectTxs(height uint32, cutoff int64) ([]*TX, Amount) {
+	txs, fees := []*TX{}, Amount(0)
+	weight := int(MAX_BLOCK_WEIGHT) - COINBASE_RESERVED_WEIGHT
+	sigops := MAX_BLOCK_SIGOPS_COST - COINBASE_RESERVED_SIGOPS
+	TxsMap.mu.RLock()
+	defer TxsMap.mu.RUnlock()
+	pool := TxsMap.sorted()
+	pkgs := make(map[HashID]*blockPackage, len(pool))
+	for i, e := range pool {
+		as := TxsMap.ancestors(e)
+		pkgs[e.Tx.Hash] = &blockPackage{e: e, weight: e.Tx.GetWeight(), depth: len(as), order: i, as: as}
+	}
+	h := &packageHeap{}
+	for _, e := range pool {
+		p := pkgs[e.Tx.Hash]
+		p.pfee, p.psize, p.pweight, p.pops = e.Fee, e.VSize, p.weight, e.SigOps
+		for id, a := range p.as {
+			p.pfee += a.Fee
+			p.psize += a.VSize
+			p.pweight += pkgs[id].weight
+			p.pops += a.SigOps
+		}
+		heap.Push(h, p.item())
+	}
+	added := map[HashID]bool{}
+	nfailed := 0
+	for h.Len() > 0 {
+		it := heap.Pop(h).(packageItem)
+		p := it.p
+		if it.ver != p.ver || p.failed || added[p.e.Tx.Hash] {
+			continue
+		}
+		es := []*TxEntry{p.e}
+		for _, a := range p.as {
+			es = append(es, a)
+		}
+		sort.Slice(es, func(i, j int) bool {
+			return pkgs[es[i].Tx.Hash].depth < pkgs[es[j].Tx.Hash].depth
+		})
+		final := true
+		for _, e := range es {
+			if !e.Tx.IsFinal(int64(height), cutoff) {
+				final = false
+				break
+			}
+		}
+		if p.pweight > weight || p.pops > sigops || !final {
+			p.failed = true
+			nfailed++
+			if nfailed > MAX_CONSECUTIVE_FAILURES && weight < BLOCK_FULL_WEIGHT_MARGIN {
+				break
+			}
+			continue
+		}
+		nfailed = 0
+		for _, e := range es {
+			txs = append(txs, e.Tx)
+			added[e.Tx.Hash] = true
+		}
+		fees += p.pfee
+		weight -= p.pweight
+		sigops -= p.pops
+		//remove added txs from descendant packages
+		for _, e := range es {
+			ep := pkgs[e.Tx.Hash]
+			for id := range TxsMap.descendants(e) {
+				dp := pkgs[id]
+				if added[id] || dp.failed {
+					continue
+				}
+				delete(dp.as, e.Tx.Hash)
+				dp.pfee -= e.Fee
+				dp.psize -= e.VSize
+				dp.pweight -= ep.weight
+				dp.pops -= e.SigOps
+				dp.ver++
+				heap.Push(h, dp.item())
+			}
+		}
+	}
+	return txs, fees
+}
+
+//create next block template on best,coinbase pay to pks
+func NewBlockTemplate(pks *script.Script) (*MsgBlock, error) {
+	conf := config.GetConfig()
+	G.Lock()
+	best := G.LastBlock()
+	G.Unlock()
+	if best == nil {
+		return nil, errors.New("miss best block")
+	}
+	prev := Index.Get(best.Hash)
+	if prev == nil {
+		return nil, ErrPrevHeaderNotFound
+	}
+	m := NewMsgBlock()
+	m.Ver = BLOCK_VERSION_TOP_BITS
+	m.Prev = best.Hash
+	m.Height = best.Height + 1
+	//time must after median time past
+	mtp := prev.MedianTimePast()
+	m.Timestamp = uint32(time.Now().Unix())
+	if int64(m.Timestamp) <= mtp {
+		m.Timestamp = uint32(mtp + 1)
+	}
+	m.Bits = prev.NextWorkRequired(m.Timestamp)
+	txs, fees := selectTxs(m.Height, m.LockTimeCutoff(prev))
+	//bip34 height in coinbase
+	cb := &TX{Ver: 1}
+	in := &TxIn{OutIndex: math.MaxUint32, Sequence: script.SEQUENCE_FINAL}
+	in.Script = script.NewScript([]byte{}).PushInt64(int64(m.Height)).PushInt64(0)
+	cb.Ins = []*TxIn{in}
+	cb.Outs = []*TxOut{{Value: uint64(GetCoinbaseReward(int(m.Height)) + fees), Script: pks}}
+	m.Txs = append([]*TX{cb}, txs...)
+	if m.Height >= conf.SegwitHeight {
+		addWitnessCommitment(cb, m.Txs)
+	}
+	txids := []HashID{}
+	for _, v := range m.Txs {
+		v.Write(NewNetHeader())
+		txids = append(txids, v.Hash)
+	}
+	m.Merkle, _, _ = BuildMerkleTree(txids).Extract()
+	m.Write(NewNetHeader())
+	return m, nil
+}
+
+//grind nonce until proof of work pass
+func MineBlock(m *MsgBlock, tries uint64) error {
+	h := NewNetHeader()
+	m.Header().Write(h)
+	data := h.Bytes()[:80]
+	for i := uint64(0); i < tries && i <= math.MaxUint32; i++ {
+		nonce := uint32(i)
+		ByteOrder.PutUint32(data[76:], nonce)
+		id := HashID{}
+		HASH256To(data, &id)
+		if CheckProofOfWork(id, m.Bits) {
+			m.Nonce = nonce
+			m.Hash = id
+			return nil
+		}
+	}
+	return ErrMaxTries
+}
+
+//mine num blocks pay to pks,return block hashs
+func GenerateToScript(pks *script.Script, num int, tries uint64) ([]HashID, error) {
+	ids := []HashID{}
+	for i := 0; i < num; i++ {
+		m, err := NewBlockTemplate(pks)
+		if err != nil {
+			return ids, err
+		}
+		if err := MineBlock(m, tries); err != nil {
+			return ids, err
+		}
+		//same as recv from network
+		h := NewNetHeader()
+		m.Write(h)
+		b := NewMsgBlock()
+		b.Read(NewNetHeader(h.Bytes()))
+		if err := processBlock(0, nil, b); err != nil {
+			return ids, fmt.Errorf("process mined block error %w", err)
+		}
+		ids = append(ids, b.Hash)
+	}
+	return ids, nil
+}
+
+//mine num blocks pay to address
+func GenerateToAddress(addr string, num int, tries uint64) ([]HashID, error) {
+	pks, err := script.NewScriptWithAddress(addr)
+	if err != nil {
+		return nil, err
+	}
+	return GenerateToScript(pks, num, tries)
+}
@@ -0,0 +1,141 @@
+package core
+
+import (
+	"bitcoin/config"
+	"bitcoin/script"
+	"testing"
+)
+
+//regtest chain with genesis best block
+func testRegTest(t *testing.T) {
+	conf, err := config.SelectNetwork(config.NET_REGTEST)
+	if err != nil {
+		t.Fatal(err)
+	}
+	UseMemDB()
+	Index = NewBlockIndex()
+	TxsMap = NewTxMap()
+	G.SetBestBlock(nil)
+	gb, err := GetGenesisBlock(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	G.Lock()
+	err = G.AcceptBlock(gb)
+	G.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMineBlock(t *testing.T) {
+	defer config.SelectNetwork(config.NET_MAIN)
+	testRegTest(t)
+	pk, pks := testP2PKHKey(t)
+	ids, err := GenerateToScript(pks, COINBASE_MATURITY+1, DEFAULT_MAX_TRIES)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != COINBASE_MATURITY+1 || G.LastHeight() != COINBASE_MATURITY+1 || !G.LastHash().Equal(ids[len(ids)-1]) {
+		t.Fatal("generate blocks error")
+	}
+	b1, err := LoadBlock(ids[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	cb := b1.Txs[0]
+	if cb.Outs[0].Value != uint64(50*COIN) || len(cb.Outs) != 2 || !cb.HasWitness() {
+		t.Fatal("coinbase out or witness commitment error")
+	}
+	//spend mature coinbase
+	in := &TxIn{OutHash: cb.Hash, Sequence: script.SEQUENCE_FINAL}
+	tx := testSignTx(t, pk, pks, []*TxIn{in}, uint64(50*COIN)-100000)
+	if _, err := TxsMap.AcceptTx(tx); err != nil {
+		t.Fatal(err)
+	}
+	ids, err = GenerateToScript(pks, 1, DEFAULT_MAX_TRIES)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bv, err := LoadBlock(ids[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bv.Txs) != 2 || !bv.Txs[1].Hash.Equal(tx.Hash) || bv.Txs[0].Outs[0].Value != uint64(50*COIN)+100000 {
+		t.Error("block template txs or fee error")
+	}
+	if TxsMap.Len() != 0 {
+		t.Error("mined tx not remove from mempool")
+	}
+}
+
+func TestMaxTries(t *testing.T) {
+	testMempool(t)
+	_, pks := testP2PKHKey(t)
+	m, err := NewBlockTemplate(pks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//main network difficulty
+	if err := MineBlock(m, 100); err != ErrMaxTries {
+		t.Error("max tries error", err)
+	}
+}
+
+func TestSelectTxsPackage(t *testing.T) {
+	testMempool(t)
+	pk, pks := testP2PKHKey(t)
+	ina := testAddCoin(t, HashID{1}, uint64(COIN), pks)
+	inb := testAddCoin(t, HashID{2}, uint64(COIN), pks)
+	inc := testAddCoin(t, HashID{3}, uint64(COIN), pks)
+	//low fee parent,high fee child
+	parent := testSignTx(t, pk, pks, []*TxIn{ina}, uint64(COIN)-1000)
+	child := testSignTx(t, pk, pks, []*TxIn{{OutHash: parent.Hash, Sequence: script.SEQUENCE_FINAL}}, uint64(COIN)-201000)
+	other := testSignTx(t, pk, pks, []*TxIn{inb}, uint64(COIN)-20000)
+	heavy := testSignTx(t, pk, pks, []*TxIn{inc}, uint64(COIN)-500000)
+	for _, tx := range []*TX{parent, child, other, heavy} {
+		if _, err := TxsMap.AcceptTx(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	//over block sigops limit
+	TxsMap.Entry(heavy.Hash).SigOps = MAX_BLOCK_SIGOPS_COST
+	txs, fees := selectTxs(1, 0)
+	if len(txs) != 3 || !txs[0].Hash.Equal(parent.Hash) || !txs[1].Hash.Equal(child.Hash) || !txs[2].Hash.Equal(other.Hash) {
+		t.Fatal("ancestor package select error")
+	}
+	if fees != 221000 {
+		t.Error("select fees error", fees)
+	}
+}
+
+func TestSelectTxsModified(t *testing.T) {
+	testMempool(t)
+	pk, pks := testP2PKHKey(t)
+	ina := testAddCoin(t, HashID{1}, uint64(COIN), pks)
+	inb := testAddCoin(t, HashID{2}, uint64(COIN), pks)
+	half := uint64(COIN) / 2
+	parent := testSignTx(t, pk, pks, []*TxIn{ina}, half, half-1000)
+	child1 := testSignTx(t, pk, pks, []*TxIn{{OutHash: parent.Hash, Sequence: script.SEQUENCE_FINAL}}, half-200000)
+	child2 := testSignTx(t, pk, pks, []*TxIn{{OutHash: parent.Hash, OutIndex: 1, Sequence: script.SEQUENCE_FINAL}}, half-31000)
+	other := testSignTx(t, pk, pks, []*TxIn{inb}, uint64(COIN)-20000)
+	for _, tx := range []*TX{parent, child1, child2, other} {
+		if _, err := TxsMap.AcceptTx(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	//child2 with parent below other,alone above after parent added
+	txs, fees := selectTxs(1, 0)
+	want := []*TX{parent, child1, child2, other}
+	if len(txs) != len(want) {
+		t.Fatal("select count error", len(txs))
+	}
+	for i, tx := range want {
+		if !txs[i].Hash.Equal(tx.Hash) {
+			t.Fatalf("select order %d error", i)
+		}
+	}
+	if fees != 251000 {
+		t.Error("select fees error", fees)
+	}
+}
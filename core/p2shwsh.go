@@ -1,100 +0,0 @@
-package core
-
-import (
-	"bitcoin/script"
-	"bitcoin/util"
-	"errors"
-	"fmt"
-)
-
-type p2shwshVerify struct {
-	hsidx int
-	less  int
-	size  int
-	baseVerify
-}
-
-func newP2SHWSHVerify(idx int, in *TxIn, out *TxOut, ctx *TX, typ TxType) *p2shwshVerify {
-	return &p2shwshVerify{
-		hsidx: -1,
-		less:  -1,
-		size:  -1,
-		baseVerify: baseVerify{
-			idx: idx,
-			in:  in,
-			out: out,
-			ctx: ctx,
-			typ: typ,
-		},
-	}
-}
-
-func (vfy *p2shwshVerify) Packer(sig *script.SigValue) SigPacker {
-	return &witnesSigPacker{
-		idx: vfy.idx,
-		in:  vfy.in,
-		out: vfy.out,
-		ctx: vfy.ctx,
-		ht:  uint32(sig.HashType),
-		typ: vfy.typ,
-	}
-}
-
-func (vfy *p2shwshVerify) SigScript() *script.Script {
-	return vfy.in.Witness.Script[vfy.hsidx]
-}
-
-func (vfy *p2shwshVerify) CheckSig(stack *script.Stack, sigv []byte, pubv []byte) error {
-	sig, err := script.NewSigValue(sigv)
-	if err != nil {
-		return err
-	}
-	pub, err := script.NewPublicKey(pubv)
-	if err != nil {
-		return err
-	}
-	data, err := vfy.Packer(sig).Pack(vfy)
-	if err != nil {
-		return fmt.Errorf("packer hash sig data error %v", err)
-	}
-	hash := util.HASH256(data)
-	if !pub.Verify(hash, sig) {
-		return ErrSigVerify
-	}
-	return nil
-}
-
-func (vfy *p2shwshVerify) Verify(flags int) error {
-	stack := script.NewStack()
-	sv := script.NewScript([]byte{})
-	//hash equal check
-	sv.Concat(vfy.in.Script)
-	sv.Concat(vfy.out.Script)
-	if err := sv.Eval(stack, vfy, flags); err != nil {
-		return err
-	}
-	if !script.StackTopBool(stack, -1) {
-		return errors.New("hash equal error")
-	}
-	stack.Pop()
-	sv.Clean()
-	//multisig check
-	vfy.hsidx = -1
-	for i, v := range vfy.in.Witness.Script {
-		if v.Len() == 0 {
-			continue
-		} else if v.HasMultiSig() {
-			vfy.hsidx = i
-			sv.Concat(v)
-		} else {
-			sv.PushBytes(*v)
-		}
-	}
-	if err := sv.Eval(stack, vfy, flags); err != nil {
-		return err
-	}
-	if !script.StackTopBool(stack, -1) {
-		return errors.New("verify error")
-	}
-	return nil
-}
@@ -0,0 +1,267 @@
+package core
+
+import (
+	"bitcoin/script"
+	"bitcoin/util"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+//outs spent by all tx ins,bip341 sighash commit all of them
+type spentOutputs struct {
+	tx        *TX
+	outs      []*TxOut
+	once      sync.Once
+	err       error
+	prevouts  HashID
+	amounts   HashID
+	scripts   HashID
+	sequences HashID
+	outputs   HashID
+}
+
+func newSpentOutputs(tx *TX) *spentOutputs {
+	return &spentOutputs{
+		tx:   tx,
+		outs: make([]*TxOut, len(tx.Ins)),
+	}
+}
+
+//single sha256 of ins and outs fields,computed once shared by ins checks
+func (so *spentOutputs) init() error {
+	so.once.Do(func() {
+		pw, aw, sw, qw, ow := NewMsgWriter(), NewMsgWriter(), NewMsgWriter(), NewMsgWriter(), NewMsgWriter()
+		for i, in := range so.tx.Ins {
+			out := so.outs[i]
+			if out == nil {
+				so.err = fmt.Errorf("in %d spent out miss", i)
+				return
+			}
+			pw.WriteBytes(in.OutHash[:])
+			pw.WriteUInt32(in.OutIndex)
+			aw.WriteUInt64(out.Value)
+			sw.WriteScript(out.Script)
+			qw.WriteUInt32(in.Sequence)
+		}
+		for _, v := range so.tx.Outs {
+			ow.WriteUInt64(v.Value)
+			ow.WriteScript(v.Script)
+		}
+		copy(so.prevouts[:], util.SHA256(pw.Bytes()))
+		copy(so.amounts[:], util.SHA256(aw.Bytes()))
+		copy(so.scripts[:], util.SHA256(sw.Bytes()))
+		copy(so.sequences[:], util.SHA256(qw.Bytes()))
+		copy(so.outputs[:], util.SHA256(ow.Bytes()))
+	})
+	return so.err
+}
+
+//bip341 signature message
+type taprootSigPacker struct {
+	idx     int    //current ints index
+	in      *TxIn  //current in
+	out     *TxOut //in's out
+	ctx     *TX    //currenct tx'clone
+	ht      uint32 //hash type script.SIGHASH_*
+	typ     TxType //tx type
+	spent   *spentOutputs
+	annex   []byte //with 0x50 tag,nil if not present
+	leaf    []byte //tapleaf hash,nil for key path
+	codesep uint32 //last executed OP_CODESEPARATOR position
+}
+
+func IsValidTaprootHashType(ht uint32) bool {
+	return ht <= script.SIGHASH_SINGLE || (ht >= script.SIGHASH_ANYONECANPAY|script.SIGHASH_ALL && ht <= script.SIGHASH_ANYONECANPAY|script.SIGHASH_SINGLE)
+}
+
+func (sp *taprootSigPacker) Pack(imp ISigScript) ([]byte, error) {
+	if sp.spent == nil {
+		return nil, errors.New("taproot sighash miss spent outs")
+	}
+	if err := sp.spent.init(); err != nil {
+		return nil, err
+	}
+	if !IsValidTaprootHashType(sp.ht) {
+		return nil, script.SCRIPT_ERR_SCHNORR_SIG_HASHTYPE
+	}
+	anyone := (sp.ht & script.SIGHASH_ANYONECANPAY) != 0
+	single := (sp.ht & 3) == script.SIGHASH_SINGLE
+	none := (sp.ht & 3) == script.SIGHASH_NONE
+	m := NewMsgWriter()
+	//epoch
+	m.WriteUint8(0)
+	m.WriteUint8(uint8(sp.ht))
+	m.WriteInt32(sp.ctx.Ver)
+	m.WriteUInt32(sp.ctx.LockTime)
+	if !anyone {
+		m.WriteHash(sp.spent.prevouts)
+		m.WriteHash(sp.spent.amounts)
+		m.WriteHash(sp.spent.scripts)
+		m.WriteHash(sp.spent.sequences)
+	}
+	if !single && !none {
+		m.WriteHash(sp.spent.outputs)
+	}
+	spendtype := uint8(0)
+	if sp.leaf != nil {
+		spendtype |= 2
+	}
+	if sp.annex != nil {
+		spendtype |= 1
+	}
+	m.WriteUint8(spendtype)
+	if anyone {
+		m.WriteBytes(sp.in.OutHash[:])
+		m.WriteUInt32(sp.in.OutIndex)
+		m.WriteUInt64(sp.out.Value)
+		m.WriteScript(sp.out.Script)
+		m.WriteUInt32(sp.in.Sequence)
+	} else {
+		m.WriteUInt32(uint32(sp.idx))
+	}
+	if sp.annex != nil {
+		aw := NewMsgWriter()
+		aw.WriteScript(script.NewScript(sp.annex))
+		m.WriteBytes(util.SHA256(aw.Bytes()))
+	}
+	if single {
+		if sp.idx >= len(sp.ctx.Outs) {
+			return nil, script.SCRIPT_ERR_SCHNORR_SIG_HASHTYPE
+		}
+		ov := sp.ctx.Outs[sp.idx]
+		ow := NewMsgWriter()
+		ow.WriteUInt64(ov.Value)
+		ow.WriteScript(ov.Script)
+		m.WriteBytes(util.SHA256(ow.Bytes()))
+	}
+	if sp.leaf != nil {
+		m.WriteBytes(sp.leaf)
+		//key version
+		m.WriteUint8(0)
+		m.WriteUInt32(sp.codesep)
+	}
+	return m.Bytes(), nil
+}
+
+type p2trVerify struct {
+	baseVerify
+	spent *spentOutputs
+	annex []byte
+	leaf  []byte
+}
+
+func newP2TRVerify(idx int, in *TxIn, out *TxOut, ctx *TX, typ TxType, spent *spentOutputs) *p2trVerify {
+	return &p2trVerify{
+		baseVerify: baseVerify{
+			idx: idx,
+			in:  in,
+			out: out,
+			ctx: ctx,
+			typ: typ,
+		},
+		spent: spent,
+	}
+}
+
+func (sp *taprootSigPacker) Hash(imp ISigScript) ([]byte, error) {
+	data, err := sp.Pack(imp)
+	if err != nil {
+		return nil, err
+	}
+	return util.TaggedHash("TapSighash", data), nil
+}
+
+func (vfy *p2trVerify) packer(ht uint32, codesep uint32) *taprootSigPacker {
+	return &taprootSigPacker{
+		idx:     vfy.idx,
+		in:      vfy.in,
+		out:     vfy.out,
+		ctx:     vfy.ctx,
+		ht:      ht,
+		typ:     vfy.typ,
+		spent:   vfy.spent,
+		annex:   vfy.annex,
+		leaf:    vfy.leaf,
+		codesep: codesep,
+	}
+}
+
+func (vfy *p2trVerify) Packer(sig *script.SigValue) SigPacker {
+	return vfy.packer(uint32(sig.HashType), 0xFFFFFFFF)
+}
+
+func (vfy *p2trVerify) SigScript() *script.Script {
+	return nil
+}
+
+//tapscript not run ecdsa checksig
+func (vfy *p2trVerify) CheckSig(stack *script.Stack, sigv []byte, pubv []byte) error {
+	return ErrSigVerify
+}
+
+func (vfy *p2trVerify) CheckSchnorrSig(sigv []byte, pubv []byte, codesep uint32) error {
+	if len(sigv) != script.SCHNORR_SIGNATURE_SIZE && len(sigv) != script.SCHNORR_SIGNATURE_SIZE+1 {
+		return script.SCRIPT_ERR_SCHNORR_SIG_SIZE
+	}
+	sig, err := script.NewSchnorrSig(sigv)
+	if err != nil {
+		return script.SCRIPT_ERR_SCHNORR_SIG_HASHTYPE
+	}
+	hash, err := vfy.packer(uint32(sig.HashType), codesep).Hash(vfy)
+	if err != nil {
+		return err
+	}
+	pub := script.XOnlyPublicKey{}
+	copy(pub[:], pubv)
+	if !SigCache.VerifySchnorr(hash, pub, sig, pubv, sigv) {
+		return script.SCRIPT_ERR_SCHNORR_SIG
+	}
+	return nil
+}
+
+//witness v1 32 bytes program,key path or script path spend
+func (vfy *p2trVerify) Verify(flags int) error {
+	if flags&script.SCRIPT_VERIFY_TAPROOT == 0 {
+		return nil
+	}
+	if vfy.in.Script != nil && vfy.in.Script.Len() > 0 {
+		return script.SCRIPT_ERR_WITNESS_MALLEATED
+	}
+	if vfy.in.Witness == nil || len(vfy.in.Witness.Script) == 0 {
+		return script.SCRIPT_ERR_WITNESS_PROGRAM_WITNESS_EMPTY
+	}
+	wits := vfy.in.Witness.Script
+	if n := len(wits); n >= 2 && wits[n-1].Len() > 0 && (*wits[n-1])[0] == script.ANNEX_TAG {
+		vfy.annex = *wits[n-1]
+		wits = wits[:n-1]
+	}
+	program := (*vfy.out.Script)[2:]
+	if len(wits) == 1 {
+		return vfy.CheckSchnorrSig(*wits[0], program, 0xFFFFFFFF)
+	}
+	control := *wits[len(wits)-1]
+	tapscript := wits[len(wits)-2]
+	if err := script.CheckControlSize(control); err != nil {
+		return err
+	}
+	ver := control[0] & script.TAPROOT_LEAF_MASK
+	leaf := script.TapLeafHash(ver, tapscript)
+	if err := script.VerifyTaprootCommitment(control, program, leaf); err != nil {
+		return err
+	}
+	if ver != script.TAPROOT_LEAF_TAPSCRIPT {
+		if flags&script.SCRIPT_VERIFY_DISCOURAGE_UPGRADABLE_TAPROOT_VERSION != 0 {
+			return script.SCRIPT_ERR_DISCOURAGE_UPGRADABLE_TAPROOT_VERSION
+		}
+		return nil
+	}
+	vfy.leaf = leaf
+	stack := script.NewStack()
+	for _, v := range wits[:len(wits)-2] {
+		stack.Push(v.Bytes())
+	}
+	h := NewNetHeader()
+	vfy.in.Witness.Write(h)
+	return tapscript.EvalTapscript(stack, vfy, flags, len(h.Bytes()))
+}
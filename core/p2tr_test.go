@@ -0,0 +1,200 @@
+package core
+
+import (
+	"bitcoin/config"
+	"bitcoin/script"
+	"errors"
+	"testing"
+)
+
+//tx spend outs,spent outs resolved without db
+func testTaprootTx(outs ...*TxOut) (*TX, *spentOutputs) {
+	tx := &TX{Ver: 2}
+	for i := range outs {
+		in := &TxIn{OutHash: HashID{byte(i + 1)}, OutIndex: uint32(i), Script: script.NewScript([]byte{}), Sequence: script.SEQUENCE_FINAL}
+		tx.Ins = append(tx.Ins, in)
+	}
+	tx.Outs = []*TxOut{{Value: 1000, Script: outs[0].Script}}
+	spent := newSpentOutputs(tx)
+	copy(spent.outs, outs)
+	return tx, spent
+}
+
+func testTaprootVerify(tx *TX, spent *spentOutputs, idx int, flags int) error {
+	in, out := tx.Ins[idx], spent.outs[idx]
+	c := &TxInCheck{tx: tx, idx: idx, out: out, typ: CheckTXType(in, out), flags: flags, spent: spent}
+	return c.Verify()
+}
+
+//sign in idx with bip341 sighash,leaf nil for key path
+func testTaprootSign(t *testing.T, pk *script.PrivateKey, tx *TX, spent *spentOutputs, idx int, ht byte, annex []byte, leaf []byte) []byte {
+	vfy := newP2TRVerify(idx, tx.Ins[idx], spent.outs[idx], tx, TX_P2TR, spent)
+	vfy.annex, vfy.leaf = annex, leaf
+	hash, err := vfy.packer(uint32(ht), 0xFFFFFFFF).Hash(vfy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := pk.SignSchnorr(hash, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig.HashType = ht
+	return sig.Encode()
+}
+
+func testWitness(vs ...[]byte) *TxWitnesses {
+	w := &TxWitnesses{}
+	for _, v := range vs {
+		w.Script = append(w.Script, script.NewScript(v))
+	}
+	return w
+}
+
+func testTaprootKey(t *testing.T) *script.PrivateKey {
+	pk, err := script.NewPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pk
+}
+
+func TestP2TRKeyPath(t *testing.T) {
+	flags := script.SCRIPT_VERIFY_P2SH | script.SCRIPT_VERIFY_WITNESS | script.SCRIPT_VERIFY_TAPROOT
+	pk := testTaprootKey(t)
+	tk, err := pk.TapTweak(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := &TxOut{Value: 5000, Script: script.NewTaprootScript(tk.XOnlyPublicKey())}
+	tx, spent := testTaprootTx(out, out)
+	if CheckTXType(tx.Ins[0], out) != TX_P2TR {
+		t.Fatal("p2tr type error")
+	}
+	annex := []byte{script.ANNEX_TAG, 1, 2}
+	tx.Ins[0].Witness = testWitness(testTaprootSign(t, tk, tx, spent, 0, script.SIGHASH_DEFAULT, nil, nil))
+	tx.Ins[1].Witness = testWitness(testTaprootSign(t, tk, tx, spent, 1, script.SIGHASH_ALL|script.SIGHASH_ANYONECANPAY, annex, nil), annex)
+	for idx := range tx.Ins {
+		if err := testTaprootVerify(tx, spent, idx, flags); err != nil {
+			t.Error("key path verify error", idx, err)
+		}
+	}
+	//annex committed
+	tx.Ins[1].Witness.Script[1] = script.NewScript([]byte{script.ANNEX_TAG, 1, 3})
+	if err := testTaprootVerify(tx, spent, 1, flags); !errors.Is(err, script.SCRIPT_ERR_SCHNORR_SIG) {
+		t.Error("annex change not detected", err)
+	}
+	sig := *tx.Ins[0].Witness.Script[0]
+	sig[10] ^= 1
+	if err := testTaprootVerify(tx, spent, 0, flags); !errors.Is(err, script.SCRIPT_ERR_SCHNORR_SIG) {
+		t.Error("bad sig not detected", err)
+	}
+	//not active before taproot height
+	if err := testTaprootVerify(tx, spent, 0, flags&^script.SCRIPT_VERIFY_TAPROOT); err != nil {
+		t.Error("taproot not active must pass", err)
+	}
+	sig[10] ^= 1
+	tx.Ins[0].Witness.Script[0] = script.NewScript(append(sig, 0x04))
+	if err := testTaprootVerify(tx, spent, 0, flags); !errors.Is(err, script.SCRIPT_ERR_SCHNORR_SIG_HASHTYPE) {
+		t.Error("bad hashtype not detected", err)
+	}
+	tx.Ins[0].Witness.Script[0] = script.NewScript(sig[:63])
+	if err := testTaprootVerify(tx, spent, 0, flags); !errors.Is(err, script.SCRIPT_ERR_SCHNORR_SIG_SIZE) {
+		t.Error("bad sig size not detected", err)
+	}
+	tx.Ins[0].Witness = nil
+	if err := testTaprootVerify(tx, spent, 0, flags); !errors.Is(err, script.SCRIPT_ERR_WITNESS_PROGRAM_WITNESS_EMPTY) {
+		t.Error("empty witness not detected", err)
+	}
+}
+
+//single leaf tree output and control block
+func testTaprootLeaf(t *testing.T, ik *script.PrivateKey, ver byte, s *script.Script) (*TxOut, []byte) {
+	leaf := script.TapLeafHash(ver, s)
+	q, odd, err := script.TaprootOutputKey(ik.XOnlyPublicKey(), leaf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	xk := ik.XOnlyPublicKey()
+	control := append([]byte{ver}, xk[:]...)
+	if odd {
+		control[0] |= 1
+	}
+	return &TxOut{Value: 5000, Script: script.NewTaprootScript(q)}, control
+}
+
+func TestP2TRScriptPath(t *testing.T) {
+	flags := script.SCRIPT_VERIFY_P2SH | script.SCRIPT_VERIFY_WITNESS | script.SCRIPT_VERIFY_TAPROOT
+	ik, k1, k2 := testTaprootKey(t), testTaprootKey(t), testTaprootKey(t)
+	x1, x2 := k1.XOnlyPublicKey(), k2.XOnlyPublicKey()
+	sa := script.NewScript([]byte{}).PushBytes(x1[:]).PushOp(script.OP_CHECKSIG)
+	sb := script.NewScript([]byte{}).PushBytes(x1[:]).PushOp(script.OP_CHECKSIG)
+	sb.PushBytes(x2[:]).PushOp(script.OP_CHECKSIGADD).PushOp(script.OP_2).PushOp(script.OP_NUMEQUAL)
+	la := script.TapLeafHash(script.TAPROOT_LEAF_TAPSCRIPT, sa)
+	lb := script.TapLeafHash(script.TAPROOT_LEAF_TAPSCRIPT, sb)
+	q, odd, err := script.TaprootOutputKey(ik.XOnlyPublicKey(), script.TapBranchHash(la, lb))
+	if err != nil {
+		t.Fatal(err)
+	}
+	xk := ik.XOnlyPublicKey()
+	control := append([]byte{script.TAPROOT_LEAF_TAPSCRIPT}, xk[:]...)
+	if odd {
+		control[0] |= 1
+	}
+	control = append(control, la...)
+	out := &TxOut{Value: 5000, Script: script.NewTaprootScript(q)}
+	sout, scontrol := testTaprootLeaf(t, ik, script.TAPROOT_LEAF_TAPSCRIPT, script.NewScript([]byte{script.OP_RETURN, 0x50}))
+	uout, ucontrol := testTaprootLeaf(t, ik, 0xc2, script.NewScript([]byte{script.OP_RETURN}))
+	tx, spent := testTaprootTx(out, sout, uout)
+	sig1 := testTaprootSign(t, k1, tx, spent, 0, script.SIGHASH_DEFAULT, nil, lb)
+	sig2 := testTaprootSign(t, k2, tx, spent, 0, script.SIGHASH_SINGLE, nil, lb)
+	tx.Ins[0].Witness = testWitness(sig2, sig1, *sb, control)
+	tx.Ins[1].Witness = testWitness([]byte{script.OP_RETURN, 0x50}, scontrol)
+	tx.Ins[2].Witness = testWitness([]byte{script.OP_RETURN}, ucontrol)
+	for idx := range tx.Ins {
+		if err := testTaprootVerify(tx, spent, idx, flags); err != nil {
+			t.Error("script path verify error", idx, err)
+		}
+	}
+	if err := testTaprootVerify(tx, spent, 1, flags|script.SCRIPT_VERIFY_DISCOURAGE_OP_SUCCESS); !errors.Is(err, script.SCRIPT_ERR_DISCOURAGE_OP_SUCCESS) {
+		t.Error("discourage op success error", err)
+	}
+	if err := testTaprootVerify(tx, spent, 2, flags|script.SCRIPT_VERIFY_DISCOURAGE_UPGRADABLE_TAPROOT_VERSION); !errors.Is(err, script.SCRIPT_ERR_DISCOURAGE_UPGRADABLE_TAPROOT_VERSION) {
+		t.Error("discourage leaf version error", err)
+	}
+	//one of two sigs missing
+	tx.Ins[0].Witness = testWitness([]byte{}, sig1, *sb, control)
+	if err := testTaprootVerify(tx, spent, 0, flags); !errors.Is(err, script.SCRIPT_ERR_EVAL_FALSE) {
+		t.Error("missing sig not detected", err)
+	}
+	//sig for other leaf
+	tx.Ins[0].Witness = testWitness(testTaprootSign(t, k2, tx, spent, 0, script.SIGHASH_DEFAULT, nil, la), sig1, *sb, control)
+	if err := testTaprootVerify(tx, spent, 0, flags); !errors.Is(err, script.SCRIPT_ERR_SCHNORR_SIG) {
+		t.Error("wrong leaf sig not detected", err)
+	}
+	//wrong merkle path
+	bad := append(append([]byte{}, control[:33]...), lb...)
+	tx.Ins[0].Witness = testWitness(sig2, sig1, *sb, bad)
+	if err := testTaprootVerify(tx, spent, 0, flags); !errors.Is(err, script.SCRIPT_ERR_WITNESS_PROGRAM_MISMATCH) {
+		t.Error("wrong merkle path not detected", err)
+	}
+	tx.Ins[0].Witness = testWitness(sig2, sig1, *sb, control[:40])
+	if err := testTaprootVerify(tx, spent, 0, flags); !errors.Is(err, script.SCRIPT_ERR_TAPROOT_WRONG_CONTROL_SIZE) {
+		t.Error("wrong control size not detected", err)
+	}
+}
+
+func TestTaprootScriptFlags(t *testing.T) {
+	conf, err := config.SelectNetwork(config.NET_MAIN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer config.SelectNetwork(config.NET_MAIN)
+	m := &MsgBlock{Height: conf.TaprootHeight - 1}
+	if m.GetScriptFlags()&script.SCRIPT_VERIFY_TAPROOT != 0 {
+		t.Error("taproot active before height")
+	}
+	m.Height = conf.TaprootHeight
+	if m.GetScriptFlags()&script.SCRIPT_VERIFY_TAPROOT == 0 {
+		t.Error("taproot not active at height")
+	}
+}
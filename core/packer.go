@@ -2,6 +2,8 @@ package core
 
 import (
 	"bitcoin/script"
+	"bitcoin/util"
+	"math"
 )
 
 //get sig script interface
@@ -13,8 +15,15 @@ type SigPacker interface {
 	//pack sig data
 	//imp get sig script code
 	Pack(imp ISigScript) ([]byte, error)
+	//signed hash of packed data
+	Hash(imp ISigScript) ([]byte, error)
 }
 
+var (
+	//legacy single without matched out signs uint256 one,bitcoin core bug kept
+	sigHashOne = HashID{1}
+)
+
 type baseSigPacker struct {
 	idx int    //current ints index
 	in  *TxIn  //current in
@@ -24,21 +33,33 @@ type baseSigPacker struct {
 	typ TxType //tx type
 }
 
+//bitcoin core CTransactionSignatureSerializer
 func (sp *baseSigPacker) Pack(imp ISigScript) ([]byte, error) {
 	anyone := (sp.ht & script.SIGHASH_ANYONECANPAY) != 0
-	single := (sp.ht & 0x7F) == script.SIGHASH_SINGLE
-	none := (sp.ht & 0x7F) == script.SIGHASH_NONE
+	single := (sp.ht & 0x1F) == script.SIGHASH_SINGLE
+	none := (sp.ht & 0x1F) == script.SIGHASH_NONE
+	code := script.NewScript([]byte{})
+	if sc := imp.SigScript(); sc != nil {
+		code = sc.RemoveCodeSeparators()
+	}
 	w := NewMsgWriter()
 	w.WriteInt32(sp.ctx.Ver)
-	w.WriteVarInt(len(sp.ctx.Ins))
-	for i, v := range sp.ctx.Ins {
-		if anyone {
-			i = sp.idx
+	//anyone can pay only sign current in
+	ins := []int{}
+	if anyone {
+		ins = append(ins, sp.idx)
+	} else {
+		for i := range sp.ctx.Ins {
+			ins = append(ins, i)
 		}
+	}
+	w.WriteVarInt(len(ins))
+	for _, i := range ins {
+		v := sp.ctx.Ins[i]
 		w.WriteBytes(v.OutHash[:])
 		w.WriteUInt32(v.OutIndex)
 		if i == sp.idx {
-			w.WriteScript(imp.SigScript())
+			w.WriteScript(code)
 		} else {
 			w.WriteScript(nil)
 		}
@@ -57,10 +78,14 @@ func (sp *baseSigPacker) Pack(imp ISigScript) ([]byte, error) {
 		outs = len(sp.ctx.Outs)
 	}
 	w.WriteVarInt(outs)
-	for i, v := range sp.ctx.Outs {
-		if i >= outs {
-			break
+	for i := 0; i < outs; i++ {
+		//single outs before current in value -1 and empty script
+		if single && i != sp.idx {
+			w.WriteUInt64(math.MaxUint64)
+			w.WriteScript(nil)
+			continue
 		}
+		v := sp.ctx.Outs[i]
 		w.WriteUInt64(v.Value)
 		w.WriteScript(v.Script)
 	}
@@ -69,6 +94,20 @@ func (sp *baseSigPacker) Pack(imp ISigScript) ([]byte, error) {
 	return w.Bytes(), nil
 }
 
+func (sp *baseSigPacker) Hash(imp ISigScript) ([]byte, error) {
+	if sp.idx >= len(sp.ctx.Ins) {
+		return sigHashOne.Bytes(), nil
+	}
+	if (sp.ht&0x1F) == script.SIGHASH_SINGLE && sp.idx >= len(sp.ctx.Outs) {
+		return sigHashOne.Bytes(), nil
+	}
+	data, err := sp.Pack(imp)
+	if err != nil {
+		return nil, err
+	}
+	return util.HASH256(data), nil
+}
+
 type witnesSigPacker struct {
 	idx int    //current ints index
 	in  *TxIn  //current in
@@ -145,3 +184,11 @@ func (sp *witnesSigPacker) Pack(imp ISigScript) ([]byte, error) {
 	m.WriteUInt32(sp.ht)
 	return m.Bytes(), nil
 }
+
+func (sp *witnesSigPacker) Hash(imp ISigScript) ([]byte, error) {
+	data, err := sp.Pack(imp)
+	if err != nil {
+		return nil, err
+	}
+	return util.HASH256(data), nil
+}
@@ -0,0 +1,194 @@
+package core
+
+import (
+	"bitcoin/script"
+	"errors"
+	"fmt"
+)
+
+const (
+	//max standard tx version
+	MAX_STANDARD_VERSION = 2
+	//max standard tx weight
+	MAX_STANDARD_TX_WEIGHT = 400000
+	//max standard scriptSig size,15-of-15 p2sh multisig
+	MAX_STANDARD_SCRIPTSIG_SIZE = 1650
+	//max op_return script size
+	MAX_OP_RETURN_RELAY = 83
+	//max bare multisig pubkeys
+	MAX_STANDARD_BARE_MULTISIG = 3
+	//dust relay fee satoshi per 1000 vbytes
+	DUST_RELAY_TX_FEE = 3000
+	//mempool chain limits
+	DEFAULT_ANCESTOR_LIMIT        = 25
+	DEFAULT_ANCESTOR_SIZE_LIMIT   = 101000
+	DEFAULT_DESCENDANT_LIMIT      = 25
+	DEFAULT_DESCENDANT_SIZE_LIMIT = 101000
+	//bip125 in sequence <= this signal replaceable
+	MAX_BIP125_RBF_SEQUENCE = uint32(0xfffffffd)
+	//max entries one replacement can evict
+	MAX_BIP125_REPLACEMENT_CANDIDATES = 100
+	//replacement min fee rate over replaced,satoshi per 1000 vbytes
+	DEFAULT_INCREMENTAL_RELAY_FEE = 1000
+	//script flags checked at mempool acceptance,consensus flags plus policy rules
+	STANDARD_SCRIPT_VERIFY_FLAGS = script.SCRIPT_VERIFY_P2SH |
+		script.SCRIPT_VERIFY_DERSIG |
+		script.SCRIPT_VERIFY_STRICTENC |
+		script.SCRIPT_VERIFY_MINIMALDATA |
+		script.SCRIPT_VERIFY_NULLDUMMY |
+		script.SCRIPT_VERIFY_DISCOURAGE_UPGRADABLE_NOPS |
+		script.SCRIPT_VERIFY_CLEANSTACK |
+		script.SCRIPT_VERIFY_MINIMALIF |
+		script.SCRIPT_VERIFY_NULLFAIL |
+		script.SCRIPT_VERIFY_CHECKLOCKTIMEVERIFY |
+		script.SCRIPT_VERIFY_CHECKSEQUENCEVERIFY |
+		script.SCRIPT_VERIFY_LOW_S |
+		script.SCRIPT_VERIFY_WITNESS |
+		script.SCRIPT_VERIFY_DISCOURAGE_UPGRADABLE_WITNESS_PROGRAM |
+		script.SCRIPT_VERIFY_WITNESS_PUBKEYTYPE |
+		script.SCRIPT_VERIFY_CONST_SCRIPTCODE |
+		script.SCRIPT_VERIFY_TAPROOT |
+		script.SCRIPT_VERIFY_DISCOURAGE_UPGRADABLE_TAPROOT_VERSION |
+		script.SCRIPT_VERIFY_DISCOURAGE_OP_SUCCESS |
+		script.SCRIPT_VERIFY_DISCOURAGE_UPGRADABLE_PUBKEYTYPE
+)
+
+var (
+	ErrTxNonStandard = errors.New("tx non standard")
+	ErrTxDust        = errors.New("tx out dust")
+)
+
+//fee for vsize at rate satoshi per 1000 vbytes
+func GetFeeForSize(rate int64, vsize int) Amount {
+	fee := Amount(rate * int64(vsize) / 1000)
+	if fee == 0 && vsize > 0 && rate > 0 {
+		fee = 1
+	}
+	return fee
+}
+
+//out value less than the fee to spend it
+func GetDustThreshold(out *TxOut) Amount {
+	if out.Script.IsUnspendable() {
+		return 0
+	}
+	h := NewNetHeader()
+	out.Write(h)
+	size := int(h.Len())
+	if out.Script.IsWitnessProgram() {
+		//outpoint + scriptSig len + sequence + witness sig and pubkey
+		size += 32 + 4 + 1 + (107 / script.WITNESS_SCALE_FACTOR) + 4
+	} else {
+		size += 32 + 4 + 1 + 107 + 4
+	}
+	return GetFeeForSize(DUST_RELAY_TX_FEE, size)
+}
+
+func IsDust(out *TxOut) bool {
+	return Amount(out.Value) < GetDustThreshold(out)
+}
+
+//m-of-n bare multisig,n <= 3
+func isStandardMultiSig(s *script.Script) bool {
+	ops := []byte{}
+	keys := 0
+	for i := 0; i < s.Len(); {
+		b, p, op, data := s.GetOp(i)
+		if !b {
+			return false
+		}
+		if len(data) > 0 {
+			if !script.IsCompressedOrUncompressedPubKey(data) {
+				return false
+			}
+			keys++
+		} else {
+			ops = append(ops, op)
+		}
+		i = p
+	}
+	if len(ops) != 3 || ops[2] != script.OP_CHECKMULTISIG {
+		return false
+	}
+	if ops[0] < script.OP_1 || ops[1] < ops[0] || ops[1] > script.OP_16 {
+		return false
+	}
+	n := int(ops[1]-script.OP_1) + 1
+	return n == keys && n <= MAX_STANDARD_BARE_MULTISIG
+}
+
+//standard out script type
+func IsStandardScript(s *script.Script) bool {
+	if s == nil {
+		return false
+	}
+	if s.IsWitnessProgram() {
+		//v0 only p2wpkh p2wsh,other version for upgrade
+		return (*s)[0] != script.OP_0 || s.Len() == 22 || s.Len() == 34
+	}
+	if s.IsNull() {
+		return s.Len() <= MAX_OP_RETURN_RELAY
+	}
+	if s.Len() == 25 && s.IsP2PKH() {
+		return true
+	}
+	return s.IsP2PK() || s.IsP2SH() || isStandardMultiSig(s)
+}
+
+//check tx relay policy
+func IsStandardTx(tx *TX) error {
+	if tx.Ver < 1 || tx.Ver > MAX_STANDARD_VERSION {
+		return fmt.Errorf("%w version %d", ErrTxNonStandard, tx.Ver)
+	}
+	if tx.GetWeight() > MAX_STANDARD_TX_WEIGHT {
+		return fmt.Errorf("%w tx-size %d", ErrTxNonStandard, tx.GetWeight())
+	}
+	for idx, in := range tx.Ins {
+		if in.Script.Len() > MAX_STANDARD_SCRIPTSIG_SIZE {
+			return fmt.Errorf("%w in %d scriptsig-size", ErrTxNonStandard, idx)
+		}
+		if !in.Script.IsPushOnly() {
+			return fmt.Errorf("%w in %d scriptsig-not-pushonly", ErrTxNonStandard, idx)
+		}
+	}
+	nulldata := 0
+	for idx, out := range tx.Outs {
+		if !IsStandardScript(out.Script) {
+			return fmt.Errorf("%w out %d scriptpubkey", ErrTxNonStandard, idx)
+		}
+		if out.Script.IsNull() {
+			nulldata++
+		} else if IsDust(out) {
+			return fmt.Errorf("%w out %d value %d", ErrTxDust, idx, out.Value)
+		}
+	}
+	if nulldata > 1 {
+		return fmt.Errorf("%w multi-op-return", ErrTxNonStandard)
+	}
+	return nil
+}
+
+//check tx ins spend standard outs,ref outs must can load
+func AreInputsStandard(tx *TX) error {
+	for idx, in := range tx.Ins {
+		out, err := in.OutTx()
+		if err != nil {
+			return err
+		}
+		typ := CheckTXType(in, out)
+		if typ == TX_UNKNOW || typ == TX_NONSTANDARD || typ == TX_NULL_DATA {
+			return fmt.Errorf("%w in %d spend nonstandard out", ErrTxNonStandard, idx)
+		}
+	}
+	return nil
+}
+
+//bip125 tx signal replaceable
+func SignalsOptInRBF(tx *TX) bool {
+	for _, in := range tx.Ins {
+		if in.Sequence <= MAX_BIP125_RBF_SEQUENCE {
+			return true
+		}
+	}
+	return false
+}
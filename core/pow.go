@@ -53,3 +53,35 @@ func CalculateWorkRequired(ct uint32, pt uint32, pw uint32) uint32 {
 	}
 	return n.Compact(false)
 }
+
+//block proof work = 2^256 / (target+1)
+//2^256 can't represent,use (~target / (target+1)) + 1
+func GetBlockProof(bits uint32) UIHash {
+	target := UIHash{}
+	n, o := target.SetCompact(bits)
+	if n || o || target.IsZero() {
+		return UIHash{}
+	}
+	not := UIHash{}
+	for i, v := range target {
+		not[i] = ^v
+	}
+	return not.Div(target.Add(NewUIHash(1))).Add(NewUIHash(1))
+}
+
+//difficulty as a multiple of the minimum difficulty
+func GetDifficulty(bits uint32) float64 {
+	shift := (bits >> 24) & 0xff
+	mant := bits & 0x00ffffff
+	if mant == 0 {
+		return 0
+	}
+	diff := float64(0x0000ffff) / float64(mant)
+	for ; shift < 29; shift++ {
+		diff *= 256.0
+	}
+	for ; shift > 29; shift-- {
+		diff /= 256.0
+	}
+	return diff
+}
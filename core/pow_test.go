@@ -2,6 +2,7 @@ package core
 
 import (
 	"bitcoin/config"
+	"bytes"
 	"testing"
 	"time"
 )
@@ -41,3 +42,75 @@ func TestCheckProofOfWork(t *testing.T) {
 		t.Errorf("test 0 height block failed")
 	}
 }
+
+func TestGetDifficulty(t *testing.T) {
+	if GetDifficulty(0x1d00ffff) != 1.0 {
+		t.Errorf("min difficulty error")
+	}
+	if d := GetDifficulty(0x1a05db8b); int64(d) != 2864140 {
+		t.Errorf("difficulty error %f", d)
+	}
+}
+
+func testBitsChain(bits ...uint32) *IndexNode {
+	var n *IndexNode = nil
+	for i, v := range bits {
+		h := &BHeader{Bits: v, Timestamp: uint32(1000 + i*600)}
+		nn := &IndexNode{Header: h, Height: uint32(2016 + i), prev: n}
+		n = nn
+	}
+	return n
+}
+
+func TestMinDifficultyBlocks(t *testing.T) {
+	defer config.SelectNetwork(config.NET_MAIN)
+	conf, err := config.SelectNetwork(config.NET_TEST)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := testBitsChain(0x1c0ffff0, 0x1d00ffff, 0x1d00ffff)
+	if bits := n.NextWorkRequired(n.Header.Timestamp + uint32(conf.PowTargetSpacing*2) + 1); bits != 0x1d00ffff {
+		t.Errorf("min difficulty block bits %x", bits)
+	}
+	if bits := n.NextWorkRequired(n.Header.Timestamp + 600); bits != 0x1c0ffff0 {
+		t.Errorf("last normal block bits %x", bits)
+	}
+	config.SelectNetwork(config.NET_MAIN)
+	if bits := n.NextWorkRequired(n.Header.Timestamp + 6000); bits != 0x1d00ffff {
+		t.Errorf("main network bits %x", bits)
+	}
+}
+
+func TestRegTestNoRetargeting(t *testing.T) {
+	defer config.SelectNetwork(config.NET_MAIN)
+	if _, err := config.SelectNetwork(config.NET_REGTEST); err != nil {
+		t.Fatal(err)
+	}
+	n := &IndexNode{Header: &BHeader{Bits: 0x207fffff}, Height: 2015}
+	if bits := n.NextWorkRequired(0); bits != 0x207fffff {
+		t.Errorf("regtest retarget bits %x", bits)
+	}
+}
+
+func TestNetworkGenesis(t *testing.T) {
+	defer config.SelectNetwork(config.NET_MAIN)
+	for _, id := range []string{config.NET_MAIN, config.NET_TEST, config.NET_SIGNET, config.NET_REGTEST} {
+		conf, err := config.SelectNetwork(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, err := GetGenesisBlock(conf)
+		if err != nil {
+			t.Fatal(id, err)
+		}
+		if !m.IsGenesis() || m.checkBits() != nil {
+			t.Error(id, "genesis bits error")
+		}
+	}
+	if conf, _ := config.NewConfig(config.NET_SIGNET); !bytes.Equal(conf.MsgStart, []byte{0x0a, 0x03, 0xcf, 0x40}) {
+		t.Error("signet message start error")
+	}
+	if _, err := config.NewConfig("xx"); err == nil {
+		t.Error("unknown network error")
+	}
+}
@@ -87,6 +87,9 @@ const (
 	MSG_BLOCK          = 2
 	MSG_FILTERED_BLOCK = 3
 	MSG_CMPCT_BLOCK    = 4
+	MSG_WITNESS_FLAG   = 1 << 30
+	MSG_WITNESS_BLOCK  = MSG_BLOCK | MSG_WITNESS_FLAG
+	MSG_WITNESS_TX     = MSG_TX | MSG_WITNESS_FLAG
 )
 
 const (
@@ -94,6 +97,9 @@ const (
 	MAX_BLOCK_WEIGHT                    = uint(4000000)
 	MAX_BLOCK_SIGOPS_COST               = int64(80000)
 	COINBASE_MATURITY                   = 100
+	MAX_HEADERS_RESULTS                 = 2000
+	MAX_BLOCKS_RESULTS                  = 500
+	MAX_ADDR_RESULTS                    = 1000
 	WITNESS_SCALE_FACTOR                = 4
 	MIN_TRANSACTION_WEIGHT              = WITNESS_SCALE_FACTOR * 60
 	MIN_SERIALIZABLE_TRANSACTION_WEIGHT = WITNESS_SCALE_FACTOR * 10
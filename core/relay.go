@@ -0,0 +1,196 @@
+package core
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	//max inv items in one message
+	MAX_INV_SZ = 50000
+	//average trickle interval for inbound peers,outbound half
+	INVENTORY_BROADCAST_INTERVAL = 5 * time.Second
+	//max tx invs one trickle
+	INVENTORY_BROADCAST_MAX = 35
+	//max tx ids remember per peer
+	MAX_PEER_TX_KNOWN = 50000
+)
+
+//
+type MsgMemPool struct {
+}
+
+func (m *MsgMemPool) Command() string {
+	return NMT_MEMPOOL
+}
+
+func (m *MsgMemPool) Read(h *NetHeader) {
+	//no payload
+}
+
+func (m *MsgMemPool) Write(h *NetHeader) {
+	//no payload
+}
+
+func NewMsgMemPool() *MsgMemPool {
+	return &MsgMemPool{}
+}
+
+//tx without witness data,for MSG_TX request
+type MsgTXNoWitness struct {
+	*MsgTX
+}
+
+func (m MsgTXNoWitness) Write(h *NetHeader) {
+	m.Tx.WriteNoWitness(h)
+}
+
+type relayPeer struct {
+	invs  map[HashID]bool //wait announce
+	known map[HashID]bool //peer has tx
+	next  time.Time       //next trickle time
+}
+
+func (p *relayPeer) addKnown(id HashID) {
+	if len(p.known) >= MAX_PEER_TX_KNOWN {
+		p.known = map[HashID]bool{}
+	}
+	p.known[id] = true
+}
+
+//announce mempool tx to peers
+type TxRelay struct {
+	mu    sync.Mutex
+	peers map[string]*relayPeer
+}
+
+var (
+	Relay = NewTxRelay()
+)
+
+func NewTxRelay() *TxRelay {
+	return &TxRelay{peers: map[string]*relayPeer{}}
+}
+
+//poisson distributed delay with average avg
+func poissonDelay(avg time.Duration) time.Duration {
+	return time.Duration(rand.ExpFloat64() * float64(avg))
+}
+
+//peer want tx inv
+func canRelayTx(c *Client) bool {
+	return c.VerInfo != nil && c.VerInfo.Relay != 0
+}
+
+func (r *TxRelay) peer(c *Client) *relayPeer {
+	p, ok := r.peers[c.Key()]
+	if !ok {
+		p = &relayPeer{invs: map[HashID]bool{}, known: map[HashID]bool{}}
+		r.peers[c.Key()] = p
+	}
+	return p
+}
+
+func (r *TxRelay) RemovePeer(c *Client) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.peers, c.Key())
+}
+
+//peer sent or announced tx
+func (r *TxRelay) AddKnown(c *Client, id HashID) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p := r.peer(c)
+	p.addKnown(id)
+	delete(p.invs, id)
+}
+
+func (r *TxRelay) IsKnown(c *Client, id HashID) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p, ok := r.peers[c.Key()]
+	return ok && p.known[id]
+}
+
+//queue tx inv to peer,send at next trickle
+func (r *TxRelay) Queue(c *Client, id HashID) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p := r.peer(c)
+	if p.known[id] {
+		return
+	}
+	p.invs[id] = true
+}
+
+//announce tx to all connected peers except from
+func (r *TxRelay) Announce(id HashID, from *Client) {
+	cs := append(OutIps.All(), InIps.All()...)
+	for _, c := range cs {
+		if c == from || !canRelayTx(c) {
+			continue
+		}
+		r.Queue(c, id)
+	}
+}
+
+//pop queued invs if trickle time arrived
+func (r *TxRelay) Trickle(c *Client, now time.Time) *MsgINV {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p, ok := r.peers[c.Key()]
+	if !ok || len(p.invs) == 0 || now.Before(p.next) {
+		return nil
+	}
+	if c.Type == ClientTypeIn {
+		p.next = now.Add(poissonDelay(INVENTORY_BROADCAST_INTERVAL))
+	} else {
+		p.next = now.Add(poissonDelay(INVENTORY_BROADCAST_INTERVAL / 2))
+	}
+	es := []*TxEntry{}
+	for id := range p.invs {
+		e := TxsMap.Entry(id)
+		//removed from mempool or below peer feefilter
+		if e == nil || e.FeeRate() < c.FeeRate {
+			delete(p.invs, id)
+			continue
+		}
+		es = append(es, e)
+	}
+	//parents first,then higher fee rate
+	deps := map[HashID]int{}
+	for _, e := range es {
+		deps[e.Tx.Hash] = len(TxsMap.Ancestors(e.Tx.Hash))
+	}
+	sort.Slice(es, func(i, j int) bool {
+		a, b := es[i], es[j]
+		if deps[a.Tx.Hash] != deps[b.Tx.Hash] {
+			return deps[a.Tx.Hash] < deps[b.Tx.Hash]
+		}
+		return feeRateLess(b.Fee, b.VSize, a.Fee, a.VSize)
+	})
+	if len(es) > INVENTORY_BROADCAST_MAX {
+		es = es[:INVENTORY_BROADCAST_MAX]
+	}
+	if len(es) == 0 {
+		return nil
+	}
+	m := NewMsgINV()
+	for _, e := range es {
+		id := e.Tx.Hash
+		delete(p.invs, id)
+		p.addKnown(id)
+		m.Invs = append(m.Invs, &Inventory{Type: MSG_TX, ID: id})
+	}
+	return m
+}
+
+//send queued tx invs,call from client loop
+func (r *TxRelay) Flush(c *Client) {
+	if m := r.Trickle(c, time.Now()); m != nil {
+		c.WriteMsg(m)
+	}
+}
@@ -0,0 +1,102 @@
+package core
+
+import (
+	"bitcoin/script"
+	"testing"
+	"time"
+)
+
+func TestRelayTrickle(t *testing.T) {
+	testMempool(t)
+	pk, pks := testP2PKHKey(t)
+	ina := testAddCoin(t, HashID{1}, uint64(COIN), pks)
+	tx1 := testSignTx(t, pk, pks, []*TxIn{ina}, uint64(COIN)-100000)
+	if _, err := TxsMap.AcceptTx(tx1); err != nil {
+		t.Fatal(err)
+	}
+	tx2 := testSignTx(t, pk, pks, []*TxIn{{OutHash: tx1.Hash, Sequence: script.SEQUENCE_FINAL}}, uint64(COIN)-900000)
+	if _, err := TxsMap.AcceptTx(tx2); err != nil {
+		t.Fatal(err)
+	}
+	r := NewTxRelay()
+	pa := testDownloadPeer("1.1.1.1", 0)
+	pb := testDownloadPeer("2.2.2.2", 0)
+	pb.FeeRate = TxsMap.Entry(tx1.Hash).FeeRate() + 1
+	for _, p := range []*Client{pa, pb} {
+		r.Queue(p, tx2.Hash)
+		r.Queue(p, tx1.Hash)
+	}
+	now := time.Now()
+	m := r.Trickle(pa, now)
+	if m == nil || len(m.Invs) != 2 || !m.Invs[0].ID.Equal(tx1.Hash) || m.Invs[0].Type != MSG_TX {
+		t.Fatal("trickle parent first error")
+	}
+	//tx2 fee rate higher,tx1 below feefilter
+	if m := r.Trickle(pb, now); m == nil || len(m.Invs) != 1 || !m.Invs[0].ID.Equal(tx2.Hash) {
+		t.Fatal("trickle feefilter error")
+	}
+	//known tx not queue again
+	r.Queue(pa, tx1.Hash)
+	if m := r.Trickle(pa, now.Add(time.Hour)); m != nil {
+		t.Error("trickle known tx error")
+	}
+	inb := testAddCoin(t, HashID{2}, uint64(COIN), pks)
+	tx3 := testSignTx(t, pk, pks, []*TxIn{inb}, uint64(COIN)-100000)
+	if _, err := TxsMap.AcceptTx(tx3); err != nil {
+		t.Fatal(err)
+	}
+	r.Queue(pa, tx3.Hash)
+	if m := r.Trickle(pa, now); m != nil {
+		t.Error("trickle before next time error")
+	}
+	if m := r.Trickle(pa, now.Add(time.Hour)); m == nil || len(m.Invs) != 1 {
+		t.Error("trickle next time error")
+	}
+	//version relay flag
+	pa.VerInfo.Relay = 1
+	if !canRelayTx(pa) || canRelayTx(pb) {
+		t.Error("relay flag error")
+	}
+}
+
+func TestServeTxData(t *testing.T) {
+	testMempool(t)
+	pk, pks := testP2PKHKey(t)
+	ina := testAddCoin(t, HashID{1}, uint64(COIN), pks)
+	tx1 := testSignTx(t, pk, pks, []*TxIn{ina}, uint64(COIN)-100000)
+	if _, err := TxsMap.AcceptTx(tx1); err != nil {
+		t.Fatal(err)
+	}
+	c := testDownloadPeer("1.1.1.1", 0)
+	gm := NewMsgGetData()
+	gm.AddHash(MSG_WITNESS_TX, tx1.Hash[:])
+	gm.AddHash(MSG_TX, tx1.Hash[:])
+	nid := HashID{9}
+	gm.AddHash(MSG_TX, nid[:])
+	if err := processGetData(0, c, gm); err != nil {
+		t.Fatal(err)
+	}
+	if tm, ok := (<-c.wc).(*MsgTX); !ok || !tm.Tx.Hash.Equal(tx1.Hash) {
+		t.Fatal("getdata witness tx error")
+	}
+	if tm, ok := (<-c.wc).(MsgTXNoWitness); !ok || !tm.Tx.Hash.Equal(tx1.Hash) {
+		t.Fatal("getdata tx error")
+	}
+	if nf, ok := (<-c.wc).(*MsgNotFound); !ok || len(nf.Invs) != 1 {
+		t.Fatal("getdata notfound error")
+	}
+	//mempool message
+	if err := processMemPool(0, c, NewMsgMemPool()); err != nil {
+		t.Fatal(err)
+	}
+	if inv, ok := (<-c.wc).(*MsgINV); !ok || len(inv.Invs) != 1 || !inv.Invs[0].ID.Equal(tx1.Hash) {
+		t.Fatal("mempool inv error")
+	}
+	c.FeeRate = TxsMap.Entry(tx1.Hash).FeeRate() + 1
+	if err := processMemPool(0, c, NewMsgMemPool()); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.wc) != 0 {
+		t.Error("mempool feefilter error")
+	}
+}
@@ -224,6 +224,16 @@ func (m *ClientMap) Iter(f func(c *Client) bool) {
 	}
 }
 
+func (m *ClientMap) All() []*Client {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ds := []*Client{}
+	for _, v := range m.nodes {
+		ds = append(ds, v)
+	}
+	return ds
+}
+
 func (m *ClientMap) Has(c *Client) bool {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -319,6 +329,23 @@ var (
 	Addrs    = NewAddrMap()
 )
 
+//dispatch peer message to worker
+func dispatchMsg(c *Client, msg MsgIO) {
+	cmd := msg.Command()
+	switch cmd {
+	case NMT_HEADERS, NMT_GETHEADERS, NMT_GETBLOCKS:
+		WorkerQueue <- NewWorkerUnit(msg, c)
+	case NMT_BLOCK, NMT_TX, NMT_INV:
+		WorkerQueue <- NewWorkerUnit(msg, c)
+	case NMT_CMPCTBLOCK, NMT_GETBLOCKTXN, NMT_BLOCKTXN:
+		WorkerQueue <- NewWorkerUnit(msg, c)
+	case NMT_GETDATA, NMT_GETADDR, NMT_MEMPOOL:
+		WorkerQueue <- NewWorkerUnit(msg, c)
+	case NMT_ADDR:
+		RecvAddr <- msg.(*MsgAddr)
+	}
+}
+
 func startconnect(ip IPPort) {
 	c := NewClientWithIPPort(ClientTypeOut, ip)
 	c.SetListener(&ClientListener{
@@ -327,20 +354,13 @@ func startconnect(ip IPPort) {
 		},
 		OnClosed: func() {
 			Addrs.Close(c.IP)
+			Download.RemovePeer(c)
 		},
 		OnLoop: func() {
 			Addrs.Update(c)
 		},
 		OnMessage: func(msg MsgIO) {
-			cmd := msg.Command()
-			switch cmd {
-			case NMT_HEADERS, NMT_GETHEADERS:
-				WorkerQueue <- NewWorkerUnit(msg, c)
-			case NMT_BLOCK, NMT_TX, NMT_INV:
-				WorkerQueue <- NewWorkerUnit(msg, c)
-			case NMT_ADDR:
-				RecvAddr <- msg.(*MsgAddr)
-			}
+			dispatchMsg(c, msg)
 			Addrs.UpRead(c.IP)
 		},
 		OnWrite: func(msg MsgIO) {
@@ -371,8 +391,7 @@ func processAddrs(addr *MsgAddr, conf *config.Config) {
 }
 
 var (
-	Notice  = make(chan *Client, 10)
-	Headers = NewBlockHeaderList()
+	Notice = make(chan *Client, 10)
 )
 
 func syncData(client *Client, conf *config.Config) {
@@ -386,16 +405,12 @@ func syncData(client *Client, conf *config.Config) {
 			ID:   NewHashID(conf.GenesisBlock),
 		})
 		client.WriteMsg(m)
-	} else if Headers.Len() == 0 {
-		m := NewMsgGetHeaders()
-		NewMsgGetBlocks()
-		m.AddHashID(G.LastHash())
-		client.WriteMsg(m)
-	} else if h := Headers.Front(); h != nil {
-		m := NewMsgGetData()
-		m.AddHash(MSG_BLOCK, h.Hash[:])
-		client.WriteMsg(m)
+		return
+	}
+	if Download.NeedHeaders(client) {
+		RequestHeaders(client, Index.BestHeader())
 	}
+	Download.Schedule(Index.Get(G.LastHash()), OutIps.All())
 }
 
 func StartDispatch(ctx context.Context) {
@@ -0,0 +1,86 @@
+package core
+
+import (
+	"bitcoin/config"
+	"bitcoin/script"
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+const (
+	//OP_RETURN 0x24 aa21a9ed + 32 bytes commitment
+	MIN_WITNESS_COMMITMENT_SIZE = 38
+)
+
+var (
+	//bip141 witness commitment out header
+	WitnessCommitmentHeader = []byte{0xaa, 0x21, 0xa9, 0xed}
+	//block witness data malleated or missing,block may valid with right witness
+	ErrBlockMutated = errors.New("block witness mutated")
+)
+
+//block witness root,coinbase wtxid is zero
+func BlockWitnessRoot(txs []*TX) HashID {
+	ids := []HashID{}
+	for i, v := range txs {
+		if i == 0 {
+			ids = append(ids, ZeroHashID)
+		} else {
+			ids = append(ids, v.WitnessHash())
+		}
+	}
+	root, _, _ := BuildMerkleTree(ids).Extract()
+	return root
+}
+
+//last coinbase out with witness commitment,-1 not found
+func GetWitnessCommitmentIndex(cb *TX) int {
+	idx := -1
+	for i, v := range cb.Outs {
+		s := v.Script
+		if s.Len() >= MIN_WITNESS_COMMITMENT_SIZE && (*s)[0] == script.OP_RETURN && (*s)[1] == 0x24 &&
+			bytes.Equal(s.SubBytes(2, 6), WitnessCommitmentHeader) {
+			idx = i
+		}
+	}
+	return idx
+}
+
+//bip141 block weight,header and tx count scaled
+func (m *MsgBlock) GetWeight() int {
+	h := NewNetHeader()
+	weight := (80 + h.WriteVarInt(len(m.Txs))) * WITNESS_SCALE_FACTOR
+	for _, v := range m.Txs {
+		weight += v.GetWeight()
+	}
+	return weight
+}
+
+//check coinbase witness commitment,no witness data allowed without commitment
+func (m *MsgBlock) checkWitness(flags int) error {
+	cb := m.Txs[0]
+	idx := -1
+	if flags&script.SCRIPT_VERIFY_WITNESS != 0 && m.Height >= config.GetConfig().SegwitHeight {
+		idx = GetWitnessCommitmentIndex(cb)
+	}
+	if idx >= 0 {
+		in := cb.Ins[0]
+		if !cb.HasWitness() || in.Witness == nil || len(in.Witness.Script) != 1 || in.Witness.Script[0].Len() != 32 {
+			return fmt.Errorf("bad-witness-nonce-size %w", ErrBlockMutated)
+		}
+		root := BlockWitnessRoot(m.Txs)
+		id := HashID{}
+		HASH256To(append(root[:], in.Witness.Script[0].Bytes()...), &id)
+		if !bytes.Equal(cb.Outs[idx].Script.SubBytes(6, 38), id[:]) {
+			return fmt.Errorf("bad-witness-merkle-match %w", ErrBlockMutated)
+		}
+		return nil
+	}
+	for _, v := range m.Txs {
+		if v.HasWitness() {
+			return fmt.Errorf("unexpected-witness tx=%v %w", v.Hash, ErrBlockMutated)
+		}
+	}
+	return nil
+}
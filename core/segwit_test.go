@@ -0,0 +1,112 @@
+package core
+
+import (
+	"bitcoin/config"
+	"bitcoin/script"
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+//rebuild merkle,mine and reread block like recv from network
+func testRemineBlock(t *testing.T, m *MsgBlock) *MsgBlock {
+	txids := []HashID{}
+	for _, v := range m.Txs {
+		v.Write(NewNetHeader())
+		txids = append(txids, v.Hash)
+	}
+	m.Merkle, _, _ = BuildMerkleTree(txids).Extract()
+	if err := MineBlock(m, DEFAULT_MAX_TRIES); err != nil {
+		t.Fatal(err)
+	}
+	h := NewNetHeader()
+	m.Write(h)
+	b := NewMsgBlock()
+	b.Read(NewNetHeader(h.Bytes()))
+	b.Height = m.Height
+	return b
+}
+
+func TestWitnessCommitment(t *testing.T) {
+	defer config.SelectNetwork(config.NET_MAIN)
+	testRegTest(t)
+	_, pks := testP2PKHKey(t)
+	m, err := NewBlockTemplate(pks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := testRemineBlock(t, m)
+	if GetWitnessCommitmentIndex(b.Txs[0]) != 1 {
+		t.Fatal("witness commitment index error")
+	}
+	if err := b.Check(); err != nil {
+		t.Fatal(err)
+	}
+	//commitment not match
+	m1, _ := NewBlockTemplate(pks)
+	(*m1.Txs[0].Outs[1].Script)[10] ^= 1
+	if err := testRemineBlock(t, m1).Check(); !errors.Is(err, ErrBlockMutated) {
+		t.Error("bad commitment check error", err)
+	}
+	//witness nonce stripped
+	m2, _ := NewBlockTemplate(pks)
+	m2.Txs[0].SetHasWitness(false)
+	b2 := testRemineBlock(t, m2)
+	if err := b2.Check(); !errors.Is(err, ErrBlockMutated) {
+		t.Error("miss witness nonce check error", err)
+	}
+	//mutated block not mark header failed
+	G.Lock()
+	err = G.AcceptBlock(b2)
+	G.Unlock()
+	if !errors.Is(err, ErrBlockMutated) {
+		t.Fatal("accept mutated block error", err)
+	}
+	if n := Index.Get(b2.Hash); n == nil || n.IsFailed() || n.HasData() {
+		t.Error("mutated block index status error")
+	}
+	//witness data without commitment
+	m3, _ := NewBlockTemplate(pks)
+	m3.Txs[0].Outs = m3.Txs[0].Outs[:1]
+	if err := testRemineBlock(t, m3).Check(); !errors.Is(err, ErrBlockMutated) {
+		t.Error("unexpected witness check error", err)
+	}
+}
+
+func TestBlockWeightLimit(t *testing.T) {
+	defer config.SelectNetwork(config.NET_MAIN)
+	testRegTest(t)
+	_, pks := testP2PKHKey(t)
+	m, err := NewBlockTemplate(pks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	big := bytes.Repeat([]byte{script.OP_NOP}, int(MAX_BLOCK_WEIGHT)/WITNESS_SCALE_FACTOR)
+	m.Txs[0].Outs = append(m.Txs[0].Outs, &TxOut{Script: script.NewScript(big)})
+	addWitnessCommitment(m.Txs[0], m.Txs)
+	b := testRemineBlock(t, m)
+	if b.GetWeight() <= int(MAX_BLOCK_WEIGHT) {
+		t.Fatal("block weight error", b.GetWeight())
+	}
+	if err := b.Check(); err == nil || !strings.Contains(err.Error(), "bad-blk-weight") {
+		t.Error("block weight limit check error", err)
+	}
+}
+
+func TestBlockSigOpsLimit(t *testing.T) {
+	defer config.SelectNetwork(config.NET_MAIN)
+	testRegTest(t)
+	_, pks := testP2PKHKey(t)
+	m, err := NewBlockTemplate(pks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ops := bytes.Repeat([]byte{script.OP_CHECKSIG}, int(MAX_BLOCK_SIGOPS_COST)/WITNESS_SCALE_FACTOR+1)
+	m.Txs[0].Outs = append(m.Txs[0].Outs, &TxOut{Script: script.NewScript(ops)})
+	addWitnessCommitment(m.Txs[0], m.Txs)
+	b := testRemineBlock(t, m)
+	if err := b.Check(); err == nil || !strings.Contains(err.Error(), "bad-blk-sigops") {
+		t.Error("block sigops limit check error", err)
+	}
+}
@@ -0,0 +1,105 @@
+package core
+
+import (
+	"bitcoin/config"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	//accepted inbound connections,handshaken or not
+	inConns int32
+	//inbound peer must send version in time
+	inVersionTimeout = time.Second * 5
+)
+
+//start accept inbound client
+func startaccept(conn net.Conn) {
+	addr, ok := conn.RemoteAddr().(*net.TCPAddr)
+	if !ok {
+		conn.Close()
+		return
+	}
+	atomic.AddInt32(&inConns, 1)
+	c := NewClientWithIPPort(ClientTypeIn, IPPort{ip: addr.IP, port: addr.Port})
+	c.Conn = conn
+	c.SetListener(&ClientListener{
+		OnMessage: func(msg MsgIO) {
+			dispatchMsg(c, msg)
+		},
+		OnError: func(err interface{}) {
+			//log.Println(c.IP, "close err ", err)
+		},
+		OnClosed: func() {
+			atomic.AddInt32(&inConns, -1)
+		},
+	})
+	//read fail if version not recv,cleared in OnVersion
+	conn.SetReadDeadline(time.Now().Add(inVersionTimeout))
+	c.Run()
+}
+
+//accept inbound client until listener closed
+func serveListener(ctx context.Context, lis net.Listener, conf *config.Config) error {
+	for {
+		conn, err := lis.Accept()
+		if ctx.Err() != nil {
+			return fmt.Errorf("listen end, return %w", ctx.Err())
+		}
+		if err != nil {
+			return fmt.Errorf("accept error %w", err)
+		}
+		if int(atomic.LoadInt32(&inConns)) >= conf.MaxInConn {
+			conn.Close()
+			continue
+		}
+		startaccept(conn)
+	}
+}
+
+//start listen inbound client
+func StartListen(ctx context.Context) {
+	defer func() {
+		MWG.Done()
+	}()
+	MWG.Add(1)
+	mfx := func() error {
+		defer func() {
+			if err := recover(); err != nil {
+				log.Println("[listen error]:", err)
+			}
+		}()
+		conf := config.GetConfig()
+		addr := net.JoinHostPort(conf.ListenAddr, fmt.Sprintf("%d", conf.ListenPort))
+		lis, err := net.Listen("tcp", addr)
+		if err != nil {
+			return fmt.Errorf("listen %s error %w", addr, err)
+		}
+		log.Println("listen start", addr)
+		done := make(chan bool)
+		defer close(done)
+		go func() {
+			select {
+			case <-ctx.Done():
+			case <-done:
+			}
+			lis.Close()
+		}()
+		return serveListener(ctx, lis, conf)
+	}
+	for {
+		err := mfx()
+		if err != nil {
+			log.Println(err)
+		}
+		if errors.Is(err, context.Canceled) {
+			break
+		}
+		time.Sleep(time.Second * 3)
+	}
+}
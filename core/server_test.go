@@ -0,0 +1,200 @@
+package core
+
+import (
+	"bitcoin/config"
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func testReadMsg(t *testing.T, conn net.Conn) *NetHeader {
+	conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+	h, err := ReadMsg(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func TestInboundHandshake(t *testing.T) {
+	UseMemDB()
+	conf := config.GetConfig()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip("listen error", err)
+	}
+	omax := conf.MaxInConn
+	conf.MaxInConn = 1
+	ctx, cancel := context.WithCancel(context.Background())
+	defer func() {
+		cancel()
+		lis.Close()
+		conf.MaxInConn = omax
+	}()
+	go serveListener(ctx, lis, conf)
+	conn, err := net.Dial("tcp", lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	local := IPPort{ip: net.ParseIP("127.0.0.1"), port: 8333}
+	if err := WriteMsg(conn, NewMsgVersion(local, local)); err != nil {
+		t.Fatal(err)
+	}
+	if h := testReadMsg(t, conn); h.Command != NMT_VERSION {
+		t.Fatalf("recv %s,want version", h.Command)
+	}
+	if h := testReadMsg(t, conn); h.Command != NMT_VERACK {
+		t.Fatalf("recv %s,want verack", h.Command)
+	}
+	if err := WriteMsg(conn, NewMsgVerAck()); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteMsg(conn, NewMsgGetAddr()); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case unit := <-WorkerQueue:
+		if unit.m.Command() != NMT_GETADDR || unit.c.Type != ClientTypeIn {
+			t.Errorf("dispatch %s error", unit.m.Command())
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("getaddr not dispatch")
+	}
+	//max in conn
+	conn2, err := net.Dial("tcp", lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn2.Close()
+	conn2.SetReadDeadline(time.Now().Add(time.Second * 5))
+	if _, err := ReadMsg(conn2); err == nil {
+		t.Error("max in conn not enforce")
+	}
+}
+
+func TestInboundNoVersion(t *testing.T) {
+	UseMemDB()
+	conf := config.GetConfig()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip("listen error", err)
+	}
+	omax, otimeout := conf.MaxInConn, inVersionTimeout
+	conf.MaxInConn = 1
+	inVersionTimeout = time.Millisecond * 500
+	ctx, cancel := context.WithCancel(context.Background())
+	defer func() {
+		cancel()
+		lis.Close()
+		conf.MaxInConn = omax
+		inVersionTimeout = otimeout
+	}()
+	//wait other tests inbound closed
+	for i := 0; i < 50 && atomic.LoadInt32(&inConns) > 0; i++ {
+		time.Sleep(time.Millisecond * 100)
+	}
+	go serveListener(ctx, lis, conf)
+	//not send version,still count
+	conn, err := net.Dial("tcp", lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	for i := 0; i < 50 && atomic.LoadInt32(&inConns) == 0; i++ {
+		time.Sleep(time.Millisecond * 10)
+	}
+	conn2, err := net.Dial("tcp", lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn2.Close()
+	conn2.SetReadDeadline(time.Now().Add(time.Millisecond * 300))
+	if _, err := conn2.Read(make([]byte, 1)); err == nil || testIsTimeout(err) {
+		t.Error("max in conn not count connection without version")
+	}
+	//dropped after version timeout
+	conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+	if _, err := conn.Read(make([]byte, 1)); err == nil || testIsTimeout(err) {
+		t.Error("connection without version not dropped")
+	}
+}
+
+func testIsTimeout(err error) bool {
+	ne, ok := err.(net.Error)
+	return ok && ne.Timeout()
+}
+
+func testServeChain(t *testing.T) []*MsgBlock {
+	UseMemDB()
+	Index = NewBlockIndex()
+	gb := testGenesis(t)
+	if err := gb.Save(true); err != nil {
+		t.Fatal(err)
+	}
+	testIndexBlock(gb, IndexStatusData)
+	ms := []*MsgBlock{gb}
+	for i := 1; i <= 3; i++ {
+		m := testNewBlock(ms[i-1], testCoinbaseTx(int64(i), testP2PKHScript(1)))
+		if err := m.Save(true); err != nil {
+			t.Fatal(err)
+		}
+		testIndexBlock(m, IndexStatusData)
+		ms = append(ms, m)
+	}
+	return ms
+}
+
+func TestServeGetHeadersBlocks(t *testing.T) {
+	ms := testServeChain(t)
+	c := testDownloadPeer("1.1.1.1", 0)
+	//locator with unknown hash
+	gh := NewMsgGetHeaders()
+	gh.AddHashID(HashID{1})
+	gh.AddHashID(ms[1].Hash)
+	if err := processGetHeaders(0, c, gh); err != nil {
+		t.Fatal(err)
+	}
+	hm := (<-c.wc).(*MsgHeaders)
+	if len(hm.Headers) != 2 || !hm.Headers[0].Hash.Equal(ms[2].Hash) || !hm.Headers[1].Hash.Equal(ms[3].Hash) {
+		t.Fatal("getheaders result error")
+	}
+	//stop hash
+	gh = NewMsgGetHeaders()
+	gh.AddHashID(ms[0].Hash)
+	gh.Stop = ms[2].Hash
+	processGetHeaders(0, c, gh)
+	if hm := (<-c.wc).(*MsgHeaders); len(hm.Headers) != 2 {
+		t.Fatal("getheaders stop error")
+	}
+	gb := NewMsgGetBlocks()
+	gb.AddHashID(ms[0].Hash)
+	processGetBlocks(0, c, gb)
+	im := (<-c.wc).(*MsgINV)
+	if len(im.Invs) != 3 || !im.Invs[0].ID.Equal(ms[1].Hash) || im.Invs[0].Type != MSG_BLOCK {
+		t.Fatal("getblocks result error")
+	}
+}
+
+func TestServeGetData(t *testing.T) {
+	ms := testServeChain(t)
+	c := testDownloadPeer("1.1.1.1", 0)
+	gd := NewMsgGetData()
+	gd.AddHash(MSG_WITNESS_BLOCK, ms[1].Hash[:])
+	gd.AddHash(MSG_BLOCK, ms[2].Hash[:])
+	gd.AddHash(MSG_BLOCK, HashID{1}.Bytes())
+	if err := processGetData(0, c, gd); err != nil {
+		t.Fatal(err)
+	}
+	if bv, ok := (<-c.wc).(*MsgBlock); !ok || !bv.Hash.Equal(ms[1].Hash) {
+		t.Fatal("getdata witness block error")
+	}
+	if bv, ok := (<-c.wc).(MsgBlockNoWitness); !ok || !bv.Hash.Equal(ms[2].Hash) {
+		t.Fatal("getdata block error")
+	}
+	if nf, ok := (<-c.wc).(*MsgNotFound); !ok || len(nf.Invs) != 1 {
+		t.Fatal("getdata notfound error")
+	}
+}
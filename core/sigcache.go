@@ -0,0 +1,135 @@
+package core
+
+import (
+	"bitcoin/script"
+	"crypto/rand"
+	"sync"
+)
+
+const (
+	//max cached verified signatures
+	DEFAULT_SIG_CACHE_SIZE = 100000
+	//max cached verified txs scripts
+	DEFAULT_SCRIPT_CACHE_SIZE = 50000
+	//sig cache key domain,ecdsa and schnorr entries never collide
+	SIG_CACHE_ECDSA   = byte('E')
+	SIG_CACHE_SCHNORR = byte('S')
+)
+
+//bounded hash set with random salt,random evict when full
+type saltedCache struct {
+	mu    sync.Mutex
+	salt  [32]byte
+	max   int
+	items map[HashID]struct{}
+}
+
+func newSaltedCache(max int) *saltedCache {
+	c := &saltedCache{max: max, items: map[HashID]struct{}{}}
+	if _, err := rand.Read(c.salt[:]); err != nil {
+		panic(err)
+	}
+	return c
+}
+
+func (c *saltedCache) key(vs ...[]byte) HashID {
+	b := append([]byte{}, c.salt[:]...)
+	for _, v := range vs {
+		b = append(b, v...)
+	}
+	id := HashID{}
+	return HASH256To(b, &id)
+}
+
+func (c *saltedCache) has(k HashID) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.items[k]
+	return ok
+}
+
+func (c *saltedCache) add(k HashID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.items[k]; ok {
+		return
+	}
+	//map range order random
+	for ek := range c.items {
+		if len(c.items) < c.max {
+			break
+		}
+		delete(c.items, ek)
+	}
+	c.items[k] = struct{}{}
+}
+
+func (c *saltedCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.items)
+}
+
+//verified signatures,key (domain,sighash,pubkey,signature)
+type SigCacher struct {
+	*saltedCache
+}
+
+func NewSigCacher(max int) *SigCacher {
+	return &SigCacher{saltedCache: newSaltedCache(max)}
+}
+
+//verify sig with cache,cache valid sig
+func (c *SigCacher) Verify(hash []byte, pub *script.PublicKey, sig *script.SigValue, pubv []byte, sigv []byte) bool {
+	k := c.key([]byte{SIG_CACHE_ECDSA}, hash, pubv, sigv)
+	if c.has(k) {
+		return true
+	}
+	if !pub.Verify(hash, sig) {
+		return false
+	}
+	c.add(k)
+	return true
+}
+
+//verify bip340 sig with cache,sigv may has hashtype byte
+func (c *SigCacher) VerifySchnorr(hash []byte, pub script.XOnlyPublicKey, sig *script.SchnorrSig, pubv []byte, sigv []byte) bool {
+	k := c.key([]byte{SIG_CACHE_SCHNORR}, hash, pubv, sigv)
+	if c.has(k) {
+		return true
+	}
+	if !pub.Verify(hash, sig) {
+		return false
+	}
+	c.add(k)
+	return true
+}
+
+//txs all ins scripts verified,key (wtxid,flags)
+type ScriptCacher struct {
+	*saltedCache
+}
+
+func NewScriptCacher(max int) *ScriptCacher {
+	return &ScriptCacher{saltedCache: newSaltedCache(max)}
+}
+
+func (c *ScriptCacher) txKey(tx *TX, flags int) HashID {
+	wid := tx.WitnessHash()
+	fb := []byte{0, 0, 0, 0}
+	ByteOrder.PutUint32(fb, uint32(flags))
+	return c.key(wid[:], fb)
+}
+
+func (c *ScriptCacher) Has(tx *TX, flags int) bool {
+	return c.has(c.txKey(tx, flags))
+}
+
+func (c *ScriptCacher) Add(tx *TX, flags int) {
+	c.add(c.txKey(tx, flags))
+}
+
+var (
+	SigCache    = NewSigCacher(DEFAULT_SIG_CACHE_SIZE)
+	ScriptCache = NewScriptCacher(DEFAULT_SCRIPT_CACHE_SIZE)
+)
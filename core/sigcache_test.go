@@ -0,0 +1,80 @@
+package core
+
+import (
+	"bitcoin/script"
+	"bitcoin/util"
+	"testing"
+)
+
+func TestSigCache(t *testing.T) {
+	pk, _ := testP2PKHKey(t)
+	pub := pk.PublicKey()
+	hash := util.HASH256([]byte("sig cache"))
+	sig, err := pk.Sign(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewSigCacher(2)
+	pubv, sigv := pub.Marshal(), sig.Encode()
+	if !c.Verify(hash, pub, sig, pubv, sigv) || c.Len() != 1 {
+		t.Fatal("verify sig cache error")
+	}
+	if !c.Verify(hash, pub, sig, pubv, sigv) || c.Len() != 1 {
+		t.Error("cached sig verify error")
+	}
+	//invalid sig not cached
+	other := util.HASH256([]byte("other"))
+	if c.Verify(other, pub, sig, pubv, sigv) || c.Len() != 1 {
+		t.Error("invalid sig cache error")
+	}
+	for i := byte(0); i < 3; i++ {
+		c.add(HashID{i})
+	}
+	if c.Len() != 2 {
+		t.Error("sig cache bound error", c.Len())
+	}
+}
+
+func TestSigCacheDomain(t *testing.T) {
+	pk := testTaprootKey(t)
+	hash := util.HASH256([]byte("sig cache domain"))
+	ssig, err := pk.SignSchnorr(hash, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	xk := pk.XOnlyPublicKey()
+	c := NewSigCacher(10)
+	pubv, sigv := xk[:], ssig.Encode()
+	if !c.VerifySchnorr(hash, xk, ssig, pubv, sigv) || c.Len() != 1 {
+		t.Fatal("verify schnorr sig cache error")
+	}
+	//same bytes as ecdsa entry not hit schnorr cache
+	other, err := pk.Sign(util.HASH256([]byte("other")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Verify(hash, pk.PublicKey(), other, pubv, sigv) {
+		t.Error("ecdsa verify hit schnorr cache entry")
+	}
+}
+
+func TestScriptCache(t *testing.T) {
+	testMempool(t)
+	ScriptCache = NewScriptCacher(DEFAULT_SCRIPT_CACHE_SIZE)
+	pk, pks := testP2PKHKey(t)
+	in := testAddCoin(t, HashID{1}, 100000, pks)
+	tx := testSignTx(t, pk, pks, []*TxIn{in}, 90000)
+	if _, err := TxsMap.AcceptTx(tx); err != nil {
+		t.Fatal(err)
+	}
+	flags := G.LastBlock().GetScriptFlags()
+	if !ScriptCache.Has(tx, flags) || ScriptCache.Has(tx, flags^script.SCRIPT_VERIFY_P2SH) {
+		t.Fatal("mempool tx script cache error")
+	}
+	//changed tx not cached
+	tx.Ins[0].Script = script.NewScript([]byte{script.OP_0})
+	tx.Write(NewNetHeader())
+	if ScriptCache.Has(tx, flags) || VerifyTX(tx, flags) == nil {
+		t.Error("changed tx script verify error")
+	}
+}
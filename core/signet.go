@@ -0,0 +1,137 @@
+package core
+
+import (
+	"bitcoin/config"
+	"bitcoin/script"
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+const (
+	//bip325 solution script flags
+	SIGNET_SCRIPT_FLAGS = script.SCRIPT_VERIFY_P2SH | script.SCRIPT_VERIFY_WITNESS | script.SCRIPT_VERIFY_DERSIG | script.SCRIPT_VERIFY_NULLDUMMY
+)
+
+var (
+	//bip325 signet solution push header in witness commitment out
+	SignetHeader = []byte{0xec, 0xc7, 0xda, 0xa2}
+	//block solution not satisfy signet challenge
+	ErrSignetSolution = errors.New("bad-signet-blksig")
+)
+
+//find first push with signet header and data,return data after header
+//and commitment script with push data cut to header
+//every push re-encoded as core FetchAndClearCommitmentSection does,
+//non-minimal push in commitment out changed too
+func fetchSignetSolution(s *script.Script) ([]byte, *script.Script, bool) {
+	ret := script.NewScript([]byte{})
+	found := false
+	sol := []byte{}
+	for pc := 0; pc < s.Len(); {
+		ok, idx, op, ops := s.GetOp(pc)
+		if !ok {
+			break
+		}
+		if len(ops) > 0 {
+			if !found && len(ops) > len(SignetHeader) && bytes.Equal(ops[:len(SignetHeader)], SignetHeader) {
+				sol = append(sol, ops[len(SignetHeader):]...)
+				ops = ops[:len(SignetHeader)]
+				found = true
+			}
+			ret.PushBytes(ops)
+		} else {
+			ret.PushOp(op)
+		}
+		pc = idx
+	}
+	return sol, ret, found
+}
+
+//solution is scriptSig and witness stack
+func parseSignetSolution(b []byte) (sigs *script.Script, wits *TxWitnesses, err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = fmt.Errorf("signet solution parse error %v", v)
+		}
+	}()
+	h := NewNetHeader(b)
+	sigs = h.ReadScript()
+	wits = &TxWitnesses{}
+	wits.Read(h)
+	if !h.IsEOF() {
+		return nil, nil, errors.New("signet solution extraneous data")
+	}
+	return sigs, wits, nil
+}
+
+//bip325 to_spend and to_sign txs,to_sign spend to_spend out with block solution
+func NewSignetTxs(m *MsgBlock, challenge *script.Script) (*TX, *TX, error) {
+	if len(m.Txs) == 0 {
+		return nil, nil, errors.New("miss coinbase tx")
+	}
+	cb := m.Txs[0].Clone()
+	idx := GetWitnessCommitmentIndex(cb)
+	if idx < 0 {
+		return nil, nil, errors.New("miss witness commitment")
+	}
+	sigs, wits := script.NewScript([]byte{}), &TxWitnesses{}
+	//no solution allow OP_TRUE as trivial challenge
+	if sol, cs, ok := fetchSignetSolution(cb.Outs[idx].Script); ok {
+		cb.Outs[idx].Script = cs
+		v, w, err := parseSignetSolution(sol)
+		if err != nil {
+			return nil, nil, err
+		}
+		sigs, wits = v, w
+	}
+	cb.WriteNoWitness(NewNetHeader())
+	txids := []HashID{cb.Hash}
+	for _, v := range m.Txs[1:] {
+		txids = append(txids, v.Hash)
+	}
+	merkle, _, _ := BuildMerkleTree(txids).Extract()
+	h := NewNetHeader()
+	h.WriteUInt32(m.Ver)
+	h.WriteBytes(m.Prev[:])
+	h.WriteBytes(merkle[:])
+	h.WriteUInt32(m.Timestamp)
+	spend := &TX{Ver: 0}
+	spend.Ins = []*TxIn{{
+		OutIndex: 0xffffffff,
+		Script:   script.NewScript([]byte{script.OP_0}).PushBytes(h.Bytes()),
+		Sequence: 0,
+	}}
+	spend.Outs = []*TxOut{{Value: 0, Script: challenge}}
+	spend.Write(NewNetHeader())
+	sign := &TX{Ver: 0}
+	in := &TxIn{OutHash: spend.Hash, OutIndex: 0, Script: sigs, Sequence: 0}
+	if len(wits.Script) > 0 {
+		in.Witness = wits
+		sign.SetHasWitness(true)
+	}
+	sign.Ins = []*TxIn{in}
+	sign.Outs = []*TxOut{{Value: 0, Script: script.NewScript([]byte{script.OP_RETURN})}}
+	sign.Write(NewNetHeader())
+	return spend, sign, nil
+}
+
+//bip325 block solution must satisfy signet challenge,genesis always valid
+func (m *MsgBlock) checkSignet() error {
+	conf := config.GetConfig()
+	if conf.SignetChallenge == "" || m.IsGenesis() {
+		return nil
+	}
+	spend, sign, err := NewSignetTxs(m, script.NewScriptHex(conf.SignetChallenge))
+	if err != nil {
+		return fmt.Errorf("%w %v", ErrSignetSolution, err)
+	}
+	out := spend.Outs[0]
+	spent := newSpentOutputs(sign)
+	spent.outs[0] = out
+	vfy := newScriptVerify(0, sign.Ins[0], out, sign, CheckTXType(sign.Ins[0], out), spent)
+	if err := vfy.Verify(SIGNET_SCRIPT_FLAGS); err != nil {
+		return fmt.Errorf("%w %v", ErrSignetSolution, err)
+	}
+	return nil
+}
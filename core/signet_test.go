@@ -0,0 +1,86 @@
+package core
+
+import (
+	"bitcoin/config"
+	"bitcoin/script"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+//append signet solution push to witness commitment out
+func testSignetSolution(cb *TX, sigs *script.Script, wits *TxWitnesses, extra ...byte) {
+	h := NewNetHeader()
+	h.WriteScript(sigs)
+	wits.Write(h)
+	sol := append(append([]byte{}, SignetHeader...), h.Bytes()...)
+	sol = append(sol, extra...)
+	idx := GetWitnessCommitmentIndex(cb)
+	s := cb.Outs[idx].Script.Clone()
+	cb.Outs[idx].Script = s.PushBytes(sol)
+}
+
+func TestFetchSignetSolution(t *testing.T) {
+	s := script.NewScript([]byte{script.OP_RETURN, script.OP_PUSHDATA1, 3, 1, 2, 3})
+	s.PushBytes(append(append([]byte{}, SignetHeader...), 9, 9))
+	sol, cs, ok := fetchSignetSolution(s)
+	if !ok || !bytes.Equal(sol, []byte{9, 9}) {
+		t.Fatal("fetch signet solution error")
+	}
+	//core re-encode pushdata1 short push
+	want := script.NewScript([]byte{script.OP_RETURN, 3, 1, 2, 3}).PushBytes(SignetHeader)
+	if !bytes.Equal(*cs, *want) {
+		t.Errorf("commitment script %x want %x", *cs, *want)
+	}
+	if _, _, ok := fetchSignetSolution(script.NewScript([]byte{script.OP_RETURN}).PushBytes(SignetHeader)); ok {
+		t.Error("header without data found")
+	}
+}
+
+func TestSignetBlockSolution(t *testing.T) {
+	defer config.SelectNetwork(config.NET_MAIN)
+	testRegTest(t)
+	pk, pks := testP2PKHKey(t)
+	challenge := script.NewScript([]byte{}).PushBytes(pk.PublicKey().Marshal()).PushOp(script.OP_CHECKSIG)
+	conf := config.GetConfig()
+	conf.SignetChallenge = hex.EncodeToString(*challenge)
+	//unsigned block
+	m, err := NewBlockTemplate(pks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := testRemineBlock(t, m).Check(); !errors.Is(err, ErrSignetSolution) {
+		t.Fatal("unsigned block not reject", err)
+	}
+	//solution not change to_sign
+	m, _ = NewBlockTemplate(pks)
+	cb := m.Txs[0]
+	idx := GetWitnessCommitmentIndex(cb)
+	commit := cb.Outs[idx].Script.Clone()
+	testSignetSolution(cb, script.NewScript([]byte{}), &TxWitnesses{})
+	spend, sign, err := NewSignetTxs(m, challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spent := newSpentOutputs(sign)
+	spent.outs[0] = spend.Outs[0]
+	sig := testScriptSign(t, pk, sign, spent, 0, challenge, script.SIGVERSION_BASE)
+	cb.Outs[idx].Script = commit
+	testSignetSolution(cb, script.NewScript([]byte{}).PushBytes(sig), &TxWitnesses{})
+	if err := testRemineBlock(t, m).Check(); err != nil {
+		t.Fatal(err)
+	}
+	//extra data after solution
+	m, _ = NewBlockTemplate(pks)
+	testSignetSolution(m.Txs[0], script.NewScript([]byte{}).PushBytes(sig), &TxWitnesses{}, 0)
+	if err := testRemineBlock(t, m).Check(); !errors.Is(err, ErrSignetSolution) {
+		t.Error("solution extra data not reject", err)
+	}
+	//trivial challenge allow block without solution
+	conf.SignetChallenge = hex.EncodeToString([]byte{script.OP_TRUE})
+	m, _ = NewBlockTemplate(pks)
+	if err := testRemineBlock(t, m).Check(); err != nil {
+		t.Error("op_true challenge block reject", err)
+	}
+}
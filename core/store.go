@@ -1,6 +1,7 @@
 package core
 
 import (
+	"bitcoin/config"
 	"bytes"
 	"encoding/binary"
 	"errors"
@@ -10,7 +11,9 @@ import (
 	"sync"
 
 	"github.com/syndtr/goleveldb/leveldb/filter"
+	"github.com/syndtr/goleveldb/leveldb/iterator"
 	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/storage"
 
 	"github.com/syndtr/goleveldb/leveldb/util"
 
@@ -22,13 +25,53 @@ var (
 	once  sync.Once
 )
 
+//leveldb read write,*leveldb.DB or *leveldb.Transaction
+type DBImp interface {
+	Get(key []byte, ro *opt.ReadOptions) ([]byte, error)
+	Has(key []byte, ro *opt.ReadOptions) (bool, error)
+	NewIterator(slice *util.Range, ro *opt.ReadOptions) iterator.Iterator
+	Put(key, value []byte, wo *opt.WriteOptions) error
+	Delete(key []byte, wo *opt.WriteOptions) error
+	Write(batch *leveldb.Batch, wo *opt.WriteOptions) error
+}
+
+//committed store
+func Store() DBImp {
+	return DB()
+}
+
+//run fn in leveldb transaction,fn read and write with tr
+//fn return nil commit else discard
+func DBTransaction(fn func(tr DBImp) error) error {
+	tr, err := DB().OpenTransaction()
+	if err != nil {
+		return err
+	}
+	if err := fn(tr); err != nil {
+		tr.Discard()
+		return err
+	}
+	return tr.Commit()
+}
+
+//use memory leveldb replace default db,for test
+func UseMemDB() *leveldb.DB {
+	once.Do(func() {})
+	sdb, err := leveldb.Open(storage.NewMemStorage(), nil)
+	if err != nil {
+		panic(err)
+	}
+	dbptr = sdb
+	return dbptr
+}
+
 func DB() *leveldb.DB {
 	once.Do(func() {
 		bf := filter.NewBloomFilter(5)
 		opts := &opt.Options{
 			Filter: bf,
 		}
-		sdb, err := leveldb.OpenFile("database", opts)
+		sdb, err := leveldb.OpenFile(config.GetConfig().DataDir, opts)
 		if err != nil {
 			panic(err)
 		}
@@ -94,13 +137,9 @@ func (c *Chain) WriteDB(path string, lh int) error {
 		if !G.IsNextBlock(m) {
 			return errors.New("connect to next block error")
 		}
-		if err := m.Check(); err != nil {
-			return err
-		}
-		if err := m.Save(true); err != nil {
+		if err := G.AcceptBlock(m); err != nil {
 			return err
 		}
-		G.SetBestBlock(m)
 		log.Println(c.Hash[i], i, "WRITE OK")
 	}
 	return nil
@@ -122,13 +161,27 @@ const (
 	//OutTxid[32]+OutIdx[4] -> block[32]-txidx[4]-inidx[4]
 	TPrefixOutTx = byte(5)
 
+	//block undo data blockid -> TBlockUndo
+	TPrefixUndo = byte(6)
+
+	//7 retired,old block chain work prefix,not reuse
+
+	//unspent out OutTxid[32]+OutIdx[4] -> TCoin
+	TPrefixCoin = byte(8)
+
+	//block index blockid -> IndexNode
+	TPrefixIndex = byte(9)
+
 	//Best block hash key -> blockid
 	TBestBlockHashKey = "TBestBlockHashKey"
+
+	//utxo set best block hash key -> blockid
+	TCoinsBestKey = "TCoinsBestKey"
 )
 
 func LoadHeightBlock(h uint32) (*MsgBlock, error) {
 	hkey := NewTHeightKey(h)
-	hv, err := DB().Get(hkey[:], nil)
+	hv, err := Store().Get(hkey[:], nil)
 	if err != nil {
 		return nil, fmt.Errorf("load height block %w h=%d", err, h)
 	}
@@ -187,7 +240,7 @@ type TAddrElement struct {
 func ListAddrValues(addr string) []TAddrElement {
 	eles := []TAddrElement{}
 	prefix := util.BytesPrefix(append([]byte{TPrefixAddress, byte(len(addr))}, []byte(addr)...))
-	iter := DB().NewIterator(prefix, nil)
+	iter := Store().NewIterator(prefix, nil)
 	for iter.Next() {
 		v := TAddrValue{}
 		copy(v[:], iter.Value())
@@ -228,8 +281,12 @@ func NewTTxValue(hv HashID, idx uint32) TTxValue {
 }
 
 func HasTx(hv HashID) bool {
+	return hasTx(Store(), hv)
+}
+
+func hasTx(db DBImp, hv HashID) bool {
 	tkey := NewTxKey(hv)
-	ok, err := DB().Has(tkey[:], nil)
+	ok, err := db.Has(tkey[:], nil)
 	return err == nil && ok
 }
 
@@ -274,7 +331,7 @@ func (b TBlock) ToBlock() *MsgBlock {
 }
 
 func LoadBestBlock() (*MsgBlock, error) {
-	val, err := DB().Get([]byte(TBestBlockHashKey), nil)
+	val, err := Store().Get([]byte(TBestBlockHashKey), nil)
 	if err != nil {
 		return nil, err
 	}
@@ -286,7 +343,7 @@ func LoadBlock(id HashID) (*MsgBlock, error) {
 		return bv, nil
 	}
 	key := NewTBlockKey(id)
-	bb, err := DB().Get(key[:], nil)
+	bb, err := Store().Get(key[:], nil)
 	if err != nil {
 		return nil, err
 	}
@@ -331,8 +388,12 @@ func LoadTx(tx HashID) (*TX, error) {
 }
 
 func LoadTxValue(tx HashID) (TTxValue, error) {
+	return loadTxValue(Store(), tx)
+}
+
+func loadTxValue(db DBImp, tx HashID) (TTxValue, error) {
 	txkey := NewTxKey(tx)
-	return DB().Get(txkey[:], nil)
+	return db.Get(txkey[:], nil)
 }
 
 func NewTBlock(m *MsgBlock) TBlock {
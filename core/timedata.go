@@ -0,0 +1,76 @@
+package core
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	//max peer time offset samples
+	MAX_TIMEDATA_SAMPLES = 200
+	//min samples before adjust clock
+	MIN_TIMEDATA_SAMPLES = 5
+	//max clock adjust by peers
+	DEFAULT_MAX_TIME_ADJUSTMENT = int64(70 * 60)
+	//header time max ahead of network adjusted time
+	MAX_FUTURE_BLOCK_TIME = int64(2 * 60 * 60)
+)
+
+//network adjusted clock from peers version time
+type TimeData struct {
+	mu      sync.Mutex
+	known   map[string]bool
+	offsets []int64
+	offset  int64
+}
+
+var (
+	NetTime = NewTimeData()
+)
+
+func NewTimeData() *TimeData {
+	//local clock offset 0 as first sample
+	return &TimeData{known: map[string]bool{}, offsets: []int64{0}}
+}
+
+//add peer time offset,one sample per ip
+func (td *TimeData) Add(ip string, offset int64) {
+	td.mu.Lock()
+	defer td.mu.Unlock()
+	if len(td.known) >= MAX_TIMEDATA_SAMPLES || td.known[ip] {
+		return
+	}
+	td.known[ip] = true
+	td.offsets = append(td.offsets, offset)
+	if len(td.offsets) > MAX_TIMEDATA_SAMPLES {
+		td.offsets = td.offsets[1:]
+	}
+	//odd samples median
+	if len(td.offsets) < MIN_TIMEDATA_SAMPLES || len(td.offsets)%2 != 1 {
+		return
+	}
+	vs := append([]int64{}, td.offsets...)
+	sort.Slice(vs, func(i, j int) bool {
+		return vs[i] < vs[j]
+	})
+	median := vs[len(vs)/2]
+	if median > -DEFAULT_MAX_TIME_ADJUSTMENT && median < DEFAULT_MAX_TIME_ADJUSTMENT {
+		td.offset = median
+	} else {
+		td.offset = 0
+		log.Println("peers time offset", median, "too large,check computer's date and time")
+	}
+}
+
+func (td *TimeData) Offset() int64 {
+	td.mu.Lock()
+	defer td.mu.Unlock()
+	return td.offset
+}
+
+//local time adjusted by peers offset
+func GetAdjustedTime() int64 {
+	return time.Now().Unix() + NetTime.Offset()
+}
@@ -0,0 +1,29 @@
+package core
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestTimeDataOffset(t *testing.T) {
+	td := NewTimeData()
+	for i := 1; i <= 3; i++ {
+		td.Add(fmt.Sprintf("1.1.1.%d", i), 100)
+	}
+	if td.Offset() != 0 {
+		t.Error("adjust with few samples")
+	}
+	//same ip one sample
+	td.Add("1.1.1.1", 100)
+	td.Add("1.1.1.4", 200)
+	if td.Offset() != 100 {
+		t.Error("median offset error", td.Offset())
+	}
+	td = NewTimeData()
+	for i := 1; i <= 4; i++ {
+		td.Add(fmt.Sprintf("1.1.1.%d", i), DEFAULT_MAX_TIME_ADJUSTMENT+1)
+	}
+	if td.Offset() != 0 {
+		t.Error("max time adjustment error", td.Offset())
+	}
+}
@@ -95,17 +95,25 @@ type TxIn struct {
 }
 
 func (m *TxIn) OutTx() (*TxOut, error) {
+	return m.outTx(Store())
+}
+
+func (m *TxIn) outTx(db DBImp) (*TxOut, error) {
 	if m.OutHash.IsZero() {
 		return nil, errors.New("coinbase first txin,No previous out")
 	}
-	tx, err := LoadTx(m.OutHash)
-	if err != nil {
-		return nil, fmt.Errorf("%v %w", m.OutHash, err)
+	//cached tx,unconfirmed or in current block
+	if tx, err := Txs.Get(m.OutHash); err == nil {
+		if int(m.OutIndex) >= len(tx.Outs) {
+			return nil, errors.New("out index outbound pre tx outs")
+		}
+		return tx.Outs[m.OutIndex], nil
 	}
-	if int(m.OutIndex) >= len(tx.Outs) {
-		return nil, errors.New("out index outbound pre tx outs")
+	coin, err := loadCoin(db, m.OutHash, m.OutIndex)
+	if err != nil {
+		return nil, fmt.Errorf("%v[%d] %w", m.OutHash, m.OutIndex, err)
 	}
-	return tx.Outs[m.OutIndex], nil
+	return coin.ToTxOut(), nil
 }
 
 func (m *TxIn) Clone() *TxIn {
@@ -205,6 +213,47 @@ func (m *TX) GetWeight() int {
 	return m.Base*3 + m.Size
 }
 
+//legacy sigops in ins and outs script
+func (m *TX) GetLegacySigOpCount() int {
+	n := 0
+	for _, v := range m.Ins {
+		n += v.Script.GetSigOpCount(false)
+	}
+	for _, v := range m.Outs {
+		n += v.Script.GetSigOpCount(false)
+	}
+	return n
+}
+
+//bip141 sigop cost,legacy and p2sh scaled,need prev outs
+func (m *TX) GetSigOpCost(flags int) (int64, error) {
+	return m.getSigOpCost(Store(), flags)
+}
+
+func (m *TX) getSigOpCost(db DBImp, flags int) (int64, error) {
+	n := int64(m.GetLegacySigOpCount() * WITNESS_SCALE_FACTOR)
+	if m.IsCoinBase() {
+		return n, nil
+	}
+	for _, in := range m.Ins {
+		out, err := in.outTx(db)
+		if err != nil {
+			return 0, err
+		}
+		if flags&script.SCRIPT_VERIFY_P2SH != 0 {
+			if out.Script.IsP2SH() {
+				n += int64(out.Script.GetP2SHSigOpCount(in.Script) * WITNESS_SCALE_FACTOR)
+			}
+		}
+		wits := []*script.Script{}
+		if in.Witness != nil {
+			wits = in.Witness.Script
+		}
+		n += int64(out.Script.GetWitnessSigOpCount(in.Script, wits, flags))
+	}
+	return n, nil
+}
+
 func NewTX(bid HashID, idx uint32) *TX {
 	return &TX{
 		Block: bid,
@@ -214,6 +263,10 @@ func NewTX(bid HashID, idx uint32) *TX {
 
 //check tx ,return trans fee
 func (m *TX) GetFee() (Amount, error) {
+	return m.getFee(Store())
+}
+
+func (m *TX) getFee(db DBImp) (Amount, error) {
 	iv := Amount(0)
 	ov := Amount(0)
 	if m.IsCoinBase() {
@@ -226,7 +279,7 @@ func (m *TX) GetFee() (Amount, error) {
 		return ov, nil
 	}
 	for _, v := range m.Ins {
-		out, err := v.OutTx()
+		out, err := v.outTx(db)
 		if err != nil {
 			return 0, err
 		}
@@ -325,7 +378,13 @@ func (m *TX) Check() error {
 			return errors.New("bad-cb-ins-count")
 		}
 	} else {
+		ins := map[TCoinKey]bool{}
 		for _, v := range m.Ins {
+			ckey := NewTCoinKey(v.OutHash, v.OutIndex)
+			if ins[ckey] {
+				return errors.New("bad-txns-inputs-duplicate")
+			}
+			ins[ckey] = true
 			if len(*v.Script) > script.MAX_SCRIPT_SIZE {
 				return errors.New("script too long")
 			}
@@ -339,7 +398,7 @@ func (m *TX) Check() error {
 
 func (m *TX) IsFinal(blockHeight, blockTime int64) bool {
 	if m.LockTime == 0 {
-		return false
+		return true
 	}
 	lt := int64(0)
 	if m.LockTime < script.LOCKTIME_THRESHOLD {
@@ -439,6 +498,17 @@ func (m *TX) HasWitness() bool {
 	return len(m.Flag) == 2 && m.Flag[0] == 0 && m.Flag[1] == 1
 }
 
+//wtxid,hash with witness data
+func (m *TX) WitnessHash() HashID {
+	if !m.HasWitness() {
+		return m.Hash
+	}
+	h := NewNetHeader()
+	m.Write(h)
+	id := HashID{}
+	return HASH256To(h.Bytes(), &id)
+}
+
 func (m *TX) WriteWitnesses(h *NetHeader) {
 	for _, v := range m.Ins {
 		v.Witness.Write(h)
@@ -454,6 +524,15 @@ func (m *TX) SetHasWitness(v bool) {
 }
 
 func (m *TX) Write(h *NetHeader) {
+	m.write(h, m.HasWitness())
+}
+
+//write tx without witness data
+func (m *TX) WriteNoWitness(h *NetHeader) {
+	m.write(h, false)
+}
+
+func (m *TX) write(h *NetHeader, witness bool) {
 	rbpos := h.Pos()
 	buf := bytes.Buffer{}
 	bbpos := h.Pos()
@@ -461,7 +540,7 @@ func (m *TX) Write(h *NetHeader) {
 	bepos := h.Pos()
 	buf.Write(h.SubBytes(bbpos, bepos))
 
-	if m.HasWitness() {
+	if witness {
 		h.WriteBytes(m.Flag)
 	}
 
@@ -477,7 +556,7 @@ func (m *TX) Write(h *NetHeader) {
 	bepos = h.Pos()
 	buf.Write(h.SubBytes(bbpos, bepos))
 
-	if m.HasWitness() {
+	if witness {
 		m.WriteWitnesses(h)
 	}
 	bbpos = h.Pos()
@@ -486,8 +565,11 @@ func (m *TX) Write(h *NetHeader) {
 	buf.Write(h.SubBytes(bbpos, bepos))
 	m.Base = buf.Len()
 	HASH256To(buf.Bytes(), &m.Hash)
-	repos := h.Pos()
-	m.Size = repos - rbpos
+	//size with witness
+	if witness == m.HasWitness() {
+		repos := h.Pos()
+		m.Size = repos - rbpos
+	}
 }
 
 //
@@ -618,8 +700,32 @@ func (b *MsgBlock) IsGenesis() bool {
 	return bytes.Equal(ZeroHashID[:], b.Prev[:]) && bytes.Equal(gid[:], b.Hash[:])
 }
 
+//block header
+func (m *MsgBlock) Header() *BHeader {
+	return &BHeader{
+		Ver:       m.Ver,
+		Prev:      m.Prev,
+		Merkle:    m.Merkle,
+		Timestamp: m.Timestamp,
+		Bits:      m.Bits,
+		Nonce:     m.Nonce,
+		Hash:      m.Hash,
+	}
+}
+
+//only save block data,use for side chain block
+func (m *MsgBlock) SaveData() error {
+	bkey := NewTBlockKey(m.Hash)
+	return Store().Put(bkey[:], NewTBlock(m), nil)
+}
+
 //sb = save best
 func (m *MsgBlock) Save(sb bool) error {
+	return m.save(Store(), sb)
+}
+
+//save block with db,read and write in the same transaction when reorganize
+func (m *MsgBlock) save(db DBImp, sb bool) error {
 	batch := &leveldb.Batch{}
 	//save block data
 	bkey := NewTBlockKey(m.Hash)
@@ -627,11 +733,15 @@ func (m *MsgBlock) Save(sb bool) error {
 	//save height index
 	hkey := NewTHeightKey(m.Height)
 	batch.Put(hkey[:], m.Hash[:])
+	//spent outs and removed address index
+	undo := &TBlockUndo{}
+	//txs in current block
+	txs := map[HashID]*TX{}
 	//save tx index,addr index
 	for idx, tx := range m.Txs {
 		//txid  -> block txs[idx]
 		//coinbase txid,There may be the same
-		if !tx.IsCoinBase() && HasTx(tx.Hash) {
+		if !tx.IsCoinBase() && hasTx(db, tx.Hash) {
 			return fmt.Errorf("block tx exists txid=%v", tx.Hash)
 		}
 		txkey := NewTxKey(tx.Hash)
@@ -641,21 +751,35 @@ func (m *MsgBlock) Save(sb bool) error {
 			if iidx == 0 && tx.IsCoinBase() {
 				continue
 			}
-			outtx, err := LoadTx(in.OutHash)
-			if err != nil {
-				return fmt.Errorf("load outtx failed: %w, tx=%v[%d] miss", err, in.OutHash, in.OutIndex)
+			//out tx in current block,not need undo
+			outtx, inblock := txs[in.OutHash]
+			coin := (*TCoin)(nil)
+			if inblock {
+				if int(in.OutIndex) >= len(outtx.Outs) {
+					return fmt.Errorf("outindex outbound outs block=%v tx=%v", m.Hash, tx.Hash)
+				}
+				coin = NewTCoin(outtx.Outs[in.OutIndex], m.Height, outtx.IsCoinBase())
+			} else if cv, err := loadCoin(db, in.OutHash, in.OutIndex); err == nil {
+				coin = cv
+			} else {
+				return fmt.Errorf("load coin failed: %w, tx=%v[%d] miss", err, in.OutHash, in.OutIndex)
 			}
-			if int(in.OutIndex) >= len(outtx.Outs) {
-				return fmt.Errorf("outindex outbound outs block=%v tx=%v", m.Hash, tx.Hash)
-			}
-			outv := outtx.Outs[in.OutIndex]
-			if outv.Script == nil {
+			if coin.Script == nil {
 				return fmt.Errorf("out script nil,error")
 			}
-			if outv.Value == 0 {
+			ckey := NewTCoinKey(in.OutHash, in.OutIndex)
+			batch.Delete(ckey[:])
+			if !inblock {
+				undo.Outs = append(undo.Outs, &TUndoOut{
+					OutHash:  in.OutHash,
+					OutIndex: in.OutIndex,
+					Coin:     coin,
+				})
+			}
+			if coin.Value == 0 {
 				continue
 			}
-			addr := outv.Script.GetAddress()
+			addr := coin.Script.GetAddress()
 			if addr == "" {
 				log.Println("warn, address parse failed 1")
 				continue
@@ -663,15 +787,25 @@ func (m *MsgBlock) Save(sb bool) error {
 			//cost addr
 			akey := NewTAddrKey(addr, in.OutHash, in.OutIndex)
 			batch.Delete(akey)
+			if !inblock {
+				undo.Addrs = append(undo.Addrs, &TUndoAddr{
+					Key:   akey,
+					Value: NewTAddrValue(coin.Value),
+				})
+			}
 		}
 		//get value
 		for oidx, out := range tx.Outs {
-			if out.Value == 0 {
-				continue
-			}
 			if out.Script == nil {
 				return fmt.Errorf("out script nil,error")
 			}
+			if IsCoinOut(out) {
+				ckey := NewTCoinKey(tx.Hash, uint32(oidx))
+				batch.Put(ckey[:], NewTCoin(out, m.Height, tx.IsCoinBase()).Bytes())
+			}
+			if out.Value == 0 {
+				continue
+			}
 			addr := out.Script.GetAddress()
 			if addr == "" {
 				log.Println("warn, address parse failed 2")
@@ -681,46 +815,85 @@ func (m *MsgBlock) Save(sb bool) error {
 			aval := NewTAddrValue(out.Value)
 			batch.Put(akey, aval[:])
 		}
+		txs[tx.Hash] = tx
 	}
+	//save undo data
+	ukey := NewTUndoKey(m.Hash)
+	batch.Put(ukey[:], undo.Bytes())
 	//update best block
 	if sb {
 		batch.Put([]byte(TBestBlockHashKey), m.Hash[:])
+		batch.Put([]byte(TCoinsBestKey), m.Hash[:])
 	}
-	return DB().Write(batch, nil)
+	return db.Write(batch, nil)
 }
 
-//
-////get prev bits
-func (m *MsgBlock) prevBits() uint32 {
-	conf := config.GetConfig()
-	lb := G.LastBlock()
-	hfv := int(lb.Height) - conf.DiffAdjusInterval() + 1
-	if hfv < 0 {
-		log.Panicf("first height %d error", hfv)
-	}
-	bh, err := LoadHeightBlock(uint32(hfv))
+//disconnect best block,restore spent address index by undo data
+//block data and chain work keep,block become side chain block
+func (m *MsgBlock) Disconnect() error {
+	return m.disconnect(Store())
+}
+
+func (m *MsgBlock) disconnect(db DBImp) error {
+	undo, err := loadBlockUndo(db, m.Hash)
 	if err != nil {
-		log.Panicf("get block for height %d error", hfv)
+		return fmt.Errorf("load block undo error %w", err)
+	}
+	batch := &leveldb.Batch{}
+	//remove height index
+	hkey := NewTHeightKey(m.Height)
+	batch.Delete(hkey[:])
+	//remove tx index,addr index
+	for _, tx := range m.Txs {
+		//coinbase txid,There may be the same
+		if tv, err := loadTxValue(db, tx.Hash); err == nil && tv.BlockHash().Equal(m.Hash) {
+			txkey := NewTxKey(tx.Hash)
+			batch.Delete(txkey[:])
+		}
+		for oidx, out := range tx.Outs {
+			ckey := NewTCoinKey(tx.Hash, uint32(oidx))
+			batch.Delete(ckey[:])
+			if out.Value == 0 || out.Script == nil {
+				continue
+			}
+			addr := out.Script.GetAddress()
+			if addr == "" {
+				continue
+			}
+			akey := NewTAddrKey(addr, tx.Hash, uint32(oidx))
+			batch.Delete(akey)
+		}
+	}
+	//restore spent coins,addr index
+	for _, v := range undo.Outs {
+		ckey := NewTCoinKey(v.OutHash, v.OutIndex)
+		batch.Put(ckey[:], v.Coin.Bytes())
 	}
-	return CalculateWorkRequired(lb.Timestamp, bh.Timestamp, lb.Bits)
+	for _, v := range undo.Addrs {
+		batch.Put(v.Key, v.Value[:])
+	}
+	ukey := NewTUndoKey(m.Hash)
+	batch.Delete(ukey[:])
+	//prev block become best
+	batch.Put([]byte(TBestBlockHashKey), m.Prev[:])
+	batch.Put([]byte(TCoinsBestKey), m.Prev[:])
+	return db.Write(batch, nil)
 }
 
-//
-////check proof of work return height
+//check proof of work and bits
 func (m *MsgBlock) checkBits() error {
 	conf := config.GetConfig()
 	if !CheckProofOfWork(m.Hash, m.Bits) {
 		return errors.New("block proof of work check error")
 	}
-	dav := conf.DiffAdjusInterval()
 	bits := uint32(0)
 	if m.IsGenesis() {
 		limit := NewUIHash(conf.PowLimit)
 		bits = limit.Compact(false)
-	} else if int(m.Height)%dav != 0 {
-		bits = G.LastBlock().Bits
+	} else if prev := Index.Get(m.Prev); prev != nil {
+		bits = prev.NextWorkRequired(m.Timestamp)
 	} else {
-		bits = m.prevBits()
+		return ErrPrevHeaderNotFound
 	}
 	if m.Bits != bits {
 		return fmt.Errorf("block bits error %x - %x", m.Bits, bits)
@@ -753,11 +926,19 @@ func (m *MsgBlock) GetScriptFlags() int {
 	if m.Height >= conf.SegwitHeight {
 		flags |= script.SCRIPT_VERIFY_NULLDUMMY
 	}
+	if flags&script.SCRIPT_VERIFY_WITNESS != 0 && m.Height >= conf.TaprootHeight {
+		flags |= script.SCRIPT_VERIFY_TAPROOT
+	}
 	return flags
 }
 
 //check recv block
 func (m *MsgBlock) Check() error {
+	return m.check(Store())
+}
+
+//check block,coins and tx index read from db
+func (m *MsgBlock) check(db DBImp) error {
 	txids := []HashID{}
 	if len(m.Txs) == 0 {
 		return errors.New("miss tx data")
@@ -765,26 +946,68 @@ func (m *MsgBlock) Check() error {
 	if err := m.checkBits(); err != nil {
 		return err
 	}
+	if err := m.checkSignet(); err != nil {
+		return err
+	}
+	if m.GetWeight() > int(MAX_BLOCK_WEIGHT) {
+		return fmt.Errorf("bad-blk-weight %d", m.GetWeight())
+	}
 	bfee, vfee, cfee := Amount(0), GetCoinbaseReward(int(m.Height)), Amount(0)
 	if !vfee.IsRange() {
 		return errors.New("get coinbase reward error")
 	}
+	if err := m.checkDeployments(); err != nil {
+		return err
+	}
 	flags := m.GetScriptFlags()
+	if err := m.checkWitness(flags); err != nil {
+		return err
+	}
+	sigops := int64(0)
+	prev := Index.Get(m.Prev)
+	//txs in current block
+	intxs := map[HashID]bool{}
 	Txs.Push()
 	defer Txs.Pop()
+	//ins scripts verify concurrently
+	queue := NewCheckQueue(VerifyWorkers())
+	defer queue.Wait()
+	//spent outs in block
+	spent := map[TCoinKey]bool{}
 	for i, v := range m.Txs {
 		if i == 0 && !v.IsCoinBase() {
 			return errors.New("0 tx not coinbase")
 		}
 		//coinbase txid,There may be the same
-		if !v.IsCoinBase() && HasTx(v.Hash) {
+		if !v.IsCoinBase() && hasTx(db, v.Hash) {
 			return fmt.Errorf("block tx exists txid=%v", v.Hash)
 		}
-		if err := VerifyTX(v, flags); err != nil {
-			return fmt.Errorf("verify tx error %v", err)
+		if err := m.checkSpent(db, v, spent); err != nil {
+			return err
+		}
+		if err := m.checkTxLocks(db, v, prev, intxs); err != nil {
+			return err
+		}
+		cost, err := v.getSigOpCost(db, flags)
+		if err != nil {
+			return fmt.Errorf("tx %v sigop cost error %w", v.Hash, err)
+		}
+		if sigops += cost; sigops > MAX_BLOCK_SIGOPS_COST {
+			return fmt.Errorf("bad-blk-sigops %d", sigops)
+		}
+		checks, err := newTxInChecks(db, v, flags)
+		if err != nil {
+			return fmt.Errorf("verify tx error %w", err)
+		}
+		//scripts verified when mempool accept
+		if len(checks) > 0 && !ScriptCache.Has(v, flags) {
+			queue.Add(checks...)
+		}
+		if queue.Failed() {
+			break
 		}
 		txids = append(txids, v.Hash)
-		av, err := v.GetFee()
+		av, err := v.getFee(db)
 		if err != nil {
 			return fmt.Errorf("check tx amount error %v", err)
 		}
@@ -794,6 +1017,10 @@ func (m *MsgBlock) Check() error {
 			bfee += av
 		}
 		Txs.Set(v)
+		intxs[v.Hash] = true
+	}
+	if err := queue.Wait(); err != nil {
+		return fmt.Errorf("verify tx error %w", err)
 	}
 	if !cfee.IsRange() || !bfee.IsRange() {
 		return errors.New("check block fee error")
@@ -801,6 +1028,48 @@ func (m *MsgBlock) Check() error {
 	if (cfee - bfee) > vfee {
 		return errors.New("block amount error")
 	}
+	return m.checkMerkle(txids)
+}
+
+//check tx ins double spend in block and utxo set
+func (m *MsgBlock) checkSpent(db DBImp, tx *TX, spent map[TCoinKey]bool) error {
+	if tx.IsCoinBase() {
+		return nil
+	}
+	for idx, in := range tx.Ins {
+		ckey := NewTCoinKey(in.OutHash, in.OutIndex)
+		if spent[ckey] {
+			return fmt.Errorf("tx %v in %d double spend in block", tx.Hash, idx)
+		}
+		spent[ckey] = true
+		//out tx in current block
+		if _, err := Txs.Get(in.OutHash); err == nil {
+			continue
+		}
+		coin, err := loadCoin(db, in.OutHash, in.OutIndex)
+		if err != nil {
+			return fmt.Errorf("tx %v in %d spend %v[%d] error %w", tx.Hash, idx, in.OutHash, in.OutIndex, err)
+		}
+		if !coin.IsMature(m.Height) {
+			return fmt.Errorf("tx %v in %d spend immature coinbase", tx.Hash, idx)
+		}
+	}
+	return nil
+}
+
+//check block txs merkle root
+func (m *MsgBlock) CheckMerkle() error {
+	txids := []HashID{}
+	for _, v := range m.Txs {
+		txids = append(txids, v.Hash)
+	}
+	return m.checkMerkle(txids)
+}
+
+func (m *MsgBlock) checkMerkle(txids []HashID) error {
+	if len(txids) == 0 {
+		return errors.New("miss tx data")
+	}
 	root, _, _ := BuildMerkleTree(txids).Extract()
 	if root.IsZero() {
 		return errors.New("merkle tree root error")
@@ -838,6 +1107,10 @@ func (m *MsgBlock) Read(h *NetHeader) {
 }
 
 func (m *MsgBlock) Write(h *NetHeader) {
+	m.write(h, true)
+}
+
+func (m *MsgBlock) write(h *NetHeader, witness bool) {
 	hs, bb := h.Pos(), h.Pos()
 	h.WriteUInt32(m.Ver)
 	h.WriteBytes(m.Prev[:])
@@ -849,11 +1122,17 @@ func (m *MsgBlock) Write(h *NetHeader) {
 	HASH256To(h.SubBytes(hs, he), &m.Hash)
 	h.WriteVarInt(len(m.Txs))
 	for _, v := range m.Txs {
-		v.Write(h)
+		if witness {
+			v.Write(h)
+		} else {
+			v.WriteNoWitness(h)
+		}
 	}
 	m.Count = len(m.Txs)
-	be := h.Pos()
-	m.Size = be - bb
+	if witness {
+		be := h.Pos()
+		m.Size = be - bb
+	}
 }
 
 func (m *MsgBlock) BuildMarkleTree() *MerkleTree {
@@ -871,6 +1150,15 @@ func NewMsgBlock() *MsgBlock {
 	return &MsgBlock{}
 }
 
+//block without witness data,for MSG_BLOCK request
+type MsgBlockNoWitness struct {
+	*MsgBlock
+}
+
+func (m MsgBlockNoWitness) Write(h *NetHeader) {
+	m.MsgBlock.write(h, false)
+}
+
 //
 type MsgGetData struct {
 	Invs []Inventory
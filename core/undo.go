@@ -0,0 +1,106 @@
+package core
+
+//prefix[1] blockhash[32]
+type TUndoKey [33]byte
+
+func NewTUndoKey(id HashID) TUndoKey {
+	k := TUndoKey{}
+	k[0] = TPrefixUndo
+	copy(k[1:], id[:])
+	return k
+}
+
+//spent out,restore when disconnect block
+type TUndoOut struct {
+	OutHash  HashID
+	OutIndex uint32
+	Coin     *TCoin
+}
+
+func (m *TUndoOut) Read(h *NetHeader) {
+	h.ReadBytes(m.OutHash[:])
+	m.OutIndex = h.ReadUInt32()
+	m.Coin = &TCoin{}
+	m.Coin.Read(h)
+}
+
+func (m *TUndoOut) Write(h *NetHeader) {
+	h.WriteBytes(m.OutHash[:])
+	h.WriteUInt32(m.OutIndex)
+	m.Coin.Write(h)
+}
+
+//removed address index
+type TUndoAddr struct {
+	Key   TAddrKey
+	Value TAddrValue
+}
+
+func (m *TUndoAddr) Read(h *NetHeader) {
+	kl, _ := h.ReadVarInt()
+	m.Key = make(TAddrKey, kl)
+	h.ReadBytes(m.Key)
+	h.ReadBytes(m.Value[:])
+}
+
+func (m *TUndoAddr) Write(h *NetHeader) {
+	h.WriteVarInt(len(m.Key))
+	h.WriteBytes(m.Key)
+	h.WriteBytes(m.Value[:])
+}
+
+//block undo data,write with block connect
+type TBlockUndo struct {
+	Outs  []*TUndoOut
+	Addrs []*TUndoAddr
+}
+
+func (m *TBlockUndo) Read(h *NetHeader) {
+	ol, _ := h.ReadVarInt()
+	m.Outs = make([]*TUndoOut, ol)
+	for i, _ := range m.Outs {
+		v := &TUndoOut{}
+		v.Read(h)
+		m.Outs[i] = v
+	}
+	al, _ := h.ReadVarInt()
+	m.Addrs = make([]*TUndoAddr, al)
+	for i, _ := range m.Addrs {
+		v := &TUndoAddr{}
+		v.Read(h)
+		m.Addrs[i] = v
+	}
+}
+
+func (m *TBlockUndo) Write(h *NetHeader) {
+	h.WriteVarInt(len(m.Outs))
+	for _, v := range m.Outs {
+		v.Write(h)
+	}
+	h.WriteVarInt(len(m.Addrs))
+	for _, v := range m.Addrs {
+		v.Write(h)
+	}
+}
+
+func (m *TBlockUndo) Bytes() []byte {
+	h := NewNetHeader()
+	m.Write(h)
+	return h.Bytes()
+}
+
+func LoadBlockUndo(id HashID) (*TBlockUndo, error) {
+	return loadBlockUndo(Store(), id)
+}
+
+func loadBlockUndo(db DBImp, id HashID) (*TBlockUndo, error) {
+	ukey := NewTUndoKey(id)
+	data, err := db.Get(ukey[:], nil)
+	if err != nil {
+		return nil, err
+	}
+	h := NewNetHeader(data)
+	m := &TBlockUndo{}
+	m.Read(h)
+	return m, nil
+}
@@ -4,8 +4,6 @@ import (
 	"bitcoin/script"
 	"errors"
 	"fmt"
-	"io/ioutil"
-	"os"
 )
 
 var (
@@ -78,6 +76,7 @@ const (
 	TX_P2WSH_MSIG
 	TX_P2SH_MSIG
 	TX_P2WPKH
+	TX_P2TR
 )
 
 func (i *TxIn) OnlyHasWitness() bool {
@@ -117,6 +116,9 @@ func CheckTXType(in *TxIn, out *TxOut) TxType {
 	if out.Script.IsP2WPKH() && in.OnlyHasWitness() {
 		return TX_P2WPKH
 	}
+	if out.Script.IsP2TR() {
+		return TX_P2TR
+	}
 	if out.Script.IsNull() {
 		return TX_NULL_DATA
 	}
@@ -135,54 +137,68 @@ func CheckTXType(in *TxIn, out *TxOut) TxType {
 	return TX_NONSTANDARD
 }
 
-func VerifyTX(tx *TX, flags int) error {
+//script check for one tx in,out resolved
+type TxInCheck struct {
+	tx    *TX
+	idx   int
+	out   *TxOut
+	typ   TxType
+	flags int
+	spent *spentOutputs //all ins outs,taproot sighash
+}
+
+func (c *TxInCheck) Verify() error {
+	in := c.tx.Ins[c.idx]
+	verifyer := newScriptVerify(c.idx, in, c.out, c.tx, c.typ, c.spent)
+	return script.WithIndex(verifyer.Verify(c.flags), c.idx)
+}
+
+//check tx and resolve ins out,return script checks
+func NewTxInChecks(tx *TX, flags int) ([]*TxInCheck, error) {
+	return newTxInChecks(Store(), tx, flags)
+}
+
+func newTxInChecks(db DBImp, tx *TX, flags int) ([]*TxInCheck, error) {
 	if tx == nil {
-		return errors.New("args nil")
+		return nil, errors.New("args nil")
 	}
 	if err := tx.Check(); err != nil {
-		return err
+		return nil, err
 	}
 	if tx.IsCoinBase() {
-		return nil
+		return nil, nil
 	}
+	checks := []*TxInCheck{}
+	spent := newSpentOutputs(tx)
 	for idx, in := range tx.Ins {
-		out, err := in.OutTx()
+		out, err := in.outTx(db)
 		if err != nil {
-			return fmt.Errorf("load ref out error %w", err)
+			return nil, fmt.Errorf("load ref out error %w", err)
 		}
+		spent.outs[idx] = out
 		typ := CheckTXType(in, out)
 		if typ == TX_UNKNOW {
-			return fmt.Errorf("in %d checktype not support tx=%v", idx, tx.Hash)
+			return nil, fmt.Errorf("in %d checktype not support tx=%v", idx, tx.Hash)
 		}
-		var verifyer Verifyer
-		switch typ {
-		case TX_NULL_DATA:
-			continue
-		case TX_NONSTANDARD:
-			h := NewNetHeader()
-			tx.Write(h)
-			ioutil.WriteFile(tx.Hash.String(), h.Bytes(), os.ModePerm)
-			continue
-		case TX_P2PKH, TX_P2PK:
-			verifyer = newP2PKHVerify(idx, in, out, tx, typ)
-		case TX_P2WPKH:
-			verifyer = newP2WPKHVerify(idx, in, out, tx, typ)
-		case TX_P2SH_WPKH:
-			verifyer = newP2SHWPKHVerify(idx, in, out, tx, typ)
-		case TX_P2WSH_MSIG:
-			flags |= script.SCRIPT_WITNESS_V0_PUBKEYTYPE
-			verifyer = newP2WSHMSIGVerify(idx, in, out, tx, typ)
-		case TX_P2SH_MSIG:
-			verifyer = newP2SHMSIGVerify(idx, in, out, tx, typ)
-		case TX_P2SH_WSH:
-			flags |= script.SCRIPT_WITNESS_V0_PUBKEYTYPE
-			verifyer = newP2SHWSHVerify(idx, in, out, tx, typ)
-		default:
-			return fmt.Errorf("in %d checktype not support,miss Verifyer", idx)
-		}
-		if err := verifyer.Verify(flags); err != nil {
-			return fmt.Errorf("Verifyer in %d error %v", idx, err)
+		checks = append(checks, &TxInCheck{tx: tx, idx: idx, out: out, typ: typ, flags: flags, spent: spent})
+	}
+	return checks, nil
+}
+
+func VerifyTX(tx *TX, flags int) error {
+	checks, err := NewTxInChecks(tx, flags)
+	if err != nil {
+		return err
+	}
+	//verified with same flags,mempool accepted
+	if len(checks) == 0 || ScriptCache.Has(tx, flags) {
+		return nil
+	}
+	for _, v := range checks {
+		if err := v.Verify(); err != nil {
+			return err
 		}
 	}
+	ScriptCache.Add(tx, flags)
 	return nil
 }
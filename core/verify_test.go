@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"io/ioutil"
 	"testing"
+
+	"github.com/syndtr/goleveldb/leveldb"
 )
 
 type testtxcacher struct {
@@ -30,6 +32,21 @@ func (t *testtxcacher) Get(id HashID) (interface{}, error) {
 	return t.Set(id, tx)
 }
 
+//leveldb store in test temp dir,restore previous store after test
+func testTempDB(t *testing.T) {
+	once.Do(func() {})
+	sdb, err := leveldb.OpenFile(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := dbptr
+	dbptr = sdb
+	t.Cleanup(func() {
+		dbptr = prev
+		sdb.Close()
+	})
+}
+
 func NewTestFileCacher() ICacher {
 	return &testtxcacher{
 		items: map[HashID]interface{}{},
@@ -38,6 +55,7 @@ func NewTestFileCacher() ICacher {
 
 //out script:2a9bc5447d664c1d0141392a842d23dba45c4f13 OP_CHECKLOCKTIMEVERIFY OP_DROP
 func TestNonStandardSign(t *testing.T) {
+	testTempDB(t)
 	Txs.Push(NewTestFileCacher())
 	defer Txs.Pop()
 	id := NewHashID("6d36bc17e947ce00bb6f12f8e7a56a1585c5a36188ffa2b05e10b4743273a74b")
@@ -51,6 +69,7 @@ func TestNonStandardSign(t *testing.T) {
 }
 
 func Test1of2Sign(t *testing.T) {
+	testTempDB(t)
 	Txs.Push(NewTestFileCacher())
 	defer Txs.Pop()
 	id := NewHashID("1cc1ecdf5c05765df3d1f59fba24cd01c45464c329b0f0a25aa9883adfcf7f29")
@@ -65,6 +84,7 @@ func Test1of2Sign(t *testing.T) {
 
 //8d5bc6ff636d9cfb3a3b37cc2ad7681e5ba8078d8c7eb4a47531d75c18c8487f
 func TestP2WPKHSign(t *testing.T) {
+	testTempDB(t)
 	Txs.Push(NewTestFileCacher())
 	defer Txs.Pop()
 	id := NewHashID("8d5bc6ff636d9cfb3a3b37cc2ad7681e5ba8078d8c7eb4a47531d75c18c8487f")
@@ -83,6 +103,7 @@ func TestP2WPKHSign(t *testing.T) {
 }
 
 func TestP2PKHSingleOne(t *testing.T) {
+	testTempDB(t)
 	Txs.Push(NewTestFileCacher())
 	defer Txs.Pop()
 	id := NewHashID("599e47a8114fe098103663029548811d2651991b62397e057f0c863c2bc9f9ea")
@@ -96,6 +117,7 @@ func TestP2PKHSingleOne(t *testing.T) {
 }
 
 func TestP2SHMSIGSign(t *testing.T) {
+	testTempDB(t)
 	Txs.Push(NewTestFileCacher())
 	defer Txs.Pop()
 	id := NewHashID("c7f04832fc99b87a0140da2377ec81d1e1a062ed72f507f84533e572db1f6d15")
@@ -117,6 +139,7 @@ func TestP2SHMSIGSign(t *testing.T) {
 }
 
 func TestP2WSHMSIGSign(t *testing.T) {
+	testTempDB(t)
 	Txs.Push(NewTestFileCacher())
 	defer Txs.Pop()
 	id := NewHashID("2cc59f3c646b3917ed9b5224f71b335a2eab70ca4610a01dee90c2536d35d940")
@@ -138,6 +161,7 @@ func TestP2WSHMSIGSign(t *testing.T) {
 }
 
 func TestP2SHWPKHSign(t *testing.T) {
+	testTempDB(t)
 	Txs.Push(NewTestFileCacher())
 	defer Txs.Pop()
 	id := NewHashID("0ae88f93be14b77994da8ebb948e817e6fbb98d66c0091366e46df0663ea3813")
@@ -159,6 +183,7 @@ func TestP2SHWPKHSign(t *testing.T) {
 }
 
 func TestP2PKSign(t *testing.T) {
+	testTempDB(t)
 	Txs.Push(NewTestFileCacher())
 	defer Txs.Pop()
 	id := NewHashID("80d417567b5a032465474052cca4dc38c57f6d5dc10dc7519b2ca20ac7d5512b")
@@ -180,6 +205,7 @@ func TestP2PKSign(t *testing.T) {
 }
 
 func TestP2PKHSign(t *testing.T) {
+	testTempDB(t)
 	Txs.Push(NewTestFileCacher())
 	defer Txs.Pop()
 	id := NewHashID("78470577b25f58e0b18fd21e57eb64c10eb66272a856208440362103de0f31da")
@@ -0,0 +1,102 @@
+package core
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	//script verification threads for block
+	verifyWorkers = int32(runtime.NumCPU())
+)
+
+//set block script verification threads,<=1 verify inline
+func SetVerifyWorkers(num int) {
+	if num < 1 {
+		num = 1
+	}
+	atomic.StoreInt32(&verifyWorkers, int32(num))
+}
+
+func VerifyWorkers() int {
+	return int(atomic.LoadInt32(&verifyWorkers))
+}
+
+//verify block ins scripts concurrently,stop at first failure
+type CheckQueue struct {
+	jobs   chan *TxInCheck
+	wg     sync.WaitGroup
+	once   sync.Once
+	num    int
+	failed int32
+	mu     sync.Mutex
+	err    error
+}
+
+func NewCheckQueue(num int) *CheckQueue {
+	q := &CheckQueue{num: num}
+	if num <= 1 {
+		return q
+	}
+	q.jobs = make(chan *TxInCheck, num*16)
+	for i := 0; i < num; i++ {
+		q.wg.Add(1)
+		go q.worker()
+	}
+	return q
+}
+
+func (q *CheckQueue) worker() {
+	defer q.wg.Done()
+	for c := range q.jobs {
+		if q.Failed() {
+			continue
+		}
+		if err := c.Verify(); err != nil {
+			q.setError(err)
+		}
+	}
+}
+
+func (q *CheckQueue) setError(err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.err == nil {
+		q.err = err
+		atomic.StoreInt32(&q.failed, 1)
+	}
+}
+
+func (q *CheckQueue) Failed() bool {
+	return atomic.LoadInt32(&q.failed) != 0
+}
+
+//queue checks,skip if failed
+func (q *CheckQueue) Add(cs ...*TxInCheck) {
+	for _, c := range cs {
+		if q.Failed() {
+			return
+		}
+		if q.jobs == nil {
+			if err := c.Verify(); err != nil {
+				q.setError(err)
+			}
+			continue
+		}
+		q.jobs <- c
+	}
+}
+
+//wait all queued checks done,return first error
+func (q *CheckQueue) Wait() error {
+	q.once.Do(func() {
+		if q.jobs != nil {
+			close(q.jobs)
+		}
+	})
+	q.wg.Wait()
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.err
+}
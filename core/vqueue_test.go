@@ -0,0 +1,106 @@
+package core
+
+import (
+	"bitcoin/script"
+	"bitcoin/util"
+	"testing"
+)
+
+//last push data in sig script
+func testLastPush(s *script.Script) []byte {
+	data := []byte{}
+	for i := 0; i < s.Len(); {
+		b, p, _, ops := s.GetOp(i)
+		if !b {
+			return nil
+		}
+		data = ops
+		i = p
+	}
+	return data
+}
+
+//script checks for block.dat ins with out script rebuild from sig script
+//p2pkh and p2sh multisig,legacy sighash without out value
+func testBlockChecks(t testing.TB) []*TxInCheck {
+	m := testLoadBlockFile(t)
+	flags := script.SCRIPT_VERIFY_P2SH | script.SCRIPT_VERIFY_DERSIG
+	checks := []*TxInCheck{}
+	for _, tx := range m.Txs[1:] {
+		for idx, in := range tx.Ins {
+			if in.Witness != nil && len(in.Witness.Script) > 0 {
+				continue
+			}
+			push := testLastPush(in.Script)
+			if push == nil {
+				continue
+			}
+			out := &TxOut{}
+			if in.HasScriptMultiSig() {
+				out.Script = script.NewScript([]byte{script.OP_HASH160}).PushBytes(util.HASH160(push)).PushOp(script.OP_EQUAL)
+			} else if script.IsCompressedOrUncompressedPubKey(push) {
+				out.Script = script.NewScript([]byte{script.OP_DUP, script.OP_HASH160}).PushBytes(util.HASH160(push))
+				out.Script.PushOp(script.OP_EQUALVERIFY).PushOp(script.OP_CHECKSIG)
+			} else {
+				continue
+			}
+			typ := CheckTXType(in, out)
+			if typ != TX_P2PKH && typ != TX_P2SH_MSIG {
+				continue
+			}
+			checks = append(checks, &TxInCheck{tx: tx, idx: idx, out: out, typ: typ, flags: flags})
+		}
+	}
+	return checks
+}
+
+func TestCheckQueue(t *testing.T) {
+	checks := testBlockChecks(t)
+	if len(checks) < 1000 {
+		t.Fatal("block checks too few", len(checks))
+	}
+	//full block in benchmark
+	checks = checks[:200]
+	for _, num := range []int{1, 4} {
+		q := NewCheckQueue(num)
+		q.Add(checks...)
+		if err := q.Wait(); err != nil {
+			t.Fatal(num, err)
+		}
+	}
+	//wrong pubkey hash fail
+	bad := *checks[len(checks)/2]
+	bad.out = &TxOut{Script: bad.out.Script.Clone()}
+	(*bad.out.Script)[4] ^= 1
+	q := NewCheckQueue(4)
+	q.Add(checks[:10]...)
+	q.Add(&bad)
+	q.Add(checks[10:]...)
+	if err := q.Wait(); err == nil || !q.Failed() {
+		t.Error("check queue failure error")
+	}
+}
+
+func benchmarkCheckQueue(b *testing.B, num int) {
+	checks := testBlockChecks(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		//verify without sig cache
+		b.StopTimer()
+		SigCache = NewSigCacher(DEFAULT_SIG_CACHE_SIZE)
+		b.StartTimer()
+		q := NewCheckQueue(num)
+		q.Add(checks...)
+		if err := q.Wait(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkCheckQueueSerial(b *testing.B) {
+	benchmarkCheckQueue(b, 1)
+}
+
+func BenchmarkCheckQueueParallel(b *testing.B) {
+	benchmarkCheckQueue(b, VerifyWorkers())
+}
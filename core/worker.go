@@ -1,11 +1,11 @@
 package core
 
 import (
-	"container/list"
 	"context"
 	"errors"
 	"fmt"
 	"log"
+	"math/rand"
 	"sync"
 	"time"
 )
@@ -14,58 +14,6 @@ const (
 	WorkerQueueSize = 64
 )
 
-type BlockHeaderList struct {
-	mu sync.Mutex
-	lv *list.List
-}
-
-func (l *BlockHeaderList) Remove() {
-	l.mu.Lock()
-	defer l.mu.Unlock()
-	if l.lv.Len() == 0 {
-		return
-	}
-	e := l.lv.Front()
-	l.lv.Remove(e)
-}
-
-func (l *BlockHeaderList) Front() *BHeader {
-	l.mu.Lock()
-	defer l.mu.Unlock()
-	if l.lv.Len() == 0 {
-		return nil
-	}
-	el := l.lv.Front()
-	return el.Value.(*BHeader)
-}
-
-func (l *BlockHeaderList) Push(h *BHeader) {
-	l.mu.Lock()
-	defer l.mu.Unlock()
-	l.lv.PushBack(h)
-}
-
-func (l *BlockHeaderList) Len() int {
-	l.mu.Lock()
-	defer l.mu.Unlock()
-	return l.lv.Len()
-}
-
-func (l *BlockHeaderList) Pop() {
-	l.mu.Lock()
-	defer l.mu.Unlock()
-	if l.lv.Len() == 0 {
-		return
-	}
-	l.lv.Remove(l.lv.Front())
-}
-
-func NewBlockHeaderList() *BlockHeaderList {
-	return &BlockHeaderList{
-		lv: list.New(),
-	}
-}
-
 type WorkerUnit struct {
 	m MsgIO
 	c *Client
@@ -79,43 +27,196 @@ var (
 	WorkerQueue = make(chan *WorkerUnit, WorkerQueueSize)
 )
 
-func processBlock(wid int, c *Client, m *MsgBlock) error {
+//accept block return old and new best block
+func acceptBlock(m *MsgBlock) (*MsgBlock, *MsgBlock, error) {
 	G.Lock()
 	defer G.Unlock()
-	if !G.IsNextBlock(m) {
-		return fmt.Errorf("can't link prev block,ignore block %v", m.Hash)
+	obest := G.LastBlock()
+	err := G.AcceptBlock(m)
+	return obest, G.LastBlock(), err
+}
+
+//remove connected block txs from mempool,disconnected block txs back to mempool
+func updateMempool(obest, best *MsgBlock) {
+	if obest == nil || best == nil || obest.Hash.Equal(best.Hash) {
+		return
+	}
+	on, bn := Index.Get(obest.Hash), Index.Get(best.Hash)
+	if on == nil || bn == nil {
+		return
 	}
-	if err := m.Check(); err != nil {
-		return fmt.Errorf("check block error %w", err)
+	fork := LastCommonAncestor(on, bn)
+	if fork == nil {
+		return
 	}
-	if err := m.Save(true); err != nil {
-		return fmt.Errorf("DB save block error %w", err)
+	for _, v := range Index.Path(fork, bn) {
+		if b, err := LoadBlock(v.Hash()); err == nil {
+			TxsMap.RemoveForBlock(b)
+		}
 	}
-	Headers.Remove()
-	G.SetBestBlock(m)
-	if c != nil {
-		Notice <- c
-		hv := fmt.Sprintf("%.3f", float32(m.Height)/float32(c.VerInfo.Height))
-		log.Println("Work", wid, "save block:", m.Hash, "height=", m.Height, "finish=", hv, "from", c.Key(), "OK")
+	if fork == on {
+		return
+	}
+	TxsMap.RemoveForReorg()
+	for _, v := range Index.Path(fork, on) {
+		b, err := LoadBlock(v.Hash())
+		if err != nil {
+			continue
+		}
+		for _, tx := range b.Txs {
+			if !tx.IsCoinBase() {
+				TxsMap.AcceptTx(tx)
+			}
+		}
 	}
+}
+
+func processBlock(wid int, c *Client, m *MsgBlock) error {
+	Download.Received(m.Hash)
+	obest, best, err := acceptBlock(m)
+	if err != nil {
+		return err
+	}
+	updateMempool(obest, best)
+	if obest == nil || !best.Hash.Equal(obest.Hash) {
+		AnnounceBlock(best, c)
+	}
+	if c == nil {
+		return nil
+	}
+	Notice <- c
+	//side chain block or wait prev block
+	if obest != nil && best.Hash.Equal(obest.Hash) {
+		return nil
+	}
+	if best.Hash.Equal(m.Hash) && isRecentBlock(best) {
+		Compact.UpdateHigh(c)
+	}
+	hv := fmt.Sprintf("%.3f", float32(best.Height)/float32(c.VerInfo.Height))
+	log.Println("Work", wid, "save block:", best.Hash, "height=", best.Height, "finish=", hv, "from", c.Key(), "OK")
 	return nil
 }
 
 func processTX(wid int, c *Client, m *MsgTX) error {
 	//log.Println("Work id", wid, "recv tx=", m.Tx.Hash)
-	//TxsMap.Set(&m.Tx)
+	Relay.AddKnown(c, m.Tx.Hash)
+	//invalid or policy reject tx,not worker error
+	if _, err := TxsMap.AcceptTx(&m.Tx); err != nil {
+		//log.Println("Work id", wid, "reject tx=", m.Tx.Hash, err)
+		return nil
+	}
+	Relay.Announce(m.Tx.Hash, c)
 	return nil
 }
 
 func processHeaders(wid int, c *Client, m *MsgHeaders) error {
+	var last *IndexNode
 	for _, v := range m.Headers {
-		if G.IsNextHeader(v) {
-			Headers.Push(v)
+		n, err := Index.AddHeader(v)
+		if errors.Is(err, ErrPrevHeaderNotFound) {
+			//unconnecting headers,sync from best header
+			Download.ContinueHeaders(c)
+			RequestHeaders(c, Index.BestHeader())
+			return nil
+		}
+		if err != nil {
+			Download.HeadersDone(c)
+			return fmt.Errorf("process headers error %w", err)
 		}
+		last = n
+	}
+	if len(m.Headers) == MAX_HEADERS_RESULTS && last != nil {
+		//more headers
+		Download.ContinueHeaders(c)
+		RequestHeaders(c, last)
+	} else {
+		Download.HeadersDone(c)
+	}
+	Notice <- c
+	return nil
+}
+
+func requestFullBlock(c *Client, id HashID) {
+	m := NewMsgGetData()
+	m.AddHash(MSG_WITNESS_BLOCK, id[:])
+	c.WriteMsg(m)
+}
+
+//rebuild block from compact block and mempool
+func processCmpctBlock(wid int, c *Client, m *MsgCmpctBlock) error {
+	n, err := Index.AddHeader(m.Header.BHeader())
+	if errors.Is(err, ErrPrevHeaderNotFound) {
+		Download.ContinueHeaders(c)
+		RequestHeaders(c, Index.BestHeader())
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("process cmpct block error %w", err)
 	}
-	if Headers.Len() > 0 {
+	if n.HasData() {
+		return nil
+	}
+	//only rebuild block extend best,other download by headers
+	if !n.Header.Prev.Equal(G.LastHash()) {
 		Notice <- c
+		return nil
+	}
+	pb, err := NewPartialBlock(m, TxsMap)
+	if err != nil {
+		requestFullBlock(c, n.Hash())
+		return nil
+	}
+	if miss := pb.Missing(); len(miss) > 0 {
+		Compact.SetPending(c, pb)
+		c.WriteMsg(&MsgGetBlockTxn{Hash: pb.Hash, Indexs: miss})
+		return nil
 	}
+	return processPartialBlock(wid, c, pb)
+}
+
+func processPartialBlock(wid int, c *Client, pb *PartialBlock) error {
+	b, err := pb.Block()
+	if err != nil {
+		requestFullBlock(c, pb.Hash)
+		return nil
+	}
+	return processBlock(wid, c, b)
+}
+
+func processBlockTxn(wid int, c *Client, m *MsgBlockTxn) error {
+	pb := Compact.TakePending(c, m.Hash)
+	if pb == nil {
+		return nil
+	}
+	if err := pb.Fill(m); err != nil {
+		requestFullBlock(c, pb.Hash)
+		return nil
+	}
+	return processPartialBlock(wid, c, pb)
+}
+
+func processGetBlockTxn(wid int, c *Client, m *MsgGetBlockTxn) error {
+	n := Index.Get(m.Hash)
+	if n == nil || !n.HasData() {
+		return nil
+	}
+	bv, err := LoadBlock(m.Hash)
+	if err != nil {
+		return nil
+	}
+	//old block send full block
+	if n.Height+MAX_BLOCKTXN_DEPTH < G.LastHeight() {
+		c.WriteMsg(bv)
+		return nil
+	}
+	rm := &MsgBlockTxn{Hash: m.Hash}
+	for _, v := range m.Indexs {
+		if int(v) >= len(bv.Txs) {
+			return fmt.Errorf("getblocktxn index %d outbound from %v", v, c.Key())
+		}
+		rm.Txs = append(rm.Txs, *bv.Txs[v])
+	}
+	c.WriteMsg(rm)
 	return nil
 }
 
@@ -126,9 +227,21 @@ func processInv(wid int, c *Client, m *MsgINV) error {
 		switch v.Type {
 		case MSG_TX:
 			//log.Println("get inv TX ", v.ID, " start get TX data")
+			Relay.AddKnown(c, v.ID)
+			if TxsMap.Has(v.ID) || HasTx(v.ID) {
+				continue
+			}
 			tm.AddHash(v.Type, v.ID[:])
 		case MSG_BLOCK:
-			tm.AddHash(v.Type, v.ID[:])
+			if n := Index.Get(v.ID); n != nil && n.HasData() {
+				continue
+			}
+			//low bandwidth compact block
+			if c.CmpctVer == CMPCT_VERSION {
+				tm.AddHash(MSG_CMPCT_BLOCK, v.ID[:])
+			} else {
+				tm.AddHash(MSG_WITNESS_BLOCK, v.ID[:])
+			}
 		case MSG_FILTERED_BLOCK:
 		case MSG_CMPCT_BLOCK:
 		}
@@ -139,8 +252,158 @@ func processInv(wid int, c *Client, m *MsgINV) error {
 	return nil
 }
 
+//main chain block index at height
+func mainIndexNode(h uint32) *IndexNode {
+	hkey := NewTHeightKey(h)
+	hv, err := Store().Get(hkey[:], nil)
+	if err != nil {
+		return nil
+	}
+	return Index.Get(NewHashID(hv))
+}
+
+//first locator block in main chain,return next height
+func locatorStart(locator []HashID) uint32 {
+	for _, v := range locator {
+		if n := Index.Get(v); n != nil && IsMainChain(v) {
+			return n.Height + 1
+		}
+	}
+	//start after genesis
+	return 1
+}
+
 func processGetHeaders(wid int, c *Client, m *MsgGetHeaders) error {
-	//log.Println("Work id", wid, "recv headers")
+	rm := NewMsgHeaders()
+	//only stop header
+	if len(m.Blocks) == 0 {
+		if n := Index.Get(m.Stop); n != nil && n.HasData() {
+			rm.Headers = append(rm.Headers, n.Header)
+		}
+		c.WriteMsg(rm)
+		return nil
+	}
+	for h := locatorStart(m.Blocks); len(rm.Headers) < MAX_HEADERS_RESULTS; h++ {
+		n := mainIndexNode(h)
+		if n == nil {
+			break
+		}
+		rm.Headers = append(rm.Headers, n.Header)
+		if n.Hash().Equal(m.Stop) {
+			break
+		}
+	}
+	c.WriteMsg(rm)
+	return nil
+}
+
+func processGetBlocks(wid int, c *Client, m *MsgGetBlocks) error {
+	rm := NewMsgINV()
+	for h := locatorStart(m.Blocks); len(rm.Invs) < MAX_BLOCKS_RESULTS; h++ {
+		n := mainIndexNode(h)
+		if n == nil || n.Hash().Equal(m.Stop) {
+			break
+		}
+		rm.Invs = append(rm.Invs, &Inventory{Type: MSG_BLOCK, ID: n.Hash()})
+	}
+	if len(rm.Invs) > 0 {
+		c.WriteMsg(rm)
+	}
+	return nil
+}
+
+func processGetData(wid int, c *Client, m *MsgGetData) error {
+	nf := NewMsgNotFound()
+	for _, v := range m.Invs {
+		switch v.Type {
+		case MSG_BLOCK, MSG_WITNESS_BLOCK:
+			if n := Index.Get(v.ID); n == nil || !n.HasData() {
+				nf.Invs = append(nf.Invs, &Inventory{Type: v.Type, ID: v.ID})
+				continue
+			}
+			bv, err := LoadBlock(v.ID)
+			if err != nil {
+				nf.Invs = append(nf.Invs, &Inventory{Type: v.Type, ID: v.ID})
+				continue
+			}
+			if v.Type == MSG_WITNESS_BLOCK {
+				c.WriteMsg(bv)
+			} else {
+				c.WriteMsg(MsgBlockNoWitness{bv})
+			}
+		case MSG_CMPCT_BLOCK:
+			n := Index.Get(v.ID)
+			if n == nil || !n.HasData() {
+				nf.Invs = append(nf.Invs, &Inventory{Type: v.Type, ID: v.ID})
+				continue
+			}
+			bv, err := LoadBlock(v.ID)
+			if err != nil {
+				nf.Invs = append(nf.Invs, &Inventory{Type: v.Type, ID: v.ID})
+				continue
+			}
+			//old block send full block
+			if n.Height+MAX_CMPCTBLOCK_DEPTH < G.LastHeight() {
+				c.WriteMsg(bv)
+			} else {
+				c.WriteMsg(NewMsgCmpctBlockWithBlock(bv, rand.Uint64()))
+			}
+		case MSG_TX, MSG_WITNESS_TX:
+			tx, ok := TxsMap.Get(v.ID)
+			if !ok {
+				nf.Invs = append(nf.Invs, &Inventory{Type: v.Type, ID: v.ID})
+				continue
+			}
+			//copy,write update tx fields
+			tm := &MsgTX{Tx: *tx}
+			if v.Type == MSG_WITNESS_TX {
+				c.WriteMsg(tm)
+			} else {
+				c.WriteMsg(MsgTXNoWitness{tm})
+			}
+			Relay.AddKnown(c, v.ID)
+		default:
+			nf.Invs = append(nf.Invs, &Inventory{Type: v.Type, ID: v.ID})
+		}
+	}
+	if len(nf.Invs) > 0 {
+		c.WriteMsg(nf)
+	}
+	return nil
+}
+
+//bip35 announce all mempool txs over peer feefilter
+func processMemPool(wid int, c *Client, m *MsgMemPool) error {
+	inv := NewMsgINV()
+	for _, e := range TxsMap.Sorted() {
+		if e.FeeRate() < c.FeeRate {
+			continue
+		}
+		Relay.AddKnown(c, e.Tx.Hash)
+		inv.Invs = append(inv.Invs, &Inventory{Type: MSG_TX, ID: e.Tx.Hash})
+		if len(inv.Invs) >= MAX_INV_SZ {
+			c.WriteMsg(inv)
+			inv = NewMsgINV()
+		}
+	}
+	if len(inv.Invs) > 0 {
+		c.WriteMsg(inv)
+	}
+	return nil
+}
+
+func processGetAddr(wid int, c *Client, m *MsgGetAddr) error {
+	rm := NewMsgAddr()
+	Addrs.Iter(func(a *AddrElement) {
+		if len(rm.Addrs) >= MAX_ADDR_RESULTS || !a.IP.IsEnable() {
+			return
+		}
+		av := NewAddress(NODE_NETWORK, a.IP)
+		av.IpAddr = a.IP.ip.To16()
+		av.Time = uint32(a.LastTime.Unix())
+		rm.Addrs = append(rm.Addrs, av)
+	})
+	c.WriteMsg(rm)
 	return nil
 }
 
@@ -169,6 +432,20 @@ func doWorker(ctx context.Context, wg *sync.WaitGroup, i int) {
 					err = processHeaders(i, unit.c, unit.m.(*MsgHeaders))
 				case NMT_GETHEADERS:
 					err = processGetHeaders(i, unit.c, unit.m.(*MsgGetHeaders))
+				case NMT_GETBLOCKS:
+					err = processGetBlocks(i, unit.c, unit.m.(*MsgGetBlocks))
+				case NMT_GETDATA:
+					err = processGetData(i, unit.c, unit.m.(*MsgGetData))
+				case NMT_GETADDR:
+					err = processGetAddr(i, unit.c, unit.m.(*MsgGetAddr))
+				case NMT_CMPCTBLOCK:
+					err = processCmpctBlock(i, unit.c, unit.m.(*MsgCmpctBlock))
+				case NMT_GETBLOCKTXN:
+					err = processGetBlockTxn(i, unit.c, unit.m.(*MsgGetBlockTxn))
+				case NMT_BLOCKTXN:
+					err = processBlockTxn(i, unit.c, unit.m.(*MsgBlockTxn))
+				case NMT_MEMPOOL:
+					err = processMemPool(i, unit.c, unit.m.(*MsgMemPool))
 				}
 			case <-ctx.Done():
 				err = fmt.Errorf("recv done worker exit %w", ctx.Err())
@@ -1,33 +1,33 @@
 package main
 
 import (
+	"bitcoin/config"
 	"bitcoin/core"
+	"bitcoin/rpc"
 	"context"
+	"flag"
 	"log"
 	"os"
 	"os/signal"
+	"runtime"
 	"syscall"
 )
 
-//000000000000000009a0f8ed656d8bc40fef69ec5a366d0eb70945e893882daa 317867
-func write() {
-	//init db
-	db := core.DB()
-	defer db.Close()
-	if err := core.G.Init(); err != nil {
-		panic(err)
-	}
-	//
-	chian := core.GetChain("000000000000034a7dedef4a161fa058a2d67a173a90155f3a2fe6fc132e0ebf", 200000)
-	if err := chian.WriteDB("f:\\blocks", int(core.G.LastHeight())); err != nil {
-		log.Println(err)
-	}
-}
-
 func main() {
-	write()
-	return
-	csig := make(chan os.Signal)
+	network := flag.String("network", config.NET_MAIN, "network main,test,signet or regtest")
+	par := flag.Int("par", runtime.NumCPU(), "script verification threads")
+	rpcuser := flag.String("rpcuser", "", "json rpc user,cookie file auth if user or password empty")
+	rpcpass := flag.String("rpcpassword", "", "json rpc password")
+	flag.Parse()
+	//select network before db and config used
+	conf, err := config.SelectNetwork(*network)
+	if err != nil {
+		log.Fatal(err)
+	}
+	conf.RpcUser, conf.RpcPass = *rpcuser, *rpcpass
+	//apply before blocks verified
+	core.SetVerifyWorkers(*par)
+	csig := make(chan os.Signal, 1)
 	//
 	ctx, cancel := context.WithCancel(context.Background())
 	//init db
@@ -40,8 +40,12 @@ func main() {
 	go core.StartLookUp(ctx)
 	//startup block sync
 	go core.StartDispatch(ctx)
+	//startup inbound listen
+	go core.StartListen(ctx)
+	//startup json rpc server
+	go rpc.Start(ctx)
 	//start worker
-	go core.StartWorker(ctx, 4)
+	go core.StartWorker(ctx, *par)
 	//wait quit
 	signal.Notify(csig, syscall.SIGKILL, syscall.SIGTERM, syscall.SIGINT)
 	sig := <-csig
@@ -0,0 +1,492 @@
+package rpc
+
+import (
+	"bitcoin/core"
+	"bitcoin/script"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+//positional params
+type Params []json.RawMessage
+
+func (ps Params) has(i int) bool {
+	return i < len(ps) && string(ps[i]) != "null"
+}
+
+func (ps Params) String(i int) (string, error) {
+	if !ps.has(i) {
+		return "", NewError(RPC_INVALID_PARAMS, "missing param %d", i)
+	}
+	s := ""
+	if err := json.Unmarshal(ps[i], &s); err != nil {
+		return "", NewError(RPC_TYPE_ERROR, "param %d expected string", i)
+	}
+	return s, nil
+}
+
+func (ps Params) Int(i int, def int) (int, error) {
+	if !ps.has(i) {
+		return def, nil
+	}
+	v := 0
+	if err := json.Unmarshal(ps[i], &v); err != nil {
+		return 0, NewError(RPC_TYPE_ERROR, "param %d expected number", i)
+	}
+	return v, nil
+}
+
+func (ps Params) Bool(i int, def bool) (bool, error) {
+	if !ps.has(i) {
+		return def, nil
+	}
+	v := false
+	if err := json.Unmarshal(ps[i], &v); err != nil {
+		return false, NewError(RPC_TYPE_ERROR, "param %d expected bool", i)
+	}
+	return v, nil
+}
+
+//int or bool(old bitcoind verbose arg)
+func (ps Params) Verbosity(i int, def int) (int, error) {
+	if b, err := ps.Bool(i, def != 0); err == nil {
+		if b {
+			return 1, nil
+		}
+		return 0, nil
+	}
+	return ps.Int(i, def)
+}
+
+func (ps Params) Hex(i int) ([]byte, error) {
+	s, err := ps.String(i)
+	if err != nil {
+		return nil, err
+	}
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, NewError(RPC_DESERIALIZATION_ERROR, "param %d must be hexadecimal string", i)
+	}
+	return b, nil
+}
+
+func (ps Params) HashID(i int) (core.HashID, error) {
+	s, err := ps.String(i)
+	if err != nil {
+		return core.ZeroHashID, err
+	}
+	if _, err := hex.DecodeString(s); err != nil || len(s) != 64 {
+		return core.ZeroHashID, NewError(RPC_INVALID_PARAMETER, "param %d must be of length 64 hexadecimal string", i)
+	}
+	return core.NewHashID(s), nil
+}
+
+func toBTC(v uint64) float64 {
+	return float64(v) / float64(core.COIN)
+}
+
+//best height,-1 if no block
+func bestHeight() int64 {
+	if core.G.IsRequestGenesis() {
+		return -1
+	}
+	return int64(core.G.LastHeight())
+}
+
+//main chain confirmations,-1 if block not in main chain
+func confirmations(id core.HashID, height uint32) int64 {
+	if !core.IsMainChain(id) {
+		return -1
+	}
+	return bestHeight() - int64(height) + 1
+}
+
+type writer interface {
+	Write(h *core.NetHeader)
+}
+
+func encodeMsg(m writer) []byte {
+	h := core.NewNetHeader()
+	m.Write(h)
+	return h.Bytes()
+}
+
+func headerHex(m *core.MsgBlock) string {
+	//block header 80 bytes,without tx count
+	return hex.EncodeToString(encodeMsg(m)[:80])
+}
+
+func scriptJSON(s []byte) map[string]interface{} {
+	v := map[string]interface{}{
+		"hex": hex.EncodeToString(s),
+	}
+	if addr := script.NewScript(s).GetAddress(); addr != "" {
+		v["address"] = addr
+	}
+	return v
+}
+
+func txJSON(tx *core.TX) map[string]interface{} {
+	h := core.NewNetHeader()
+	tx.Write(h)
+	raw := h.Bytes()
+	wtxid := core.HashID{}
+	core.HASH256To(raw, &wtxid)
+	vin := []interface{}{}
+	for _, in := range tx.Ins {
+		iv := map[string]interface{}{}
+		if tx.IsCoinBase() {
+			iv["coinbase"] = hex.EncodeToString(in.Script.Bytes())
+		} else {
+			iv["txid"] = in.OutHash.String()
+			iv["vout"] = in.OutIndex
+			iv["scriptSig"] = map[string]interface{}{
+				"hex": hex.EncodeToString(in.Script.Bytes()),
+			}
+		}
+		if tx.HasWitness() && in.Witness != nil {
+			ws := []string{}
+			for _, w := range in.Witness.Script {
+				ws = append(ws, hex.EncodeToString(w.Bytes()))
+			}
+			iv["txinwitness"] = ws
+		}
+		iv["sequence"] = in.Sequence
+		vin = append(vin, iv)
+	}
+	vout := []interface{}{}
+	for i, out := range tx.Outs {
+		vout = append(vout, map[string]interface{}{
+			"value":        toBTC(out.Value),
+			"n":            i,
+			"scriptPubKey": scriptJSON(out.Script.Bytes()),
+		})
+	}
+	return map[string]interface{}{
+		"txid":     tx.Hash.String(),
+		"hash":     wtxid.String(),
+		"version":  tx.Ver,
+		"size":     tx.Size,
+		"vsize":    tx.VirtualSize(),
+		"weight":   tx.GetWeight(),
+		"locktime": tx.LockTime,
+		"vin":      vin,
+		"vout":     vout,
+		"hex":      hex.EncodeToString(raw),
+	}
+}
+
+func blockJSON(m *core.MsgBlock, verbosity int) map[string]interface{} {
+	raw := encodeMsg(m)
+	stripped := encodeMsg(core.MsgBlockNoWitness{MsgBlock: m})
+	txs := []interface{}{}
+	for _, tx := range m.Txs {
+		if verbosity >= 2 {
+			txs = append(txs, txJSON(tx))
+		} else {
+			txs = append(txs, tx.Hash.String())
+		}
+	}
+	v := map[string]interface{}{
+		"hash":          m.Hash.String(),
+		"confirmations": confirmations(m.Hash, m.Height),
+		"size":          len(raw),
+		"strippedsize":  len(stripped),
+		"weight":        len(stripped)*3 + len(raw),
+		"height":        m.Height,
+		"version":       m.Ver,
+		"versionHex":    fmt.Sprintf("%08x", m.Ver),
+		"merkleroot":    m.Merkle.String(),
+		"tx":            txs,
+		"time":          m.Timestamp,
+		"nonce":         m.Nonce,
+		"bits":          fmt.Sprintf("%08x", m.Bits),
+		"difficulty":    core.GetDifficulty(m.Bits),
+		"nTx":           len(m.Txs),
+	}
+	headerExtra(v, m)
+	return v
+}
+
+//chainwork,prev and next block hash
+func headerExtra(v map[string]interface{}, m *core.MsgBlock) {
+	if n := core.Index.Get(m.Hash); n != nil {
+		v["chainwork"] = n.Work.String()
+	}
+	if !m.Prev.IsZero() {
+		v["previousblockhash"] = m.Prev.String()
+	}
+	if !core.IsMainChain(m.Hash) {
+		return
+	}
+	if next, err := core.LoadHeightBlock(m.Height + 1); err == nil {
+		v["nextblockhash"] = next.Hash.String()
+	}
+}
+
+func loadBlock(ps Params) (*core.MsgBlock, error) {
+	id, err := ps.HashID(0)
+	if err != nil {
+		return nil, err
+	}
+	m, err := core.LoadBlock(id)
+	if err != nil {
+		return nil, NewError(RPC_INVALID_ADDRESS_OR_KEY, "Block not found")
+	}
+	return m, nil
+}
+
+//getblockcount
+func getBlockCount(ps Params) (interface{}, error) {
+	return bestHeight(), nil
+}
+
+//getbestblockhash
+func getBestBlockHash(ps Params) (interface{}, error) {
+	if core.G.IsRequestGenesis() {
+		return nil, NewError(RPC_MISC_ERROR, "No best block")
+	}
+	return core.G.LastHash().String(), nil
+}
+
+//getblock "blockhash" ( verbosity )
+func getBlock(ps Params) (interface{}, error) {
+	verbosity, err := ps.Verbosity(1, 1)
+	if err != nil {
+		return nil, err
+	}
+	m, err := loadBlock(ps)
+	if err != nil {
+		return nil, err
+	}
+	if verbosity <= 0 {
+		return hex.EncodeToString(encodeMsg(m)), nil
+	}
+	return blockJSON(m, verbosity), nil
+}
+
+//getblockheader "blockhash" ( verbose )
+func getBlockHeader(ps Params) (interface{}, error) {
+	verbose, err := ps.Bool(1, true)
+	if err != nil {
+		return nil, err
+	}
+	m, err := loadBlock(ps)
+	if err != nil {
+		return nil, err
+	}
+	if !verbose {
+		return headerHex(m), nil
+	}
+	v := map[string]interface{}{
+		"hash":          m.Hash.String(),
+		"confirmations": confirmations(m.Hash, m.Height),
+		"height":        m.Height,
+		"version":       m.Ver,
+		"versionHex":    fmt.Sprintf("%08x", m.Ver),
+		"merkleroot":    m.Merkle.String(),
+		"time":          m.Timestamp,
+		"nonce":         m.Nonce,
+		"bits":          fmt.Sprintf("%08x", m.Bits),
+		"difficulty":    core.GetDifficulty(m.Bits),
+		"nTx":           len(m.Txs),
+	}
+	headerExtra(v, m)
+	return v, nil
+}
+
+//getrawtransaction "txid" ( verbose )
+func getRawTransaction(ps Params) (interface{}, error) {
+	id, err := ps.HashID(0)
+	if err != nil {
+		return nil, err
+	}
+	verbose, err := ps.Verbosity(1, 0)
+	if err != nil {
+		return nil, err
+	}
+	var blk *core.MsgBlock
+	tx, ok := core.TxsMap.Get(id)
+	if !ok {
+		tv, err := core.LoadTxValue(id)
+		if err != nil {
+			return nil, NewError(RPC_INVALID_ADDRESS_OR_KEY, "No such mempool or blockchain transaction")
+		}
+		if blk, err = core.LoadBlock(tv.BlockHash()); err != nil {
+			return nil, err
+		}
+		if tx, err = tv.GetTx(); err != nil {
+			return nil, err
+		}
+	}
+	if verbose == 0 {
+		return hex.EncodeToString(encodeMsg(tx)), nil
+	}
+	v := txJSON(tx)
+	if blk != nil {
+		v["blockhash"] = blk.Hash.String()
+		v["confirmations"] = confirmations(blk.Hash, blk.Height)
+		v["time"] = blk.Timestamp
+		v["blocktime"] = blk.Timestamp
+	}
+	return v, nil
+}
+
+//gettxout "txid" n ( include_mempool )
+func getTxOut(ps Params) (interface{}, error) {
+	id, err := ps.HashID(0)
+	if err != nil {
+		return nil, err
+	}
+	n, err := ps.Int(1, -1)
+	if err != nil {
+		return nil, err
+	}
+	if n < 0 {
+		return nil, NewError(RPC_INVALID_PARAMETER, "Invalid vout")
+	}
+	mempool, err := ps.Bool(2, true)
+	if err != nil {
+		return nil, err
+	}
+	if core.G.IsRequestGenesis() {
+		return nil, nil
+	}
+	best := core.G.LastBlock()
+	v := map[string]interface{}{
+		"bestblock": best.Hash.String(),
+	}
+	if mempool && core.TxsMap.IsSpent(id, uint32(n)) {
+		return nil, nil
+	}
+	coin, err := core.LoadCoin(id, uint32(n))
+	if err == nil {
+		v["confirmations"] = int64(best.Height) - int64(coin.Height) + 1
+		v["value"] = toBTC(uint64(coin.Value))
+		v["scriptPubKey"] = scriptJSON(coin.Script.Bytes())
+		v["coinbase"] = coin.CoinBase
+		return v, nil
+	}
+	if !errors.Is(err, core.ErrCoinNotFound) {
+		return nil, err
+	}
+	if tx, ok := core.TxsMap.Get(id); ok && mempool && n < len(tx.Outs) {
+		out := tx.Outs[n]
+		v["confirmations"] = 0
+		v["value"] = toBTC(out.Value)
+		v["scriptPubKey"] = scriptJSON(out.Script.Bytes())
+		v["coinbase"] = false
+		return v, nil
+	}
+	return nil, nil
+}
+
+//getpeerinfo
+func getPeerInfo(ps Params) (interface{}, error) {
+	cs := append(core.OutIps.All(), core.InIps.All()...)
+	vs := []interface{}{}
+	for i, c := range cs {
+		v := map[string]interface{}{
+			"id":           i,
+			"addr":         c.Key(),
+			"inbound":      c.Type == core.ClientTypeIn,
+			"pingtime":     float64(c.Ping) / 1000.0,
+			"minfeefilter": toBTC(uint64(c.FeeRate)),
+		}
+		if c.VerInfo != nil {
+			v["version"] = c.VerInfo.Ver
+			v["subver"] = c.VerInfo.SubVer
+			v["services"] = fmt.Sprintf("%016x", c.VerInfo.Service)
+			v["startingheight"] = c.VerInfo.Height
+			v["relaytxes"] = c.VerInfo.Relay != 0
+		}
+		vs = append(vs, v)
+	}
+	return vs, nil
+}
+
+//getmempoolinfo
+func getMempoolInfo(ps Params) (interface{}, error) {
+	return map[string]interface{}{
+		"loaded": true,
+		"size":   core.TxsMap.Len(),
+		"bytes":  core.TxsMap.Bytes(),
+	}, nil
+}
+
+func decodeTx(b []byte) (tx *core.TX, err error) {
+	defer func() {
+		if rerr := recover(); rerr != nil {
+			err = NewError(RPC_DESERIALIZATION_ERROR, "TX decode failed")
+		}
+	}()
+	h := core.NewNetHeader(b)
+	tx = &core.TX{}
+	tx.Read(h)
+	if !h.IsEOF() {
+		return nil, NewError(RPC_DESERIALIZATION_ERROR, "TX decode failed")
+	}
+	return tx, nil
+}
+
+//sendrawtransaction "hexstring"
+func sendRawTransaction(ps Params) (interface{}, error) {
+	b, err := ps.Hex(0)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := decodeTx(b)
+	if err != nil {
+		return nil, err
+	}
+	if core.HasTx(tx.Hash) {
+		return nil, NewError(RPC_VERIFY_ALREADY_IN_CHAIN, "Transaction already in block chain")
+	}
+	_, err = core.TxsMap.AcceptTx(tx)
+	if errors.Is(err, core.ErrTxExists) {
+		return tx.Hash.String(), nil
+	}
+	if errors.Is(err, core.ErrCoinNotFound) {
+		return nil, NewError(RPC_VERIFY_ERROR, "Missing inputs")
+	}
+	if err != nil {
+		return nil, NewError(RPC_VERIFY_REJECTED, "%v", err)
+	}
+	core.Relay.Announce(tx.Hash, nil)
+	return tx.Hash.String(), nil
+}
+
+//generatetoaddress nblocks address (maxtries)
+func generateToAddress(ps Params) (interface{}, error) {
+	if !ps.has(0) {
+		return nil, NewError(RPC_INVALID_PARAMS, "missing param %d", 0)
+	}
+	num, err := ps.Int(0, 0)
+	if err != nil {
+		return nil, err
+	}
+	addr, err := ps.String(1)
+	if err != nil {
+		return nil, err
+	}
+	tries, err := ps.Int(2, core.DEFAULT_MAX_TRIES)
+	if err != nil {
+		return nil, err
+	}
+	pks, err := script.NewScriptWithAddress(addr)
+	if err != nil {
+		return nil, NewError(RPC_INVALID_ADDRESS_OR_KEY, "Error: Invalid address")
+	}
+	ids, err := core.GenerateToScript(pks, num, uint64(tries))
+	vs := []string{}
+	for _, v := range ids {
+		vs = append(vs, v.String())
+	}
+	//max tries return mined blocks
+	if err != nil && !errors.Is(err, core.ErrMaxTries) {
+		return nil, NewError(RPC_MISC_ERROR, "%v", err)
+	}
+	return vs, nil
+}
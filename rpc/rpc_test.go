@@ -0,0 +1,258 @@
+package rpc
+
+import (
+	"bitcoin/config"
+	"bitcoin/core"
+	"bitcoin/script"
+	"bitcoin/util"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const (
+	testGenesisBlock = "0100000000000000000000000000000000000000000000000000000000000000000000003ba3edfd7a7b12b27ac72c3e67768f617fc81bc3888a51323a9fb8aa4b1e5e4a29ab5f49ffff001d1dac2b7c0101000000010000000000000000000000000000000000000000000000000000000000000000ffffffff4d04ffff001d0104455468652054696d65732030332f4a616e2f32303039204368616e63656c6c6f72206f6e206272696e6b206f66207365636f6e64206261696c6f757420666f722062616e6b73ffffffff0100f2052a01000000434104678afdb0fe5548271967f1a67130b7105cd6a828e03909a67962e0ea1f61deb649f6bc3f4cef38c4f35504e51ec112de5c384df7ba0b8d578a4c702b6bf11d5fac00000000"
+	testGenesisTx    = "4a5e1e4baab89f3a32518a88c31bc87f618f76673e2cc77ab2127b7afdeda33b"
+)
+
+//server with genesis block in memory db
+func testServer(t *testing.T) *httptest.Server {
+	core.UseMemDB()
+	core.Index = core.NewBlockIndex()
+	data, err := hex.DecodeString(testGenesisBlock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := core.NewMsgBlock()
+	m.Read(core.NewNetHeader(data))
+	core.G.Lock()
+	err = core.G.AcceptBlock(m)
+	core.G.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return httptest.NewServer(NewServer(testAuthConfig(config.GetConfig())))
+}
+
+func testAuthConfig(conf *config.Config) *config.Config {
+	conf.RpcUser, conf.RpcPass = "test", "test"
+	return conf
+}
+
+func testCall(t *testing.T, srv *httptest.Server, method string, params ...interface{}) *Response {
+	if params == nil {
+		params = []interface{}{}
+	}
+	body, _ := json.Marshal(map[string]interface{}{"method": method, "params": params, "id": 1})
+	req, _ := http.NewRequest(http.MethodPost, srv.URL, bytes.NewReader(body))
+	conf := config.GetConfig()
+	req.SetBasicAuth(conf.RpcUser, conf.RpcPass)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	rv := &Response{}
+	if err := json.NewDecoder(res.Body).Decode(rv); err != nil {
+		t.Fatal(err)
+	}
+	return rv
+}
+
+func TestAuth(t *testing.T) {
+	srv := testServer(t)
+	defer srv.Close()
+	req, _ := http.NewRequest(http.MethodPost, srv.URL, bytes.NewReader([]byte(`{"method":"getblockcount"}`)))
+	req.SetBasicAuth("bad", "bad")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("auth status %d", res.StatusCode)
+	}
+	if rv := testCall(t, srv, "notexists"); rv.Error == nil || rv.Error.Code != RPC_METHOD_NOT_FOUND {
+		t.Error("method not found error")
+	}
+	//regtest only
+	if rv := testCall(t, srv, "generatetoaddress", 1, util.BECH32Address(make([]byte, 20))); rv.Error == nil || rv.Error.Code != RPC_METHOD_NOT_FOUND {
+		t.Error("generatetoaddress registered on main network")
+	}
+}
+
+func TestEmptyPasswordAuth(t *testing.T) {
+	conf := config.GetConfig()
+	defer testAuthConfig(conf)
+	conf.RpcUser, conf.RpcPass = "", ""
+	srv := httptest.NewServer(NewServer(conf))
+	defer srv.Close()
+	req, _ := http.NewRequest(http.MethodPost, srv.URL, bytes.NewReader([]byte(`{"method":"getblockcount"}`)))
+	req.SetBasicAuth("", "")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("empty password auth status %d", res.StatusCode)
+	}
+}
+
+func TestWriteCookie(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rpccookie")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	user, pass, err := WriteCookie(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(filepath.Join(dir, COOKIE_FILE))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Errorf("cookie file mode %v", fi.Mode())
+	}
+	data, _ := ioutil.ReadFile(filepath.Join(dir, COOKIE_FILE))
+	if user != COOKIE_USER || len(pass) != 64 || string(data) != user+":"+pass {
+		t.Errorf("cookie %s error", data)
+	}
+	if _, pass2, _ := WriteCookie(dir); pass2 == pass {
+		t.Error("cookie password not random")
+	}
+}
+
+func TestGetBlock(t *testing.T) {
+	srv := testServer(t)
+	defer srv.Close()
+	conf := config.GetConfig()
+	if rv := testCall(t, srv, "getblockcount"); rv.Error != nil || rv.Result.(float64) != 0 {
+		t.Fatal("getblockcount error")
+	}
+	if rv := testCall(t, srv, "getbestblockhash"); rv.Error != nil || rv.Result.(string) != conf.GenesisBlock {
+		t.Fatal("getbestblockhash error")
+	}
+	rv := testCall(t, srv, "getblock", conf.GenesisBlock)
+	if rv.Error != nil {
+		t.Fatal(rv.Error)
+	}
+	bv := rv.Result.(map[string]interface{})
+	if bv["confirmations"].(float64) != 1 || bv["size"].(float64) != 285 || bv["difficulty"].(float64) != 1 {
+		t.Error("getblock result error")
+	}
+	if txs := bv["tx"].([]interface{}); len(txs) != 1 || txs[0].(string) != testGenesisTx {
+		t.Error("getblock tx error")
+	}
+	if rv := testCall(t, srv, "getblock", conf.GenesisBlock, 0); rv.Result.(string) != testGenesisBlock {
+		t.Error("getblock hex error")
+	}
+	if rv := testCall(t, srv, "getblockheader", conf.GenesisBlock, false); rv.Result.(string) != testGenesisBlock[:160] {
+		t.Error("getblockheader hex error")
+	}
+	if rv := testCall(t, srv, "getblock", "xx"); rv.Error == nil || rv.Error.Code != RPC_INVALID_PARAMETER {
+		t.Error("invalid hash param error")
+	}
+	if rv := testCall(t, srv, "getblock", testGenesisTx); rv.Error == nil || rv.Error.Code != RPC_INVALID_ADDRESS_OR_KEY {
+		t.Error("block not found error")
+	}
+}
+
+func TestGetTransaction(t *testing.T) {
+	srv := testServer(t)
+	defer srv.Close()
+	rv := testCall(t, srv, "getrawtransaction", testGenesisTx, true)
+	if rv.Error != nil {
+		t.Fatal(rv.Error)
+	}
+	tv := rv.Result.(map[string]interface{})
+	if tv["txid"].(string) != testGenesisTx || tv["confirmations"].(float64) != 1 {
+		t.Error("getrawtransaction result error")
+	}
+	rv = testCall(t, srv, "gettxout", testGenesisTx, 0)
+	if rv.Error != nil || rv.Result == nil {
+		t.Fatal("gettxout error")
+	}
+	if ov := rv.Result.(map[string]interface{}); ov["value"].(float64) != 50 || !ov["coinbase"].(bool) {
+		t.Error("gettxout result error")
+	}
+	if rv := testCall(t, srv, "gettxout", testGenesisTx, 1); rv.Error != nil || rv.Result != nil {
+		t.Error("gettxout not exists error")
+	}
+	if rv := testCall(t, srv, "getmempoolinfo"); rv.Error != nil || rv.Result.(map[string]interface{})["size"].(float64) != 0 {
+		t.Error("getmempoolinfo error")
+	}
+	if rv := testCall(t, srv, "getpeerinfo"); rv.Error != nil {
+		t.Error("getpeerinfo error")
+	}
+}
+
+func TestSendRawTransaction(t *testing.T) {
+	srv := testServer(t)
+	defer srv.Close()
+	if rv := testCall(t, srv, "sendrawtransaction", "zz"); rv.Error == nil || rv.Error.Code != RPC_DESERIALIZATION_ERROR {
+		t.Error("bad hex error")
+	}
+	if rv := testCall(t, srv, "sendrawtransaction", "0100"); rv.Error == nil || rv.Error.Code != RPC_DESERIALIZATION_ERROR {
+		t.Error("decode tx error")
+	}
+	//spend unknown out
+	tx := &core.TX{Ver: 1}
+	in := &core.TxIn{OutHash: core.HashID{1}, Script: script.NewScript([]byte{0x51}), Sequence: 0xffffffff}
+	tx.Ins = []*core.TxIn{in}
+	pkh := script.NewScript([]byte{}).PushOp(script.OP_DUP).PushOp(script.OP_HASH160).PushBytes(make([]byte, 20))
+	pkh.PushOp(script.OP_EQUALVERIFY).PushOp(script.OP_CHECKSIG)
+	tx.Outs = []*core.TxOut{{Value: 1000, Script: pkh}}
+	h := core.NewNetHeader()
+	tx.Write(h)
+	rv := testCall(t, srv, "sendrawtransaction", hex.EncodeToString(h.Bytes()))
+	if rv.Error == nil || rv.Error.Code != RPC_VERIFY_ERROR {
+		t.Errorf("missing inputs error %v", rv.Error)
+	}
+}
+
+func TestGenerateToAddress(t *testing.T) {
+	defer config.SelectNetwork(config.NET_MAIN)
+	conf, err := config.SelectNetwork(config.NET_REGTEST)
+	if err != nil {
+		t.Fatal(err)
+	}
+	core.UseMemDB()
+	core.Index = core.NewBlockIndex()
+	core.TxsMap = core.NewTxMap()
+	core.G.SetBestBlock(nil)
+	gb, err := core.GetGenesisBlock(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	core.G.Lock()
+	err = core.G.AcceptBlock(gb)
+	core.G.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(NewServer(testAuthConfig(conf)))
+	defer srv.Close()
+	addr := util.BECH32Address(make([]byte, 20))
+	rv := testCall(t, srv, "generatetoaddress", 2, addr)
+	if rv.Error != nil {
+		t.Fatal(rv.Error)
+	}
+	if ids := rv.Result.([]interface{}); len(ids) != 2 {
+		t.Fatal("generate blocks num error")
+	}
+	if rv := testCall(t, srv, "getblockcount"); rv.Result.(float64) != 2 {
+		t.Error("generate block count error")
+	}
+	if rv := testCall(t, srv, "generatetoaddress", 1, "bc1qxx"); rv.Error == nil || rv.Error.Code != RPC_INVALID_ADDRESS_OR_KEY {
+		t.Error("invalid address error")
+	}
+}
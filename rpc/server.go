@@ -0,0 +1,261 @@
+package rpc
+
+import (
+	"bitcoin/config"
+	"bitcoin/core"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+//bitcoind compatible error codes
+const (
+	//standard json-rpc 2.0 errors
+	RPC_INVALID_REQUEST  = -32600
+	RPC_METHOD_NOT_FOUND = -32601
+	RPC_INVALID_PARAMS   = -32602
+	RPC_INTERNAL_ERROR   = -32603
+	RPC_PARSE_ERROR      = -32700
+	//general application defined errors
+	RPC_MISC_ERROR              = -1
+	RPC_TYPE_ERROR              = -3
+	RPC_INVALID_ADDRESS_OR_KEY  = -5
+	RPC_INVALID_PARAMETER       = -8
+	RPC_DESERIALIZATION_ERROR   = -22
+	RPC_VERIFY_ERROR            = -25
+	RPC_VERIFY_REJECTED         = -26
+	RPC_VERIFY_ALREADY_IN_CHAIN = -27
+)
+
+//max request body size
+const MaxRequestSize = 1024 * 1024 * 32
+
+const (
+	//cookie file in data dir when rpc user or password not set
+	COOKIE_FILE = ".cookie"
+	COOKIE_USER = "__cookie__"
+)
+
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("rpc error %d: %s", e.Code, e.Message)
+}
+
+func NewError(code int, format string, args ...interface{}) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+type Request struct {
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	ID     json.RawMessage `json:"id"`
+}
+
+type Response struct {
+	Result interface{}     `json:"result"`
+	Error  *Error          `json:"error"`
+	ID     json.RawMessage `json:"id"`
+}
+
+//rpc method,return result marshal to json
+type HandlerFunc func(ps Params) (interface{}, error)
+
+//json-rpc 1.0 server over http with basic auth
+type Server struct {
+	user    string
+	pass    string
+	methods map[string]HandlerFunc
+}
+
+func NewServer(conf *config.Config) *Server {
+	s := &Server{
+		user:    conf.RpcUser,
+		pass:    conf.RpcPass,
+		methods: map[string]HandlerFunc{},
+	}
+	s.Register("getblockcount", getBlockCount)
+	s.Register("getbestblockhash", getBestBlockHash)
+	s.Register("getblock", getBlock)
+	s.Register("getblockheader", getBlockHeader)
+	s.Register("getrawtransaction", getRawTransaction)
+	s.Register("gettxout", getTxOut)
+	s.Register("getpeerinfo", getPeerInfo)
+	s.Register("getmempoolinfo", getMempoolInfo)
+	s.Register("sendrawtransaction", sendRawTransaction)
+	//mine blocks only for local test network
+	if conf.Id == config.NET_REGTEST {
+		s.Register("generatetoaddress", generateToAddress)
+	}
+	return s
+}
+
+//write random password cookie file,same format as bitcoind
+func WriteCookie(dir string) (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	pass := hex.EncodeToString(b)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", "", err
+	}
+	file := filepath.Join(dir, COOKIE_FILE)
+	if err := ioutil.WriteFile(file, []byte(COOKIE_USER+":"+pass), 0600); err != nil {
+		return "", "", err
+	}
+	return COOKIE_USER, pass, nil
+}
+
+func (s *Server) Register(name string, fn HandlerFunc) {
+	s.methods[name] = fn
+}
+
+func (s *Server) checkAuth(r *http.Request) bool {
+	user, pass, ok := r.BasicAuth()
+	//empty password never auth
+	if !ok || s.pass == "" {
+		return false
+	}
+	uok := subtle.ConstantTimeCompare([]byte(user), []byte(s.user)) == 1
+	pok := subtle.ConstantTimeCompare([]byte(pass), []byte(s.pass)) == 1
+	return uok && pok
+}
+
+func (s *Server) call(req *Request) (res *Response) {
+	res = &Response{ID: req.ID}
+	defer func() {
+		if err := recover(); err != nil {
+			res.Result = nil
+			res.Error = NewError(RPC_INTERNAL_ERROR, "%v", err)
+		}
+	}()
+	fn, ok := s.methods[req.Method]
+	if !ok {
+		res.Error = NewError(RPC_METHOD_NOT_FOUND, "Method not found")
+		return
+	}
+	ps := Params{}
+	if len(req.Params) > 0 && !bytes.Equal(req.Params, []byte("null")) {
+		if err := json.Unmarshal(req.Params, &ps); err != nil {
+			res.Error = NewError(RPC_INVALID_REQUEST, "Params must be an array")
+			return
+		}
+	}
+	v, err := fn(ps)
+	if err == nil {
+		res.Result = v
+	} else if rerr, ok := err.(*Error); ok {
+		res.Error = rerr
+	} else {
+		res.Error = NewError(RPC_MISC_ERROR, "%v", err)
+	}
+	return
+}
+
+//http status for single request error,same as bitcoind
+func httpStatus(err *Error) int {
+	if err == nil {
+		return http.StatusOK
+	}
+	switch err.Code {
+	case RPC_INVALID_REQUEST, RPC_PARSE_ERROR:
+		return http.StatusBadRequest
+	case RPC_METHOD_NOT_FOUND:
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+func (s *Server) reply(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Println("rpc write response error", err)
+	}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.checkAuth(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="jsonrpc"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "JSONRPC server handles only POST requests", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, MaxRequestSize))
+	if err != nil {
+		s.reply(w, http.StatusBadRequest, &Response{Error: NewError(RPC_PARSE_ERROR, "Read error")})
+		return
+	}
+	body = bytes.TrimSpace(body)
+	//batch request
+	if len(body) > 0 && body[0] == '[' {
+		reqs := []*Request{}
+		if err := json.Unmarshal(body, &reqs); err != nil {
+			s.reply(w, http.StatusInternalServerError, &Response{Error: NewError(RPC_PARSE_ERROR, "Parse error")})
+			return
+		}
+		ress := []*Response{}
+		for _, req := range reqs {
+			ress = append(ress, s.call(req))
+		}
+		s.reply(w, http.StatusOK, ress)
+		return
+	}
+	req := &Request{}
+	if err := json.Unmarshal(body, req); err != nil {
+		s.reply(w, http.StatusInternalServerError, &Response{Error: NewError(RPC_PARSE_ERROR, "Parse error")})
+		return
+	}
+	res := s.call(req)
+	s.reply(w, httpStatus(res.Error), res)
+}
+
+//start json rpc server
+func Start(ctx context.Context) {
+	defer func() {
+		core.MWG.Done()
+	}()
+	core.MWG.Add(1)
+	conf := config.GetConfig()
+	rs := NewServer(conf)
+	if conf.RpcUser == "" || conf.RpcPass == "" {
+		user, pass, err := WriteCookie(conf.DataDir)
+		if err != nil {
+			log.Println("rpc write cookie error", err)
+			return
+		}
+		defer os.Remove(filepath.Join(conf.DataDir, COOKIE_FILE))
+		rs.user, rs.pass = user, pass
+		log.Println("rpc auth cookie", filepath.Join(conf.DataDir, COOKIE_FILE))
+	}
+	srv := &http.Server{Addr: conf.RpcAddr, Handler: rs}
+	done := make(chan bool)
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		srv.Shutdown(context.Background())
+	}()
+	log.Println("rpc listen start", conf.RpcAddr)
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		log.Println("rpc listen error", err)
+	}
+}
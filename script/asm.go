@@ -0,0 +1,112 @@
+package script
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+//disassemble script,pushes as <hex>,unknown ops and bad tail as 0x raw bytes
+func (s Script) Asm() string {
+	ret := []string{}
+	for pc := 0; pc < s.Len(); {
+		ok, idx, op, ops := s.GetOp(pc)
+		if !ok {
+			ret = append(ret, "0x"+hex.EncodeToString(s[pc:]))
+			break
+		}
+		if op > OP_0 && op <= OP_PUSHDATA4 {
+			ret = append(ret, "<"+hex.EncodeToString(ops)+">")
+		} else if name := GetOpName(op); name != "OP_UNKNOWN" {
+			ret = append(ret, name)
+		} else {
+			ret = append(ret, fmt.Sprintf("0x%02x", op))
+		}
+		pc = idx
+	}
+	return strings.Join(ret, " ")
+}
+
+//push data with smallest opcode,OP_0 OP_1NEGATE OP_1-OP_16 for single values
+func (s *Script) PushMinimal(b []byte) *Script {
+	if len(b) == 0 {
+		return s.PushOp(OP_0)
+	}
+	if len(b) == 1 && b[0] >= 1 && b[0] <= 16 {
+		return s.PushOp(OP_1 + b[0] - 1)
+	}
+	if len(b) == 1 && b[0] == 0x81 {
+		return s.PushOp(OP_1NEGATE)
+	}
+	return s.PushBytes(b)
+}
+
+//split asm text,quoted strings keep spaces
+func asmTokens(s string) ([]string, error) {
+	ret := []string{}
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c == ' ' || c == '\t' || c == '\n' || c == '\r' {
+			i++
+			continue
+		}
+		e := i + 1
+		if c == '\'' || c == '"' {
+			for e < len(s) && s[e] != c {
+				e++
+			}
+			if e == len(s) {
+				return nil, fmt.Errorf("unterminated string at %d", i)
+			}
+			e++
+		} else {
+			for e < len(s) && s[e] != ' ' && s[e] != '\t' && s[e] != '\n' && s[e] != '\r' {
+				e++
+			}
+		}
+		ret = append(ret, s[i:e])
+		i = e
+	}
+	return ret, nil
+}
+
+//assemble text from Asm,also numbers,'string' pushes and op names without OP_ prefix
+func NewScriptAsm(s string) (*Script, error) {
+	tokens, err := asmTokens(s)
+	if err != nil {
+		return nil, err
+	}
+	ret := NewScript([]byte{})
+	for _, w := range tokens {
+		switch {
+		case len(w) >= 2 && (w[0] == '\'' || w[0] == '"'):
+			ret.PushMinimal([]byte(w[1 : len(w)-1]))
+		case len(w) >= 2 && w[0] == '<' && w[len(w)-1] == '>':
+			b, err := hex.DecodeString(w[1 : len(w)-1])
+			if err != nil {
+				return nil, fmt.Errorf("bad push %s", w)
+			}
+			ret.PushMinimal(b)
+		case strings.HasPrefix(w, "0x"):
+			b, err := hex.DecodeString(w[2:])
+			if err != nil || len(b) == 0 {
+				return nil, fmt.Errorf("bad raw bytes %s", w)
+			}
+			ret.Concat(NewScript(b))
+		default:
+			if n, err := strconv.ParseInt(w, 10, 64); err == nil {
+				if n > 0xffffffff || n < -0xffffffff {
+					return nil, fmt.Errorf("number %s out of range", w)
+				}
+				ret.PushInt64(n)
+			} else if op, ok := GetOpCode(w); ok {
+				ret.PushOp(op)
+			} else {
+				return nil, errors.New("unknown token " + w)
+			}
+		}
+	}
+	return ret, nil
+}
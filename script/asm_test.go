@@ -0,0 +1,139 @@
+package script
+
+import (
+	"bytes"
+	"encoding/hex"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+)
+
+//op with minimal push data if op is push
+func testOpScript(op byte) *Script {
+	s := NewScript([]byte{})
+	switch {
+	case op > OP_0 && op < OP_PUSHDATA1:
+		s.PushBytes(bytes.Repeat([]byte{0xff}, int(op)))
+	case op == OP_PUSHDATA1:
+		s.PushBytes(bytes.Repeat([]byte{0xff}, 0x4c))
+	case op == OP_PUSHDATA2:
+		s.PushBytes(bytes.Repeat([]byte{0xff}, 0x100))
+	case op == OP_PUSHDATA4:
+		s.PushBytes(bytes.Repeat([]byte{0xff}, 0x10000))
+	default:
+		s.PushOp(op)
+	}
+	if (*s)[0] != op {
+		panic("test op script error")
+	}
+	return s
+}
+
+func testAsmRoundTrip(t *testing.T, s *Script) {
+	asm := s.Asm()
+	v, err := NewScriptAsm(asm)
+	if err != nil || !bytes.Equal(*v, *s) {
+		t.Errorf("round trip %x asm %.40s error %v", (*s)[:1], asm, err)
+	}
+}
+
+//every OP_ constant in script.go
+func TestAsmOpCodes(t *testing.T) {
+	f, err := parser.ParseFile(token.NewFileSet(), "script.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	num := 0
+	for _, decl := range f.Decls {
+		gd, ok := decl.(*ast.GenDecl)
+		if !ok || gd.Tok != token.CONST {
+			continue
+		}
+		for _, spec := range gd.Specs {
+			for _, name := range spec.(*ast.ValueSpec).Names {
+				if !strings.HasPrefix(name.Name, "OP_") {
+					continue
+				}
+				num++
+				op, ok := GetOpCode(name.Name)
+				if !ok {
+					t.Errorf("%s miss name", name.Name)
+					continue
+				}
+				s := testOpScript(op)
+				if asm := s.Asm(); op > OP_PUSHDATA4 && asm != GetOpName(op) {
+					t.Errorf("%s asm %s", name.Name, asm)
+				}
+				testAsmRoundTrip(t, s)
+			}
+		}
+	}
+	if num < 100 {
+		t.Error("opcode constants not found", num)
+	}
+}
+
+func TestAsmAllBytes(t *testing.T) {
+	for i := 0; i < 256; i++ {
+		testAsmRoundTrip(t, testOpScript(byte(i)))
+	}
+	//truncated push kept as raw bytes
+	s := NewScript([]byte{OP_DUP, OP_PUSHDATA1, 5, 1})
+	if s.Asm() != "OP_DUP 0x4c0501" {
+		t.Error("bad push asm error", s.Asm())
+	}
+	testAsmRoundTrip(t, s)
+}
+
+func TestAsmMinimal(t *testing.T) {
+	tests := []struct {
+		s    string
+		want string
+	}{
+		{"4c0107", "57"},
+		{"0181", "4f"},
+		{"4c00", "00"},
+		{"4d0300616263", "03616263"},
+		{"0110", "60"},
+		{"0111", "0111"},
+	}
+	for _, v := range tests {
+		s, err := NewScriptAsm(NewScriptHex(v.s).Asm())
+		if err != nil || hex.EncodeToString(*s) != v.want {
+			t.Errorf("minimal %s got %v %v", v.s, s, err)
+		}
+	}
+}
+
+func TestNewScriptAsm(t *testing.T) {
+	pkh := strings.Repeat("ab", 20)
+	tests := []struct {
+		s    string
+		want string
+	}{
+		{"OP_DUP OP_HASH160 <" + pkh + "> OP_EQUALVERIFY OP_CHECKSIG", "76a914" + pkh + "88ac"},
+		{"DUP HASH160 <" + pkh + "> EQUALVERIFY CHECKSIG", "76a914" + pkh + "88ac"},
+		{"0 -1 1 16 17 -17 1000", "004f516001110191" + "02e803"},
+		{"'hello world' \"ab\" ''", "0b68656c6c6f20776f726c64" + "026162" + "00"},
+		{"OP_FALSE OP_TRUE OP_NOP2 OP_NOP3", "0051b1b2"},
+		{" OP_1\tOP_2\n", "5152"},
+		{"0xbb 0x0102", "bb0102"},
+	}
+	for _, v := range tests {
+		s, err := NewScriptAsm(v.s)
+		if err != nil || hex.EncodeToString(*s) != v.want {
+			t.Errorf("asm %q got %v %v", v.s, s, err)
+		}
+	}
+	for _, v := range []string{"OP_FOO", "<zz>", "'abc", "0x", "0x1", "99999999999"} {
+		if _, err := NewScriptAsm(v); err == nil {
+			t.Errorf("asm %q error not detected", v)
+		}
+	}
+	s := NewScriptHex("76a914" + pkh + "88ac")
+	if s.Asm() != "OP_DUP OP_HASH160 <"+pkh+"> OP_EQUALVERIFY OP_CHECKSIG" {
+		t.Error("p2pkh asm error", s.Asm())
+	}
+}
@@ -10,8 +10,33 @@ const (
 
 type SigVersion uint
 
+//sighash version of script being executed
+const (
+	SIGVERSION_BASE SigVersion = iota
+	SIGVERSION_WITNESS_V0
+	SIGVERSION_TAPROOT
+	SIGVERSION_TAPSCRIPT
+)
+
 type SigChecker interface {
 	CheckSig(stack *Stack, sig []byte, pub []byte) error
 	CheckLockTime(ltime ScriptNum) error
 	CheckSequence(seq ScriptNum) error
 }
+
+//optional,told byte position after last executed OP_CODESEPARATOR
+//script code for sighash start from there
+type CodeSeparatorChecker interface {
+	SetCodeSeparator(pos int)
+}
+
+//optional,told signatures of one checksig op to remove from legacy script code
+//return count found,core FindAndDelete
+type SigDeleteChecker interface {
+	DeleteSigs(sigs [][]byte) int
+}
+
+//optional,told sighash version of script executing,base if not implemented
+type SigVersionChecker interface {
+	SigVersion() SigVersion
+}
@@ -0,0 +1,209 @@
+package script
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+//state before op executed
+type TraceStep struct {
+	Script   *Script //script executing
+	PC       int     //op byte position
+	Op       byte
+	Data     []byte  //push data
+	Exec     bool    //false if skipped by condition
+	Stack    []Value //bottom to top
+	AltStack []Value
+	Cond     []bool //condition stack,true branch executing
+}
+
+//tracer told each step,error stop Eval
+type Tracer interface {
+	Trace(st *TraceStep) error
+}
+
+func copyValues(vs []Value) []Value {
+	ret := make([]Value, len(vs))
+	for i, v := range vs {
+		ret[i] = append(Value{}, v...)
+	}
+	return ret
+}
+
+func newTraceStep(s *Script, pc int, op byte, ops []byte, fexec bool, stack *Stack, alts *Stack, vfexec *Stack) *TraceStep {
+	st := &TraceStep{
+		Script:   s,
+		PC:       pc,
+		Op:       op,
+		Data:     append([]byte{}, ops...),
+		Exec:     fexec,
+		Stack:    copyValues(stack.Values()),
+		AltStack: copyValues(alts.Values()),
+	}
+	for _, v := range vfexec.Values() {
+		st.Cond = append(st.Cond, v.ToBool())
+	}
+	return st
+}
+
+func valuesString(vs []Value) string {
+	ret := []string{}
+	for _, v := range vs {
+		ret = append(ret, "<"+hex.EncodeToString(v)+">")
+	}
+	return "[" + strings.Join(ret, " ") + "]"
+}
+
+//op asm text
+func (st *TraceStep) OpString() string {
+	if st.Op > OP_0 && st.Op <= OP_PUSHDATA4 {
+		return "<" + hex.EncodeToString(st.Data) + ">"
+	}
+	return GetOpName(st.Op)
+}
+
+func (st *TraceStep) String() string {
+	return fmt.Sprintf("%d %s exec=%v stack=%s alt=%s cond=%v", st.PC, st.OpString(), st.Exec, valuesString(st.Stack), valuesString(st.AltStack), st.Cond)
+}
+
+//asm with op at PC marked,ops around limited by n
+func (st *TraceStep) Context(n int) string {
+	ret := []string{}
+	mark := -1
+	s := *st.Script
+	for pc := 0; pc < s.Len(); {
+		ok, idx, _, _ := s.GetOp(pc)
+		if !ok {
+			idx = s.Len()
+		}
+		asm := s.SubScript(pc, idx).Asm()
+		if pc == st.PC {
+			mark = len(ret)
+			asm = ">>" + asm + "<<"
+		}
+		ret = append(ret, asm)
+		pc = idx
+	}
+	if mark >= 0 && n > 0 {
+		b, e := mark-n, mark+n+1
+		if b < 0 {
+			b = 0
+		}
+		if e > len(ret) {
+			e = len(ret)
+		}
+		ret = ret[b:e]
+	}
+	return strings.Join(ret, " ")
+}
+
+//record all steps,replay with step and breakpoints
+type Debugger struct {
+	steps  []*TraceStep
+	err    error
+	pos    int //next step index
+	breaks map[int]bool
+	bops   map[byte]bool
+}
+
+func NewDebugger() *Debugger {
+	return &Debugger{
+		breaks: map[int]bool{},
+		bops:   map[byte]bool{},
+	}
+}
+
+func (d *Debugger) Trace(st *TraceStep) error {
+	d.steps = append(d.steps, st)
+	return nil
+}
+
+//run f with debugger as tracer,record result and rewind
+func (d *Debugger) Run(f func(tr Tracer) error) error {
+	d.steps = nil
+	d.pos = 0
+	d.err = f(d)
+	return d.err
+}
+
+//debug Eval
+func (s Script) Debug(stack *Stack, checker SigChecker, flags int) *Debugger {
+	d := NewDebugger()
+	d.Run(func(tr Tracer) error {
+		return s.EvalTrace(stack, checker, flags, tr)
+	})
+	return d
+}
+
+//eval result
+func (d *Debugger) Err() error {
+	return d.err
+}
+
+func (d *Debugger) Steps() []*TraceStep {
+	return d.steps
+}
+
+//break before op at byte position pc
+func (d *Debugger) Break(pc int) {
+	d.breaks[pc] = true
+}
+
+//break before any op
+func (d *Debugger) BreakOp(op byte) {
+	d.bops[op] = true
+}
+
+func (d *Debugger) ClearBreaks() {
+	d.breaks = map[int]bool{}
+	d.bops = map[byte]bool{}
+}
+
+func (d *Debugger) Rewind() {
+	d.pos = 0
+}
+
+//last step returned,nil before first step
+func (d *Debugger) Current() *TraceStep {
+	if d.pos == 0 {
+		return nil
+	}
+	return d.steps[d.pos-1]
+}
+
+//next step,nil if end
+func (d *Debugger) Step() *TraceStep {
+	if d.pos >= len(d.steps) {
+		return nil
+	}
+	d.pos++
+	return d.steps[d.pos-1]
+}
+
+//run to next breakpoint,nil if end
+func (d *Debugger) Continue() *TraceStep {
+	for st := d.Step(); st != nil; st = d.Step() {
+		if d.breaks[st.PC] || d.bops[st.Op] {
+			return st
+		}
+	}
+	return nil
+}
+
+//step eval stopped on,nil if success
+func (d *Debugger) Failed() *TraceStep {
+	if d.err == nil || len(d.steps) == 0 {
+		return nil
+	}
+	return d.steps[len(d.steps)-1]
+}
+
+//failed op with script context and stacks
+func (d *Debugger) FailContext() string {
+	st := d.Failed()
+	if st == nil {
+		return ""
+	}
+	return fmt.Sprintf("%v at %d %s\nscript: %s\nstack: %s\nalt: %s\ncond: %v", d.err, st.PC, st.OpString(), st.Context(5), valuesString(st.Stack), valuesString(st.AltStack), st.Cond)
+}
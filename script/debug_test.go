@@ -0,0 +1,94 @@
+package script
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func testAsm(t *testing.T, s string) *Script {
+	v, err := NewScriptAsm(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestEvalTrace(t *testing.T) {
+	s := testAsm(t, "OP_1 OP_IF OP_2 OP_ELSE OP_3 OP_ENDIF OP_DUP OP_TOALTSTACK")
+	d := s.Debug(NewStack(), &testTapChecker{}, 0)
+	if d.Err() != nil || len(d.Steps()) != 8 {
+		t.Fatal("trace error", d.Err(), len(d.Steps()))
+	}
+	//OP_3 skipped in else branch
+	st := d.Steps()[4]
+	if st.Op != OP_3 || st.PC != 4 || st.Exec || len(st.Cond) != 1 || st.Cond[0] {
+		t.Error("skipped step error", st)
+	}
+	st = d.Steps()[7]
+	if st.Op != OP_TOALTSTACK || len(st.Stack) != 2 || len(st.AltStack) != 0 || len(st.Cond) != 0 {
+		t.Error("last step error", st)
+	}
+	if !strings.HasPrefix(st.String(), "7 OP_TOALTSTACK exec=true stack=[<02> <02>]") {
+		t.Error("step string error", st)
+	}
+}
+
+func TestDebugger(t *testing.T) {
+	s := testAsm(t, "OP_1 OP_DUP OP_ADD <02> OP_EQUALVERIFY OP_3 OP_4 OP_EQUALVERIFY OP_1")
+	d := s.Debug(NewStack(), &testTapChecker{}, 0)
+	if !errors.Is(d.Err(), SCRIPT_ERR_EQUALVERIFY) {
+		t.Fatal("eval error", d.Err())
+	}
+	if d.Current() != nil || d.Step().Op != OP_1 || d.Step().Op != OP_DUP || d.Current().Op != OP_DUP {
+		t.Error("step error")
+	}
+	d.BreakOp(OP_EQUALVERIFY)
+	if st := d.Continue(); st == nil || st.PC != 4 {
+		t.Error("break op error", st)
+	}
+	if st := d.Continue(); st == nil || st.PC != 7 || len(st.Stack) != 2 {
+		t.Error("second break error", st)
+	}
+	if d.Continue() != nil {
+		t.Error("end not detected")
+	}
+	d.Rewind()
+	d.ClearBreaks()
+	d.Break(5)
+	if st := d.Continue(); st == nil || st.Op != OP_3 {
+		t.Error("break pc error", st)
+	}
+	if st := d.Failed(); st == nil || st.PC != 7 || st.Op != OP_EQUALVERIFY {
+		t.Fatal("failed step error", st)
+	}
+	ctx := d.FailContext()
+	if !strings.Contains(ctx, "OP_3 OP_4 >>OP_EQUALVERIFY<< OP_1") || !strings.Contains(ctx, "stack: [<03> <04>]") {
+		t.Error("fail context error", ctx)
+	}
+}
+
+type testStopTracer struct {
+	n int
+}
+
+var errTestStop = errors.New("stop")
+
+func (tr *testStopTracer) Trace(st *TraceStep) error {
+	if tr.n++; tr.n == 2 {
+		return errTestStop
+	}
+	return nil
+}
+
+func TestTracerStop(t *testing.T) {
+	stack := NewStack()
+	if err := testAsm(t, "OP_1 OP_2 OP_3").EvalTrace(stack, &testTapChecker{}, 0, &testStopTracer{}); !errors.Is(err, errTestStop) || stack.Len() != 1 {
+		t.Error("tracer stop error", err, stack.Len())
+	}
+	//bad push traced before fail
+	d := NewScript([]byte{OP_1, OP_PUSHDATA1, 5}).Debug(NewStack(), &testTapChecker{}, 0)
+	if st := d.Failed(); !errors.Is(d.Err(), SCRIPT_ERR_BAD_OPCODE) || st == nil || st.PC != 1 {
+		t.Error("bad opcode step error", d.Err(), st)
+	}
+}
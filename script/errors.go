@@ -1,6 +1,9 @@
 package script
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 var (
 	SCRIPT_ERR_BAD_OPCODE                 = errors.New("SCRIPT_ERR_BAD_OPCODE")
@@ -8,8 +11,10 @@ var (
 	SCRIPT_ERR_DISABLED_OPCODE            = errors.New("SCRIPT_ERR_DISABLED_OPCODE")
 	SCRIPT_ERR_MINIMALDATA                = errors.New("SCRIPT_ERR_MINIMALDATA")
 	SCRIPT_ERR_STACK_SIZE                 = errors.New("SCRIPT_ERR_STACK_SIZE")
+	SCRIPT_ERR_SCRIPT_SIZE                = errors.New("SCRIPT_ERR_SCRIPT_SIZE")
 	SCRIPT_ERR_UNBALANCED_CONDITIONAL     = errors.New("SCRIPT_ERR_UNBALANCED_CONDITIONAL")
 	SCRIPT_ERR_INVALID_STACK_OPERATION    = errors.New("SCRIPT_ERR_INVALID_STACK_OPERATION")
+	SCRIPT_ERR_INVALID_ALTSTACK_OPERATION = errors.New("SCRIPT_ERR_INVALID_ALTSTACK_OPERATION")
 	SCRIPT_ERR_NEGATIVE_LOCKTIME          = errors.New("SCRIPT_ERR_NEGATIVE_LOCKTIME")
 	SCRIPT_ERR_UNSATISFIED_LOCKTIME       = errors.New("SCRIPT_ERR_UNSATISFIED_LOCKTIME")
 	SCRIPT_ERR_DISCOURAGE_UPGRADABLE_NOPS = errors.New("SCRIPT_ERR_DISCOURAGE_UPGRADABLE_NOPS")
@@ -31,4 +36,117 @@ var (
 	SCRIPT_ERR_SIG_NULLDUMMY              = errors.New("SCRIPT_ERR_SIG_NULLDUMMY")
 	SCRIPT_ERR_CHECKMULTISIGVERIFY        = errors.New("SCRIPT_ERR_CHECKMULTISIGVERIFY")
 	SCRIPT_ERR_OP_CODESEPARATOR           = errors.New("SCRIPT_ERR_OP_CODESEPARATOR")
+	SCRIPT_ERR_SCRIPTNUM                  = errors.New("SCRIPT_ERR_SCRIPTNUM")
+	SCRIPT_ERR_PUSH_SIZE                  = errors.New("SCRIPT_ERR_PUSH_SIZE")
+	SCRIPT_ERR_EVAL_FALSE                 = errors.New("SCRIPT_ERR_EVAL_FALSE")
+	SCRIPT_ERR_CLEANSTACK                 = errors.New("SCRIPT_ERR_CLEANSTACK")
+	SCRIPT_ERR_SIG_PUSHONLY               = errors.New("SCRIPT_ERR_SIG_PUSHONLY")
+	//taproot
+	SCRIPT_ERR_WITNESS_PROGRAM_WITNESS_EMPTY         = errors.New("SCRIPT_ERR_WITNESS_PROGRAM_WITNESS_EMPTY")
+	SCRIPT_ERR_WITNESS_PROGRAM_MISMATCH              = errors.New("SCRIPT_ERR_WITNESS_PROGRAM_MISMATCH")
+	SCRIPT_ERR_WITNESS_MALLEATED                     = errors.New("SCRIPT_ERR_WITNESS_MALLEATED")
+	SCRIPT_ERR_WITNESS_MALLEATED_P2SH                = errors.New("SCRIPT_ERR_WITNESS_MALLEATED_P2SH")
+	SCRIPT_ERR_WITNESS_UNEXPECTED                    = errors.New("SCRIPT_ERR_WITNESS_UNEXPECTED")
+	SCRIPT_ERR_WITNESS_PROGRAM_WRONG_LENGTH          = errors.New("SCRIPT_ERR_WITNESS_PROGRAM_WRONG_LENGTH")
+	SCRIPT_ERR_DISCOURAGE_UPGRADABLE_WITNESS_PROGRAM = errors.New("SCRIPT_ERR_DISCOURAGE_UPGRADABLE_WITNESS_PROGRAM")
+	SCRIPT_ERR_TAPROOT_WRONG_CONTROL_SIZE            = errors.New("SCRIPT_ERR_TAPROOT_WRONG_CONTROL_SIZE")
+	SCRIPT_ERR_DISCOURAGE_UPGRADABLE_TAPROOT_VERSION = errors.New("SCRIPT_ERR_DISCOURAGE_UPGRADABLE_TAPROOT_VERSION")
+	SCRIPT_ERR_DISCOURAGE_OP_SUCCESS                 = errors.New("SCRIPT_ERR_DISCOURAGE_OP_SUCCESS")
+	SCRIPT_ERR_DISCOURAGE_UPGRADABLE_PUBKEYTYPE      = errors.New("SCRIPT_ERR_DISCOURAGE_UPGRADABLE_PUBKEYTYPE")
+	SCRIPT_ERR_TAPSCRIPT_VALIDATION_WEIGHT           = errors.New("SCRIPT_ERR_TAPSCRIPT_VALIDATION_WEIGHT")
+	SCRIPT_ERR_TAPSCRIPT_CHECKMULTISIG               = errors.New("SCRIPT_ERR_TAPSCRIPT_CHECKMULTISIG")
+	SCRIPT_ERR_TAPSCRIPT_MINIMALIF                   = errors.New("SCRIPT_ERR_TAPSCRIPT_MINIMALIF")
+	SCRIPT_ERR_SCHNORR_SIG                           = errors.New("SCRIPT_ERR_SCHNORR_SIG")
+	SCRIPT_ERR_SCHNORR_SIG_SIZE                      = errors.New("SCRIPT_ERR_SCHNORR_SIG_SIZE")
+	SCRIPT_ERR_SCHNORR_SIG_HASHTYPE                  = errors.New("SCRIPT_ERR_SCHNORR_SIG_HASHTYPE")
+)
+
+//script executing when error raised
+type ScriptStage uint
+
+const (
+	SCRIPT_STAGE_UNKNOWN ScriptStage = iota
+	SCRIPT_STAGE_SIG
+	SCRIPT_STAGE_PUBKEY
+	SCRIPT_STAGE_REDEEM
+	SCRIPT_STAGE_WITNESS
 )
+
+func (s ScriptStage) String() string {
+	switch s {
+	case SCRIPT_STAGE_SIG:
+		return "scriptSig"
+	case SCRIPT_STAGE_PUBKEY:
+		return "scriptPubKey"
+	case SCRIPT_STAGE_REDEEM:
+		return "redeemScript"
+	case SCRIPT_STAGE_WITNESS:
+		return "witness"
+	}
+	return "unknown"
+}
+
+//script error with position,errors.Is match Code
+type ScriptError struct {
+	Code  error       //SCRIPT_ERR_* or checker error
+	Op    byte        //op failed,OP_INVALIDOPCODE if not at op
+	Pos   int         //op byte offset in script,script len if at end,-1 unknown
+	Index int         //tx in index,-1 unknown
+	Stage ScriptStage //script executing,SCRIPT_STAGE_UNKNOWN if not set
+}
+
+//wrap code at op position,ScriptError returned as is
+func NewScriptError(code error, op byte, pos int) error {
+	if _, ok := code.(*ScriptError); ok {
+		return code
+	}
+	return &ScriptError{Code: code, Op: op, Pos: pos, Index: -1}
+}
+
+//copy of ScriptError in err chain,or new one wrap err
+func copyScriptError(err error) *ScriptError {
+	se := &ScriptError{}
+	if errors.As(err, &se) {
+		v := *se
+		return &v
+	}
+	return &ScriptError{Code: err, Op: OP_INVALIDOPCODE, Pos: -1, Index: -1}
+}
+
+//set tx in index,wrap err if not ScriptError
+func WithIndex(err error, idx int) error {
+	if err == nil {
+		return nil
+	}
+	v := copyScriptError(err)
+	v.Index = idx
+	return v
+}
+
+//set script executing,wrap err if not ScriptError
+func WithStage(err error, stage ScriptStage) error {
+	if err == nil {
+		return nil
+	}
+	v := copyScriptError(err)
+	v.Stage = stage
+	return v
+}
+
+func (e *ScriptError) Error() string {
+	s := e.Code.Error()
+	if e.Pos >= 0 {
+		s += fmt.Sprintf(" at %d %s", e.Pos, GetOpName(e.Op))
+	}
+	if e.Stage != SCRIPT_STAGE_UNKNOWN {
+		s += " of " + e.Stage.String()
+	}
+	if e.Index >= 0 {
+		s += fmt.Sprintf(" in %d", e.Index)
+	}
+	return s
+}
+
+func (e *ScriptError) Unwrap() error {
+	return e.Code
+}
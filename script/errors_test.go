@@ -0,0 +1,39 @@
+package script
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestScriptError(t *testing.T) {
+	err := NewScript([]byte{OP_1, OP_2, OP_EQUALVERIFY}).Eval(NewStack(), &testTapChecker{}, 0)
+	se := &ScriptError{}
+	if !errors.As(err, &se) || se.Code != SCRIPT_ERR_EQUALVERIFY || se.Op != OP_EQUALVERIFY || se.Pos != 2 || se.Index != -1 {
+		t.Fatal("eval script error", err)
+	}
+	err = fmt.Errorf("verify tx error %w", WithIndex(err, 3))
+	if !errors.Is(err, SCRIPT_ERR_EQUALVERIFY) || !errors.As(err, &se) || se.Index != 3 || se.Pos != 2 {
+		t.Error("with index error", err)
+	}
+	if se.Error() != "SCRIPT_ERR_EQUALVERIFY at 2 OP_EQUALVERIFY in 3" {
+		t.Error("error string error", se)
+	}
+	//unbalanced at script end
+	err = NewScript([]byte{OP_1, OP_IF}).Eval(NewStack(), &testTapChecker{}, 0)
+	if !errors.As(err, &se) || se.Code != SCRIPT_ERR_UNBALANCED_CONDITIONAL || se.Pos != 2 || se.Op != OP_INVALIDOPCODE {
+		t.Error("end of script error", err)
+	}
+	err = WithIndex(SCRIPT_ERR_EVAL_FALSE, 1)
+	if !errors.As(err, &se) || se.Pos != -1 || se.Error() != "SCRIPT_ERR_EVAL_FALSE in 1" {
+		t.Error("wrap sentinel error", err)
+	}
+	//stage kept by index
+	err = WithIndex(WithStage(NewScriptError(SCRIPT_ERR_EQUALVERIFY, OP_EQUALVERIFY, 2), SCRIPT_STAGE_REDEEM), 3)
+	if !errors.As(err, &se) || se.Stage != SCRIPT_STAGE_REDEEM || se.Error() != "SCRIPT_ERR_EQUALVERIFY at 2 OP_EQUALVERIFY of redeemScript in 3" {
+		t.Error("with stage error", err)
+	}
+	if WithIndex(nil, 1) != nil || WithStage(nil, SCRIPT_STAGE_SIG) != nil {
+		t.Error("nil error wrapped")
+	}
+}
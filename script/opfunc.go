@@ -1,15 +1,21 @@
 package script
 
 import (
+	"bitcoin/config"
 	"bitcoin/util"
+	"bytes"
 	"encoding/binary"
 	"errors"
+	"fmt"
+	"strings"
 )
 
 const (
 	INT_MAX           = int(^uint(0) >> 1)
 	INT_MIN           = ^INT_MAX
 	DEFAULT_MINI_SIZE = 5
+	//arithmetic operand max size
+	MAX_SCRIPT_NUM_SIZE = 4
 )
 
 type ScriptNum int64
@@ -54,6 +60,39 @@ func GetScriptNum(b []byte) ScriptNum {
 	return ScriptNum(result)
 }
 
+//stack number operand,size limit and minimal encode if require
+func ParseScriptNum(b []byte, minimal bool, size int) (ScriptNum, error) {
+	if len(b) > size {
+		return 0, SCRIPT_ERR_SCRIPTNUM
+	}
+	//no sign byte needed if top bit of prev byte not set
+	if minimal && len(b) > 0 && b[len(b)-1]&0x7f == 0 {
+		if len(b) == 1 || b[len(b)-2]&0x80 == 0 {
+			return 0, SCRIPT_ERR_SCRIPTNUM
+		}
+	}
+	return GetScriptNum(b), nil
+}
+
+//push data use the smallest op
+func CheckMinimalPush(b []byte, op byte) bool {
+	l := len(b)
+	if l == 0 {
+		return op == OP_0
+	} else if l == 1 && b[0] >= 1 && b[0] <= 16 {
+		return op == OP_1+b[0]-1
+	} else if l == 1 && b[0] == 0x81 {
+		return op == OP_1NEGATE
+	} else if l < OP_PUSHDATA1 {
+		return int(op) == l
+	} else if l <= 0xff {
+		return op == OP_PUSHDATA1
+	} else if l <= 0xffff {
+		return op == OP_PUSHDATA2
+	}
+	return true
+}
+
 func IsDefinedHashtypeSignature(sig []byte) bool {
 	if len(sig) == 0 {
 		return false
@@ -69,9 +108,10 @@ func IsLowDERSignature(sig []byte) error {
 	if !IsValidSignatureEncoding(sig) {
 		return SCRIPT_ERR_SIG_DER
 	}
-	nsig := sig[:len(sig)-1]
-	_, _, err := CheckLowS(nsig)
-	return err
+	if !IsLowS(sig[:len(sig)-1]) {
+		return SCRIPT_ERR_SIG_HIGH_S
+	}
+	return nil
 }
 
 func IsSmallInteger(op byte) bool {
@@ -151,16 +191,28 @@ func IsCompressedPubKey(pub []byte) bool {
 	return true
 }
 
-func CheckPubKeyEncoding(pub []byte, flags int) error {
+func CheckPubKeyEncoding(pub []byte, flags int, sigver SigVersion) error {
 	if flags&SCRIPT_VERIFY_STRICTENC != 0 && !IsCompressedOrUncompressedPubKey(pub) {
 		return SCRIPT_ERR_PUBKEYTYPE
 	}
-	if flags&SCRIPT_VERIFY_WITNESS_PUBKEYTYPE != 0 && flags&SCRIPT_WITNESS_V0_PUBKEYTYPE != 0 && !IsCompressedPubKey(pub) {
+	if flags&SCRIPT_VERIFY_WITNESS_PUBKEYTYPE != 0 && sigver == SIGVERSION_WITNESS_V0 && !IsCompressedPubKey(pub) {
 		return SCRIPT_ERR_WITNESS_PUBKEYTYPE
 	}
 	return nil
 }
 
+//legacy script code drop signatures before check
+func deleteSigs(checker SigChecker, sigs [][]byte, sigver SigVersion, flags int) error {
+	sd, ok := checker.(SigDeleteChecker)
+	if !ok || sigver != SIGVERSION_BASE {
+		return nil
+	}
+	if sd.DeleteSigs(sigs) > 0 && flags&SCRIPT_VERIFY_CONST_SCRIPTCODE != 0 {
+		return SCRIPT_ERR_SIG_FINDANDDELETE
+	}
+	return nil
+}
+
 func IsCompressedOrUncompressedPubKey(pb []byte) bool {
 	if len(pb) < COMPRESSED_PUBLIC_KEY_SIZE {
 		return false
@@ -243,23 +295,97 @@ func (s Script) IsPushOnly() bool {
 	return true
 }
 
-func (s Script) GetSigOpCount() int {
+//accurate use multisig pubkey num before op,else MAX_PUBKEYS_PER_MULTISIG
+func (s Script) GetSigOpCount(accurate bool) int {
 	n := 0
+	last := byte(OP_INVALIDOPCODE)
 	for i := 0; i < s.Len(); {
 		b, p, op, _ := s.GetOp(i)
 		if !b {
 			break
 		}
-		if op >= OP_CHECKSIG || op == OP_CHECKSIGVERIFY {
+		if op == OP_CHECKSIG || op == OP_CHECKSIGVERIFY {
 			n++
 		} else if op == OP_CHECKMULTISIG || op == OP_CHECKMULTISIGVERIFY {
-			n += MAX_PUBKEYS_PER_MULTISIG
+			if accurate && last >= OP_1 && last <= OP_16 {
+				n += int(last-OP_1) + 1
+			} else {
+				n += MAX_PUBKEYS_PER_MULTISIG
+			}
 		}
+		last = op
 		i = p
 	}
 	return n
 }
 
+//p2sh out script sigops count in redeem script,last push in sig
+func (s Script) GetP2SHSigOpCount(sig *Script) int {
+	if !s.IsP2SH() {
+		return s.GetSigOpCount(true)
+	}
+	data := []byte{}
+	for i := 0; i < sig.Len(); {
+		b, p, op, ops := sig.GetOp(i)
+		if !b || op > OP_16 {
+			return 0
+		}
+		data = ops
+		i = p
+	}
+	return NewScript(data).GetSigOpCount(true)
+}
+
+//return version,program
+func (s Script) GetWitnessProgram() (int, []byte, bool) {
+	if !s.IsWitnessProgram() {
+		return 0, nil, false
+	}
+	ver := 0
+	if s[0] != OP_0 {
+		ver = int(s[0]-OP_1) + 1
+	}
+	return ver, s.SubBytes(2, s.Len()), true
+}
+
+//sigops in witness program,only version 0 counted
+func WitnessSigOps(ver int, prog []byte, wits []*Script) int {
+	if ver != 0 {
+		return 0
+	}
+	if len(prog) == 20 {
+		return 1
+	}
+	if len(prog) == 32 && len(wits) > 0 {
+		return wits[len(wits)-1].GetSigOpCount(true)
+	}
+	return 0
+}
+
+//witness sigops spend out script s
+func (s Script) GetWitnessSigOpCount(sig *Script, wits []*Script, flags int) int {
+	if flags&SCRIPT_VERIFY_WITNESS == 0 {
+		return 0
+	}
+	if ver, prog, ok := s.GetWitnessProgram(); ok {
+		return WitnessSigOps(ver, prog, wits)
+	}
+	if !s.IsP2SH() || !sig.IsPushOnly() {
+		return 0
+	}
+	//p2sh-p2wpkh p2sh-p2wsh,redeem script last push
+	data := []byte{}
+	for i := 0; i < sig.Len(); {
+		_, p, _, ops := sig.GetOp(i)
+		data = ops
+		i = p
+	}
+	if ver, prog, ok := NewScript(data).GetWitnessProgram(); ok {
+		return WitnessSigOps(ver, prog, wits)
+	}
+	return 0
+}
+
 func (s Script) GetAddress() string {
 	var ab []byte
 	if s.IsP2PK(&ab) || s.IsP2PKH(&ab) {
@@ -274,6 +400,48 @@ func (s Script) GetAddress() string {
 	return ""
 }
 
+//out script pay to current network address
+func NewScriptWithAddress(addr string) (*Script, error) {
+	conf := config.GetConfig()
+	if strings.HasPrefix(strings.ToLower(addr), conf.Bech32HRP+"1") {
+		hrp, _, err := util.DecodeSquashed(addr)
+		if err != nil {
+			return nil, err
+		}
+		if hrp != conf.Bech32HRP {
+			return nil, fmt.Errorf("address %s hrp error", addr)
+		}
+		b, err := util.SegWitAddressDecode(addr)
+		if err != nil {
+			return nil, err
+		}
+		s := NewScript([]byte{})
+		if ver := b[0] & 0x7f; ver == 0 {
+			s.PushOp(OP_0)
+		} else {
+			s.PushOp(OP_1 + ver - 1)
+		}
+		return s.PushBytes(b[2:]), nil
+	}
+	b, err := util.B58Decode(addr, util.BitcoinAlphabet)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) != 25 || !bytes.Equal(util.HASH256(b[:21])[:4], b[21:]) {
+		return nil, fmt.Errorf("address %s check num error", addr)
+	}
+	s := NewScript([]byte{})
+	switch b[0] {
+	case conf.Base58Prefix(config.PUBKEY_ADDRESS)[0]:
+		s.PushOp(OP_DUP).PushOp(OP_HASH160).PushBytes(b[1:21]).PushOp(OP_EQUALVERIFY).PushOp(OP_CHECKSIG)
+	case conf.Base58Prefix(config.SCRIPT_ADDRESS)[0]:
+		s.PushOp(OP_HASH160).PushBytes(b[1:21]).PushOp(OP_EQUAL)
+	default:
+		return nil, fmt.Errorf("address %s prefix error", addr)
+	}
+	return s, nil
+}
+
 func (s Script) IsNull() bool {
 	return s.Len() >= 1 && s[0] == OP_RETURN && NewScript(s[1:]).IsPushOnly()
 }
@@ -365,6 +533,55 @@ func (s Script) IsP2WSH(v ...*[]byte) bool {
 	return b
 }
 
+//witness v1 output key
+func (s Script) IsP2TR(v ...*[]byte) bool {
+	b := s.Len() == 34 && s[0] == OP_1 && s[1] == 0x20
+	if b && len(v) > 0 {
+		*v[0] = s.SubBytes(2, 34)
+	}
+	return b
+}
+
+//remove b at opcode boundaries,return count removed
+func (s Script) FindAndDelete(b Script) (*Script, int) {
+	if b.Len() == 0 {
+		return s.Clone(), 0
+	}
+	ret := NewScript([]byte{})
+	found := 0
+	for pc := 0; pc < s.Len(); {
+		if bytes.HasPrefix(s[pc:], b) {
+			pc += b.Len()
+			found++
+			continue
+		}
+		ok, idx, _, _ := s.GetOp(pc)
+		if !ok {
+			idx = s.Len()
+		}
+		*ret = append(*ret, s[pc:idx]...)
+		pc = idx
+	}
+	return ret, found
+}
+
+//legacy sighash script code without OP_CODESEPARATOR
+func (s Script) RemoveCodeSeparators() *Script {
+	ret := NewScript([]byte{})
+	for pc := 0; pc < s.Len(); {
+		ok, idx, op, _ := s.GetOp(pc)
+		if !ok {
+			idx = s.Len()
+		} else if op == OP_CODESEPARATOR {
+			pc = idx
+			continue
+		}
+		*ret = append(*ret, s[pc:idx]...)
+		pc = idx
+	}
+	return ret
+}
+
 func (s Script) IsWitnessProgram() bool {
 	if s.Len() < 4 || s.Len() > 42 {
 		return false
@@ -414,7 +631,7 @@ func (s *Script) PushInt64(v int64) *Script {
 	} else if v == 0 {
 		*s = append(*s, OP_0)
 	} else {
-		*s = append(*s, ScriptNum(v).Serialize()...)
+		s.PushBytes(ScriptNum(v).Serialize())
 	}
 	return s
 }
@@ -1,6 +1,8 @@
 package script
 
 import (
+	"bytes"
+	"errors"
 	"log"
 	"testing"
 )
@@ -12,3 +14,122 @@ func TestScriptNum(t *testing.T) {
 	b = ScriptNum(0x80).Serialize()
 	log.Println(b, GetScriptNum(b) == 0x80)
 }
+
+func TestPushInt64(t *testing.T) {
+	s := NewScript([]byte{}).PushInt64(227931)
+	if !bytes.Equal(*s, []byte{0x03, 0x5b, 0x7a, 0x03}) {
+		t.Errorf("push int64 error %x", *s)
+	}
+	if s := NewScript([]byte{}).PushInt64(16); !bytes.Equal(*s, []byte{OP_16}) {
+		t.Errorf("push small int error %x", *s)
+	}
+}
+
+func TestScriptWithAddress(t *testing.T) {
+	s, err := NewScriptWithAddress("1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2")
+	if err != nil || !s.IsP2PKH() {
+		t.Error("p2pkh address error", err)
+	}
+	s, err = NewScriptWithAddress("3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy")
+	if err != nil || !s.IsP2SH() {
+		t.Error("p2sh address error", err)
+	}
+	s, err = NewScriptWithAddress("bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4")
+	if err != nil || !s.IsP2WPKH() {
+		t.Error("p2wpkh address error", err)
+	}
+	if _, err := NewScriptWithAddress("1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN3"); err == nil {
+		t.Error("address check num error")
+	}
+}
+
+func TestSigOpCount(t *testing.T) {
+	//2-of-3 multisig redeem script
+	rs := NewScript([]byte{}).PushOp(OP_2)
+	for i := 0; i < 3; i++ {
+		rs.PushBytes(make([]byte, COMPRESSED_PUBLIC_KEY_SIZE))
+	}
+	rs.PushOp(OP_3).PushOp(OP_CHECKMULTISIG)
+	if rs.GetSigOpCount(false) != MAX_PUBKEYS_PER_MULTISIG || rs.GetSigOpCount(true) != 3 {
+		t.Error("multisig sigops error")
+	}
+	if s := NewScript([]byte{OP_CHECKSIG, OP_NOP10, OP_CHECKSIGVERIFY}); s.GetSigOpCount(false) != 2 {
+		t.Error("checksig sigops error")
+	}
+	pks := NewScript([]byte{OP_HASH160}).PushBytes(make([]byte, 20)).PushOp(OP_EQUAL)
+	sig := NewScript([]byte{}).PushOp(OP_0).PushBytes(*rs)
+	if pks.GetP2SHSigOpCount(sig) != 3 {
+		t.Error("p2sh sigops error")
+	}
+	//p2sh-p2wsh
+	wsh := NewScript([]byte{OP_0}).PushBytes(make([]byte, 32))
+	sig = NewScript([]byte{}).PushBytes(*wsh)
+	wits := []*Script{NewScript([]byte{}), rs}
+	if pks.GetWitnessSigOpCount(sig, wits, SCRIPT_VERIFY_WITNESS) != 3 {
+		t.Error("p2sh-p2wsh sigops error")
+	}
+	if pks.GetWitnessSigOpCount(sig, wits, SCRIPT_VERIFY_NONE) != 0 {
+		t.Error("witness disabled sigops error")
+	}
+	wpkh := NewScript([]byte{OP_0}).PushBytes(make([]byte, 20))
+	if wpkh.GetWitnessSigOpCount(NewScript([]byte{}), nil, SCRIPT_VERIFY_WITNESS) != 1 {
+		t.Error("p2wpkh sigops error")
+	}
+}
+
+func TestFindAndDelete(t *testing.T) {
+	tests := []struct {
+		s, d, want string
+		n          int
+	}{
+		{"0302ff03", "0302ff03", "", 1},
+		{"0302ff030302ff03", "0302ff03", "", 2},
+		{"0302ff030302ff03", "02", "0302ff030302ff03", 0},
+		{"0302ff030302ff03", "ff", "0302ff030302ff03", 0},
+		{"0302ff030302ff03", "03", "02ff0302ff03", 2},
+		{"02feed5169", "feed51", "02feed5169", 0},
+		{"02feed5169", "02feed51", "69", 1},
+		{"516902feed5169", "feed51", "516902feed5169", 0},
+		{"516902feed5169", "02feed51", "516969", 1},
+	}
+	for _, v := range tests {
+		s, n := NewScript(hextobytes(v.s)).FindAndDelete(*NewScript(hextobytes(v.d)))
+		if n != v.n || !bytes.Equal(*s, hextobytes(v.want)) {
+			t.Errorf("find %s in %s got %x %d", v.d, v.s, *s, n)
+		}
+	}
+}
+
+func TestRemoveCodeSeparators(t *testing.T) {
+	tests := []struct {
+		s, want string
+	}{
+		{"ab51ab", "51"},
+		{"01ab51", "01ab51"},
+		{"51ab4c", "514c"},
+		{"", ""},
+	}
+	for _, v := range tests {
+		if s := NewScript(hextobytes(v.s)).RemoveCodeSeparators(); !bytes.Equal(*s, hextobytes(v.want)) {
+			t.Errorf("remove codeseparators %s got %x", v.s, *s)
+		}
+	}
+}
+
+func TestCheckMultiSigDummy(t *testing.T) {
+	tests := []struct {
+		s     []byte
+		flags int
+		err   error
+	}{
+		{[]byte{OP_0, OP_0, OP_0, OP_CHECKMULTISIG}, SCRIPT_VERIFY_NULLDUMMY, nil},
+		{[]byte{OP_1, OP_0, OP_0, OP_CHECKMULTISIG}, 0, nil},
+		{[]byte{OP_1, OP_0, OP_0, OP_CHECKMULTISIG}, SCRIPT_VERIFY_NULLDUMMY, SCRIPT_ERR_SIG_NULLDUMMY},
+		{[]byte{OP_0, OP_0, OP_CHECKMULTISIG}, 0, SCRIPT_ERR_INVALID_STACK_OPERATION},
+	}
+	for i, v := range tests {
+		if err := NewScript(v.s).Eval(NewStack(), &testTapChecker{}, v.flags); !errors.Is(err, v.err) {
+			t.Errorf("test %d error %v want %v", i, err, v.err)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package script
+
+import (
+	"bitcoin/util"
+	"encoding/hex"
+	"errors"
+)
+
+const (
+	SCHNORR_PUBKEY_SIZE    = util.SCHNORR_PUBKEY_SIZE
+	SCHNORR_SIGNATURE_SIZE = util.SCHNORR_SIGNATURE_SIZE
+)
+
+//bip340 x only public key,y always even
+type XOnlyPublicKey [SCHNORR_PUBKEY_SIZE]byte
+
+func NewXOnlyPublicKey(b []byte) (XOnlyPublicKey, error) {
+	xk := XOnlyPublicKey{}
+	if len(b) != SCHNORR_PUBKEY_SIZE {
+		return xk, errors.New("x only public key size error")
+	}
+	copy(xk[:], b)
+	if !xk.IsValid() {
+		return xk, errors.New("x only public key not at curve error")
+	}
+	return xk, nil
+}
+
+func (xk XOnlyPublicKey) IsValid() bool {
+	_, err := xk.PublicKey()
+	return err == nil
+}
+
+//full public key with even y
+func (xk XOnlyPublicKey) PublicKey() (*PublicKey, error) {
+	return NewPublicKey(append([]byte{P256_PUBKEY_EVEN}, xk[:]...))
+}
+
+func (xk XOnlyPublicKey) String() string {
+	return hex.EncodeToString(xk[:])
+}
+
+func (xk XOnlyPublicKey) Verify(msg []byte, sig *SchnorrSig) bool {
+	return util.SchnorrVerify(xk[:], msg, sig.Sig[:])
+}
+
+//drop y of public key
+func (pk *PublicKey) XOnly() XOnlyPublicKey {
+	xk := XOnlyPublicKey{}
+	xb := pk.X.Bytes()
+	copy(xk[SCHNORR_PUBKEY_SIZE-len(xb):], xb)
+	return xk
+}
+
+func (pk PrivateKey) XOnlyPublicKey() XOnlyPublicKey {
+	return pk.PublicKey().XOnly()
+}
+
+//bip340 sign,aux is 32 bytes randomness,nil use zeros
+func (pk PrivateKey) SignSchnorr(msg []byte, aux []byte) (*SchnorrSig, error) {
+	b, err := util.SchnorrSign(pk.D, msg, aux)
+	if err != nil {
+		return nil, err
+	}
+	sig := &SchnorrSig{}
+	copy(sig.Sig[:], b)
+	return sig, nil
+}
+
+//bip340 signature,hashtype appended when not SIGHASH_DEFAULT
+type SchnorrSig struct {
+	Sig      [SCHNORR_SIGNATURE_SIZE]byte
+	HashType byte
+}
+
+func NewSchnorrSig(b []byte) (*SchnorrSig, error) {
+	sig := &SchnorrSig{}
+	err := sig.Decode(b)
+	return sig, err
+}
+
+func (sig SchnorrSig) Encode() []byte {
+	ret := append([]byte{}, sig.Sig[:]...)
+	if sig.HashType != SIGHASH_DEFAULT {
+		ret = append(ret, sig.HashType)
+	}
+	return ret
+}
+
+func (sig *SchnorrSig) Decode(b []byte) error {
+	if len(b) == SCHNORR_SIGNATURE_SIZE {
+		copy(sig.Sig[:], b)
+		sig.HashType = SIGHASH_DEFAULT
+		return nil
+	}
+	if len(b) != SCHNORR_SIGNATURE_SIZE+1 {
+		return errors.New("schnorr signature size error")
+	}
+	if b[SCHNORR_SIGNATURE_SIZE] == SIGHASH_DEFAULT {
+		return errors.New("schnorr signature explicit default hashtype error")
+	}
+	copy(sig.Sig[:], b)
+	sig.HashType = b[SCHNORR_SIGNATURE_SIZE]
+	return nil
+}
+
+//verify all signatures at once,false if any invalid
+func BatchVerifySchnorr(pubs []XOnlyPublicKey, msgs [][]byte, sigs []*SchnorrSig) bool {
+	if len(pubs) != len(msgs) || len(pubs) != len(sigs) {
+		return false
+	}
+	pbs := make([][]byte, len(pubs))
+	sbs := make([][]byte, len(sigs))
+	for i := range pubs {
+		pbs[i] = pubs[i][:]
+		sbs[i] = sigs[i].Sig[:]
+	}
+	return util.SchnorrBatchVerify(pbs, msgs, sbs)
+}
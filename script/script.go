@@ -4,7 +4,6 @@ import (
 	"bitcoin/util"
 	"bytes"
 	"encoding/hex"
-	"fmt"
 )
 
 const (
@@ -39,7 +38,11 @@ const (
 	SCRIPT_VERIFY_NULLFAIL                              = (1 << 14)
 	SCRIPT_VERIFY_WITNESS_PUBKEYTYPE                    = (1 << 15)
 	SCRIPT_VERIFY_CONST_SCRIPTCODE                      = (1 << 16)
-	SCRIPT_WITNESS_V0_PUBKEYTYPE                        = (1 << 17)
+	//1<<17 retired,witness v0 told by SigVersionChecker
+	SCRIPT_VERIFY_TAPROOT                               = (1 << 18)
+	SCRIPT_VERIFY_DISCOURAGE_UPGRADABLE_TAPROOT_VERSION = (1 << 19)
+	SCRIPT_VERIFY_DISCOURAGE_OP_SUCCESS                 = (1 << 20)
+	SCRIPT_VERIFY_DISCOURAGE_UPGRADABLE_PUBKEYTYPE      = (1 << 21)
 )
 
 type OpCodeType byte
@@ -178,6 +181,9 @@ const (
 	OP_NOP9                = 0xb8
 	OP_NOP10               = 0xb9
 
+	// tapscript
+	OP_CHECKSIGADD = 0xba
+
 	OP_INVALIDOPCODE = 0xff
 )
 
@@ -234,6 +240,8 @@ func (s Script) Bytes() []byte {
 }
 
 const (
+	//taproot only,signature without hashtype byte
+	SIGHASH_DEFAULT      = 0
 	SIGHASH_ALL          = 1
 	SIGHASH_NONE         = 2
 	SIGHASH_SINGLE       = 3
@@ -256,14 +264,31 @@ func StackTopBool(stack *Stack, idx int) bool {
 }
 
 var (
-	VsFalse = []byte{0}
-	VsTrue  = []byte{1, 1}
+	VsFalse = []byte{}
+	VsTrue  = []byte{1}
 )
 
 //stack []byte
 func (s Script) Eval(stack *Stack, checker SigChecker, flags int) error {
-	if s.Len() > MAX_SCRIPT_SIZE {
-		return SCRIPT_ERR_STACK_SIZE
+	return s.eval(stack, checker, flags, nil, nil)
+}
+
+//Eval with tracer told before each op
+func (s Script) EvalTrace(stack *Stack, checker SigChecker, flags int, tr Tracer) error {
+	return s.eval(stack, checker, flags, nil, tr)
+}
+
+//tap != nil run with tapscript rules,tr != nil trace steps
+func (s Script) eval(stack *Stack, checker SigChecker, flags int, tap *tapExec, tr Tracer) (err error) {
+	//position of op failed
+	epc, eop := -1, byte(OP_INVALIDOPCODE)
+	defer func() {
+		if err != nil {
+			err = NewScriptError(err, eop, epc)
+		}
+	}()
+	if tap == nil && s.Len() > MAX_SCRIPT_SIZE {
+		return SCRIPT_ERR_SCRIPT_SIZE
 	}
 	pc, pe := 0, s.Len()
 	vfexec := NewStack() //bool list
@@ -271,22 +296,49 @@ func (s Script) Eval(stack *Stack, checker SigChecker, flags int) error {
 		return v.ToBool() == false
 	}
 	alts := NewStack()
-	opc := 0
+	//opc op position,nops counted ops
+	opc, nops := 0, 0
+	minimal := flags&SCRIPT_VERIFY_MINIMALDATA != 0
+	num := func(v Value, size int) (ScriptNum, error) {
+		return ParseScriptNum(v.ToBytes(), minimal, size)
+	}
+	sigver := SIGVERSION_BASE
+	if sv, ok := checker.(SigVersionChecker); ok {
+		sigver = sv.SigVersion()
+	}
 	for pc < pe {
 		fexec := vfexec.Count(blf) == 0
 		ok, idx, op, ops := s.GetOp(pc)
+		epc, eop = pc, op
+		if tr != nil {
+			if err := tr.Trace(newTraceStep(&s, pc, op, ops, fexec, stack, alts, vfexec)); err != nil {
+				return err
+			}
+		}
 		if !ok {
 			return SCRIPT_ERR_BAD_OPCODE
 		}
 		opc++
 		pc = idx
-		if op > OP_16 && opc > MAX_OPS_PER_SCRIPT {
+		if len(ops) > MAX_SCRIPT_ELEMENT_SIZE {
+			return SCRIPT_ERR_PUSH_SIZE
+		}
+		if op > OP_16 {
+			nops++
+		}
+		if tap == nil && nops > MAX_OPS_PER_SCRIPT {
 			return SCRIPT_ERR_OP_COUNT
 		}
 		if OpIsDisabled(op) {
 			return SCRIPT_ERR_DISABLED_OPCODE
 		}
-		if fexec && 0 < op && op <= OP_PUSHDATA4 {
+		if op == OP_CODESEPARATOR && sigver == SIGVERSION_BASE && flags&SCRIPT_VERIFY_CONST_SCRIPTCODE != 0 {
+			return SCRIPT_ERR_OP_CODESEPARATOR
+		}
+		if fexec && op <= OP_PUSHDATA4 {
+			if minimal && !CheckMinimalPush(ops, op) {
+				return SCRIPT_ERR_MINIMALDATA
+			}
 			stack.Push(ops)
 		} else if fexec || (OP_IF <= op && op <= OP_ENDIF) {
 			switch op {
@@ -297,28 +349,41 @@ func (s Script) Eval(stack *Stack, checker SigChecker, flags int) error {
 				break
 			case OP_CHECKLOCKTIMEVERIFY:
 				if flags&SCRIPT_VERIFY_CHECKLOCKTIMEVERIFY == 0 {
+					if flags&SCRIPT_VERIFY_DISCOURAGE_UPGRADABLE_NOPS != 0 {
+						return SCRIPT_ERR_DISCOURAGE_UPGRADABLE_NOPS
+					}
 					break
 				}
 				t1 := stack.Top(-1)
 				if t1 == nil {
 					return SCRIPT_ERR_INVALID_STACK_OPERATION
 				}
-				locktime := t1.ToScriptNum()
+				//5 bytes for time past 2038
+				locktime, err := num(t1, DEFAULT_MINI_SIZE)
+				if err != nil {
+					return err
+				}
 				if locktime < 0 {
 					return SCRIPT_ERR_NEGATIVE_LOCKTIME
 				}
 				if err := checker.CheckLockTime(locktime); err != nil {
-					return fmt.Errorf("check locak time error %v", SCRIPT_ERR_UNSATISFIED_LOCKTIME)
+					return SCRIPT_ERR_UNSATISFIED_LOCKTIME
 				}
 			case OP_CHECKSEQUENCEVERIFY:
 				if flags&SCRIPT_VERIFY_CHECKSEQUENCEVERIFY == 0 {
+					if flags&SCRIPT_VERIFY_DISCOURAGE_UPGRADABLE_NOPS != 0 {
+						return SCRIPT_ERR_DISCOURAGE_UPGRADABLE_NOPS
+					}
 					break
 				}
 				t1 := stack.Top(-1)
 				if t1 == nil {
 					return SCRIPT_ERR_INVALID_STACK_OPERATION
 				}
-				seq := t1.ToScriptNum()
+				seq, err := num(t1, DEFAULT_MINI_SIZE)
+				if err != nil {
+					return err
+				}
 				if seq < 0 {
 					return SCRIPT_ERR_NEGATIVE_LOCKTIME
 				}
@@ -326,9 +391,12 @@ func (s Script) Eval(stack *Stack, checker SigChecker, flags int) error {
 					break
 				}
 				if err := checker.CheckSequence(seq); err != nil {
-					return fmt.Errorf("check sequence error %v", SCRIPT_ERR_UNSATISFIED_LOCKTIME)
+					return SCRIPT_ERR_UNSATISFIED_LOCKTIME
 				}
 			case OP_NOP1, OP_NOP4, OP_NOP5, OP_NOP6, OP_NOP7, OP_NOP8, OP_NOP9, OP_NOP10:
+				if flags&SCRIPT_VERIFY_DISCOURAGE_UPGRADABLE_NOPS != 0 {
+					return SCRIPT_ERR_DISCOURAGE_UPGRADABLE_NOPS
+				}
 			case OP_IF, OP_NOTIF:
 				fValue := false
 				if fexec {
@@ -336,6 +404,13 @@ func (s Script) Eval(stack *Stack, checker SigChecker, flags int) error {
 						return SCRIPT_ERR_UNBALANCED_CONDITIONAL
 					}
 					vch := stack.Top(-1)
+					notmin := vch.Len() > 1 || (vch.Len() == 1 && vch[0] != 1)
+					if tap != nil && notmin {
+						return SCRIPT_ERR_TAPSCRIPT_MINIMALIF
+					}
+					if sigver == SIGVERSION_WITNESS_V0 && flags&SCRIPT_VERIFY_MINIMALIF != 0 && notmin {
+						return SCRIPT_ERR_MINIMALIF
+					}
 					fValue = vch.ToBool()
 					if op == OP_NOTIF {
 						fValue = !fValue
@@ -348,7 +423,7 @@ func (s Script) Eval(stack *Stack, checker SigChecker, flags int) error {
 					return SCRIPT_ERR_UNBALANCED_CONDITIONAL
 				}
 				e := vfexec.Back()
-				e.Value = !e.Value.(bool)
+				e.Value = NewValueBool(!e.Value.(Value).ToBool())
 			case OP_ENDIF:
 				if vfexec.Empty() {
 					return SCRIPT_ERR_UNBALANCED_CONDITIONAL
@@ -373,7 +448,7 @@ func (s Script) Eval(stack *Stack, checker SigChecker, flags int) error {
 				alts.Push(stack.Pop())
 			case OP_FROMALTSTACK:
 				if alts.Len() < 1 {
-					return SCRIPT_ERR_INVALID_STACK_OPERATION
+					return SCRIPT_ERR_INVALID_ALTSTACK_OPERATION
 				}
 				stack.Push(alts.Pop())
 			case OP_2DROP:
@@ -414,7 +489,7 @@ func (s Script) Eval(stack *Stack, checker SigChecker, flags int) error {
 				}
 				v1 := stack.Top(-6)
 				v2 := stack.Top(-5)
-				stack.EraseRange(-6, -4)
+				stack.EraseRange(-6, -5)
 				stack.Push(v1)
 				stack.Push(v2)
 			case OP_2SWAP:
@@ -464,8 +539,11 @@ func (s Script) Eval(stack *Stack, checker SigChecker, flags int) error {
 				if stack.Len() < 2 {
 					return SCRIPT_ERR_INVALID_STACK_OPERATION
 				}
-				v1 := stack.Top(-1).ToBytes()
-				n := GetScriptNum(v1).ToInt()
+				bn, err := num(stack.Top(-1), MAX_SCRIPT_NUM_SIZE)
+				if err != nil {
+					return err
+				}
+				n := bn.ToInt()
 				stack.Pop()
 				if n < 0 || n >= stack.Len() {
 					return SCRIPT_ERR_INVALID_STACK_OPERATION
@@ -529,7 +607,10 @@ func (s Script) Eval(stack *Stack, checker SigChecker, flags int) error {
 				if stack.Len() < 1 {
 					return SCRIPT_ERR_INVALID_STACK_OPERATION
 				}
-				bn := stack.Top(-1).ToScriptNum()
+				bn, err := num(stack.Top(-1), MAX_SCRIPT_NUM_SIZE)
+				if err != nil {
+					return err
+				}
 				switch op {
 				case OP_1ADD:
 					bn++
@@ -560,8 +641,14 @@ func (s Script) Eval(stack *Stack, checker SigChecker, flags int) error {
 				if stack.Len() < 2 {
 					return SCRIPT_ERR_INVALID_STACK_OPERATION
 				}
-				bn1 := stack.Top(-2).ToScriptNum()
-				bn2 := stack.Top(-1).ToScriptNum()
+				bn1, err := num(stack.Top(-2), MAX_SCRIPT_NUM_SIZE)
+				if err != nil {
+					return err
+				}
+				bn2, err := num(stack.Top(-1), MAX_SCRIPT_NUM_SIZE)
+				if err != nil {
+					return err
+				}
 				bn := ScriptNum(0)
 				switch op {
 				case OP_ADD:
@@ -650,9 +737,18 @@ func (s Script) Eval(stack *Stack, checker SigChecker, flags int) error {
 				if stack.Len() < 3 {
 					return SCRIPT_ERR_INVALID_STACK_OPERATION
 				}
-				bn1 := stack.Top(-3).ToScriptNum()
-				bn2 := stack.Top(-2).ToScriptNum()
-				bn3 := stack.Top(-1).ToScriptNum()
+				bn1, err := num(stack.Top(-3), MAX_SCRIPT_NUM_SIZE)
+				if err != nil {
+					return err
+				}
+				bn2, err := num(stack.Top(-2), MAX_SCRIPT_NUM_SIZE)
+				if err != nil {
+					return err
+				}
+				bn3, err := num(stack.Top(-1), MAX_SCRIPT_NUM_SIZE)
+				if err != nil {
+					return err
+				}
 				fvalue := (bn2 <= bn1 && bn1 < bn3)
 				stack.Pop()
 				stack.Pop()
@@ -684,16 +780,40 @@ func (s Script) Eval(stack *Stack, checker SigChecker, flags int) error {
 				stack.Pop()
 				stack.Push(hv)
 			case OP_CODESEPARATOR:
+				if tap != nil {
+					tap.codesep = uint32(opc - 1)
+				} else if cs, ok := checker.(CodeSeparatorChecker); ok {
+					cs.SetCodeSeparator(pc)
+				}
 			case OP_CHECKSIG, OP_CHECKSIGVERIFY:
 				if stack.Len() < 2 {
 					return SCRIPT_ERR_INVALID_STACK_OPERATION
 				}
 				sig := stack.Top(-2).ToBytes()
 				pub := stack.Top(-1).ToBytes()
+				if tap != nil {
+					success, err := tap.checkSig(sig, pub)
+					if err != nil {
+						return err
+					}
+					stack.Pop()
+					stack.Pop()
+					stack.Push(NewValueBool(success))
+					if op == OP_CHECKSIGVERIFY {
+						if !success {
+							return SCRIPT_ERR_CHECKSIGVERIFY
+						}
+						stack.Pop()
+					}
+					break
+				}
+				if err := deleteSigs(checker, [][]byte{sig}, sigver, flags); err != nil {
+					return err
+				}
 				if err := CheckSignatureEncoding(sig, flags); err != nil {
 					return err
 				}
-				if err := CheckPubKeyEncoding(pub, flags); err != nil {
+				if err := CheckPubKeyEncoding(pub, flags, sigver); err != nil {
 					return err
 				}
 				err := checker.CheckSig(stack, sig, pub)
@@ -714,18 +834,51 @@ func (s Script) Eval(stack *Stack, checker SigChecker, flags int) error {
 						return err
 					}
 				}
+			case OP_CHECKSIGADD:
+				//sig num pubkey
+				if tap == nil {
+					return SCRIPT_ERR_BAD_OPCODE
+				}
+				if stack.Len() < 3 {
+					return SCRIPT_ERR_INVALID_STACK_OPERATION
+				}
+				sig := stack.Top(-3).ToBytes()
+				vnum := stack.Top(-2)
+				pub := stack.Top(-1).ToBytes()
+				n, err := num(vnum, MAX_SCRIPT_NUM_SIZE)
+				if err != nil {
+					return err
+				}
+				success, err := tap.checkSig(sig, pub)
+				if err != nil {
+					return err
+				}
+				if success {
+					n++
+				}
+				stack.Pop()
+				stack.Pop()
+				stack.Pop()
+				stack.Push(n.Serialize())
 			case OP_CHECKMULTISIG, OP_CHECKMULTISIGVERIFY:
+				if tap != nil {
+					return SCRIPT_ERR_TAPSCRIPT_CHECKMULTISIG
+				}
 				//([sig ...] num_of_signatures [pubkey ...] num_of_pubkeys
 				i := 1
 				if stack.Len() < i {
 					return SCRIPT_ERR_INVALID_STACK_OPERATION
 				}
-				keyscount := stack.Top(-1).ToInt()
+				kn, err := num(stack.Top(-1), MAX_SCRIPT_NUM_SIZE)
+				if err != nil {
+					return err
+				}
+				keyscount := kn.ToInt()
 				if keyscount < 0 || keyscount > MAX_PUBKEYS_PER_MULTISIG {
 					return SCRIPT_ERR_PUBKEY_COUNT
 				}
-				opc += keyscount
-				if opc > MAX_OPS_PER_SCRIPT {
+				nops += keyscount
+				if nops > MAX_OPS_PER_SCRIPT {
 					return SCRIPT_ERR_OP_COUNT
 				}
 				i++
@@ -735,7 +888,11 @@ func (s Script) Eval(stack *Stack, checker SigChecker, flags int) error {
 				if stack.Len() < (i - 1) {
 					return SCRIPT_ERR_INVALID_STACK_OPERATION
 				}
-				sigcount := stack.Top(-i).ToInt()
+				sn, err := num(stack.Top(-i), MAX_SCRIPT_NUM_SIZE)
+				if err != nil {
+					return err
+				}
+				sigcount := sn.ToInt()
 				if sigcount < 0 || sigcount > keyscount {
 					return SCRIPT_ERR_SIG_COUNT
 				}
@@ -743,19 +900,28 @@ func (s Script) Eval(stack *Stack, checker SigChecker, flags int) error {
 				isig1 := i
 				isig2 := isig1 + sigcount - 1
 				i += sigcount
-				if stack.Len() < i-1 {
+				//include dummy element
+				if stack.Len() < i {
 					return SCRIPT_ERR_INVALID_STACK_OPERATION
 				}
+				sigs := [][]byte{}
+				for j := isig1; j <= isig2; j++ {
+					sigs = append(sigs, stack.Top(-j).ToBytes())
+				}
+				if err := deleteSigs(checker, sigs, sigver, flags); err != nil {
+					return err
+				}
 				ikey := ikey1
 				isig := isig1
 				iok := 0
-				for isig <= isig2 && ikey <= ikey2 {
+				//stop once left sigs more than left keys
+				for isig <= isig2 && isig2-isig <= ikey2-ikey {
 					sig := stack.Top(-isig).ToBytes()
 					if err := CheckSignatureEncoding(sig, flags); err != nil {
 						return err
 					}
 					pub := stack.Top(-ikey).ToBytes()
-					if err := CheckPubKeyEncoding(pub, flags); err != nil {
+					if err := CheckPubKeyEncoding(pub, flags, sigver); err != nil {
 						return err
 					}
 					err := checker.CheckSig(stack, sig, pub)
@@ -766,11 +932,20 @@ func (s Script) Eval(stack *Stack, checker SigChecker, flags int) error {
 					ikey++
 				}
 				if iok < sigcount && flags&SCRIPT_VERIFY_NULLFAIL != 0 {
-					return SCRIPT_ERR_SIG_NULLFAIL
+					for j := isig1; j <= isig2; j++ {
+						if stack.Top(-j).Len() > 0 {
+							return SCRIPT_ERR_SIG_NULLFAIL
+						}
+					}
 				}
 				for ; i > 1; i-- {
 					stack.Pop()
 				}
+				//dummy element,extra pop bug compatible
+				if flags&SCRIPT_VERIFY_NULLDUMMY != 0 && stack.Top(-1).Len() > 0 {
+					return SCRIPT_ERR_SIG_NULLDUMMY
+				}
+				stack.Pop()
 				if iok >= sigcount {
 					stack.Push(VsTrue)
 				} else {
@@ -791,6 +966,7 @@ func (s Script) Eval(stack *Stack, checker SigChecker, flags int) error {
 			}
 		}
 	}
+	epc, eop = pe, OP_INVALIDOPCODE
 	if !vfexec.Empty() {
 		return SCRIPT_ERR_UNBALANCED_CONDITIONAL
 	}
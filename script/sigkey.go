@@ -4,8 +4,6 @@ import (
 	"bitcoin/config"
 	"bitcoin/util"
 	"bytes"
-	"crypto/ecdsa"
-	"crypto/rand"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -132,19 +130,18 @@ func LoadPrivateKey(d []byte) (*PrivateKey, error) {
 	return p, nil
 }
 
+//rfc6979 deterministic sign,low s
 func (pk PrivateKey) Sign(hash []byte) (*SigValue, error) {
-	sig := &SigValue{}
-	priv := new(ecdsa.PrivateKey)
-	priv.Curve = curve
-	priv.D = pk.D
-	pub := pk.PublicKey()
-	priv.X, priv.Y = pub.X, pub.Y
-	r, s, err := ecdsa.Sign(rand.Reader, priv, hash)
+	return pk.SignWithEntropy(hash, nil)
+}
+
+//sign with 32 bytes extra entropy mixed into rfc6979 nonce
+func (pk PrivateKey) SignWithEntropy(hash []byte, extra []byte) (*SigValue, error) {
+	r, s, err := util.SignECDSA(pk.D, hash, extra)
 	if err != nil {
 		return nil, err
 	}
-	sig.R, sig.S = r, s
-	return sig, nil
+	return &SigValue{R: r, S: s}, nil
 }
 
 func (pk PrivateKey) Marshal() []byte {
@@ -201,7 +198,7 @@ func (sig SigValue) Encode() []byte {
 }
 
 func CheckLowS(b []byte) (int, int, error) {
-	if b[0] != 0x30 || len(b) < 5 {
+	if len(b) < 5 || b[0] != 0x30 {
 		return 0, 0, errors.New("der format error")
 	}
 	lenr := int(b[3])
@@ -215,6 +212,16 @@ func CheckLowS(b []byte) (int, int, error) {
 	return lenr, lens, nil
 }
 
+//der s not above half curve order
+func IsLowS(b []byte) bool {
+	r, s, err := CheckLowS(b)
+	if err != nil {
+		return false
+	}
+	v := new(big.Int).SetBytes(b[6+r : 6+r+s])
+	return v.Cmp(new(big.Int).Rsh(curve.Params().N, 1)) <= 0
+}
+
 func (sig *SigValue) Decode(b []byte) error {
 	if r, s, err := CheckLowS(b); err != nil {
 		return err
@@ -340,10 +347,7 @@ func IsValidPublicKey(pk []byte) bool {
 }
 
 func (pk *PublicKey) Verify(hash []byte, sig *SigValue) bool {
-	pub := new(ecdsa.PublicKey)
-	pub.Curve = curve
-	pub.X, pub.Y = pk.X, pk.Y
-	return ecdsa.Verify(pub, hash, sig.R, sig.S)
+	return util.VerifyECDSA(pk.X, pk.Y, hash, sig.R, sig.S)
 }
 
 func (pk *PublicKey) Hybrid() []byte {
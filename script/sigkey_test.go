@@ -3,6 +3,7 @@ package script
 import (
 	"bitcoin/util"
 	"bytes"
+	"crypto/ecdsa"
 	"encoding/hex"
 	"log"
 	"testing"
@@ -260,3 +261,117 @@ func TestSignVerify(t *testing.T) {
 		t.Errorf("Verify 3 should error")
 	}
 }
+
+func benchmarkVerifyData(b *testing.B) (*PublicKey, []byte, *SigValue) {
+	v := ta[len(ta)-1]
+	pkey, _ := hex.DecodeString(v[0])
+	sign, _ := hex.DecodeString(v[1])
+	hash, _ := hex.DecodeString(v[2])
+	pub, err := NewPublicKey(pkey)
+	if err != nil {
+		b.Fatal(err)
+	}
+	sig := &SigValue{}
+	if err := sig.Decode(sign); err != nil {
+		b.Fatal(err)
+	}
+	return pub, hash, sig
+}
+
+func BenchmarkPublicKeyVerify(b *testing.B) {
+	pub, hash, sig := benchmarkVerifyData(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if !pub.Verify(hash, sig) {
+			b.Fatal("verify failed")
+		}
+	}
+}
+
+//crypto/ecdsa generic path over elliptic.Curve api
+func BenchmarkPublicKeyVerifyCurve(b *testing.B) {
+	pub, hash, sig := benchmarkVerifyData(b)
+	epub := &ecdsa.PublicKey{Curve: curve, X: pub.X, Y: pub.Y}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if !ecdsa.Verify(epub, hash, sig.R, sig.S) {
+			b.Fatal("verify failed")
+		}
+	}
+}
+
+func TestSignDeterministic(t *testing.T) {
+	hash := util.HASH256([]byte("Very deterministic message"))
+	//bitcoin core key_tests
+	vs := []struct {
+		k1, k2 string
+		sig    string
+	}{
+		{strSecret1, strSecret1C, "304402205dbbddda71772d95ce91cd2d14b592cfbc1dd0aabd6a394b6c2d377bbe59d31d022014ddda21494a4e221f0824f0b8b924c43fa43c0ad57dccdaa11f81a6bd4582f601"},
+		{strSecret2, strSecret2C, "3044022052d8a32079c11e79db95af63bb9600c5b04f21a9ca33dc129c2bfa8ac9dc1cd5022061d8ae5e0f6c1a16bde3719c64c2fd70e404b6428ab9a69566962e8771b5944d01"},
+	}
+	for _, v := range vs {
+		pk1, err := DecodePrivateKey(v.k1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pk2, err := DecodePrivateKey(v.k2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig1, err := pk1.Sign(hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig2, err := pk2.Sign(hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig1.HashType, sig2.HashType = 1, 1
+		if hex.EncodeToString(sig1.Encode()) != v.sig || !bytes.Equal(sig1.Encode(), sig2.Encode()) {
+			t.Errorf("deterministic sign %x want %s", sig1.Encode(), v.sig)
+		}
+		//extra entropy changes nonce,still deterministic and low s
+		extra := make([]byte, 32)
+		extra[0] = 1
+		sig3, err := pk1.SignWithEntropy(hash, extra)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig4, _ := pk1.SignWithEntropy(hash, extra)
+		sig3.HashType, sig4.HashType = 1, 1
+		if sig3.R.Cmp(sig1.R) == 0 || !bytes.Equal(sig3.Encode(), sig4.Encode()) {
+			t.Errorf("sign with entropy %x", sig3.Encode())
+		}
+		if !pk1.PublicKey().Verify(hash, sig3) {
+			t.Errorf("sign with entropy verify failed")
+		}
+		if err := IsLowDERSignature(sig3.Encode()); err != nil {
+			t.Errorf("sign with entropy high s %v", err)
+		}
+	}
+}
+
+func TestSignLowS(t *testing.T) {
+	pk, err := DecodePrivateKey(strSecret2C)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 64; i++ {
+		hash := util.HASH256([]byte{byte(i)})
+		sig, err := pk.Sign(hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig.HashType = 1
+		if err := IsLowDERSignature(sig.Encode()); err != nil {
+			t.Fatalf("sign %d high s %v", i, err)
+		}
+		if !pk.PublicKey().Verify(hash, sig) {
+			t.Fatalf("sign %d verify failed", i)
+		}
+	}
+	if _, err := pk.Sign([]byte{1, 2, 3}); err == nil {
+		t.Errorf("sign short hash should error")
+	}
+}
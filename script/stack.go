@@ -9,9 +9,9 @@ type Value []byte
 
 func NewValueBool(v bool) Value {
 	if v {
-		return []byte{1, 1}
+		return []byte{1}
 	} else {
-		return []byte{0}
+		return []byte{}
 	}
 }
 
@@ -45,6 +45,23 @@ func NewStack() *Stack {
 	}
 }
 
+func (stack *Stack) Clone() *Stack {
+	ret := NewStack()
+	for e := stack.list.Front(); e != nil; e = e.Next() {
+		ret.list.PushBack(e.Value)
+	}
+	return ret
+}
+
+//values from bottom to top
+func (stack *Stack) Values() []Value {
+	ret := []Value{}
+	for e := stack.list.Front(); e != nil; e = e.Next() {
+		ret = append(ret, e.Value.(Value))
+	}
+	return ret
+}
+
 func (stack *Stack) InsertAfter(v interface{}, e *list.Element) {
 	stack.list.InsertAfter(v, e)
 }
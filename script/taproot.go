@@ -0,0 +1,140 @@
+package script
+
+import (
+	"bitcoin/util"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math/big"
+)
+
+const (
+	TAPROOT_LEAF_MASK               = 0xfe
+	TAPROOT_LEAF_TAPSCRIPT          = 0xc0
+	TAPROOT_CONTROL_BASE_SIZE       = 33
+	TAPROOT_CONTROL_NODE_SIZE       = 32
+	TAPROOT_CONTROL_MAX_NODE_COUNT  = 128
+	TAPROOT_CONTROL_MAX_SIZE        = TAPROOT_CONTROL_BASE_SIZE + TAPROOT_CONTROL_NODE_SIZE*TAPROOT_CONTROL_MAX_NODE_COUNT
+	ANNEX_TAG                       = 0x50
+	VALIDATION_WEIGHT_PER_SIGOP     = 50
+	VALIDATION_WEIGHT_OFFSET        = 50
+	WITNESS_V1_TAPROOT_PROGRAM_SIZE = 32
+)
+
+//bitcoin compact size prefix
+func appendVarInt(b []byte, v uint64) []byte {
+	if v < 0xfd {
+		return append(b, byte(v))
+	} else if v <= 0xffff {
+		b2 := []byte{0xfd, 0, 0}
+		binary.LittleEndian.PutUint16(b2[1:], uint16(v))
+		return append(b, b2...)
+	} else if v <= 0xffffffff {
+		b4 := []byte{0xfe, 0, 0, 0, 0}
+		binary.LittleEndian.PutUint32(b4[1:], uint32(v))
+		return append(b, b4...)
+	}
+	b8 := []byte{0xff, 0, 0, 0, 0, 0, 0, 0, 0}
+	binary.LittleEndian.PutUint64(b8[1:], v)
+	return append(b, b8...)
+}
+
+//tagged hash of leaf version and compact size script
+func TapLeafHash(ver byte, s *Script) []byte {
+	buf := appendVarInt([]byte{ver}, uint64(s.Len()))
+	return util.TaggedHash("TapLeaf", buf, *s)
+}
+
+//branch hash,children sorted
+func TapBranchHash(a []byte, b []byte) []byte {
+	if bytes.Compare(a, b) > 0 {
+		a, b = b, a
+	}
+	return util.TaggedHash("TapBranch", a, b)
+}
+
+//tweak for internal key,root nil for key path only
+func TapTweakHash(pub XOnlyPublicKey, root []byte) []byte {
+	return util.TaggedHash("TapTweak", pub[:], root)
+}
+
+//output key Q = P + hash(P||root)*G,return Q and y parity
+func TaprootOutputKey(pub XOnlyPublicKey, root []byte) (XOnlyPublicKey, bool, error) {
+	out := XOnlyPublicKey{}
+	qx, odd, err := util.XOnlyTweakAdd(pub[:], TapTweakHash(pub, root))
+	if err != nil {
+		return out, false, err
+	}
+	copy(out[:], qx)
+	return out, odd, nil
+}
+
+//OP_1 <32 bytes output key>
+func NewTaprootScript(pub XOnlyPublicKey) *Script {
+	s := NewScript([]byte{})
+	s.PushOp(OP_1)
+	s.PushBytes(pub[:])
+	return s
+}
+
+//compute merkle root from control block path and leaf hash
+func TaprootMerkleRoot(control []byte, leaf []byte) []byte {
+	k := leaf
+	for i := TAPROOT_CONTROL_BASE_SIZE; i+TAPROOT_CONTROL_NODE_SIZE <= len(control); i += TAPROOT_CONTROL_NODE_SIZE {
+		k = TapBranchHash(k, control[i:i+TAPROOT_CONTROL_NODE_SIZE])
+	}
+	return k
+}
+
+//check control size,33+32m bytes,m <= 128
+func CheckControlSize(control []byte) error {
+	if len(control) < TAPROOT_CONTROL_BASE_SIZE || len(control) > TAPROOT_CONTROL_MAX_SIZE {
+		return SCRIPT_ERR_TAPROOT_WRONG_CONTROL_SIZE
+	}
+	if (len(control)-TAPROOT_CONTROL_BASE_SIZE)%TAPROOT_CONTROL_NODE_SIZE != 0 {
+		return SCRIPT_ERR_TAPROOT_WRONG_CONTROL_SIZE
+	}
+	return nil
+}
+
+//check program is internal key in control tweaked by merkle root of leaf
+func VerifyTaprootCommitment(control []byte, program []byte, leaf []byte) error {
+	if err := CheckControlSize(control); err != nil {
+		return err
+	}
+	if len(program) != WITNESS_V1_TAPROOT_PROGRAM_SIZE {
+		return SCRIPT_ERR_WITNESS_PROGRAM_MISMATCH
+	}
+	pub := XOnlyPublicKey{}
+	copy(pub[:], control[1:TAPROOT_CONTROL_BASE_SIZE])
+	q, odd, err := TaprootOutputKey(pub, TaprootMerkleRoot(control, leaf))
+	if err != nil {
+		return SCRIPT_ERR_WITNESS_PROGRAM_MISMATCH
+	}
+	if !bytes.Equal(q[:], program) || odd != (control[0]&1 == 1) {
+		return SCRIPT_ERR_WITNESS_PROGRAM_MISMATCH
+	}
+	return nil
+}
+
+//tweaked private key for key path spend,sign with output key
+func (pk PrivateKey) TapTweak(root []byte) (*PrivateKey, error) {
+	n := curve.Params().N
+	d := new(big.Int).Set(pk.D)
+	if d.Sign() <= 0 || d.Cmp(n) >= 0 {
+		return nil, errors.New("private key error")
+	}
+	pub := pk.PublicKey()
+	if pub.Y.Bit(0) == 1 {
+		d.Sub(n, d)
+	}
+	t := new(big.Int).SetBytes(TapTweakHash(pub.XOnly(), root))
+	if t.Cmp(n) >= 0 {
+		return nil, errors.New("tweak overflow error")
+	}
+	d.Add(d, t).Mod(d, n)
+	if d.Sign() == 0 {
+		return nil, errors.New("tweak result zero")
+	}
+	return &PrivateKey{D: d, compressed: true}, nil
+}
@@ -0,0 +1,186 @@
+package script
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+//bip341 wallet vectors scriptPubKey
+func TestTaprootOutputKey(t *testing.T) {
+	pub := XOnlyPublicKey{}
+	copy(pub[:], hextobytes("d6889cb081036e0faefa3a35157ad71086b123b2b144b649798b494c300a961d"))
+	q, _, err := TaprootOutputKey(pub, nil)
+	if err != nil || q.String() != "53a1f6e454df1aa2776a2814a721372d6258050de330b3c6d10ee8f4e0dda343" {
+		t.Fatal("key path output key error", q, err)
+	}
+	copy(pub[:], hextobytes("187791b6f712a8ea41c8ecdd0ee77fab3e85263b37e1ec18a3651926b3a6cf27"))
+	leaf := TapLeafHash(TAPROOT_LEAF_TAPSCRIPT, NewScriptHex("20d85a959b0290bf19bb89ed43c916be835475d013da4b362117393e25a48229b8ac"))
+	if hex.EncodeToString(leaf) != "5b75adecf53548f3ec6ad7d78383bf84cc57b55a3127c72b9a2481752dd88b21" {
+		t.Fatal("leaf hash error", hex.EncodeToString(leaf))
+	}
+	q, odd, err := TaprootOutputKey(pub, leaf)
+	if err != nil || q.String() != "147c9c57132f6e7ecddba9800bb0c4449251c92a1e60371ee77557b6620f3ea3" {
+		t.Fatal("script path output key error", q, err)
+	}
+	control := []byte{TAPROOT_LEAF_TAPSCRIPT}
+	if odd {
+		control[0] |= 1
+	}
+	control = append(control, pub[:]...)
+	if err := VerifyTaprootCommitment(control, q[:], leaf); err != nil {
+		t.Error("commitment error", err)
+	}
+	control[0] ^= 1
+	if err := VerifyTaprootCommitment(control, q[:], leaf); err != SCRIPT_ERR_WITNESS_PROGRAM_MISMATCH {
+		t.Error("parity mismatch not detected", err)
+	}
+	if err := VerifyTaprootCommitment(control[:40], q[:], leaf); err != SCRIPT_ERR_TAPROOT_WRONG_CONTROL_SIZE {
+		t.Error("control size not detected", err)
+	}
+}
+
+func TestTapBranchHash(t *testing.T) {
+	a := bytes.Repeat([]byte{1}, 32)
+	b := bytes.Repeat([]byte{2}, 32)
+	if !bytes.Equal(TapBranchHash(a, b), TapBranchHash(b, a)) {
+		t.Error("branch hash not sorted")
+	}
+}
+
+func TestTapTweakSign(t *testing.T) {
+	pk, err := NewPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := bytes.Repeat([]byte{7}, 32)
+	tk, err := pk.TapTweak(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, _, err := TaprootOutputKey(pk.XOnlyPublicKey(), root)
+	if err != nil || q != tk.XOnlyPublicKey() {
+		t.Fatal("tweaked private key not match output key", err)
+	}
+	msg := bytes.Repeat([]byte{9}, 32)
+	sig, err := tk.SignSchnorr(msg, nil)
+	if err != nil || !q.Verify(msg, sig) {
+		t.Error("tweaked key sign error", err)
+	}
+}
+
+//sig valid if first byte 1
+type testTapChecker struct {
+	codesep []uint32
+}
+
+func (c *testTapChecker) CheckSig(stack *Stack, sig []byte, pub []byte) error {
+	return errors.New("not support")
+}
+
+func (c *testTapChecker) CheckLockTime(ltime ScriptNum) error {
+	return nil
+}
+
+func (c *testTapChecker) CheckSequence(seq ScriptNum) error {
+	return nil
+}
+
+func (c *testTapChecker) CheckSchnorrSig(sig []byte, pub []byte, codesep uint32) error {
+	c.codesep = append(c.codesep, codesep)
+	if sig[0] != 1 {
+		return SCRIPT_ERR_SCHNORR_SIG
+	}
+	return nil
+}
+
+func TestEvalTapscript(t *testing.T) {
+	sig := append([]byte{1}, make([]byte, 63)...)
+	bad := make([]byte, 64)
+	key := bytes.Repeat([]byte{2}, 32)
+	multi := NewScript([]byte{})
+	multi.PushBytes(key).PushOp(OP_CHECKSIG)
+	multi.PushBytes(key).PushOp(OP_CHECKSIGADD)
+	multi.PushBytes(key).PushOp(OP_CHECKSIGADD)
+	multi.PushOp(OP_2).PushOp(OP_NUMEQUAL)
+	tests := []struct {
+		name  string
+		s     *Script
+		stack [][]byte
+		flags int
+		err   error
+	}{
+		{"2of3", multi, [][]byte{sig, {}, sig}, 0, nil},
+		{"1of3", multi, [][]byte{{}, {}, sig}, 0, SCRIPT_ERR_EVAL_FALSE},
+		{"bad sig", multi, [][]byte{sig, bad, sig}, 0, SCRIPT_ERR_SCHNORR_SIG},
+		{"empty pubkey", NewScript([]byte{OP_0, OP_CHECKSIG}), [][]byte{sig}, 0, SCRIPT_ERR_PUBKEYTYPE},
+		{"unknown pubkey", NewScript([]byte{OP_1, OP_CHECKSIG}), [][]byte{sig}, 0, nil},
+		{"discourage pubkey", NewScript([]byte{OP_1, OP_CHECKSIG}), [][]byte{sig}, SCRIPT_VERIFY_DISCOURAGE_UPGRADABLE_PUBKEYTYPE, SCRIPT_ERR_DISCOURAGE_UPGRADABLE_PUBKEYTYPE},
+		{"multisig", NewScript([]byte{OP_0, OP_0, OP_CHECKMULTISIG}), nil, 0, SCRIPT_ERR_TAPSCRIPT_CHECKMULTISIG},
+		{"minimalif", NewScript([]byte{OP_IF, OP_1, OP_ENDIF}), [][]byte{{2}}, 0, SCRIPT_ERR_TAPSCRIPT_MINIMALIF},
+		{"if else", NewScript([]byte{OP_IF, OP_0, OP_ELSE, OP_1, OP_ENDIF}), [][]byte{{}}, 0, nil},
+		{"op success", NewScript([]byte{OP_RETURN, 0x50}), nil, 0, nil},
+		{"discourage op success", NewScript([]byte{OP_RETURN, 0x50}), nil, SCRIPT_VERIFY_DISCOURAGE_OP_SUCCESS, SCRIPT_ERR_DISCOURAGE_OP_SUCCESS},
+		{"bad push before op success", NewScript([]byte{OP_PUSHDATA1, 5, 0x50}), nil, 0, SCRIPT_ERR_BAD_OPCODE},
+		{"push size", NewScript([]byte{OP_DROP, OP_1}), [][]byte{make([]byte, 521)}, 0, SCRIPT_ERR_PUSH_SIZE},
+		{"cleanstack", NewScript([]byte{OP_1}), [][]byte{{1}}, 0, SCRIPT_ERR_CLEANSTACK},
+	}
+	for _, v := range tests {
+		stack := NewStack()
+		for _, e := range v.stack {
+			stack.Push(e)
+		}
+		//witness size large enough
+		err := v.s.EvalTapscript(stack, &testTapChecker{}, v.flags, 1000)
+		if !errors.Is(err, v.err) {
+			t.Errorf("%s error %v want %v", v.name, err, v.err)
+		}
+	}
+}
+
+func TestTapscriptValidationWeight(t *testing.T) {
+	sig := append([]byte{1}, make([]byte, 63)...)
+	key := bytes.Repeat([]byte{2}, 32)
+	s := NewScript([]byte{})
+	s.PushBytes(key).PushOp(OP_CHECKSIGVERIFY)
+	s.PushBytes(key).PushOp(OP_CHECKSIG)
+	//budget 50 + witsize,two sigs cost 100
+	for _, v := range []struct {
+		witsize int
+		err     error
+	}{{50, nil}, {49, SCRIPT_ERR_TAPSCRIPT_VALIDATION_WEIGHT}} {
+		stack := NewStack()
+		stack.Push(sig)
+		stack.Push(sig)
+		if err := s.EvalTapscript(stack, &testTapChecker{}, 0, v.witsize); !errors.Is(err, v.err) {
+			t.Errorf("witsize %d error %v want %v", v.witsize, err, v.err)
+		}
+	}
+}
+
+func TestTapscriptCodeSeparator(t *testing.T) {
+	sig := append([]byte{1}, make([]byte, 63)...)
+	key := bytes.Repeat([]byte{2}, 32)
+	s := NewScript([]byte{})
+	s.PushBytes(key).PushOp(OP_CHECKSIGVERIFY)
+	s.PushOp(OP_CODESEPARATOR)
+	s.PushBytes(key).PushOp(OP_CHECKSIG)
+	stack := NewStack()
+	stack.Push(sig)
+	stack.Push(sig)
+	c := &testTapChecker{}
+	if err := s.EvalTapscript(stack, c, 0, 1000); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.codesep) != 2 || c.codesep[0] != 0xFFFFFFFF || c.codesep[1] != 2 {
+		t.Error("codesep position error", c.codesep)
+	}
+}
+
+func TestLegacyEvalCheckSigAdd(t *testing.T) {
+	s := NewScript([]byte{OP_0, OP_0, OP_1, OP_CHECKSIGADD})
+	if err := s.Eval(NewStack(), &testTapChecker{}, 0); !errors.Is(err, SCRIPT_ERR_BAD_OPCODE) {
+		t.Error("OP_CHECKSIGADD must bad opcode out of tapscript", err)
+	}
+}
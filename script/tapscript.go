@@ -0,0 +1,88 @@
+package script
+
+//bip342 checker,sig without hashtype check
+type TapscriptChecker interface {
+	SigChecker
+	//verify schnorr sig for tapscript sighash,codesep is last executed OP_CODESEPARATOR position
+	CheckSchnorrSig(sig []byte, pub []byte, codesep uint32) error
+}
+
+//tapscript execution state
+type tapExec struct {
+	checker TapscriptChecker
+	flags   int
+	codesep uint32
+	budget  int64
+}
+
+//OP_SUCCESSx make script success at once
+func IsOpSuccess(op byte) bool {
+	return op == 80 || op == 98 || (op >= 126 && op <= 129) ||
+		(op >= 131 && op <= 134) || (op >= 137 && op <= 138) ||
+		(op >= 141 && op <= 142) || (op >= 149 && op <= 153) ||
+		(op >= 187 && op <= 254)
+}
+
+//return true if signature not empty and valid
+func (e *tapExec) checkSig(sig []byte, pub []byte) (bool, error) {
+	success := len(sig) > 0
+	if success {
+		e.budget -= VALIDATION_WEIGHT_PER_SIGOP
+		if e.budget < 0 {
+			return false, SCRIPT_ERR_TAPSCRIPT_VALIDATION_WEIGHT
+		}
+	}
+	if len(pub) == 0 {
+		return false, SCRIPT_ERR_PUBKEYTYPE
+	}
+	if len(pub) == SCHNORR_PUBKEY_SIZE {
+		if success {
+			if err := e.checker.CheckSchnorrSig(sig, pub, e.codesep); err != nil {
+				return false, err
+			}
+		}
+	} else if e.flags&SCRIPT_VERIFY_DISCOURAGE_UPGRADABLE_PUBKEYTYPE != 0 {
+		return false, SCRIPT_ERR_DISCOURAGE_UPGRADABLE_PUBKEYTYPE
+	}
+	return success, nil
+}
+
+//run leaf version 0xc0 script,witsize is serialized size of the whole witness
+//stack must left exactly one true element
+func (s Script) EvalTapscript(stack *Stack, checker TapscriptChecker, flags int, witsize int) error {
+	for pc := 0; pc < s.Len(); {
+		ok, idx, op, _ := s.GetOp(pc)
+		if !ok {
+			return SCRIPT_ERR_BAD_OPCODE
+		}
+		if IsOpSuccess(op) {
+			if flags&SCRIPT_VERIFY_DISCOURAGE_OP_SUCCESS != 0 {
+				return SCRIPT_ERR_DISCOURAGE_OP_SUCCESS
+			}
+			return nil
+		}
+		pc = idx
+	}
+	if stack.Len() > MAX_STACK_SIZE {
+		return SCRIPT_ERR_STACK_SIZE
+	}
+	if stack.Count(func(v Value) bool { return v.Len() > MAX_SCRIPT_ELEMENT_SIZE }) > 0 {
+		return SCRIPT_ERR_PUSH_SIZE
+	}
+	tap := &tapExec{
+		checker: checker,
+		flags:   flags,
+		codesep: 0xFFFFFFFF,
+		budget:  int64(witsize) + VALIDATION_WEIGHT_OFFSET,
+	}
+	if err := s.eval(stack, checker, flags, tap, nil); err != nil {
+		return err
+	}
+	if stack.Len() != 1 {
+		return SCRIPT_ERR_CLEANSTACK
+	}
+	if !StackTopBool(stack, -1) {
+		return SCRIPT_ERR_EVAL_FALSE
+	}
+	return nil
+}
@@ -42,3 +42,15 @@ func HASH256(b []byte) []byte {
 	s2.Write(v1)
 	return s2.Sum(nil)
 }
+
+//bip340 tagged hash,sha256(sha256(tag) || sha256(tag) || msgs)
+func TaggedHash(tag string, msgs ...[]byte) []byte {
+	th := sha256.Sum256([]byte(tag))
+	h := sha256.New()
+	h.Write(th[:])
+	h.Write(th[:])
+	for _, m := range msgs {
+		h.Write(m)
+	}
+	return h.Sum(nil)
+}
@@ -0,0 +1,47 @@
+package util
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+)
+
+//hmac-sha256 drbg for rfc6979 nonce
+type rfc6979 struct {
+	k     [32]byte
+	v     [32]byte
+	retry bool
+}
+
+func (r *rfc6979) hmac(data ...[]byte) [32]byte {
+	var out [32]byte
+	h := hmac.New(sha256.New, r.k[:])
+	for _, d := range data {
+		h.Write(d)
+	}
+	copy(out[:], h.Sum(nil))
+	return out
+}
+
+//seed = key32 || msg32 || extra entropy
+func newRFC6979(seed []byte) *rfc6979 {
+	r := &rfc6979{}
+	for i := range r.v {
+		r.v[i] = 0x01
+	}
+	r.k = r.hmac(r.v[:], []byte{0x00}, seed)
+	r.v = r.hmac(r.v[:])
+	r.k = r.hmac(r.v[:], []byte{0x01}, seed)
+	r.v = r.hmac(r.v[:])
+	return r
+}
+
+//next 32 bytes candidate nonce
+func (r *rfc6979) generate() [32]byte {
+	if r.retry {
+		r.k = r.hmac(r.v[:], []byte{0x00})
+		r.v = r.hmac(r.v[:])
+	}
+	r.v = r.hmac(r.v[:])
+	r.retry = true
+	return r.v
+}
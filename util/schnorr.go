@@ -0,0 +1,212 @@
+package util
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"math/big"
+)
+
+const (
+	SCHNORR_PUBKEY_SIZE    = 32
+	SCHNORR_SIGNATURE_SIZE = 64
+)
+
+//point with even y for x only key,false if x >= p or not on curve
+func liftX(b []byte) (geVal, bool) {
+	var p geVal
+	var x fieldVal
+	var xb [32]byte
+	copy(xb[:], b)
+	if !x.setBytes(&xb) {
+		return p, false
+	}
+	return p, p.setXO(&x, false)
+}
+
+//e = hash(R.x || P.x || msg) mod n
+func schnorrChallenge(rx, px, msg []byte) scalarVal {
+	var e scalarVal
+	var hb [32]byte
+	copy(hb[:], TaggedHash("BIP0340/challenge", rx, px, msg))
+	e.setBytes(&hb)
+	return e
+}
+
+//bip340 sign with private key d,aux is 32 bytes randomness or nil for zeros
+func SchnorrSign(d *big.Int, msg []byte, aux []byte) ([]byte, error) {
+	genOnce.Do(initGenTable)
+	if aux == nil {
+		aux = make([]byte, 32)
+	}
+	if len(aux) != 32 {
+		return nil, errors.New("schnorr aux length error")
+	}
+	if d.Sign() <= 0 || d.BitLen() > 256 {
+		return nil, errors.New("private key error")
+	}
+	var sd scalarVal
+	kb := bigBytes32(d)
+	if sd.setBytes(&kb) || sd.isZero() {
+		return nil, errors.New("private key error")
+	}
+	pj := ecmultGen(&sd)
+	p := pj.toAffine()
+	if p.y.isOdd() {
+		sd.negate(&sd)
+	}
+	px := p.x.bytes()
+	db := sd.bytes()
+	t := TaggedHash("BIP0340/aux", aux)
+	for i := range t {
+		t[i] ^= db[i]
+	}
+	var k scalarVal
+	var nb [32]byte
+	copy(nb[:], TaggedHash("BIP0340/nonce", t, px[:], msg))
+	k.setBytes(&nb)
+	if k.isZero() {
+		return nil, errors.New("schnorr nonce zero")
+	}
+	rj := ecmultGen(&k)
+	r := rj.toAffine()
+	if r.y.isOdd() {
+		k.negate(&k)
+	}
+	rx := r.x.bytes()
+	e := schnorrChallenge(rx[:], px[:], msg)
+	//s = k + e*d
+	var s scalarVal
+	s.mul(&e, &sd).add(&s, &k)
+	sb := s.bytes()
+	sig := append(rx[:], sb[:]...)
+	if !SchnorrVerify(px[:], msg, sig) {
+		return nil, errors.New("schnorr sign verify failed")
+	}
+	return sig, nil
+}
+
+//parse r and s,false if r >= p or s >= n
+func schnorrParse(sig []byte) (fieldVal, scalarVal, bool) {
+	var r fieldVal
+	var s scalarVal
+	var b [32]byte
+	copy(b[:], sig[:32])
+	if !r.setBytes(&b) {
+		return r, s, false
+	}
+	copy(b[:], sig[32:])
+	if s.setBytes(&b) {
+		return r, s, false
+	}
+	return r, s, true
+}
+
+//bip340 verify,pub is 32 bytes x only key,sig is 64 bytes
+func SchnorrVerify(pub []byte, msg []byte, sig []byte) bool {
+	if len(pub) != SCHNORR_PUBKEY_SIZE || len(sig) != SCHNORR_SIGNATURE_SIZE {
+		return false
+	}
+	p, ok := liftX(pub)
+	if !ok {
+		return false
+	}
+	r, s, ok := schnorrParse(sig)
+	if !ok {
+		return false
+	}
+	//R = s*G - e*P
+	e := schnorrChallenge(sig[:32], pub, msg)
+	e.negate(&e)
+	rj := ecmult(&p, &e, &s)
+	if rj.inf {
+		return false
+	}
+	ra := rj.toAffine()
+	return !ra.y.isOdd() && ra.x.equal(&r)
+}
+
+//bip340 batch verify,true only if all signatures valid
+//random weights derived from hash of all inputs
+func SchnorrBatchVerify(pubs [][]byte, msgs [][]byte, sigs [][]byte) bool {
+	if len(pubs) != len(msgs) || len(pubs) != len(sigs) {
+		return false
+	}
+	if len(pubs) == 0 {
+		return true
+	}
+	h := sha256.New()
+	lb := make([]byte, 8)
+	for i := range pubs {
+		if len(pubs[i]) != SCHNORR_PUBKEY_SIZE || len(sigs[i]) != SCHNORR_SIGNATURE_SIZE {
+			return false
+		}
+		binary.LittleEndian.PutUint64(lb, uint64(len(msgs[i])))
+		h.Write(pubs[i])
+		h.Write(lb)
+		h.Write(msgs[i])
+		h.Write(sigs[i])
+	}
+	seed := h.Sum(nil)
+	//sum(a_i*s_i)*G - sum(a_i*R_i) - sum(a_i*e_i*P_i) == infinity
+	ps := make([]geVal, 0, 2*len(pubs))
+	ks := make([]scalarVal, 0, 2*len(pubs))
+	var sum scalarVal
+	for i := range pubs {
+		p, ok := liftX(pubs[i])
+		if !ok {
+			return false
+		}
+		r, s, ok := schnorrParse(sigs[i])
+		if !ok {
+			return false
+		}
+		var rp geVal
+		if !rp.setXO(&r, false) {
+			return false
+		}
+		var a scalarVal
+		a.setInt(1)
+		if i > 0 {
+			var ab [32]byte
+			binary.LittleEndian.PutUint64(lb, uint64(i))
+			copy(ab[:], TaggedHash("BIP0340/batch", seed, lb))
+			a.setBytes(&ab)
+		}
+		e := schnorrChallenge(sigs[i][:32], pubs[i], msgs[i])
+		var as, ae scalarVal
+		as.mul(&a, &s)
+		sum.add(&sum, &as)
+		ae.mul(&a, &e).negate(&ae)
+		a.negate(&a)
+		ps = append(ps, rp, p)
+		ks = append(ks, a, ae)
+	}
+	r := ecmultMulti(ps, ks, &sum)
+	return r.inf
+}
+
+//bip341 tweak Q = lift_x(P) + t*G,return x only Q and y parity
+func XOnlyTweakAdd(pub []byte, tweak []byte) ([]byte, bool, error) {
+	if len(pub) != SCHNORR_PUBKEY_SIZE || len(tweak) != 32 {
+		return nil, false, errors.New("tweak add args size error")
+	}
+	p, ok := liftX(pub)
+	if !ok {
+		return nil, false, errors.New("x only public key not at curve error")
+	}
+	var t, one scalarVal
+	var tb [32]byte
+	copy(tb[:], tweak)
+	if t.setBytes(&tb) {
+		return nil, false, errors.New("tweak overflow error")
+	}
+	one.setInt(1)
+	qj := ecmult(&p, &one, &t)
+	if qj.inf {
+		return nil, false, errors.New("tweak result infinity")
+	}
+	q := qj.toAffine()
+	qx := q.x.bytes()
+	return qx[:], q.y.isOdd(), nil
+}
@@ -40,7 +40,6 @@ import (
 var (
 	initonce  sync.Once
 	secp256k1 *secp256k1Curve
-	three     = new(big.Int).SetUint64(3)
 	one       = new(big.Int).SetInt64(1)
 )
 
@@ -103,209 +102,189 @@ func (curve *secp256k1Curve) Params() *elliptic.CurveParams {
 	return &curve.CurveParams
 }
 
-func (curve *secp256k1Curve) IsOnCurve(x, y *big.Int) bool {
-	var y2, x3 big.Int
-
-	y2.Mul(y, y)
-	y2.Mod(&y2, curve.P)
-
-	x3.Mul(x, x)
-	x3.Mul(&x3, x)
-	x3.Add(&x3, curve.B)
-	x3.Mod(&x3, curve.P)
-
-	return x3.Cmp(&y2) == 0
+//left pad big int to 32 bytes,v must < 2^256
+func bigBytes32(v *big.Int) [32]byte {
+	var b [32]byte
+	d := v.Bytes()
+	copy(b[32-len(d):], d)
+	return b
 }
 
-func (curve *secp256k1Curve) Double(x1, y1 *big.Int) (*big.Int, *big.Int) {
-	z1 := zForAffine(x1, y1)
-	return curve.affineFromJacobian(curve.doubleJacobian(x1, y1, z1))
+//convert big int to field element,false if negative or >= p
+func fieldFromBig(v *big.Int) (fieldVal, bool) {
+	var f fieldVal
+	if v.Sign() < 0 || v.BitLen() > 256 {
+		return f, false
+	}
+	b := bigBytes32(v)
+	return f, f.setBytes(&b)
 }
 
-// zForAffine returns a Jacobian Z value for the affine point (x, y). If x and
-// y are zero, it assumes that they represent the point at infinity because (0,
-// 0) is not on the any of the curves handled here.
-func zForAffine(x, y *big.Int) *big.Int {
-	z := new(big.Int)
-	if x.Sign() != 0 || y.Sign() != 0 {
-		z.SetInt64(1)
+//(0,0) as infinity
+func geFromBig(x, y *big.Int) (geVal, bool) {
+	var p geVal
+	if x.Sign() == 0 && y.Sign() == 0 {
+		p.inf = true
+		return p, true
+	}
+	fx, ok := fieldFromBig(x)
+	if !ok {
+		return p, false
 	}
-	return z
+	fy, ok := fieldFromBig(y)
+	if !ok {
+		return p, false
+	}
+	p.x, p.y = fx, fy
+	return p, true
 }
 
-// affineFromJacobian reverses the Jacobian transform. See the comment at the
-// top of the file. If the point is ∞ it returns 0, 0.
-func (curve *secp256k1Curve) affineFromJacobian(x, y, z *big.Int) (xOut, yOut *big.Int) {
-	if z.Sign() == 0 {
+func (p *geVal) toBig() (*big.Int, *big.Int) {
+	if p.inf {
 		return new(big.Int), new(big.Int)
 	}
-
-	zinv := new(big.Int).ModInverse(z, curve.P)
-	zinvsq := new(big.Int).Mul(zinv, zinv)
-
-	xOut = new(big.Int).Mul(x, zinvsq)
-	xOut.Mod(xOut, curve.P)
-	zinvsq.Mul(zinvsq, zinv)
-	yOut = new(big.Int).Mul(y, zinvsq)
-	yOut.Mod(yOut, curve.P)
-	return
+	x, y := p.x, p.y
+	xb, yb := x.normalize().bytes(), y.normalize().bytes()
+	return new(big.Int).SetBytes(xb[:]), new(big.Int).SetBytes(yb[:])
 }
 
-func (curve *secp256k1Curve) Add(x1, y1, x2, y2 *big.Int) (*big.Int, *big.Int) {
-	z1 := zForAffine(x1, y1)
-	z2 := zForAffine(x2, y2)
-	return curve.affineFromJacobian(curve.addJacobian(x1, y1, z1, x2, y2, z2))
+func (r *gejVal) toBig() (*big.Int, *big.Int) {
+	p := r.toAffine()
+	return p.toBig()
 }
 
-// addJacobian takes two points in Jacobian coordinates, (x1, y1, z1) and
-// (x2, y2, z2) and returns their sum, also in Jacobian form.
-func (curve *secp256k1Curve) addJacobian(x1, y1, z1, x2, y2, z2 *big.Int) (*big.Int, *big.Int, *big.Int) {
-	// See http://hyperelliptic.org/EFD/g1p/auto-shortw-jacobian-0.html#addition-add-2007-bl
-	x3, y3, z3 := new(big.Int), new(big.Int), new(big.Int)
-	if z1.Sign() == 0 {
-		x3.Set(x2)
-		y3.Set(y2)
-		z3.Set(z2)
-		return x3, y3, z3
-	}
-	if z2.Sign() == 0 {
-		x3.Set(x1)
-		y3.Set(y1)
-		z3.Set(z1)
-		return x3, y3, z3
+//scalar from big endian bytes mod n
+func scalarFromBytes(k []byte) scalarVal {
+	var s scalarVal
+	if len(k) > 32 {
+		k = new(big.Int).Mod(new(big.Int).SetBytes(k), secp256k1.N).Bytes()
 	}
+	s.setSlice(k)
+	return s
+}
 
-	z1z1 := new(big.Int).Mul(z1, z1)
-	z1z1.Mod(z1z1, curve.P)
-	z2z2 := new(big.Int).Mul(z2, z2)
-	z2z2.Mod(z2z2, curve.P)
+func (curve *secp256k1Curve) IsOnCurve(x, y *big.Int) bool {
+	p, ok := geFromBig(x, y)
+	return ok && p.isValid()
+}
 
-	u1 := new(big.Int).Mul(x1, z2z2)
-	u1.Mod(u1, curve.P)
-	u2 := new(big.Int).Mul(x2, z1z1)
-	u2.Mod(u2, curve.P)
-	h := new(big.Int).Sub(u2, u1)
-	xEqual := h.Sign() == 0
-	if h.Sign() == -1 {
-		h.Add(h, curve.P)
+func (curve *secp256k1Curve) Double(x1, y1 *big.Int) (*big.Int, *big.Int) {
+	p, ok := geFromBig(x1, y1)
+	if !ok {
+		return new(big.Int), new(big.Int)
 	}
-	i := new(big.Int).Lsh(h, 1)
-	i.Mul(i, i)
-	j := new(big.Int).Mul(h, i)
+	var r gejVal
+	r.setGe(&p).double(&r)
+	return r.toBig()
+}
 
-	s1 := new(big.Int).Mul(y1, z2)
-	s1.Mul(s1, z2z2)
-	s1.Mod(s1, curve.P)
-	s2 := new(big.Int).Mul(y2, z1)
-	s2.Mul(s2, z1z1)
-	s2.Mod(s2, curve.P)
-	r := new(big.Int).Sub(s2, s1)
-	if r.Sign() == -1 {
-		r.Add(r, curve.P)
-	}
-	yEqual := r.Sign() == 0
-	if xEqual && yEqual {
-		return curve.doubleJacobian(x1, y1, z1)
+func (curve *secp256k1Curve) Add(x1, y1, x2, y2 *big.Int) (*big.Int, *big.Int) {
+	p1, ok1 := geFromBig(x1, y1)
+	p2, ok2 := geFromBig(x2, y2)
+	if !ok1 || !ok2 {
+		return new(big.Int), new(big.Int)
 	}
-	r.Lsh(r, 1)
-	v := new(big.Int).Mul(u1, i)
-
-	x3.Set(r)
-	x3.Mul(x3, x3)
-	x3.Sub(x3, j)
-	x3.Sub(x3, v)
-	x3.Sub(x3, v)
-	x3.Mod(x3, curve.P)
-
-	y3.Set(r)
-	v.Sub(v, x3)
-	y3.Mul(y3, v)
-	s1.Mul(s1, j)
-	s1.Lsh(s1, 1)
-	y3.Sub(y3, s1)
-	y3.Mod(y3, curve.P)
-
-	z3.Add(z1, z2)
-	z3.Mul(z3, z3)
-	z3.Sub(z3, z1z1)
-	z3.Sub(z3, z2z2)
-	z3.Mul(z3, h)
-	z3.Mod(z3, curve.P)
-
-	return x3, y3, z3
+	var r gejVal
+	r.setGe(&p1).addGeVar(&r, &p2)
+	return r.toBig()
 }
 
-// doubleJacobian takes a point in Jacobian coordinates, (x, y, z), and
-// returns its double, also in Jacobian form.
-func (curve *secp256k1Curve) doubleJacobian(x, y, z *big.Int) (*big.Int, *big.Int, *big.Int) {
-	// See http://hyperelliptic.org/EFD/g1p/auto-shortw-jacobian-0.html#doubling-dbl-2009-l
-	var a, b, c, d, e, f, x3, y3, z3 big.Int
-
-	a.Mul(x, x)
-	a.Mod(&a, curve.P)
-	b.Mul(y, y)
-	b.Mod(&b, curve.P)
-	c.Mul(&b, &b)
-	c.Mod(&c, curve.P)
-
-	d.Add(x, &b)
-	d.Mul(&d, &d)
-	d.Sub(&d, &a)
-	d.Sub(&d, &c)
-	d.Lsh(&d, 1)
-	if d.Sign() < 0 {
-		d.Add(&d, curve.P)
-	} else {
-		d.Mod(&d, curve.P)
+//fixed window,constant time,safe for secret scalar
+//verification on public data use variable time ecmult
+func (curve *secp256k1Curve) ScalarMult(Bx, By *big.Int, k []byte) (*big.Int, *big.Int) {
+	p, ok := geFromBig(Bx, By)
+	if !ok {
+		return new(big.Int), new(big.Int)
 	}
+	s := scalarFromBytes(k)
+	r := ecmultConst(&p, &s)
+	return r.toBig()
+}
 
-	e.Mul(three, &a)
-	e.Mod(&e, curve.P)
-	f.Mul(&e, &e)
-	f.Mod(&f, curve.P)
+//blinded precomputed table,constant time
+func (curve *secp256k1Curve) ScalarBaseMult(k []byte) (*big.Int, *big.Int) {
+	s := scalarFromBytes(k)
+	r := ecmultGen(&s)
+	return r.toBig()
+}
 
-	x3.Lsh(&d, 1)
-	x3.Sub(&f, &x3)
-	if x3.Sign() < 0 {
-		x3.Add(&x3, curve.P)
-	} else {
-		x3.Mod(&x3, curve.P)
+//verify ecdsa signature with pubkey x,y,hash truncated to 32 bytes
+func VerifyECDSA(x, y *big.Int, hash []byte, r, s *big.Int) bool {
+	initonce.Do(initSECP256K1)
+	q, ok := geFromBig(x, y)
+	if !ok || q.inf {
+		return false
 	}
-
-	y3.Sub(&d, &x3)
-	y3.Mul(&e, &y3)
-	c.Lsh(&c, 3)
-	y3.Sub(&y3, &c)
-	if y3.Sign() < 0 {
-		y3.Add(&y3, curve.P)
-	} else {
-		y3.Mod(&y3, curve.P)
+	var sr, ss scalarVal
+	if r.Sign() <= 0 || r.BitLen() > 256 || s.Sign() <= 0 || s.BitLen() > 256 {
+		return false
 	}
-
-	z3.Mul(y, z)
-	z3.Lsh(&z3, 1)
-	z3.Mod(&z3, curve.P)
-
-	return &x3, &y3, &z3
+	if b := bigBytes32(r); sr.setBytes(&b) {
+		return false
+	}
+	if b := bigBytes32(s); ss.setBytes(&b) {
+		return false
+	}
+	if len(hash) > 32 {
+		hash = hash[:32]
+	}
+	e := scalarFromBytes(hash)
+	return ecdsaVerify(&q, &e, &sr, &ss)
 }
 
-func (curve *secp256k1Curve) ScalarMult(Bx, By *big.Int, k []byte) (*big.Int, *big.Int) {
-	Bz := new(big.Int).SetInt64(1)
-	x, y, z := new(big.Int), new(big.Int), new(big.Int)
-
-	for _, byte := range k {
-		for bitNum := 0; bitNum < 8; bitNum++ {
-			x, y, z = curve.doubleJacobian(x, y, z)
-			if byte&0x80 == 0x80 {
-				x, y, z = curve.addJacobian(Bx, By, Bz, x, y, z)
-			}
-			byte <<= 1
+//rfc6979 deterministic ecdsa sign with private key d,s normalized to low s
+//extra is optional 32 bytes entropy mixed into nonce
+func SignECDSA(d *big.Int, hash []byte, extra []byte) (*big.Int, *big.Int, error) {
+	initonce.Do(initSECP256K1)
+	if len(hash) != 32 {
+		return nil, nil, errors.New("sign hash length error")
+	}
+	if len(extra) != 0 && len(extra) != 32 {
+		return nil, nil, errors.New("sign extra entropy length error")
+	}
+	if d.Sign() <= 0 || d.BitLen() > 256 {
+		return nil, nil, errors.New("private key error")
+	}
+	var sd, e scalarVal
+	kb := bigBytes32(d)
+	if sd.setBytes(&kb) || sd.isZero() {
+		return nil, nil, errors.New("private key error")
+	}
+	var hb [32]byte
+	copy(hb[:], hash)
+	e.setBytes(&hb)
+	mb := e.bytes()
+	seed := make([]byte, 0, 96)
+	seed = append(seed, kb[:]...)
+	seed = append(seed, mb[:]...)
+	seed = append(seed, extra...)
+	rng := newRFC6979(seed)
+	for {
+		var k scalarVal
+		nb := rng.generate()
+		if k.setBytes(&nb) || k.isZero() {
+			continue
+		}
+		p := ecmultGen(&k)
+		ap := p.toAffine()
+		xb := ap.x.bytes()
+		var sr, ss scalarVal
+		sr.setBytes(&xb)
+		if sr.isZero() {
+			continue
 		}
+		//s = k^-1 * (e + r*d)
+		ss.mul(&sr, &sd)
+		ss.add(&ss, &e)
+		k.inverse(&k)
+		ss.mul(&ss, &k)
+		if ss.isZero() {
+			continue
+		}
+		if ss.isHigh() {
+			ss.negate(&ss)
+		}
+		rb, sb := sr.bytes(), ss.bytes()
+		return new(big.Int).SetBytes(rb[:]), new(big.Int).SetBytes(sb[:]), nil
 	}
-
-	return curve.affineFromJacobian(x, y, z)
-}
-
-func (curve *secp256k1Curve) ScalarBaseMult(k []byte) (*big.Int, *big.Int) {
-	return curve.ScalarMult(curve.Gx, curve.Gy, k)
 }
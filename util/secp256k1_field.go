@@ -0,0 +1,321 @@
+package util
+
+import (
+	"math/bits"
+)
+
+//field element mod p = 2^256 - 2^32 - 977
+//5x52 limbs,value = sum(n[i] * 2^(52*i)),top limb 48 bits when normalized
+//magnitude of limbs grows with add,mul and sqr inputs must magnitude <= 8
+type fieldVal struct {
+	n [5]uint64
+}
+
+const (
+	fieldM    = uint64(0xFFFFFFFFFFFFF)
+	fieldR    = uint64(0x1000003D10)
+	fieldTopM = uint64(0x0FFFFFFFFFFFF)
+	fieldP0   = uint64(0xFFFFEFFFFFC2F)
+	fieldC    = uint64(0x1000003D1)
+)
+
+//128 bits accumulator for limb products
+type u128 struct {
+	hi, lo uint64
+}
+
+func mul128(a, b uint64) u128 {
+	hi, lo := bits.Mul64(a, b)
+	return u128{hi: hi, lo: lo}
+}
+
+func (x u128) add(y u128) u128 {
+	lo, c := bits.Add64(x.lo, y.lo, 0)
+	hi, _ := bits.Add64(x.hi, y.hi, c)
+	return u128{hi: hi, lo: lo}
+}
+
+func (x u128) addMul(a, b uint64) u128 {
+	return x.add(mul128(a, b))
+}
+
+func (x u128) add64(a uint64) u128 {
+	return x.add(u128{lo: a})
+}
+
+func (x u128) shr52() u128 {
+	return u128{hi: x.hi >> 52, lo: x.lo>>52 | x.hi<<12}
+}
+
+func (x u128) shr64() u128 {
+	return u128{lo: x.hi}
+}
+
+//1 if a == b else 0,constant time
+func ctEq64(a, b uint64) uint64 {
+	x := a ^ b
+	return ((x | -x) >> 63) ^ 1
+}
+
+//1 if a >= b else 0,constant time
+func ctGe64(a, b uint64) uint64 {
+	_, borrow := bits.Sub64(a, b, 0)
+	return borrow ^ 1
+}
+
+func (f *fieldVal) setInt(v uint64) *fieldVal {
+	f.n = [5]uint64{v & fieldM, v >> 52, 0, 0, 0}
+	return f
+}
+
+//set big endian 32 bytes,return false if value >= p
+func (f *fieldVal) setBytes(b *[32]byte) bool {
+	var w [4]uint64
+	for i := 0; i < 4; i++ {
+		w[i] = uint64(b[31-8*i]) | uint64(b[30-8*i])<<8 | uint64(b[29-8*i])<<16 | uint64(b[28-8*i])<<24 |
+			uint64(b[27-8*i])<<32 | uint64(b[26-8*i])<<40 | uint64(b[25-8*i])<<48 | uint64(b[24-8*i])<<56
+	}
+	f.n[0] = w[0] & fieldM
+	f.n[1] = (w[0]>>52 | w[1]<<12) & fieldM
+	f.n[2] = (w[1]>>40 | w[2]<<24) & fieldM
+	f.n[3] = (w[2]>>28 | w[3]<<36) & fieldM
+	f.n[4] = w[3] >> 16
+	overflow := ctEq64(f.n[4], fieldTopM) & ctEq64(f.n[3]&f.n[2]&f.n[1], fieldM) & ctGe64(f.n[0], fieldP0)
+	return overflow == 0
+}
+
+//big endian 32 bytes,f must normalized
+func (f *fieldVal) bytes() [32]byte {
+	var b [32]byte
+	w := [4]uint64{
+		f.n[0] | f.n[1]<<52,
+		f.n[1]>>12 | f.n[2]<<40,
+		f.n[2]>>24 | f.n[3]<<28,
+		f.n[3]>>36 | f.n[4]<<16,
+	}
+	for i := 0; i < 4; i++ {
+		for j := 0; j < 8; j++ {
+			b[31-8*i-j] = byte(w[i] >> (8 * j))
+		}
+	}
+	return b
+}
+
+//reduce to magnitude 1,not fully normalized
+func (f *fieldVal) normalizeWeak() *fieldVal {
+	t0, t1, t2, t3, t4 := f.n[0], f.n[1], f.n[2], f.n[3], f.n[4]
+	x := t4 >> 48
+	t4 &= fieldTopM
+	t0 += x * fieldC
+	t1 += t0 >> 52
+	t0 &= fieldM
+	t2 += t1 >> 52
+	t1 &= fieldM
+	t3 += t2 >> 52
+	t2 &= fieldM
+	t4 += t3 >> 52
+	t3 &= fieldM
+	f.n = [5]uint64{t0, t1, t2, t3, t4}
+	return f
+}
+
+//reduce to unique value in [0,p)
+func (f *fieldVal) normalize() *fieldVal {
+	t0, t1, t2, t3, t4 := f.n[0], f.n[1], f.n[2], f.n[3], f.n[4]
+	x := t4 >> 48
+	t4 &= fieldTopM
+	t0 += x * fieldC
+	t1 += t0 >> 52
+	t0 &= fieldM
+	t2 += t1 >> 52
+	t1 &= fieldM
+	m := t1
+	t3 += t2 >> 52
+	t2 &= fieldM
+	m &= t2
+	t4 += t3 >> 52
+	t3 &= fieldM
+	m &= t3
+	//value >= p,subtract p by add 2^256-p
+	x = (t4 >> 48) | (ctEq64(t4, fieldTopM) & ctEq64(m, fieldM) & ctGe64(t0, fieldP0))
+	t0 += x * fieldC
+	t1 += t0 >> 52
+	t0 &= fieldM
+	t2 += t1 >> 52
+	t1 &= fieldM
+	t3 += t2 >> 52
+	t2 &= fieldM
+	t4 += t3 >> 52
+	t3 &= fieldM
+	t4 &= fieldTopM
+	f.n = [5]uint64{t0, t1, t2, t3, t4}
+	return f
+}
+
+func (f *fieldVal) set(a *fieldVal) *fieldVal {
+	f.n = a.n
+	return f
+}
+
+//f must normalized
+func (f *fieldVal) isZero() bool {
+	return (f.n[0] | f.n[1] | f.n[2] | f.n[3] | f.n[4]) == 0
+}
+
+//f must normalized
+func (f *fieldVal) isOdd() bool {
+	return f.n[0]&1 == 1
+}
+
+//compare normalized copies
+func (f *fieldVal) equal(a *fieldVal) bool {
+	x, y := *f, *a
+	x.normalize()
+	y.normalize()
+	return ((x.n[0] ^ y.n[0]) | (x.n[1] ^ y.n[1]) | (x.n[2] ^ y.n[2]) | (x.n[3] ^ y.n[3]) | (x.n[4] ^ y.n[4])) == 0
+}
+
+//f = f + a
+func (f *fieldVal) add(a *fieldVal) *fieldVal {
+	f.n[0] += a.n[0]
+	f.n[1] += a.n[1]
+	f.n[2] += a.n[2]
+	f.n[3] += a.n[3]
+	f.n[4] += a.n[4]
+	return f
+}
+
+//f = f * k,small k
+func (f *fieldVal) mulInt(k uint64) *fieldVal {
+	f.n[0] *= k
+	f.n[1] *= k
+	f.n[2] *= k
+	f.n[3] *= k
+	f.n[4] *= k
+	return f
+}
+
+//f = -a,a magnitude <= m
+func (f *fieldVal) negate(a *fieldVal, m uint64) *fieldVal {
+	k := 2 * (m + 1)
+	f.n[0] = fieldP0*k - a.n[0]
+	f.n[1] = fieldM*k - a.n[1]
+	f.n[2] = fieldM*k - a.n[2]
+	f.n[3] = fieldM*k - a.n[3]
+	f.n[4] = fieldTopM*k - a.n[4]
+	return f
+}
+
+//f = a * b,result magnitude 1
+func (f *fieldVal) mul(a, b *fieldVal) *fieldVal {
+	a0, a1, a2, a3, a4 := a.n[0], a.n[1], a.n[2], a.n[3], a.n[4]
+	b0, b1, b2, b3, b4 := b.n[0], b.n[1], b.n[2], b.n[3], b.n[4]
+	var r [5]uint64
+
+	//[... a b c] = ... + a<<104 + b<<52 + c mod p,[x 0 0 0 0 0] = [x*R]
+	d := mul128(a0, b3).addMul(a1, b2).addMul(a2, b1).addMul(a3, b0)
+	c := mul128(a4, b4)
+	d = d.addMul(fieldR, c.lo)
+	c = c.shr64()
+	t3 := d.lo & fieldM
+	d = d.shr52()
+
+	d = d.addMul(a0, b4).addMul(a1, b3).addMul(a2, b2).addMul(a3, b1).addMul(a4, b0)
+	d = d.addMul(fieldR<<12, c.lo)
+	t4 := d.lo & fieldM
+	d = d.shr52()
+	tx := t4 >> 48
+	t4 &= fieldM >> 4
+
+	c = mul128(a0, b0)
+	d = d.addMul(a1, b4).addMul(a2, b3).addMul(a3, b2).addMul(a4, b1)
+	u0 := d.lo & fieldM
+	d = d.shr52()
+	u0 = (u0 << 4) | tx
+	c = c.addMul(u0, fieldR>>4)
+	r[0] = c.lo & fieldM
+	c = c.shr52()
+
+	c = c.addMul(a0, b1).addMul(a1, b0)
+	d = d.addMul(a2, b4).addMul(a3, b3).addMul(a4, b2)
+	c = c.addMul(d.lo&fieldM, fieldR)
+	d = d.shr52()
+	r[1] = c.lo & fieldM
+	c = c.shr52()
+
+	c = c.addMul(a0, b2).addMul(a1, b1).addMul(a2, b0)
+	d = d.addMul(a3, b4).addMul(a4, b3)
+	c = c.addMul(fieldR, d.lo)
+	d = d.shr64()
+	r[2] = c.lo & fieldM
+	c = c.shr52()
+
+	c = c.addMul(fieldR<<12, d.lo).add64(t3)
+	r[3] = c.lo & fieldM
+	c = c.shr52()
+	r[4] = c.lo + t4
+	f.n = r
+	return f
+}
+
+func (f *fieldVal) sqr(a *fieldVal) *fieldVal {
+	return f.mul(a, a)
+}
+
+//f = a^(2^n)
+func (f *fieldVal) sqrn(a *fieldVal, n int) *fieldVal {
+	f.set(a)
+	for i := 0; i < n; i++ {
+		f.sqr(f)
+	}
+	return f
+}
+
+//a^(2^k - 1) blocks shared by inverse and sqrt
+func fieldPowBlocks(a *fieldVal) (x2, x3, x22, x223 fieldVal) {
+	var x6, x9, x11, x44, x88, x176, x220 fieldVal
+	x2.sqr(a).mul(&x2, a)
+	x3.sqr(&x2).mul(&x3, a)
+	x6.sqrn(&x3, 3).mul(&x6, &x3)
+	x9.sqrn(&x6, 3).mul(&x9, &x3)
+	x11.sqrn(&x9, 2).mul(&x11, &x2)
+	x22.sqrn(&x11, 11).mul(&x22, &x11)
+	x44.sqrn(&x22, 22).mul(&x44, &x22)
+	x88.sqrn(&x44, 44).mul(&x88, &x44)
+	x176.sqrn(&x88, 88).mul(&x176, &x88)
+	x220.sqrn(&x176, 44).mul(&x220, &x44)
+	x223.sqrn(&x220, 3).mul(&x223, &x3)
+	return
+}
+
+//f = a^(p-2),constant time
+func (f *fieldVal) inverse(a *fieldVal) *fieldVal {
+	x2, _, x22, x223 := fieldPowBlocks(a)
+	var t fieldVal
+	t.sqrn(&x223, 23).mul(&t, &x22)
+	t.sqrn(&t, 5).mul(&t, a)
+	t.sqrn(&t, 3).mul(&t, &x2)
+	t.sqrn(&t, 2).mul(&t, a)
+	return f.set(&t)
+}
+
+//f = a^((p+1)/4),return false if a not square
+func (f *fieldVal) sqrt(a *fieldVal) bool {
+	x2, _, x22, x223 := fieldPowBlocks(a)
+	var t, c fieldVal
+	t.sqrn(&x223, 23).mul(&t, &x22)
+	t.sqrn(&t, 6).mul(&t, &x2)
+	t.sqrn(&t, 2)
+	c.sqr(&t)
+	ok := c.equal(a)
+	f.set(&t)
+	return ok
+}
+
+//f = a if flag == 1,constant time
+func (f *fieldVal) cmov(a *fieldVal, flag uint64) {
+	mask := -flag
+	for i := range f.n {
+		f.n[i] ^= (f.n[i] ^ a.n[i]) & mask
+	}
+}
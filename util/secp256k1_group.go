@@ -0,0 +1,573 @@
+package util
+
+import (
+	"crypto/sha256"
+	"math/bits"
+	"sync"
+)
+
+//affine point
+type geVal struct {
+	x, y fieldVal
+	inf  bool
+}
+
+//jacobian point,x = X/Z^2,y = Y/Z^3,coords magnitude 1
+type gejVal struct {
+	x, y, z fieldVal
+	inf     bool
+}
+
+var (
+	//cube root of unity mod p,lambda*(x,y) = (beta*x,y)
+	fieldBeta = fieldVal{[5]uint64{0x96c28719501ee, 0x7512f58995c13, 0xc3434e99cf049, 0x7106e64479ea, 0x7ae96a2b657c}}
+	curveB    = fieldVal{[5]uint64{7, 0, 0, 0, 0}}
+	geG       = geVal{
+		x: fieldVal{[5]uint64{0x2815b16f81798, 0xdb2dce28d959f, 0xe870b07029bfc, 0xbbac55a06295c, 0x79be667ef9dc}},
+		y: fieldVal{[5]uint64{0x7d08ffb10d4b8, 0x48a68554199c4, 0xe1108a8fd17b4, 0xc4655da4fbfc0, 0x483ada7726a3}},
+	}
+)
+
+//y^2 = x^3 + 7
+func (p *geVal) isValid() bool {
+	if p.inf {
+		return false
+	}
+	var y2, x3 fieldVal
+	y2.sqr(&p.y)
+	x3.sqr(&p.x).mul(&x3, &p.x).add(&curveB)
+	return y2.equal(&x3)
+}
+
+//set x and y parity,return false if x not on curve
+func (p *geVal) setXO(x *fieldVal, odd bool) bool {
+	var c fieldVal
+	c.sqr(x).mul(&c, x).add(&curveB)
+	p.x = *x
+	p.inf = false
+	if !p.y.sqrt(&c) {
+		return false
+	}
+	p.y.normalize()
+	if p.y.isOdd() != odd {
+		p.y.negate(&p.y, 1).normalize()
+	}
+	return true
+}
+
+func (p *geVal) neg(a *geVal) *geVal {
+	p.x = a.x
+	p.inf = a.inf
+	p.y.negate(&a.y, 1).normalizeWeak()
+	return p
+}
+
+func (r *gejVal) setGe(a *geVal) *gejVal {
+	r.x, r.y = a.x, a.y
+	r.z.setInt(1)
+	r.inf = a.inf
+	return r
+}
+
+func (r *gejVal) setInfinity() *gejVal {
+	*r = gejVal{inf: true}
+	return r
+}
+
+//convert to affine,one inverse
+func (r *gejVal) toAffine() geVal {
+	if r.inf {
+		return geVal{inf: true}
+	}
+	var zi, zi2, zi3 fieldVal
+	zi.inverse(&r.z)
+	zi2.sqr(&zi)
+	zi3.mul(&zi2, &zi)
+	p := geVal{}
+	p.x.mul(&r.x, &zi2).normalize()
+	p.y.mul(&r.y, &zi3).normalize()
+	return p
+}
+
+//r = 2*a,dbl-2009-l
+func (r *gejVal) double(a *gejVal) *gejVal {
+	if a.inf {
+		return r.setInfinity()
+	}
+	var ta, tb, tc, td, te, tf, na, nc, nd, nx fieldVal
+	ta.sqr(&a.x)
+	tb.sqr(&a.y)
+	tc.sqr(&tb)
+	na.negate(&ta, 1)
+	nc.negate(&tc, 1)
+	td.set(&a.x).add(&tb)
+	td.sqr(&td).add(&na).add(&nc).mulInt(2).normalizeWeak()
+	te.set(&ta).mulInt(3)
+	tf.sqr(&te)
+	nd.negate(&td, 1).mulInt(2)
+	//z first,a may alias r
+	r.z.mul(&a.y, &a.z).mulInt(2).normalizeWeak()
+	r.x.set(&tf).add(&nd).normalizeWeak()
+	nx.negate(&r.x, 1).add(&td)
+	nc.mulInt(8)
+	r.y.mul(&te, &nx).add(&nc).normalizeWeak()
+	r.inf = false
+	return r
+}
+
+//r = a + b,variable time
+func (r *gejVal) addGeVar(a *gejVal, b *geVal) *gejVal {
+	if a.inf {
+		return r.setGe(b)
+	}
+	if b.inf {
+		*r = *a
+		return r
+	}
+	var z2, u2, s2, h, rr, t fieldVal
+	z2.sqr(&a.z)
+	u2.mul(&b.x, &z2)
+	s2.mul(&b.y, &z2).mul(&s2, &a.z)
+	h.set(&u2).add(t.negate(&a.x, 1)).normalize()
+	rr.set(&s2).add(t.negate(&a.y, 1)).normalize()
+	if h.isZero() {
+		if rr.isZero() {
+			return r.double(a)
+		}
+		return r.setInfinity()
+	}
+	return r.addFinish(a, &a.x, &a.y, &h, &rr, &a.z)
+}
+
+//r = a + b,variable time
+func (r *gejVal) addVar(a, b *gejVal) *gejVal {
+	if a.inf {
+		*r = *b
+		return r
+	}
+	if b.inf {
+		*r = *a
+		return r
+	}
+	var z12, z22, u1, u2, s1, s2, h, rr, z, t fieldVal
+	z12.sqr(&a.z)
+	z22.sqr(&b.z)
+	u1.mul(&a.x, &z22)
+	u2.mul(&b.x, &z12)
+	s1.mul(&a.y, &z22).mul(&s1, &b.z)
+	s2.mul(&b.y, &z12).mul(&s2, &a.z)
+	h.set(&u2).add(t.negate(&u1, 1)).normalize()
+	rr.set(&s2).add(t.negate(&s1, 1)).normalize()
+	if h.isZero() {
+		if rr.isZero() {
+			return r.double(a)
+		}
+		return r.setInfinity()
+	}
+	z.mul(&a.z, &b.z)
+	return r.addFinish(a, &u1, &s1, &h, &rr, &z)
+}
+
+//x3 = R^2 - H^3 - 2*U1*H^2,y3 = R*(U1*H^2 - x3) - S1*H^3,z3 = Z*H
+func (r *gejVal) addFinish(a *gejVal, u1, s1, h, rr, z *fieldVal) *gejVal {
+	var h2, h3, v, nh3, nv, nx, t, x3, y3 fieldVal
+	h2.sqr(h)
+	h3.mul(&h2, h)
+	v.mul(u1, &h2)
+	nh3.negate(&h3, 1)
+	nv.negate(&v, 1).mulInt(2)
+	x3.sqr(rr).add(&nh3).add(&nv).normalizeWeak()
+	nx.negate(&x3, 1)
+	y3.set(&v).add(&nx)
+	y3.mul(&y3, rr)
+	t.mul(s1, &h3)
+	t.negate(&t, 1)
+	y3.add(&t).normalizeWeak()
+	r.z.mul(z, h)
+	r.x, r.y = x3, y3
+	r.inf = false
+	return r
+}
+
+//r = a + b,constant time,handle doubling,opposite points and infinity a
+func (r *gejVal) addGe(a *gejVal, b *geVal) *gejVal {
+	var z2, u2, s2, h, rr, t fieldVal
+	z2.sqr(&a.z)
+	u2.mul(&b.x, &z2)
+	s2.mul(&b.y, &z2).mul(&s2, &a.z)
+	h.set(&u2).add(t.negate(&a.x, 1)).normalize()
+	rr.set(&s2).add(t.negate(&a.y, 1)).normalize()
+	hz := ctEq64(h.n[0]|h.n[1]|h.n[2]|h.n[3]|h.n[4], 0)
+	rz := ctEq64(rr.n[0]|rr.n[1]|rr.n[2]|rr.n[3]|rr.n[4], 0)
+	ainf := uint64(0)
+	if a.inf {
+		ainf = 1
+	}
+	var sum, dbl, gb gejVal
+	sum.addFinish(a, &a.x, &a.y, &h, &rr, &a.z)
+	dbl.double(a)
+	gb.setGe(b)
+	//h == 0 and r != 0,result infinity by z = 0
+	sum.cmov(&dbl, hz&rz)
+	sum.cmov(&gb, ainf)
+	sum.inf = (hz & (rz ^ 1) & (ainf ^ 1)) == 1
+	*r = sum
+	return r
+}
+
+//r = a if flag == 1,constant time
+func (r *gejVal) cmov(a *gejVal, flag uint64) {
+	r.x.cmov(&a.x, flag)
+	r.y.cmov(&a.y, flag)
+	r.z.cmov(&a.z, flag)
+}
+
+//r = a if flag == 1,constant time
+func (r *geVal) cmov(a *geVal, flag uint64) {
+	r.x.cmov(&a.x, flag)
+	r.y.cmov(&a.y, flag)
+}
+
+//batch convert to affine,one inverse for all
+func batchToAffine(ps []gejVal) []geVal {
+	out := make([]geVal, len(ps))
+	acc := make([]fieldVal, len(ps))
+	var z fieldVal
+	z.setInt(1)
+	for i := range ps {
+		acc[i] = z
+		if !ps[i].inf {
+			z.mul(&z, &ps[i].z)
+		}
+	}
+	var zi, zi2, zi3, t fieldVal
+	zi.inverse(&z)
+	for i := len(ps) - 1; i >= 0; i-- {
+		if ps[i].inf {
+			out[i].inf = true
+			continue
+		}
+		t.mul(&zi, &acc[i])
+		zi.mul(&zi, &ps[i].z)
+		zi2.sqr(&t)
+		zi3.mul(&zi2, &t)
+		out[i].x.mul(&ps[i].x, &zi2).normalize()
+		out[i].y.mul(&ps[i].y, &zi3).normalize()
+	}
+	return out
+}
+
+const (
+	//4 bits windows for base mult
+	genBits = 4
+	genRows = 256 / genBits
+	genCols = 1 << genBits
+	//wnaf window for variable point and generator
+	wnafWindowA = 5
+	wnafWindowG = 8
+	wnafLen     = 130
+)
+
+var (
+	genOnce  sync.Once
+	genTable [genRows][genCols]geVal
+	//start point for variable base mult and -2^256 times it
+	genBlind   geVal
+	genUnblind geVal
+	//odd multiples of G and lambda*G
+	genWnaf    []geVal
+	genWnafLam []geVal
+)
+
+//nothing up my sleeve blinding point,x = sha256(tag) incremented until on curve
+func genBlindPoint() geVal {
+	h := sha256.Sum256([]byte("secp256k1 base mult blinding"))
+	var p geVal
+	var x fieldVal
+	for {
+		if x.setBytes(&h) && p.setXO(&x, false) {
+			return p
+		}
+		h = sha256.Sum256(h[:])
+	}
+}
+
+//row j holds i*16^j*G + U,last row offset -63*U so offsets sum to zero
+func initGenTable() {
+	u := genBlindPoint()
+	genBlind = u
+	var ub gejVal
+	ub.setGe(&u)
+	for i := 0; i < 256; i++ {
+		ub.double(&ub)
+	}
+	genUnblind = ub.toAffine()
+	genUnblind.neg(&genUnblind)
+	var uj, nu gejVal
+	uj.setGe(&u)
+	//nu = -(rows-1)*U
+	nu.setInfinity()
+	for i := 0; i < genRows-1; i++ {
+		nu.addGeVar(&nu, &u)
+	}
+	nua := nu.toAffine()
+	nua.neg(&nua)
+	nu.setGe(&nua)
+
+	pts := make([]gejVal, 0, genRows*genCols)
+	var base gejVal
+	base.setGe(&geG)
+	for j := 0; j < genRows; j++ {
+		off := uj
+		if j == genRows-1 {
+			off = nu
+		}
+		var cur gejVal
+		cur = off
+		pts = append(pts, cur)
+		for i := 1; i < genCols; i++ {
+			cur.addVar(&cur, &base)
+			pts = append(pts, cur)
+		}
+		//base = 16^(j+1)*G
+		for i := 0; i < genBits; i++ {
+			base.double(&base)
+		}
+	}
+	aff := batchToAffine(pts)
+	for j := 0; j < genRows; j++ {
+		copy(genTable[j][:], aff[j*genCols:(j+1)*genCols])
+	}
+	genWnaf = oddMultiples(&geG, wnafWindowG)
+	genWnafLam = make([]geVal, len(genWnaf))
+	for i := range genWnaf {
+		genWnafLam[i] = genWnaf[i]
+		genWnafLam[i].x.mul(&genWnaf[i].x, &fieldBeta).normalize()
+	}
+}
+
+//r = k*G,constant time
+func ecmultGen(k *scalarVal) gejVal {
+	genOnce.Do(initGenTable)
+	var r gejVal
+	var p geVal
+	r.setInfinity()
+	for j := 0; j < genRows; j++ {
+		w := k.getBits(uint(j*genBits), genBits)
+		for i := 0; i < genCols; i++ {
+			p.cmov(&genTable[j][i], ctEq64(uint64(i), w))
+		}
+		r.addGe(&r, &p)
+	}
+	return r
+}
+
+//r = k*a,4 bits fixed window from blinding start,constant time in k
+func ecmultConst(a *geVal, k *scalarVal) gejVal {
+	genOnce.Do(initGenTable)
+	var r gejVal
+	if a.inf {
+		return *r.setInfinity()
+	}
+	//1..15 multiples of a,slot 0 unused
+	pts := make([]gejVal, genCols)
+	pts[1].setGe(a)
+	for i := 2; i < genCols; i++ {
+		pts[i].addGeVar(&pts[i-1], a)
+	}
+	pts[0] = pts[1]
+	tab := batchToAffine(pts)
+	var t gejVal
+	var p geVal
+	r.setGe(&genBlind)
+	for j := genRows - 1; j >= 0; j-- {
+		for i := 0; i < genBits; i++ {
+			r.double(&r)
+		}
+		w := k.getBits(uint(j*genBits), genBits)
+		p = tab[1]
+		for i := 2; i < genCols; i++ {
+			p.cmov(&tab[i], ctEq64(uint64(i), w))
+		}
+		//add always,keep sum if window not zero
+		t.addGe(&r, &p)
+		nz := ctEq64(w, 0) ^ 1
+		r.cmov(&t, nz)
+		rinf, tinf := uint64(0), uint64(0)
+		if r.inf {
+			rinf = 1
+		}
+		if t.inf {
+			tinf = 1
+		}
+		r.inf = (rinf&(nz^1))|(tinf&nz) == 1
+	}
+	r.addGe(&r, &genUnblind)
+	return r
+}
+
+//P,3P,5P ... (2^(w-1)-1)P in affine
+func oddMultiples(p *geVal, w uint) []geVal {
+	n := 1 << (w - 2)
+	pts := make([]gejVal, n)
+	var d gejVal
+	pts[0].setGe(p)
+	d.double(&pts[0])
+	for i := 1; i < n; i++ {
+		pts[i].addVar(&pts[i-1], &d)
+	}
+	return batchToAffine(pts)
+}
+
+//window non adjacent form of s,s < 2^129,variable time
+func (s *scalarVal) wnaf(w uint) [wnafLen]int {
+	var out [wnafLen]int
+	carry := uint64(0)
+	for bit := uint(0); bit < wnafLen; {
+		if s.getBits(bit, 1) == carry {
+			bit++
+			continue
+		}
+		now := w
+		if now > wnafLen-bit {
+			now = wnafLen - bit
+		}
+		word := s.getBits(bit, now) + carry
+		carry = (word >> (w - 1)) & 1
+		out[bit] = int(word) - int(carry<<w)
+		bit += now
+	}
+	return out
+}
+
+//split by lambda,make both parts positive,return neg flags
+func splitPositive(k *scalarVal) (k1, k2 scalarVal, n1, n2 bool) {
+	k1, k2 = k.splitLambda()
+	if n1 = k1.isHigh(); n1 {
+		k1.negate(&k1)
+	}
+	if n2 = k2.isHigh(); n2 {
+		k2.negate(&k2)
+	}
+	return
+}
+
+//add wnaf digit from odd multiples table
+func addWnafDigit(r *gejVal, tab []geVal, d int, neg bool) {
+	if d == 0 {
+		return
+	}
+	var p geVal
+	if d > 0 {
+		p = tab[(d-1)/2]
+	} else {
+		p.neg(&tab[(-d-1)/2])
+	}
+	if neg {
+		p.neg(&p)
+	}
+	r.addGeVar(r, &p)
+}
+
+//split and wnaf for one point in strauss-shamir
+type wnafPoint struct {
+	tab, tabLam []geVal
+	w1, w2      [wnafLen]int
+	n1, n2      bool
+}
+
+func newWnafPoint(a *geVal, k *scalarVal) *wnafPoint {
+	k1, k2, n1, n2 := splitPositive(k)
+	wp := &wnafPoint{n1: n1, n2: n2}
+	wp.w1, wp.w2 = k1.wnaf(wnafWindowA), k2.wnaf(wnafWindowA)
+	wp.tab = oddMultiples(a, wnafWindowA)
+	wp.tabLam = make([]geVal, len(wp.tab))
+	for i := range wp.tab {
+		wp.tabLam[i] = wp.tab[i]
+		wp.tabLam[i].x.mul(&wp.tab[i].x, &fieldBeta).normalize()
+	}
+	return wp
+}
+
+//r = na*a + ng*G,strauss-shamir with glv,variable time for public inputs only
+func ecmult(a *geVal, na, ng *scalarVal) gejVal {
+	if a == nil {
+		return ecmultMulti(nil, nil, ng)
+	}
+	return ecmultMulti([]geVal{*a}, []scalarVal{*na}, ng)
+}
+
+//r = sum(ks[i]*ps[i]) + ng*G,one shared doubling chain,variable time
+func ecmultMulti(ps []geVal, ks []scalarVal, ng *scalarVal) gejVal {
+	genOnce.Do(initGenTable)
+	var r gejVal
+	r.setInfinity()
+	wps := make([]*wnafPoint, 0, len(ps))
+	for i := range ps {
+		if ps[i].inf || ks[i].isZero() {
+			continue
+		}
+		wps = append(wps, newWnafPoint(&ps[i], &ks[i]))
+	}
+	var wg1, wg2 [wnafLen]int
+	var gn1, gn2 bool
+	useG := ng != nil && !ng.isZero()
+	if useG {
+		g1, g2, n1, n2 := splitPositive(ng)
+		gn1, gn2 = n1, n2
+		wg1, wg2 = g1.wnaf(wnafWindowG), g2.wnaf(wnafWindowG)
+	}
+	for i := wnafLen - 1; i >= 0; i-- {
+		r.double(&r)
+		for _, wp := range wps {
+			addWnafDigit(&r, wp.tab, wp.w1[i], wp.n1)
+			addWnafDigit(&r, wp.tabLam, wp.w2[i], wp.n2)
+		}
+		if useG {
+			addWnafDigit(&r, genWnaf, wg1[i], gn1)
+			addWnafDigit(&r, genWnafLam, wg2[i], gn2)
+		}
+	}
+	return r
+}
+
+//verify ecdsa signature r,s for message scalar e and pubkey q
+func ecdsaVerify(q *geVal, e, sr, ss *scalarVal) bool {
+	if sr.isZero() || ss.isZero() || !q.isValid() {
+		return false
+	}
+	var w, u1, u2 scalarVal
+	w.inverse(ss)
+	u1.mul(e, &w)
+	u2.mul(sr, &w)
+	p := ecmult(q, &u2, &u1)
+	if p.inf {
+		return false
+	}
+	//x/z^2 mod n == r,compare in jacobian,x may be r or r+n
+	var xr, z2 fieldVal
+	rb := sr.bytes()
+	xr.setBytes(&rb)
+	z2.sqr(&p.z)
+	xr.mul(&xr, &z2)
+	if xr.equal(&p.x) {
+		return true
+	}
+	//r + n < p
+	var rn scalarVal
+	var c uint64
+	rn.d = sr.d
+	rn.d[0], c = bits.Add64(rn.d[0], scalarN[0], 0)
+	rn.d[1], c = bits.Add64(rn.d[1], scalarN[1], c)
+	rn.d[2], c = bits.Add64(rn.d[2], scalarN[2], c)
+	rn.d[3], c = bits.Add64(rn.d[3], scalarN[3], c)
+	if c != 0 {
+		return false
+	}
+	rb = rn.bytes()
+	if !xr.setBytes(&rb) {
+		return false
+	}
+	xr.mul(&xr, &z2)
+	return xr.equal(&p.x)
+}
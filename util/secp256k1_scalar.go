@@ -0,0 +1,247 @@
+package util
+
+import (
+	"math/bits"
+)
+
+//scalar mod n,4x64 limbs little endian,always < n
+type scalarVal struct {
+	d [4]uint64
+}
+
+var (
+	//curve order n
+	scalarN = [4]uint64{0xBFD25E8CD0364141, 0xBAAEDCE6AF48A03B, 0xFFFFFFFFFFFFFFFE, 0xFFFFFFFFFFFFFFFF}
+	//2^256 - n
+	scalarNC = [4]uint64{0x402DA1732FC9BEBF, 0x4551231950B75FC4, 0x1, 0x0}
+	//n / 2
+	scalarNH = [4]uint64{0xDFE92F46681B20A0, 0x5D576E7357A4501D, 0xFFFFFFFFFFFFFFFF, 0x7FFFFFFFFFFFFFFF}
+)
+
+//return 1 if a >= b else 0,constant time
+func ctGe256(a, b *[4]uint64) uint64 {
+	var borrow uint64
+	_, borrow = bits.Sub64(a[0], b[0], 0)
+	_, borrow = bits.Sub64(a[1], b[1], borrow)
+	_, borrow = bits.Sub64(a[2], b[2], borrow)
+	_, borrow = bits.Sub64(a[3], b[3], borrow)
+	return borrow ^ 1
+}
+
+//r = r + flag*(2^256-n) mod 2^256,equal sub n when r >= n
+func (s *scalarVal) reduce(flag uint64) {
+	var c uint64
+	mask := -flag
+	s.d[0], c = bits.Add64(s.d[0], scalarNC[0]&mask, 0)
+	s.d[1], c = bits.Add64(s.d[1], scalarNC[1]&mask, c)
+	s.d[2], c = bits.Add64(s.d[2], scalarNC[2]&mask, c)
+	s.d[3], _ = bits.Add64(s.d[3], scalarNC[3]&mask, c)
+}
+
+func (s *scalarVal) setInt(v uint64) *scalarVal {
+	s.d = [4]uint64{v, 0, 0, 0}
+	return s
+}
+
+//set big endian 32 bytes,reduce mod n,return true if value >= n
+func (s *scalarVal) setBytes(b *[32]byte) bool {
+	for i := 0; i < 4; i++ {
+		s.d[i] = uint64(b[31-8*i]) | uint64(b[30-8*i])<<8 | uint64(b[29-8*i])<<16 | uint64(b[28-8*i])<<24 |
+			uint64(b[27-8*i])<<32 | uint64(b[26-8*i])<<40 | uint64(b[25-8*i])<<48 | uint64(b[24-8*i])<<56
+	}
+	overflow := ctGe256(&s.d, &scalarN)
+	s.reduce(overflow)
+	return overflow == 1
+}
+
+//set big endian bytes any length,bytes beyond 32 must be zero or value reduced
+func (s *scalarVal) setSlice(b []byte) bool {
+	var buf [32]byte
+	if len(b) > 32 {
+		b = b[len(b)-32:]
+	}
+	copy(buf[32-len(b):], b)
+	return s.setBytes(&buf)
+}
+
+//big endian 32 bytes
+func (s *scalarVal) bytes() [32]byte {
+	var b [32]byte
+	for i := 0; i < 4; i++ {
+		for j := 0; j < 8; j++ {
+			b[31-8*i-j] = byte(s.d[i] >> (8 * j))
+		}
+	}
+	return b
+}
+
+func (s *scalarVal) isZero() bool {
+	return (s.d[0] | s.d[1] | s.d[2] | s.d[3]) == 0
+}
+
+//s > n/2
+func (s *scalarVal) isHigh() bool {
+	return ctGe256(&scalarNH, &s.d) == 0
+}
+
+func (s *scalarVal) equal(a *scalarVal) bool {
+	return ((s.d[0] ^ a.d[0]) | (s.d[1] ^ a.d[1]) | (s.d[2] ^ a.d[2]) | (s.d[3] ^ a.d[3])) == 0
+}
+
+//s = a + b mod n
+func (s *scalarVal) add(a, b *scalarVal) *scalarVal {
+	var c uint64
+	s.d[0], c = bits.Add64(a.d[0], b.d[0], 0)
+	s.d[1], c = bits.Add64(a.d[1], b.d[1], c)
+	s.d[2], c = bits.Add64(a.d[2], b.d[2], c)
+	s.d[3], c = bits.Add64(a.d[3], b.d[3], c)
+	s.reduce(c | ctGe256(&s.d, &scalarN))
+	return s
+}
+
+//s = -a mod n
+func (s *scalarVal) negate(a *scalarVal) *scalarVal {
+	var b uint64
+	mask := -(((a.d[0] | a.d[1] | a.d[2] | a.d[3]) | -(a.d[0] | a.d[1] | a.d[2] | a.d[3])) >> 63)
+	s.d[0], b = bits.Sub64(scalarN[0], a.d[0], 0)
+	s.d[1], b = bits.Sub64(scalarN[1], a.d[1], b)
+	s.d[2], b = bits.Sub64(scalarN[2], a.d[2], b)
+	s.d[3], _ = bits.Sub64(scalarN[3], a.d[3], b)
+	s.d[0] &= mask
+	s.d[1] &= mask
+	s.d[2] &= mask
+	s.d[3] &= mask
+	return s
+}
+
+//s = a if flag == 1,constant time
+func (s *scalarVal) cmov(a *scalarVal, flag uint64) {
+	mask := -flag
+	for i := range s.d {
+		s.d[i] ^= (s.d[i] ^ a.d[i]) & mask
+	}
+}
+
+//512 bits product
+func mul256(a, b *[4]uint64) [8]uint64 {
+	var l [8]uint64
+	for i := 0; i < 4; i++ {
+		var c uint64
+		for j := 0; j < 4; j++ {
+			hi, lo := bits.Mul64(a[i], b[j])
+			var cc uint64
+			lo, cc = bits.Add64(lo, l[i+j], 0)
+			hi += cc
+			lo, cc = bits.Add64(lo, c, 0)
+			hi += cc
+			l[i+j] = lo
+			c = hi
+		}
+		l[i+4] = c
+	}
+	return l
+}
+
+//fold high 256 bits,l = lo + hi*(2^256-n)
+func foldScalar(l *[8]uint64) {
+	hi := [4]uint64{l[4], l[5], l[6], l[7]}
+	p := mul256(&hi, &scalarNC)
+	var c uint64
+	l[0], c = bits.Add64(l[0], p[0], 0)
+	l[1], c = bits.Add64(l[1], p[1], c)
+	l[2], c = bits.Add64(l[2], p[2], c)
+	l[3], c = bits.Add64(l[3], p[3], c)
+	l[4], c = bits.Add64(p[4], 0, c)
+	l[5], c = bits.Add64(p[5], 0, c)
+	l[6], c = bits.Add64(p[6], 0, c)
+	l[7], _ = bits.Add64(p[7], 0, c)
+}
+
+//reduce 512 bits value mod n,fixed rounds
+func (s *scalarVal) reduce512(l [8]uint64) *scalarVal {
+	//512 -> 386 -> 260 -> 257 -> 256 bits
+	for i := 0; i < 5; i++ {
+		foldScalar(&l)
+	}
+	s.d = [4]uint64{l[0], l[1], l[2], l[3]}
+	s.reduce(ctGe256(&s.d, &scalarN))
+	return s
+}
+
+//s = a * b mod n
+func (s *scalarVal) mul(a, b *scalarVal) *scalarVal {
+	return s.reduce512(mul256(&a.d, &b.d))
+}
+
+func (s *scalarVal) sqr(a *scalarVal) *scalarVal {
+	return s.mul(a, a)
+}
+
+//s = a^(n-2) mod n,4 bits fixed window,constant time
+func (s *scalarVal) inverse(a *scalarVal) *scalarVal {
+	var tab [16]scalarVal
+	tab[0].setInt(1)
+	tab[1] = *a
+	for i := 2; i < 16; i++ {
+		tab[i].mul(&tab[i-1], a)
+	}
+	//n - 2
+	e := [4]uint64{scalarN[0] - 2, scalarN[1], scalarN[2], scalarN[3]}
+	var r, t scalarVal
+	r.setInt(1)
+	for i := 63; i >= 0; i-- {
+		for j := 0; j < 4; j++ {
+			r.sqr(&r)
+		}
+		w := (e[i/16] >> (4 * uint(i%16))) & 15
+		for j := range tab {
+			t.cmov(&tab[j], ctEq64(uint64(j), w))
+		}
+		r.mul(&r, &t)
+	}
+	*s = r
+	return s
+}
+
+//count bits at offset,count <= 32
+func (s *scalarVal) getBits(offset, count uint) uint64 {
+	lo := s.d[offset>>6] >> (offset & 63)
+	if (offset&63)+count > 64 && offset>>6 < 3 {
+		lo |= s.d[(offset>>6)+1] << (64 - (offset & 63))
+	}
+	return lo & ((1 << count) - 1)
+}
+
+//round(a * b / 2^384),b constant
+func mulShift384(a, b *[4]uint64) [4]uint64 {
+	l := mul256(a, b)
+	r := [4]uint64{l[6], l[7], 0, 0}
+	//round by bit 383
+	var c uint64
+	r[0], c = bits.Add64(r[0], (l[5]>>63)&1, 0)
+	r[1], _ = bits.Add64(r[1], 0, c)
+	return r
+}
+
+var (
+	//cube root of unity mod n
+	scalarLambda  = scalarVal{[4]uint64{0xDF02967C1B23BD72, 0x122E22EA20816678, 0xA5261C028812645A, 0x5363AD4CC05C30E0}}
+	scalarMinusB1 = scalarVal{[4]uint64{0x6F547FA90ABFE4C3, 0xE4437ED6010E8828, 0x0, 0x0}}
+	scalarMinusB2 = scalarVal{[4]uint64{0xD765CDA83DB1562C, 0x8A280AC50774346D, 0xFFFFFFFFFFFFFFFE, 0xFFFFFFFFFFFFFFFF}}
+	scalarG1      = [4]uint64{0xE893209A45DBB031, 0x3DAA8A1471E8CA7F, 0xE86C90E49284EB15, 0x3086D221A7D46BCD}
+	scalarG2      = [4]uint64{0x1571B4AE8AC47F71, 0x221208AC9DF506C6, 0x6F547FA90ABFE4C4, 0xE4437ED6010E8828}
+)
+
+//split k = r1 + r2*lambda mod n,r1 and r2 in (-2^128,2^128)
+func (s *scalarVal) splitLambda() (r1, r2 scalarVal) {
+	var c1, c2 scalarVal
+	c1.d = mulShift384(&s.d, &scalarG1)
+	c2.d = mulShift384(&s.d, &scalarG2)
+	c1.mul(&c1, &scalarMinusB1)
+	c2.mul(&c2, &scalarMinusB2)
+	r2.add(&c1, &c2)
+	r1.mul(&r2, &scalarLambda)
+	r1.negate(&r1)
+	r1.add(&r1, s)
+	return
+}
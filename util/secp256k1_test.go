@@ -29,6 +29,10 @@
 package util
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
 	"fmt"
 	"math/big"
 	"testing"
@@ -101,3 +105,557 @@ func BenchmarkBaseMult(b *testing.B) {
 		s256.ScalarBaseMult(k.Bytes())
 	}
 }
+
+//math/big jacobian curve,reference for native arithmetic
+type bigCurve struct {
+	elliptic.CurveParams
+}
+
+var (
+	refCurve = &bigCurve{*SECP256K1().Params()}
+	three    = new(big.Int).SetUint64(3)
+)
+
+func (curve *bigCurve) Params() *elliptic.CurveParams {
+	return &curve.CurveParams
+}
+
+func (curve *bigCurve) IsOnCurve(x, y *big.Int) bool {
+	var y2, x3 big.Int
+
+	y2.Mul(y, y)
+	y2.Mod(&y2, curve.P)
+
+	x3.Mul(x, x)
+	x3.Mul(&x3, x)
+	x3.Add(&x3, curve.B)
+	x3.Mod(&x3, curve.P)
+
+	return x3.Cmp(&y2) == 0
+}
+
+func (curve *bigCurve) Double(x1, y1 *big.Int) (*big.Int, *big.Int) {
+	z1 := zForAffine(x1, y1)
+	return curve.affineFromJacobian(curve.doubleJacobian(x1, y1, z1))
+}
+
+// zForAffine returns a Jacobian Z value for the affine point (x, y). If x and
+// y are zero, it assumes that they represent the point at infinity because (0,
+// 0) is not on the any of the curves handled here.
+func zForAffine(x, y *big.Int) *big.Int {
+	z := new(big.Int)
+	if x.Sign() != 0 || y.Sign() != 0 {
+		z.SetInt64(1)
+	}
+	return z
+}
+
+// affineFromJacobian reverses the Jacobian transform. See the comment at the
+// top of the file. If the point is ∞ it returns 0, 0.
+func (curve *bigCurve) affineFromJacobian(x, y, z *big.Int) (xOut, yOut *big.Int) {
+	if z.Sign() == 0 {
+		return new(big.Int), new(big.Int)
+	}
+
+	zinv := new(big.Int).ModInverse(z, curve.P)
+	zinvsq := new(big.Int).Mul(zinv, zinv)
+
+	xOut = new(big.Int).Mul(x, zinvsq)
+	xOut.Mod(xOut, curve.P)
+	zinvsq.Mul(zinvsq, zinv)
+	yOut = new(big.Int).Mul(y, zinvsq)
+	yOut.Mod(yOut, curve.P)
+	return
+}
+
+func (curve *bigCurve) Add(x1, y1, x2, y2 *big.Int) (*big.Int, *big.Int) {
+	z1 := zForAffine(x1, y1)
+	z2 := zForAffine(x2, y2)
+	return curve.affineFromJacobian(curve.addJacobian(x1, y1, z1, x2, y2, z2))
+}
+
+// addJacobian takes two points in Jacobian coordinates, (x1, y1, z1) and
+// (x2, y2, z2) and returns their sum, also in Jacobian form.
+func (curve *bigCurve) addJacobian(x1, y1, z1, x2, y2, z2 *big.Int) (*big.Int, *big.Int, *big.Int) {
+	// See http://hyperelliptic.org/EFD/g1p/auto-shortw-jacobian-0.html#addition-add-2007-bl
+	x3, y3, z3 := new(big.Int), new(big.Int), new(big.Int)
+	if z1.Sign() == 0 {
+		x3.Set(x2)
+		y3.Set(y2)
+		z3.Set(z2)
+		return x3, y3, z3
+	}
+	if z2.Sign() == 0 {
+		x3.Set(x1)
+		y3.Set(y1)
+		z3.Set(z1)
+		return x3, y3, z3
+	}
+
+	z1z1 := new(big.Int).Mul(z1, z1)
+	z1z1.Mod(z1z1, curve.P)
+	z2z2 := new(big.Int).Mul(z2, z2)
+	z2z2.Mod(z2z2, curve.P)
+
+	u1 := new(big.Int).Mul(x1, z2z2)
+	u1.Mod(u1, curve.P)
+	u2 := new(big.Int).Mul(x2, z1z1)
+	u2.Mod(u2, curve.P)
+	h := new(big.Int).Sub(u2, u1)
+	xEqual := h.Sign() == 0
+	if h.Sign() == -1 {
+		h.Add(h, curve.P)
+	}
+	i := new(big.Int).Lsh(h, 1)
+	i.Mul(i, i)
+	j := new(big.Int).Mul(h, i)
+
+	s1 := new(big.Int).Mul(y1, z2)
+	s1.Mul(s1, z2z2)
+	s1.Mod(s1, curve.P)
+	s2 := new(big.Int).Mul(y2, z1)
+	s2.Mul(s2, z1z1)
+	s2.Mod(s2, curve.P)
+	r := new(big.Int).Sub(s2, s1)
+	if r.Sign() == -1 {
+		r.Add(r, curve.P)
+	}
+	yEqual := r.Sign() == 0
+	if xEqual && yEqual {
+		return curve.doubleJacobian(x1, y1, z1)
+	}
+	r.Lsh(r, 1)
+	v := new(big.Int).Mul(u1, i)
+
+	x3.Set(r)
+	x3.Mul(x3, x3)
+	x3.Sub(x3, j)
+	x3.Sub(x3, v)
+	x3.Sub(x3, v)
+	x3.Mod(x3, curve.P)
+
+	y3.Set(r)
+	v.Sub(v, x3)
+	y3.Mul(y3, v)
+	s1.Mul(s1, j)
+	s1.Lsh(s1, 1)
+	y3.Sub(y3, s1)
+	y3.Mod(y3, curve.P)
+
+	z3.Add(z1, z2)
+	z3.Mul(z3, z3)
+	z3.Sub(z3, z1z1)
+	z3.Sub(z3, z2z2)
+	z3.Mul(z3, h)
+	z3.Mod(z3, curve.P)
+
+	return x3, y3, z3
+}
+
+// doubleJacobian takes a point in Jacobian coordinates, (x, y, z), and
+// returns its double, also in Jacobian form.
+func (curve *bigCurve) doubleJacobian(x, y, z *big.Int) (*big.Int, *big.Int, *big.Int) {
+	// See http://hyperelliptic.org/EFD/g1p/auto-shortw-jacobian-0.html#doubling-dbl-2009-l
+	var a, b, c, d, e, f, x3, y3, z3 big.Int
+
+	a.Mul(x, x)
+	a.Mod(&a, curve.P)
+	b.Mul(y, y)
+	b.Mod(&b, curve.P)
+	c.Mul(&b, &b)
+	c.Mod(&c, curve.P)
+
+	d.Add(x, &b)
+	d.Mul(&d, &d)
+	d.Sub(&d, &a)
+	d.Sub(&d, &c)
+	d.Lsh(&d, 1)
+	if d.Sign() < 0 {
+		d.Add(&d, curve.P)
+	} else {
+		d.Mod(&d, curve.P)
+	}
+
+	e.Mul(three, &a)
+	e.Mod(&e, curve.P)
+	f.Mul(&e, &e)
+	f.Mod(&f, curve.P)
+
+	x3.Lsh(&d, 1)
+	x3.Sub(&f, &x3)
+	if x3.Sign() < 0 {
+		x3.Add(&x3, curve.P)
+	} else {
+		x3.Mod(&x3, curve.P)
+	}
+
+	y3.Sub(&d, &x3)
+	y3.Mul(&e, &y3)
+	c.Lsh(&c, 3)
+	y3.Sub(&y3, &c)
+	if y3.Sign() < 0 {
+		y3.Add(&y3, curve.P)
+	} else {
+		y3.Mod(&y3, curve.P)
+	}
+
+	z3.Mul(y, z)
+	z3.Lsh(&z3, 1)
+	z3.Mod(&z3, curve.P)
+
+	return &x3, &y3, &z3
+}
+
+func (curve *bigCurve) ScalarMult(Bx, By *big.Int, k []byte) (*big.Int, *big.Int) {
+	Bz := new(big.Int).SetInt64(1)
+	x, y, z := new(big.Int), new(big.Int), new(big.Int)
+
+	for _, byte := range k {
+		for bitNum := 0; bitNum < 8; bitNum++ {
+			x, y, z = curve.doubleJacobian(x, y, z)
+			if byte&0x80 == 0x80 {
+				x, y, z = curve.addJacobian(Bx, By, Bz, x, y, z)
+			}
+			byte <<= 1
+		}
+	}
+
+	return curve.affineFromJacobian(x, y, z)
+}
+
+func (curve *bigCurve) ScalarBaseMult(k []byte) (*big.Int, *big.Int) {
+	return curve.ScalarMult(curve.Gx, curve.Gy, k)
+}
+
+func testRandBig(t testing.TB, m *big.Int) *big.Int {
+	v, err := rand.Int(rand.Reader, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func testFieldBig(f fieldVal) *big.Int {
+	b := f.normalize().bytes()
+	return new(big.Int).SetBytes(b[:])
+}
+
+func testScalarBig(s scalarVal) *big.Int {
+	b := s.bytes()
+	return new(big.Int).SetBytes(b[:])
+}
+
+func TestFieldArith(t *testing.T) {
+	p := SECP256K1().Params().P
+	for i := 0; i < 200; i++ {
+		x, y := testRandBig(t, p), testRandBig(t, p)
+		fx, _ := fieldFromBig(x)
+		fy, _ := fieldFromBig(y)
+		var r, n fieldVal
+		r.mul(&fx, &fy)
+		want := new(big.Int).Mul(x, y)
+		if testFieldBig(r).Cmp(want.Mod(want, p)) != 0 {
+			t.Fatalf("mul %x %x", x, y)
+		}
+		//add and negate with magnitude
+		r.set(&fx).add(&fy).add(n.negate(&fy, 1))
+		if testFieldBig(r).Cmp(x) != 0 {
+			t.Fatalf("add negate %x %x", x, y)
+		}
+		r.inverse(&fx)
+		if testFieldBig(r).Cmp(new(big.Int).ModInverse(x, p)) != 0 {
+			t.Fatalf("inverse %x", x)
+		}
+		ok := r.sqrt(&fx)
+		want = new(big.Int).ModSqrt(x, p)
+		if ok != (want != nil) {
+			t.Fatalf("sqrt %x", x)
+		}
+		if ok {
+			r.sqr(&r)
+			if !r.equal(&fx) {
+				t.Fatalf("sqrt %x", x)
+			}
+		}
+	}
+	//p and above rejected
+	if _, ok := fieldFromBig(p); ok {
+		t.Errorf("p as field element")
+	}
+	pm := new(big.Int).Sub(p, big.NewInt(1))
+	fp, ok := fieldFromBig(pm)
+	var one fieldVal
+	one.setInt(1)
+	fp.add(&one)
+	if !ok || !fp.normalize().isZero() {
+		t.Errorf("p-1 + 1 != 0")
+	}
+}
+
+func TestScalarArith(t *testing.T) {
+	n := SECP256K1().Params().N
+	lambda := testScalarBig(scalarLambda)
+	limit := new(big.Int).Lsh(big.NewInt(1), 128)
+	for i := 0; i < 200; i++ {
+		x, y := testRandBig(t, n), testRandBig(t, n)
+		sx, sy := scalarFromBytes(x.Bytes()), scalarFromBytes(y.Bytes())
+		var r scalarVal
+		r.mul(&sx, &sy)
+		want := new(big.Int).Mul(x, y)
+		if testScalarBig(r).Cmp(want.Mod(want, n)) != 0 {
+			t.Fatalf("mul %x %x", x, y)
+		}
+		r.add(&sx, &sy)
+		want = new(big.Int).Add(x, y)
+		if testScalarBig(r).Cmp(want.Mod(want, n)) != 0 {
+			t.Fatalf("add %x %x", x, y)
+		}
+		r.inverse(&sx)
+		if testScalarBig(r).Cmp(new(big.Int).ModInverse(x, n)) != 0 {
+			t.Fatalf("inverse %x", x)
+		}
+		k1, k2, _, _ := splitPositive(&sx)
+		if testScalarBig(k1).Cmp(limit) >= 0 || testScalarBig(k2).Cmp(limit) >= 0 {
+			t.Fatalf("split %x too large", x)
+		}
+		r1, r2 := sx.splitLambda()
+		want = new(big.Int).Mul(testScalarBig(r2), lambda)
+		want.Add(want, testScalarBig(r1))
+		if want.Mod(want, n).Cmp(x) != 0 {
+			t.Fatalf("split %x", x)
+		}
+	}
+	//n reduced to zero
+	s := scalarFromBytes(n.Bytes())
+	if !s.isZero() {
+		t.Errorf("n mod n != 0")
+	}
+}
+
+func TestScalarMultRef(t *testing.T) {
+	s256 := SECP256K1()
+	n := s256.Params().N
+	for i := 0; i < 50; i++ {
+		k := testRandBig(t, n)
+		x, y := s256.ScalarBaseMult(k.Bytes())
+		rx, ry := refCurve.ScalarBaseMult(k.Bytes())
+		if x.Cmp(rx) != 0 || y.Cmp(ry) != 0 {
+			t.Fatalf("base mult %x", k)
+		}
+		if !s256.IsOnCurve(x, y) {
+			t.Fatalf("base mult %x not on curve", k)
+		}
+		m := testRandBig(t, n)
+		mx, my := s256.ScalarMult(x, y, m.Bytes())
+		rx, ry = refCurve.ScalarMult(x, y, m.Bytes())
+		if mx.Cmp(rx) != 0 || my.Cmp(ry) != 0 {
+			t.Fatalf("mult %x", m)
+		}
+		ax, ay := s256.Add(x, y, mx, my)
+		rx, ry = refCurve.Add(x, y, mx, my)
+		if ax.Cmp(rx) != 0 || ay.Cmp(ry) != 0 {
+			t.Fatalf("add %x %x", k, m)
+		}
+		dx, dy := s256.Double(x, y)
+		rx, ry = refCurve.Double(x, y)
+		if dx.Cmp(rx) != 0 || dy.Cmp(ry) != 0 {
+			t.Fatalf("double %x", k)
+		}
+	}
+}
+
+func TestScalarMultEdge(t *testing.T) {
+	s256 := SECP256K1()
+	params := s256.Params()
+	n := params.N
+	//0 and n give infinity
+	for _, k := range [][]byte{{}, {0}, n.Bytes()} {
+		x, y := s256.ScalarBaseMult(k)
+		if x.Sign() != 0 || y.Sign() != 0 {
+			t.Errorf("base mult %x not infinity", k)
+		}
+	}
+	//n-1 give -G
+	nm := new(big.Int).Sub(n, big.NewInt(1))
+	x, y := s256.ScalarBaseMult(nm.Bytes())
+	if x.Cmp(params.Gx) != 0 || new(big.Int).Add(y, params.Gy).Cmp(params.P) != 0 {
+		t.Errorf("base mult n-1 != -G")
+	}
+	//P + P and P + -P
+	x, y = s256.Add(params.Gx, params.Gy, params.Gx, params.Gy)
+	dx, dy := s256.Double(params.Gx, params.Gy)
+	if x.Cmp(dx) != 0 || y.Cmp(dy) != 0 {
+		t.Errorf("G + G != 2G")
+	}
+	ny := new(big.Int).Sub(params.P, params.Gy)
+	x, y = s256.Add(params.Gx, params.Gy, params.Gx, ny)
+	if x.Sign() != 0 || y.Sign() != 0 {
+		t.Errorf("G - G != infinity")
+	}
+	//more than 32 bytes scalar reduced mod n
+	k := new(big.Int).Add(n, big.NewInt(2))
+	k.Lsh(k, 8)
+	x, y = s256.ScalarBaseMult(k.Bytes())
+	rx, ry := refCurve.ScalarBaseMult(k.Bytes())
+	if x.Cmp(rx) != 0 || y.Cmp(ry) != 0 {
+		t.Errorf("base mult long scalar")
+	}
+	if s256.IsOnCurve(params.P, params.Gy) {
+		t.Errorf("x >= p on curve")
+	}
+	//constant time variable base mult edges and zero windows
+	px, py := s256.ScalarBaseMult([]byte{7})
+	for _, k := range [][]byte{{}, {0}, n.Bytes()} {
+		x, y := s256.ScalarMult(px, py, k)
+		if x.Sign() != 0 || y.Sign() != 0 {
+			t.Errorf("mult %x not infinity", k)
+		}
+	}
+	for _, k := range []*big.Int{big.NewInt(1), big.NewInt(2), big.NewInt(15), big.NewInt(16), big.NewInt(0x1000), nm} {
+		x, y := s256.ScalarMult(px, py, k.Bytes())
+		rx, ry := refCurve.ScalarMult(px, py, k.Bytes())
+		if x.Cmp(rx) != 0 || y.Cmp(ry) != 0 {
+			t.Errorf("mult %x", k)
+		}
+	}
+}
+
+func TestScalarMultConst(t *testing.T) {
+	initonce.Do(initSECP256K1)
+	n := SECP256K1().Params().N
+	p := geG
+	for i := 0; i < 20; i++ {
+		k := scalarFromBytes(testRandBig(t, n).Bytes())
+		c, v := ecmultConst(&p, &k), ecmult(&p, &k, nil)
+		cx, cy := c.toBig()
+		vx, vy := v.toBig()
+		if cx.Cmp(vx) != 0 || cy.Cmp(vy) != 0 {
+			t.Fatalf("const mult %x differ from variable", k.bytes())
+		}
+		p = c.toAffine()
+	}
+}
+
+func testSignECDSA(t testing.TB) (*ecdsa.PrivateKey, []byte, *big.Int, *big.Int) {
+	priv, err := ecdsa.GenerateKey(SECP256K1(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := sha256.Sum256([]byte("secp256k1 verify"))
+	r, s, err := ecdsa.Sign(rand.Reader, priv, hash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return priv, hash[:], r, s
+}
+
+func TestVerifyECDSA(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		priv, hash, r, s := testSignECDSA(t)
+		if !VerifyECDSA(priv.X, priv.Y, hash, r, s) {
+			t.Fatalf("verify failed")
+		}
+		pub := &ecdsa.PublicKey{Curve: refCurve, X: priv.X, Y: priv.Y}
+		if !ecdsa.Verify(pub, hash, r, s) {
+			t.Fatalf("reference verify failed")
+		}
+		//high s also valid ecdsa
+		hs := new(big.Int).Sub(refCurve.N, s)
+		if !VerifyECDSA(priv.X, priv.Y, hash, r, hs) {
+			t.Fatalf("verify high s failed")
+		}
+		bad := append([]byte{}, hash...)
+		bad[0] ^= 1
+		if VerifyECDSA(priv.X, priv.Y, bad, r, s) {
+			t.Fatalf("verify bad hash")
+		}
+		if VerifyECDSA(priv.X, priv.Y, hash, s, r) {
+			t.Fatalf("verify swapped r s")
+		}
+		if VerifyECDSA(priv.X, priv.Y, hash, refCurve.N, s) || VerifyECDSA(priv.X, priv.Y, hash, r, new(big.Int)) {
+			t.Fatalf("verify out of range r s")
+		}
+		if VerifyECDSA(priv.X, new(big.Int).Add(priv.Y, big.NewInt(1)), hash, r, s) {
+			t.Fatalf("verify pubkey not on curve")
+		}
+	}
+}
+
+func BenchmarkScalarMult(b *testing.B) {
+	s256 := SECP256K1()
+	e := s256BaseMultTests[0]
+	k, _ := new(big.Int).SetString(e.k, 16)
+	x, y := s256.ScalarBaseMult(k.Bytes())
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s256.ScalarMult(x, y, k.Bytes())
+	}
+}
+
+func BenchmarkBaseMultBig(b *testing.B) {
+	e := s256BaseMultTests[0]
+	k, _ := new(big.Int).SetString(e.k, 16)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		refCurve.ScalarBaseMult(k.Bytes())
+	}
+}
+
+func BenchmarkVerifyECDSA(b *testing.B) {
+	priv, hash, r, s := testSignECDSA(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		VerifyECDSA(priv.X, priv.Y, hash, r, s)
+	}
+}
+
+func BenchmarkVerifyECDSABig(b *testing.B) {
+	priv, hash, r, s := testSignECDSA(b)
+	pub := &ecdsa.PublicKey{Curve: refCurve, X: priv.X, Y: priv.Y}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ecdsa.Verify(pub, hash, r, s)
+	}
+}
+
+func TestSignECDSA(t *testing.T) {
+	n := SECP256K1().Params().N
+	d2, _ := new(big.Int).SetString("f8b8af8ce3c7cca5e300d33939540c10d45ce001b8f252bfbc57ba0342904181", 16)
+	//rfc6979 secp256k1 vectors
+	vs := []struct {
+		d    *big.Int
+		msg  string
+		r, s string
+	}{
+		{big.NewInt(1), "Satoshi Nakamoto", "934b1ea10a4b3c1757e2b0c017d0b6143ce3c9a7e6a4a49860d7a6ab210ee3d8", "2442ce9d2b916064108014783e923ec36b49743e2ffa1c4496f01a512aafd9e5"},
+		{big.NewInt(1), "All those moments will be lost in time, like tears in rain. Time to die...", "8600dbd41e348fe5c9465ab92d23e3db8b98b873beecd930736488696438cb6b", "547fe64427496db33bf66019dacbf0039c04199abb0122918601db38a72cfc21"},
+		{new(big.Int).Sub(n, big.NewInt(1)), "Satoshi Nakamoto", "fd567d121db66e382991534ada77a6bd3106f0a1098c231e47993447cd6af2d0", "6b39cd0eb1bc8603e159ef5c20a5c8ad685a45b06ce9bebed3f153d10d93bed5"},
+		{d2, "Alan Turing", "7063ae83e7f62bbb171798131b4a0564b956930092b33b07b395615d9ec7e15c", "58dfcc1e00a35e1572f366ffe34ba0fc47db1e7189759b9fb233c5b05ab388ea"},
+	}
+	for i, v := range vs {
+		hash := sha256.Sum256([]byte(v.msg))
+		r, s, err := SignECDSA(v.d, hash[:], nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprintf("%064x", r) != v.r || fmt.Sprintf("%064x", s) != v.s {
+			t.Errorf("%d: sign got %064x %064x", i, r, s)
+		}
+		x, y := SECP256K1().ScalarBaseMult(v.d.Bytes())
+		if !VerifyECDSA(x, y, hash[:], r, s) {
+			t.Errorf("%d: verify failed", i)
+		}
+	}
+	if _, _, err := SignECDSA(n, make([]byte, 32), nil); err == nil {
+		t.Errorf("sign with key n should error")
+	}
+}
+
+func BenchmarkSignECDSA(b *testing.B) {
+	d := big.NewInt(1)
+	hash := sha256.Sum256([]byte("Satoshi Nakamoto"))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		SignECDSA(d, hash[:], nil)
+	}
+}